@@ -0,0 +1,388 @@
+// Package bundle reads and writes pgit bundle files, which carry a range of
+// commits to a database that cannot reach the remote.
+//
+// A bundle starts with the line "# pgit bundle v<version>", followed by a gzip
+// stream of JSON records, one per line:
+//
+//	{"type":"manifest", ...}   what the bundle holds and what it needs
+//	{"type":"commit", ...}     one per commit, oldest first
+//	{"type":"file", ...}       the file versions a commit changed, after it
+//	{"type":"end", ...}        record counts and the SHA-256 of all lines above
+//
+// A bundle with a prerequisite only applies to a database that already has
+// that commit: it holds the commits after it, not the tree they build on.
+package bundle
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+)
+
+// Version is the bundle format version written by this package. Version 2
+// adds the commit hash to commit records, which the receiver verifies;
+// version 1 bundles are still read, without commit hashes.
+const Version = 2
+
+// headerPrefix starts every bundle; the format version and a newline follow.
+const headerPrefix = "# pgit bundle v"
+
+var header = fmt.Sprintf("%s%d\n", headerPrefix, Version)
+
+var (
+	// ErrNotBundle is returned for input that doesn't start with a bundle header.
+	ErrNotBundle = errors.New("not a pgit bundle")
+	// ErrChecksum is returned when the content doesn't match the recorded checksum.
+	ErrChecksum = errors.New("bundle checksum mismatch")
+)
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"created_at"`
+	Prerequisite string    `json:"prerequisite,omitempty"` // parent of the first commit, "" for full history
+	Head         string    `json:"head"`
+	Commits      int       `json:"commits"`
+	Refs         []Ref     `json:"refs,omitempty"`
+}
+
+// Ref is a branch or tag pointing at a commit in the bundle.
+type Ref struct {
+	Name     string `json:"name"`
+	CommitID string `json:"commit_id"`
+}
+
+// record is one line of the bundle stream.
+type record struct {
+	Type     string    `json:"type"`
+	Manifest *Manifest `json:"manifest,omitempty"`
+	Commit   *commit   `json:"commit,omitempty"`
+	File     *file     `json:"file,omitempty"`
+	Commits  int       `json:"commits,omitempty"`
+	Files    int       `json:"files,omitempty"`
+	Checksum string    `json:"checksum,omitempty"`
+}
+
+type commit struct {
+	ID             string    `json:"id"`
+	ParentID       *string   `json:"parent_id,omitempty"`
+	TreeHash       string    `json:"tree_hash"`
+	Message        string    `json:"message"`
+	AuthorName     string    `json:"author_name"`
+	AuthorEmail    string    `json:"author_email"`
+	AuthoredAt     time.Time `json:"authored_at"`
+	CommitterName  string    `json:"committer_name"`
+	CommitterEmail string    `json:"committer_email"`
+	CommittedAt    time.Time `json:"committed_at"`
+	CommitHash     string    `json:"commit_hash"`
+}
+
+type file struct {
+	Path          string  `json:"path"`
+	CommitID      string  `json:"commit_id"`
+	Content       []byte  `json:"content,omitempty"`
+	ContentHash   []byte  `json:"content_hash,omitempty"` // absent for a deletion
+	Mode          int     `json:"mode"`
+	IsSymlink     bool    `json:"is_symlink,omitempty"`
+	SymlinkTarget *string `json:"symlink_target,omitempty"`
+	IsBinary      bool    `json:"is_binary,omitempty"`
+}
+
+// ═══════════════════════════════════════════════════════════════════════════
+// Writing
+// ═══════════════════════════════════════════════════════════════════════════
+
+// Writer writes a bundle. Close must be called to write the checksum.
+type Writer struct {
+	gz      *gzip.Writer
+	sum     hash.Hash
+	commits int
+	files   int
+	want    int
+	err     error
+}
+
+// NewWriter writes the header and manifest of a bundle to w. m.Version is
+// set by the writer; m.Commits is the number of WriteCommit calls to expect.
+func NewWriter(w io.Writer, m *Manifest) (*Writer, error) {
+	if _, err := io.WriteString(w, header); err != nil {
+		return nil, err
+	}
+	m.Version = Version
+	bw := &Writer{gz: gzip.NewWriter(w), sum: sha256.New(), want: m.Commits}
+	if err := bw.write(&record{Type: "manifest", Manifest: m}); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// WriteCommit adds a commit. Commits go oldest first, each followed by the
+// file versions it changed.
+func (w *Writer) WriteCommit(c *db.Commit) error {
+	w.commits++
+	return w.write(&record{Type: "commit", Commit: &commit{
+		ID:             c.ID,
+		ParentID:       c.ParentID,
+		TreeHash:       c.TreeHash,
+		Message:        c.Message,
+		AuthorName:     c.AuthorName,
+		AuthorEmail:    c.AuthorEmail,
+		AuthoredAt:     c.AuthoredAt,
+		CommitterName:  c.CommitterName,
+		CommitterEmail: c.CommitterEmail,
+		CommittedAt:    c.CommittedAt,
+		CommitHash:     c.CommitHash,
+	}})
+}
+
+// WriteFile adds a file version of the last commit written.
+func (w *Writer) WriteFile(b *db.Blob) error {
+	w.files++
+	return w.write(&record{Type: "file", File: &file{
+		Path:          b.Path,
+		CommitID:      b.CommitID,
+		Content:       b.Content,
+		ContentHash:   b.ContentHash,
+		Mode:          b.Mode,
+		IsSymlink:     b.IsSymlink,
+		SymlinkTarget: b.SymlinkTarget,
+		IsBinary:      b.IsBinary,
+	}})
+}
+
+// Close writes the end record with the checksum and flushes the stream. It
+// does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.commits != w.want {
+		return fmt.Errorf("bundle manifest announces %d commit(s), %d written", w.want, w.commits)
+	}
+	end := &record{
+		Type:     "end",
+		Commits:  w.commits,
+		Files:    w.files,
+		Checksum: hex.EncodeToString(w.sum.Sum(nil)),
+	}
+	line, err := json.Marshal(end)
+	if err != nil {
+		return err
+	}
+	if _, err := w.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+func (w *Writer) write(rec *record) error {
+	if w.err != nil {
+		return w.err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	line = append(line, '\n')
+	w.sum.Write(line)
+	if _, err := w.gz.Write(line); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// ═══════════════════════════════════════════════════════════════════════════
+// Reading
+// ═══════════════════════════════════════════════════════════════════════════
+
+// Reader reads a bundle record by record.
+type Reader struct {
+	br       *bufio.Reader
+	sum      hash.Hash
+	manifest *Manifest
+	commits  int
+	files    int
+	last     string // ID of the last commit read
+}
+
+// NewReader reads the header and manifest of a bundle from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, headerPrefix) {
+		if err == nil || err == io.EOF {
+			err = ErrNotBundle
+		}
+		return nil, err
+	}
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, headerPrefix), "\n"))
+	if err != nil {
+		return nil, ErrNotBundle
+	}
+	if err := checkVersion(version); err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt bundle: %w", err)
+	}
+	rd := &Reader{br: bufio.NewReader(gz), sum: sha256.New()}
+
+	rec, err := rd.next()
+	if err != nil {
+		return nil, err
+	}
+	if rec.Type != "manifest" || rec.Manifest == nil {
+		return nil, fmt.Errorf("corrupt bundle: expected manifest, got %q record", rec.Type)
+	}
+	// Bundles written before the header carried the version say v1 there
+	// and 2 in the manifest, so the manifest decides
+	if err := checkVersion(rec.Manifest.Version); err != nil {
+		return nil, err
+	}
+	rd.manifest = rec.Manifest
+	return rd, nil
+}
+
+// checkVersion rejects bundle format versions this package can't read.
+func checkVersion(version int) error {
+	if version < 1 || version > Version {
+		return fmt.Errorf("unsupported bundle version %d (this pgit reads versions 1 to %d)", version, Version)
+	}
+	return nil
+}
+
+// Manifest returns the bundle manifest.
+func (r *Reader) Manifest() *Manifest {
+	return r.manifest
+}
+
+// Next returns the next commit or file version; exactly one of the results
+// is non-nil. After the last one it checks the record counts and checksum
+// and returns io.EOF if they match.
+func (r *Reader) Next() (*db.Commit, *db.Blob, error) {
+	rec, err := r.next()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case rec.Type == "commit" && rec.Commit != nil:
+		r.commits++
+		c := rec.Commit
+		r.last = c.ID
+		return &db.Commit{
+			ID:             c.ID,
+			ParentID:       c.ParentID,
+			TreeHash:       c.TreeHash,
+			Message:        c.Message,
+			AuthorName:     c.AuthorName,
+			AuthorEmail:    c.AuthorEmail,
+			AuthoredAt:     c.AuthoredAt,
+			CommitterName:  c.CommitterName,
+			CommitterEmail: c.CommitterEmail,
+			CommittedAt:    c.CommittedAt,
+			CommitHash:     c.CommitHash,
+		}, nil, nil
+
+	case rec.Type == "file" && rec.File != nil:
+		r.files++
+		f := rec.File
+		if f.CommitID != r.last {
+			return nil, nil, fmt.Errorf("corrupt bundle: file %s of commit %s out of order", f.Path, f.CommitID)
+		}
+		content := f.Content
+		if content == nil && f.ContentHash != nil {
+			content = []byte{} // empty file
+		}
+		return nil, &db.Blob{
+			Path:          f.Path,
+			CommitID:      f.CommitID,
+			Content:       content,
+			ContentHash:   f.ContentHash,
+			Mode:          f.Mode,
+			IsSymlink:     f.IsSymlink,
+			SymlinkTarget: f.SymlinkTarget,
+			IsBinary:      f.IsBinary,
+		}, nil
+
+	case rec.Type == "end":
+		if rec.Checksum != hex.EncodeToString(r.sum.Sum(nil)) {
+			return nil, nil, ErrChecksum
+		}
+		if rec.Commits != r.commits || rec.Files != r.files || r.commits != r.manifest.Commits {
+			return nil, nil, fmt.Errorf("corrupt bundle: %d commit(s) and %d file(s) read, %d and %d recorded",
+				r.commits, r.files, rec.Commits, rec.Files)
+		}
+		if r.commits > 0 && r.last != r.manifest.Head {
+			return nil, nil, fmt.Errorf("corrupt bundle: last commit %s is not the head %s", r.last, r.manifest.Head)
+		}
+		return nil, nil, io.EOF
+	}
+	return nil, nil, fmt.Errorf("corrupt bundle: unexpected %q record", rec.Type)
+}
+
+// next reads one record, adding it to the checksum unless it is the end
+// record (which holds the checksum).
+func (r *Reader) next() (*record, error) {
+	line, err := r.br.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("corrupt bundle: %w", err)
+	}
+	rec := &record{}
+	if err := json.Unmarshal(line, rec); err != nil {
+		return nil, fmt.Errorf("corrupt bundle: %w", err)
+	}
+	if rec.Type != "end" {
+		r.sum.Write(line)
+	}
+	return rec, nil
+}
+
+// Verify reads a whole bundle and checks its structure and checksum. It
+// returns the manifest and the number of file versions.
+func Verify(r io.Reader) (*Manifest, int, error) {
+	rd, err := NewReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		if _, _, err := rd.Next(); err == io.EOF {
+			return rd.manifest, rd.files, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// IsBundleFile reports whether path is a readable file starting with a
+// bundle header of any version.
+func IsBundleFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(headerPrefix))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return string(buf) == headerPrefix
+}
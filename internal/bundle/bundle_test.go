@@ -0,0 +1,255 @@
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+)
+
+func testBundle(t *testing.T) ([]*db.Commit, []*db.Blob, []byte) {
+	t.Helper()
+	when := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	parent := "01BASE"
+	first := "01FIRST"
+	target := "link/target"
+	commits := []*db.Commit{
+		{ID: first, ParentID: &parent, TreeHash: "t1", Message: "first", AuthorName: "A", AuthorEmail: "a@x", AuthoredAt: when, CommitterName: "A", CommitterEmail: "a@x", CommittedAt: when, CommitHash: "h1"},
+		{ID: "01SECOND", ParentID: &first, TreeHash: "t2", Message: "second\n\nbody", AuthorName: "B", AuthorEmail: "b@x", AuthoredAt: when, CommitterName: "B", CommitterEmail: "b@x", CommittedAt: when, CommitHash: "h2"},
+	}
+	blobs := []*db.Blob{
+		{Path: "a.txt", CommitID: first, Content: []byte("hello\n"), ContentHash: []byte{1, 2}, Mode: 0644},
+		{Path: "empty", CommitID: first, Content: []byte{}, ContentHash: []byte{3}, Mode: 0644},
+		{Path: "img.bin", CommitID: "01SECOND", Content: []byte{0, 255, 10}, ContentHash: []byte{4}, Mode: 0644, IsBinary: true},
+		{Path: "link", CommitID: "01SECOND", Content: []byte(target), ContentHash: []byte{5}, Mode: 0777, IsSymlink: true, SymlinkTarget: &target},
+		{Path: "a.txt", CommitID: "01SECOND", Mode: 0644}, // deleted
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, &Manifest{
+		Prerequisite: parent,
+		Head:         "01SECOND",
+		Commits:      len(commits),
+		Refs:         []Ref{{Name: "refs/tags/v1", CommitID: first}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commits {
+		if err := w.WriteCommit(c); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range blobs {
+			if b.CommitID == c.ID {
+				if err := w.WriteFile(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return commits, blobs, buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	commits, blobs, data := testBundle(t)
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := r.Manifest()
+	if m.Version != Version || m.Prerequisite != "01BASE" || m.Head != "01SECOND" || len(m.Refs) != 1 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	var gotCommits []*db.Commit
+	var gotBlobs []*db.Blob
+	for {
+		c, b, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != nil {
+			gotCommits = append(gotCommits, c)
+		} else {
+			gotBlobs = append(gotBlobs, b)
+		}
+	}
+	if !reflect.DeepEqual(gotCommits, commits) {
+		t.Errorf("commits differ:\n got %+v\nwant %+v", gotCommits, commits)
+	}
+	if !reflect.DeepEqual(gotBlobs, blobs) {
+		t.Errorf("files differ:\n got %+v\nwant %+v", gotBlobs, blobs)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	_, blobs, data := testBundle(t)
+
+	m, files, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Commits != 2 || files != len(blobs) {
+		t.Errorf("got %d commit(s), %d file(s)", m.Commits, files)
+	}
+
+	if _, _, err := Verify(strings.NewReader("PK\x03\x04 not a bundle")); !errors.Is(err, ErrNotBundle) {
+		t.Errorf("expected ErrNotBundle, got %v", err)
+	}
+	if _, _, err := Verify(bytes.NewReader(data[:len(data)-20])); err == nil {
+		t.Error("expected an error for a truncated bundle")
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	// Rewrite a commit message inside a valid gzip stream: the structure
+	// stays intact, only the checksum catches it
+	_, _, data := testBundle(t)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines [][]byte
+	for {
+		line, err := r.br.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, bytes.Replace(line, []byte(`"first"`), []byte(`"FIRST"`), 1))
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, r.Manifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		w.gz.Write(line) // bypass the checksum
+	}
+	w.gz.Close()
+
+	if _, _, err := Verify(&buf); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+}
+
+// writeVersion writes commits and blobs as a bundle with the given header
+// and manifest versions, as an older or newer pgit would.
+func writeVersion(t *testing.T, headerVersion, version int, commits []*db.Commit, blobs []*db.Blob) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%d\n", headerPrefix, headerVersion)
+	w := &Writer{gz: gzip.NewWriter(&buf), sum: sha256.New(), want: len(commits)}
+	m := &Manifest{Version: version, Head: commits[len(commits)-1].ID, Commits: len(commits)}
+	if err := w.write(&record{Type: "manifest", Manifest: m}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commits {
+		if err := w.WriteCommit(c); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range blobs {
+			if b.CommitID == c.ID {
+				if err := w.WriteFile(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadVersion1(t *testing.T) {
+	commits, blobs, _ := testBundle(t)
+	for _, c := range commits {
+		c.CommitHash = "" // version 1 predates commit hashes
+	}
+	data := writeVersion(t, 1, 1, commits, blobs)
+
+	if !strings.HasPrefix(string(data), "# pgit bundle v1\n") {
+		t.Fatalf("unexpected header %q", data[:20])
+	}
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Manifest().Version; v != 1 {
+		t.Fatalf("manifest version = %d, want 1", v)
+	}
+	var gotCommits []*db.Commit
+	var gotBlobs []*db.Blob
+	for {
+		c, b, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != nil {
+			gotCommits = append(gotCommits, c)
+		} else {
+			gotBlobs = append(gotBlobs, b)
+		}
+	}
+	if !reflect.DeepEqual(gotCommits, commits) {
+		t.Errorf("commits differ:\n got %+v\nwant %+v", gotCommits, commits)
+	}
+	if !reflect.DeepEqual(gotBlobs, blobs) {
+		t.Errorf("files differ:\n got %+v\nwant %+v", gotBlobs, blobs)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	commits, blobs, data := testBundle(t)
+	if want := fmt.Sprintf("# pgit bundle v%d\n", Version); !strings.HasPrefix(string(data), want) {
+		t.Errorf("header %q, want %q", data[:len(want)], want)
+	}
+
+	// Version 2 bundles were first written with a v1 header
+	if _, _, err := Verify(bytes.NewReader(writeVersion(t, 1, 2, commits, blobs))); err != nil {
+		t.Errorf("v1 header with version 2 manifest: %v", err)
+	}
+
+	for _, tt := range []struct{ header, manifest int }{{Version + 1, Version + 1}, {1, Version + 1}, {1, 0}} {
+		_, _, err := Verify(bytes.NewReader(writeVersion(t, tt.header, tt.manifest, commits, blobs)))
+		if err == nil || !strings.Contains(err.Error(), "unsupported bundle version") {
+			t.Errorf("header v%d, manifest %d: expected unsupported version, got %v", tt.header, tt.manifest, err)
+		}
+	}
+
+	if _, _, err := Verify(strings.NewReader("# pgit bundle vX\n")); !errors.Is(err, ErrNotBundle) {
+		t.Errorf("expected ErrNotBundle for a malformed header, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "old.bundle")
+	if err := os.WriteFile(path, writeVersion(t, 1, 1, commits, blobs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !IsBundleFile(path) {
+		t.Error("IsBundleFile rejects a version 1 bundle")
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/imgajeed76/pgit/v4/internal/config"
+	"github.com/imgajeed76/pgit/v4/internal/merge"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
 	"github.com/spf13/cobra"
 )
 
@@ -61,12 +64,21 @@ func runAdd(cmd *cobra.Command, args []string) error {
 	}
 	defer r.Close()
 
+	mergeState, err := config.LoadMergeState(r.Root)
+	if err != nil {
+		return err
+	}
+
 	// Handle -A flag or "." special case
 	if addAll || (len(args) == 1 && args[0] == ".") {
 		count, err := r.StageAll(ctx)
 		if err != nil {
 			return err
 		}
+		// Staging everything marks every conflict resolved
+		if err := markResolved(r, mergeState, mergeState.ConflictedFiles...); err != nil {
+			return err
+		}
 		if verbose {
 			fmt.Printf("Added %d file(s) to staging area\n", count)
 		} else if count > 0 {
@@ -114,7 +126,10 @@ func runAdd(cmd *cobra.Command, args []string) error {
 					fmt.Printf("add '%s'\n", rel)
 				}
 				addedCount++
-				return r.StageFile(ctx, rel)
+				if err := r.StageFile(ctx, rel); err != nil {
+					return err
+				}
+				return markResolved(r, mergeState, rel)
 			})
 			if err != nil {
 				return err
@@ -124,6 +139,9 @@ func runAdd(cmd *cobra.Command, args []string) error {
 			if err := r.StageFile(ctx, relPath); err != nil {
 				return fmt.Errorf("%s: %w", path, err)
 			}
+			if err := markResolved(r, mergeState, relPath); err != nil {
+				return err
+			}
 			if verbose {
 				fmt.Printf("add '%s'\n", relPath)
 			}
@@ -138,3 +156,27 @@ func runAdd(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// markResolved removes staged paths from the conflict list of a merge in
+// progress. Files that still contain conflict markers are marked too, with
+// a warning.
+func markResolved(r *repo.Repository, mergeState *config.MergeState, paths ...string) error {
+	if !mergeState.HasConflicts() {
+		return nil
+	}
+	changed := false
+	for _, path := range append([]string(nil), paths...) {
+		if !mergeState.IsConflicted(path) {
+			continue
+		}
+		if content, err := os.ReadFile(r.AbsPath(path)); err == nil && merge.HasConflictMarkers(content) {
+			fmt.Println(styles.Warningf("'%s' still contains conflict markers", path))
+		}
+		mergeState.RemoveConflict(path)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return mergeState.Save(r.Root)
+}
@@ -10,9 +10,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/imgajeed76/pgit/v4/internal/db"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
 	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
 	"github.com/imgajeed76/pgit/v4/internal/ui/table"
+	"github.com/imgajeed76/pgit/v4/internal/util"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
@@ -39,7 +42,8 @@ Available analyses:
   hotspots    Churn aggregated by directory
   authors     Commits per author
   activity    Commit activity over time
-  bus-factor  Files with fewest distinct authors (knowledge silos)`,
+  bus-factor  Files with fewest distinct authors (knowledge silos)
+  size        Largest and fastest-growing files, lines of code over time`,
 	}
 
 	cmd.AddCommand(
@@ -49,6 +53,7 @@ Available analyses:
 		newAnalyzeAuthorsCmd(),
 		newAnalyzeActivityCmd(),
 		newAnalyzeBusFactorCmd(),
+		newAnalyzeSizeCmd(),
 	)
 
 	return cmd
@@ -69,6 +74,7 @@ type analyzeFlags struct {
 	sortBy   string
 	reverse  bool
 	timeout  time.Duration
+	ref      string
 }
 
 // addAnalyzeFlags adds the shared flags to a cobra.Command.
@@ -82,6 +88,7 @@ func addAnalyzeFlags(cmd *cobra.Command) {
 	cmd.Flags().String("sort", "", "Sort by column name")
 	cmd.Flags().Bool("reverse", false, "Reverse the sort order")
 	cmd.Flags().Duration("timeout", 5*time.Minute, "Maximum time for the analysis (e.g. 5m, 30m, 2h)")
+	cmd.Flags().String("ref", "", "Only analyze history reachable from a branch, tag, or commit")
 }
 
 // parseAnalyzeFlags reads the shared flags from a cobra.Command.
@@ -98,6 +105,7 @@ func parseAnalyzeFlags(cmd *cobra.Command) analyzeFlags {
 	if timeout <= 0 {
 		timeout = 5 * time.Minute
 	}
+	ref, _ := cmd.Flags().GetString("ref")
 	return analyzeFlags{
 		limit:    limit,
 		pathGlob: pathGlob,
@@ -108,6 +116,7 @@ func parseAnalyzeFlags(cmd *cobra.Command) analyzeFlags {
 		sortBy:   sortBy,
 		reverse:  reverse,
 		timeout:  timeout,
+		ref:      ref,
 	}
 }
 
@@ -221,6 +230,29 @@ func matchPath(pattern, path string) bool {
 	return matched
 }
 
+// refCommits resolves --ref to the commit IDs on its first-parent chain.
+// Returns nil (no filtering) when --ref is not set. The slice form is passed
+// to SQL as "$1::text[] IS NULL OR commit_id = ANY($1)"; the set form filters
+// rows from xpatch scans in Go.
+func refCommits(ctx context.Context, r *repo.Repository, flags analyzeFlags) ([]string, map[string]bool, error) {
+	if flags.ref == "" {
+		return nil, nil, nil
+	}
+	commitID, err := resolveCommitRef(ctx, r, flags.ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids, err := r.DB.GetFirstParentChain(ctx, commitID, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return ids, set, nil
+}
+
 // connectRepo opens and connects to the repository database.
 // If remoteName is non-empty, connects to that remote instead of the local database.
 func connectRepo(ctx context.Context, remoteName string) (*repo.Repository, error) {
@@ -240,15 +272,23 @@ func newAnalyzeChurnCmd() *cobra.Command {
 Files that change often are maintenance hotspots — they tend to contain
 bugs, have complex logic, or suffer from unclear responsibilities.
 
+With --by lines, files are ranked by lines added plus removed instead,
+which tells a one-line fix apart from a rewrite.
+
 This query runs entirely on heap tables (no xpatch decompression).`,
 		RunE: runAnalyzeChurn,
 	}
 	addAnalyzeFlags(cmd)
+	addChurnByFlag(cmd)
 	return cmd
 }
 
 func runAnalyzeChurn(cmd *cobra.Command, args []string) error {
 	flags := parseAnalyzeFlags(cmd)
+	byLines, err := parseChurnBy(cmd)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), flags.timeout)
 	defer cancel()
@@ -259,46 +299,57 @@ func runAnalyzeChurn(cmd *cobra.Command, args []string) error {
 	}
 	defer r.Close()
 
+	if byLines {
+		if err := ensureLineCounts(ctx, r.DB); err != nil {
+			return err
+		}
+	}
+
 	spinner := ui.NewSpinner("Analyzing file churn")
 	spinner.Start()
 
-	// Query: count file refs per path (heap tables only, no xpatch)
-	rows, err := r.DB.Query(ctx, `
-		SELECT p.path, COUNT(*) as versions
-		FROM pgit_file_refs r
-		JOIN pgit_paths p ON p.path_id = r.path_id
-		GROUP BY p.path
-	`)
+	refIDs, _, err := refCommits(ctx, r, flags)
 	if err != nil {
 		spinner.Stop()
 		return err
 	}
 
+	churn, err := queryPathChurn(ctx, r, refIDs, byLines)
+	spinner.Stop()
+	if err != nil {
+		return err
+	}
+
 	// Build table data (filter by path glob, sort and limit in Go)
 	columns := []string{"path", "versions"}
+	cfg := sortConfig{
+		validColumns:  map[string]int{"path": 0, "versions": 1},
+		defaultColumn: "versions",
+		defaultDesc:   true,
+	}
+	if byLines {
+		columns = append(columns, "added", "removed", "lines")
+		cfg.validColumns["added"] = 2
+		cfg.validColumns["removed"] = 3
+		cfg.validColumns["lines"] = 4
+		cfg.defaultColumn = "lines"
+	}
 	var tableRows [][]string
-	for rows.Next() {
-		var path string
-		var versions int64
-		if err := rows.Scan(&path, &versions); err != nil {
-			rows.Close()
-			spinner.Stop()
-			return err
+	for _, c := range churn {
+		if !matchPath(flags.pathGlob, c.path) {
+			continue
 		}
-		if matchPath(flags.pathGlob, path) {
-			tableRows = append(tableRows, []string{path, strconv.FormatInt(versions, 10)})
+		row := []string{c.path, strconv.FormatInt(c.versions, 10)}
+		if byLines {
+			row = append(row,
+				strconv.FormatInt(c.added, 10),
+				strconv.FormatInt(c.removed, 10),
+				strconv.FormatInt(c.added+c.removed, 10))
 		}
+		tableRows = append(tableRows, row)
 	}
-	rows.Close()
-
-	spinner.Stop()
 
 	// Sort
-	cfg := sortConfig{
-		validColumns:  map[string]int{"path": 0, "versions": 1},
-		defaultColumn: "versions",
-		defaultDesc:   true,
-	}
 	if err := applySortFlags(flags, cfg, tableRows); err != nil {
 		return err
 	}
@@ -312,6 +363,83 @@ func runAnalyzeChurn(cmd *cobra.Command, args []string) error {
 	return table.DisplayResults(title, columns, tableRows, flags.displayOpts())
 }
 
+// addChurnByFlag adds --by to churn and hotspots.
+func addChurnByFlag(cmd *cobra.Command) {
+	cmd.Flags().String("by", "commits", "Rank by: commits (versions) or lines (added + removed)")
+}
+
+// parseChurnBy reports whether --by asks for line counts.
+func parseChurnBy(cmd *cobra.Command) (bool, error) {
+	by, _ := cmd.Flags().GetString("by")
+	switch by {
+	case "", "commits":
+		return false, nil
+	case "lines":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid --by value %q, valid values: commits, lines", by)
+}
+
+// pathChurn is the history of one path: how many versions it has and, for
+// --by lines, the lines its commits added and removed.
+type pathChurn struct {
+	path     string
+	versions int64
+	added    int64
+	removed  int64
+}
+
+// queryPathChurn counts file refs per path, on heap tables only. With
+// byLines the counts of pgit_file_changes are summed as well.
+func queryPathChurn(ctx context.Context, r *repo.Repository, refIDs []string, byLines bool) ([]pathChurn, error) {
+	sql := `
+		SELECT p.path, COUNT(*) as versions, 0::bigint, 0::bigint
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE $1::text[] IS NULL OR r.commit_id = ANY($1)
+		GROUP BY p.path`
+	if byLines {
+		sql = `
+		SELECT p.path, COUNT(*) as versions,
+			COALESCE(SUM(c.added), 0)::bigint, COALESCE(SUM(c.removed), 0)::bigint
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		LEFT JOIN pgit_file_changes c ON c.commit_id = r.commit_id AND c.path_id = r.path_id
+		WHERE $1::text[] IS NULL OR r.commit_id = ANY($1)
+		GROUP BY p.path`
+	}
+	rows, err := r.DB.Query(ctx, sql, refIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var churn []pathChurn
+	for rows.Next() {
+		var c pathChurn
+		if err := rows.Scan(&c.path, &c.versions, &c.added, &c.removed); err != nil {
+			return nil, err
+		}
+		churn = append(churn, c)
+	}
+	return churn, rows.Err()
+}
+
+// ensureLineCounts computes the line counts pgit_file_changes lacks before
+// a --by lines analysis: databases from before it existed are filled in on
+// first use, once.
+func ensureLineCounts(ctx context.Context, database *db.DB) error {
+	missing, err := database.MissingFileChanges(ctx)
+	if err != nil {
+		return err
+	}
+	if missing == 0 {
+		return nil
+	}
+	fmt.Println(styles.MutedMsg(fmt.Sprintf("Computing line counts for %s file versions (stored for next time)", ui.FormatCount(int(missing)))))
+	return fillFileChanges(ctx, database, nil)
+}
+
 // ═══════════════════════════════════════════════════════════════════════════
 // coupling — Files changed together
 // ═══════════════════════════════════════════════════════════════════════════
@@ -354,12 +482,19 @@ func runAnalyzeCoupling(cmd *cobra.Command, args []string) error {
 	spinner := ui.NewSpinner("Analyzing file coupling")
 	spinner.Start()
 
+	refIDs, _, err := refCommits(ctx, r, flags)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
 	// Step 1: Fetch all (commit_id, path_id) pairs from heap table
 	rows, err := r.DB.Query(ctx, `
 		SELECT commit_id, path_id
 		FROM pgit_file_refs
+		WHERE $1::text[] IS NULL OR commit_id = ANY($1)
 		ORDER BY commit_id
-	`)
+	`, refIDs)
 	if err != nil {
 		spinner.Stop()
 		return err
@@ -483,10 +618,12 @@ For large repos, per-file churn is noisy. Hotspots shows which
 directories (subsystems) accumulate the most changes, helping you
 identify problem areas at a higher level.
 
-Use --depth to control how many directory levels to aggregate.`,
+Use --depth to control how many directory levels to aggregate, and
+--by lines to rank by lines added plus removed instead of versions.`,
 		RunE: runAnalyzeHotspots,
 	}
 	addAnalyzeFlags(cmd)
+	addChurnByFlag(cmd)
 	cmd.Flags().Int("depth", 1, "Directory depth to aggregate at (1 = top-level)")
 	return cmd
 }
@@ -497,6 +634,10 @@ func runAnalyzeHotspots(cmd *cobra.Command, args []string) error {
 	if depth < 1 {
 		depth = 1
 	}
+	byLines, err := parseChurnBy(cmd)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), flags.timeout)
 	defer cancel()
@@ -507,71 +648,86 @@ func runAnalyzeHotspots(cmd *cobra.Command, args []string) error {
 	}
 	defer r.Close()
 
+	if byLines {
+		if err := ensureLineCounts(ctx, r.DB); err != nil {
+			return err
+		}
+	}
+
 	spinner := ui.NewSpinner("Analyzing directory hotspots")
 	spinner.Start()
 
-	// Same base query as churn
-	rows, err := r.DB.Query(ctx, `
-		SELECT p.path, COUNT(*) as versions
-		FROM pgit_file_refs r
-		JOIN pgit_paths p ON p.path_id = r.path_id
-		GROUP BY p.path
-	`)
+	refIDs, _, err := refCommits(ctx, r, flags)
 	if err != nil {
 		spinner.Stop()
 		return err
 	}
 
+	// Same base query as churn
+	churn, err := queryPathChurn(ctx, r, refIDs, byLines)
+	spinner.Stop()
+	if err != nil {
+		return err
+	}
+
 	// Aggregate by directory prefix in Go
 	type dirStats struct {
 		files    int
 		versions int64
+		added    int64
+		removed  int64
 	}
 	dirMap := make(map[string]*dirStats)
 
-	for rows.Next() {
-		var path string
-		var versions int64
-		if err := rows.Scan(&path, &versions); err != nil {
-			rows.Close()
-			spinner.Stop()
-			return err
-		}
-		if !matchPath(flags.pathGlob, path) {
+	for _, c := range churn {
+		if !matchPath(flags.pathGlob, c.path) {
 			continue
 		}
-		dir := extractDirPrefix(path, depth)
+		dir := extractDirPrefix(c.path, depth)
 		stats, ok := dirMap[dir]
 		if !ok {
 			stats = &dirStats{}
 			dirMap[dir] = stats
 		}
 		stats.files++
-		stats.versions += versions
+		stats.versions += c.versions
+		stats.added += c.added
+		stats.removed += c.removed
 	}
-	rows.Close()
-
-	spinner.Stop()
 
 	// Build table data
 	columns := []string{"directory", "files", "total_versions", "avg_versions"}
+	cfg := sortConfig{
+		validColumns:  map[string]int{"directory": 0, "files": 1, "total_versions": 2, "avg_versions": 3},
+		defaultColumn: "total_versions",
+		defaultDesc:   true,
+	}
+	if byLines {
+		columns = append(columns, "added", "removed", "lines")
+		cfg.validColumns["added"] = 4
+		cfg.validColumns["removed"] = 5
+		cfg.validColumns["lines"] = 6
+		cfg.defaultColumn = "lines"
+	}
 	var tableRows [][]string
 	for dir, stats := range dirMap {
 		avg := float64(stats.versions) / float64(stats.files)
-		tableRows = append(tableRows, []string{
+		row := []string{
 			dir,
 			strconv.Itoa(stats.files),
 			strconv.FormatInt(stats.versions, 10),
 			fmt.Sprintf("%.1f", avg),
-		})
+		}
+		if byLines {
+			row = append(row,
+				strconv.FormatInt(stats.added, 10),
+				strconv.FormatInt(stats.removed, 10),
+				strconv.FormatInt(stats.added+stats.removed, 10))
+		}
+		tableRows = append(tableRows, row)
 	}
 
 	// Sort
-	cfg := sortConfig{
-		validColumns:  map[string]int{"directory": 0, "files": 1, "total_versions": 2, "avg_versions": 3},
-		defaultColumn: "total_versions",
-		defaultDesc:   true,
-	}
 	if err := applySortFlags(flags, cfg, tableRows); err != nil {
 		return err
 	}
@@ -616,15 +772,21 @@ first and last commit. Useful for understanding contributor distribution
 and identifying core maintainers vs occasional contributors.
 
 The query uses a front-to-back sequential scan of pgit_commits, which
-is the optimal access pattern for xpatch delta-compressed tables.`,
+is the optimal access pattern for xpatch delta-compressed tables.
+
+With --include-coauthors, every Co-authored-by trailer also credits the
+commit to that co-author, and a co_authored column shows how many of each
+author's commits came from trailers.`,
 		RunE: runAnalyzeAuthors,
 	}
 	addAnalyzeFlags(cmd)
+	cmd.Flags().Bool("include-coauthors", false, "Also credit commits to Co-authored-by trailers")
 	return cmd
 }
 
 func runAnalyzeAuthors(cmd *cobra.Command, args []string) error {
 	flags := parseAnalyzeFlags(cmd)
+	includeCoauthors, _ := cmd.Flags().GetBool("include-coauthors")
 
 	ctx, cancel := context.WithTimeout(context.Background(), flags.timeout)
 	defer cancel()
@@ -638,11 +800,35 @@ func runAnalyzeAuthors(cmd *cobra.Command, args []string) error {
 	spinner := ui.NewSpinner("Analyzing commit authors")
 	spinner.Start()
 
+	_, refSet, err := refCommits(ctx, r, flags)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+	mm := authorMailmap(ctx, r.DB)
+
+	// Co-authored-by trailers come from the pgit_commit_trailers heap table
+	var coauthors map[string][]string
+	if includeCoauthors {
+		if !r.DB.TrailersIndexed(ctx) {
+			// One-time backfill for databases created before the table existed
+			if err := r.DB.BackfillCommitTrailers(ctx); err != nil {
+				spinner.Stop()
+				return fmt.Errorf("failed to index commit trailers: %w", err)
+			}
+		}
+		coauthors, err = r.DB.GetTrailersByKey(ctx, util.TrailerCoAuthoredBy)
+		if err != nil {
+			spinner.Stop()
+			return err
+		}
+	}
+
 	// Front-to-back sequential scan — optimal xpatch access pattern.
 	// ORDER BY seq ASC decompresses the delta chain in natural order,
 	// each row reusing the previous row's cached decompression result.
 	rows, err := r.DB.Query(ctx, `
-		SELECT author_name, author_email, authored_at
+		SELECT id, author_name, author_email, authored_at
 		FROM pgit_commits
 		ORDER BY seq ASC
 	`)
@@ -656,28 +842,49 @@ func runAnalyzeAuthors(cmd *cobra.Command, args []string) error {
 		email string
 	}
 	type authorStats struct {
-		commits int
-		first   time.Time
-		last    time.Time
+		commits    int
+		coauthored int
+		first      time.Time
+		last       time.Time
 	}
 	statsMap := make(map[authorKey]*authorStats)
+	credit := func(k authorKey, authoredAt time.Time) *authorStats {
+		s, ok := statsMap[k]
+		if !ok {
+			s = &authorStats{first: authoredAt}
+			statsMap[k] = s
+		}
+		s.commits++
+		s.last = authoredAt
+		return s
+	}
 
 	for rows.Next() {
-		var name, email string
+		var id, name, email string
 		var authoredAt time.Time
-		if err := rows.Scan(&name, &email, &authoredAt); err != nil {
+		if err := rows.Scan(&id, &name, &email, &authoredAt); err != nil {
 			rows.Close()
 			spinner.Stop()
 			return err
 		}
+		if refSet != nil && !refSet[id] {
+			continue
+		}
+		name, email = mm.Resolve(name, email)
 		k := authorKey{name, email}
-		s, ok := statsMap[k]
-		if !ok {
-			s = &authorStats{first: authoredAt}
-			statsMap[k] = s
+		credit(k, authoredAt)
+
+		credited := map[authorKey]bool{k: true}
+		for _, value := range coauthors[id] {
+			coName, coEmail := util.ParseIdentity(value)
+			coName, coEmail = mm.Resolve(coName, coEmail)
+			ck := authorKey{coName, coEmail}
+			if credited[ck] {
+				continue
+			}
+			credited[ck] = true
+			credit(ck, authoredAt).coauthored++
 		}
-		s.commits++
-		s.last = authoredAt
 	}
 	rows.Close()
 
@@ -685,20 +892,29 @@ func runAnalyzeAuthors(cmd *cobra.Command, args []string) error {
 
 	// Build table data
 	columns := []string{"author", "email", "commits", "first_commit", "last_commit"}
+	validColumns := map[string]int{"author": 0, "email": 1, "commits": 2, "first_commit": 3, "last_commit": 4}
+	if includeCoauthors {
+		columns = append(columns, "co_authored")
+		validColumns["co_authored"] = 5
+	}
 	var tableRows [][]string
 	for k, s := range statsMap {
-		tableRows = append(tableRows, []string{
+		row := []string{
 			k.name,
 			k.email,
 			strconv.Itoa(s.commits),
 			s.first.Format("2006-01-02"),
 			s.last.Format("2006-01-02"),
-		})
+		}
+		if includeCoauthors {
+			row = append(row, strconv.Itoa(s.coauthored))
+		}
+		tableRows = append(tableRows, row)
 	}
 
 	// Sort
 	cfg := sortConfig{
-		validColumns:  map[string]int{"author": 0, "email": 1, "commits": 2, "first_commit": 3, "last_commit": 4},
+		validColumns:  validColumns,
 		defaultColumn: "commits",
 		defaultDesc:   true,
 	}
@@ -762,9 +978,15 @@ func runAnalyzeActivity(cmd *cobra.Command, args []string) error {
 	spinner := ui.NewSpinner("Analyzing commit activity")
 	spinner.Start()
 
+	_, refSet, err := refCommits(ctx, r, flags)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
 	// Front-to-back sequential scan — optimal xpatch access pattern
 	rows, err := r.DB.Query(ctx, `
-		SELECT authored_at
+		SELECT id, authored_at
 		FROM pgit_commits
 		ORDER BY seq ASC
 	`)
@@ -776,12 +998,16 @@ func runAnalyzeActivity(cmd *cobra.Command, args []string) error {
 	// Collect all timestamps
 	var timestamps []time.Time
 	for rows.Next() {
+		var id string
 		var t time.Time
-		if err := rows.Scan(&t); err != nil {
+		if err := rows.Scan(&id, &t); err != nil {
 			rows.Close()
 			spinner.Stop()
 			return err
 		}
+		if refSet != nil && !refSet[id] {
+			continue
+		}
 		timestamps = append(timestamps, t)
 	}
 	rows.Close()
@@ -793,27 +1019,10 @@ func runAnalyzeActivity(cmd *cobra.Command, args []string) error {
 		return table.DisplayResults("activity: 0 commits", columns, nil, flags.displayOpts())
 	}
 
-	// Bucket timestamps by period
-	bucketKey := func(t time.Time) string {
-		switch period {
-		case "week":
-			year, week := t.ISOWeek()
-			return fmt.Sprintf("%d-W%02d", year, week)
-		case "month":
-			return t.Format("2006-01")
-		case "quarter":
-			q := (t.Month()-1)/3 + 1
-			return fmt.Sprintf("%d-Q%d", t.Year(), q)
-		case "year":
-			return fmt.Sprintf("%d", t.Year())
-		}
-		return ""
-	}
-
 	// Count per bucket (maintaining order)
 	bucketCounts := make(map[string]int)
 	for _, t := range timestamps {
-		k := bucketKey(t)
+		k := periodKey(t, period)
 		bucketCounts[k]++
 	}
 
@@ -893,6 +1102,24 @@ func runAnalyzeActivity(cmd *cobra.Command, args []string) error {
 	return table.DisplayResults(title, columns, tableRows, flags.displayOpts())
 }
 
+// periodKey returns the key of the period (week, month, quarter or year)
+// containing t.
+func periodKey(t time.Time, period string) string {
+	switch period {
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "month":
+		return t.Format("2006-01")
+	case "quarter":
+		q := (t.Month()-1)/3 + 1
+		return fmt.Sprintf("%d-Q%d", t.Year(), q)
+	case "year":
+		return fmt.Sprintf("%d", t.Year())
+	}
+	return ""
+}
+
 // generatePeriodRange generates all period keys between start and end (inclusive).
 func generatePeriodRange(start, end time.Time, period string) []string {
 	var periods []string
@@ -968,12 +1195,21 @@ func runAnalyzeBusFactor(cmd *cobra.Command, args []string) error {
 	spinner := ui.NewSpinner("Analyzing bus factor")
 	spinner.Start()
 
-	// Step 1: Build commit_id -> author_name map from pgit_commits.
+	_, refSet, err := refCommits(ctx, r, flags)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
+	mm := authorMailmap(ctx, r.DB)
+
+	// Step 1: Build commit_id -> author_name map from pgit_commits,
+	// with names normalized through the mailmap.
 	// Front-to-back sequential scan (ORDER BY seq ASC) is the
 	// optimal xpatch access pattern — each row reuses the previous
 	// row's cached decompression result.
 	commitRows, err := r.DB.Query(ctx, `
-		SELECT id, author_name
+		SELECT id, author_name, author_email
 		FROM pgit_commits
 		ORDER BY seq ASC
 	`)
@@ -984,13 +1220,16 @@ func runAnalyzeBusFactor(cmd *cobra.Command, args []string) error {
 
 	commitAuthor := make(map[string]string)
 	for commitRows.Next() {
-		var id, author string
-		if err := commitRows.Scan(&id, &author); err != nil {
+		var id, author, email string
+		if err := commitRows.Scan(&id, &author, &email); err != nil {
 			commitRows.Close()
 			spinner.Stop()
 			return err
 		}
-		commitAuthor[id] = author
+		if refSet != nil && !refSet[id] {
+			continue // file_refs of unreachable commits are skipped below
+		}
+		commitAuthor[id] = mm.ResolveName(author, email)
 	}
 	commitRows.Close()
 
@@ -1107,3 +1346,336 @@ func runAnalyzeBusFactor(cmd *cobra.Command, args []string) error {
 	title := fmt.Sprintf("bus-factor: %d files", len(tableRows))
 	return table.DisplayResults(title, columns, tableRows, flags.displayOpts())
 }
+
+// ═══════════════════════════════════════════════════════════════════════════
+// size — File sizes and lines of code
+// ═══════════════════════════════════════════════════════════════════════════
+
+func newAnalyzeSizeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "size",
+		Short: "Largest and fastest-growing files, lines of code over time",
+		Long: `Show how large files are and how they grew.
+
+Views (--view):
+  largest  Files by their current size in bytes
+  growth   Files by how much they grew since they were added
+  loc      Lines of code per file extension over time (see --period)
+
+Binary files have a size but no line count, and are left out of loc.
+With --view loc, --limit is the number of extensions shown; the rest are
+summed up as "other".
+
+Sizes and line counts are stored with each file version, so this query
+runs entirely on heap tables (no xpatch decompression).`,
+		RunE: runAnalyzeSize,
+	}
+	addAnalyzeFlags(cmd)
+	cmd.Flags().String("view", "largest", "What to show: largest, growth, loc")
+	cmd.Flags().String("period", "month", "Time bucket for --view loc: week, month, quarter, year")
+	return cmd
+}
+
+func runAnalyzeSize(cmd *cobra.Command, args []string) error {
+	flags := parseAnalyzeFlags(cmd)
+	view, _ := cmd.Flags().GetString("view")
+	period, _ := cmd.Flags().GetString("period")
+
+	switch view {
+	case "largest", "growth":
+	case "loc":
+		switch period {
+		case "week", "month", "quarter", "year":
+		default:
+			return fmt.Errorf("invalid period %q: must be week, month, quarter, or year", period)
+		}
+		if flags.sortBy != "" {
+			return fmt.Errorf("--sort is not supported for --view loc (output is chronological, use --reverse)")
+		}
+	default:
+		return fmt.Errorf("invalid --view value %q, valid values: largest, growth, loc", view)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flags.timeout)
+	defer cancel()
+
+	r, err := connectRepo(ctx, flags.remote)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	spinner := ui.NewSpinner("Analyzing file sizes")
+	spinner.Start()
+
+	refIDs, _, err := refCommits(ctx, r, flags)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
+	versions, err := queryFileSizes(ctx, r, refIDs, flags.pathGlob)
+	spinner.Stop()
+	if err != nil {
+		return err
+	}
+
+	if view == "loc" {
+		return displayLinesOfCode(flags, period, versions)
+	}
+
+	// Replay the versions to get each file's first and current size
+	type sizeHistory struct {
+		path                  string
+		versions              int64
+		added                 bool
+		firstSize, size       int64
+		firstLines, lineCount *int32
+		deleted               bool
+	}
+	histories := make(map[string]*sizeHistory)
+	var order []*sizeHistory
+	for _, v := range versions {
+		h := histories[v.path]
+		if h == nil {
+			h = &sizeHistory{path: v.path}
+			histories[v.path] = h
+			order = append(order, h)
+		}
+		h.versions++
+		h.deleted = v.deleted
+		if v.deleted {
+			continue
+		}
+		if !h.added {
+			h.added, h.firstSize, h.firstLines = true, v.size, v.lineCount
+		}
+		h.size, h.lineCount = v.size, v.lineCount
+	}
+
+	columns := []string{"path", "bytes", "lines", "versions"}
+	cfg := sortConfig{
+		validColumns:  map[string]int{"path": 0, "bytes": 1, "lines": 2, "versions": 3},
+		defaultColumn: "bytes",
+		defaultDesc:   true,
+	}
+	if view == "growth" {
+		columns = []string{"path", "bytes", "growth", "lines", "line_growth", "versions"}
+		cfg.validColumns = map[string]int{"path": 0, "bytes": 1, "growth": 2, "lines": 3, "line_growth": 4, "versions": 5}
+		cfg.defaultColumn = "growth"
+	}
+
+	var tableRows [][]string
+	for _, h := range order {
+		if h.deleted {
+			continue
+		}
+		if view == "growth" {
+			lineGrowth := ""
+			if h.lineCount != nil && h.firstLines != nil {
+				lineGrowth = strconv.Itoa(int(*h.lineCount - *h.firstLines))
+			}
+			tableRows = append(tableRows, []string{
+				h.path,
+				strconv.FormatInt(h.size, 10),
+				strconv.FormatInt(h.size-h.firstSize, 10),
+				formatLineCount(h.lineCount),
+				lineGrowth,
+				strconv.FormatInt(h.versions, 10),
+			})
+			continue
+		}
+		tableRows = append(tableRows, []string{
+			h.path,
+			strconv.FormatInt(h.size, 10),
+			formatLineCount(h.lineCount),
+			strconv.FormatInt(h.versions, 10),
+		})
+	}
+
+	if err := applySortFlags(flags, cfg, tableRows); err != nil {
+		return err
+	}
+	if flags.limit > 0 && len(tableRows) > flags.limit {
+		tableRows = tableRows[:flags.limit]
+	}
+
+	title := fmt.Sprintf("size: %d largest files", len(tableRows))
+	if view == "growth" {
+		title = fmt.Sprintf("size: %d fastest-growing files", len(tableRows))
+	}
+	return table.DisplayResults(title, columns, tableRows, flags.displayOpts())
+}
+
+// fileVersionSize is the size of one file version, from pgit_file_refs.
+type fileVersionSize struct {
+	path      string
+	commitID  string
+	size      int64
+	lineCount *int32 // nil for binary files
+	deleted   bool
+}
+
+// queryFileSizes returns the sizes of every file version matching pathGlob,
+// oldest commit first, on heap tables only.
+func queryFileSizes(ctx context.Context, r *repo.Repository, refIDs []string, pathGlob string) ([]fileVersionSize, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT p.path, r.commit_id, r.size, r.line_count, r.content_hash IS NULL
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE $1::text[] IS NULL OR r.commit_id = ANY($1)
+		ORDER BY r.commit_id, r.path_id`, refIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []fileVersionSize
+	for rows.Next() {
+		var v fileVersionSize
+		if err := rows.Scan(&v.path, &v.commitID, &v.size, &v.lineCount, &v.deleted); err != nil {
+			return nil, err
+		}
+		if matchPath(pathGlob, v.path) {
+			versions = append(versions, v)
+		}
+	}
+	return versions, rows.Err()
+}
+
+// formatLineCount formats a line count, empty for binary files.
+func formatLineCount(n *int32) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*n))
+}
+
+// displayLinesOfCode shows the lines of text files per extension at the
+// end of each period. Commit times come from the commit IDs (ULIDs), so
+// pgit_commits is not read either.
+func displayLinesOfCode(flags analyzeFlags, period string, versions []fileVersionSize) error {
+	columns := []string{"period", "extension", "files", "lines"}
+	if len(versions) == 0 {
+		return table.DisplayResults("size: 0 periods", columns, nil, flags.displayOpts())
+	}
+
+	type extTotal struct {
+		files, lines int64
+	}
+	current := make(map[string]int64) // path → lines, text files only
+	totals := make(map[string]*extTotal)
+	snapshots := make(map[string]map[string]extTotal)
+	snapshot := func(key string) {
+		snap := make(map[string]extTotal, len(totals))
+		for ext, t := range totals {
+			snap[ext] = *t
+		}
+		snapshots[key] = snap
+	}
+
+	var first, last time.Time
+	key := ""
+	for _, v := range versions {
+		if t, err := util.ParseULID(v.commitID); err == nil {
+			if first.IsZero() {
+				first = t
+			}
+			last = t
+		}
+		if k := periodKey(last, period); k != key {
+			if key != "" {
+				snapshot(key)
+			}
+			key = k
+		}
+
+		ext := fileExtension(v.path)
+		t := totals[ext]
+		if t == nil {
+			t = &extTotal{}
+			totals[ext] = t
+		}
+		if lines, ok := current[v.path]; ok {
+			t.files--
+			t.lines -= lines
+			delete(current, v.path)
+		}
+		if !v.deleted && v.lineCount != nil {
+			t.files++
+			t.lines += int64(*v.lineCount)
+			current[v.path] = int64(*v.lineCount)
+		}
+	}
+	snapshot(key)
+
+	// Extensions by current lines; past --limit they are summed up as other
+	exts := make([]string, 0, len(totals))
+	for ext := range totals {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if totals[exts[i]].lines != totals[exts[j]].lines {
+			return totals[exts[i]].lines > totals[exts[j]].lines
+		}
+		return exts[i] < exts[j]
+	})
+	shown := make(map[string]string, len(exts))
+	for i, ext := range exts {
+		shown[ext] = ext
+		if flags.limit > 0 && i >= flags.limit {
+			shown[ext] = "other"
+		}
+	}
+	if flags.limit > 0 && len(exts) > flags.limit {
+		exts = append(exts[:flags.limit], "other")
+	}
+
+	// Periods without commits repeat the totals before them
+	periods := generatePeriodRange(first, last, period)
+	snaps := make([]map[string]extTotal, len(periods))
+	var snap map[string]extTotal
+	for i, p := range periods {
+		if s, ok := snapshots[p]; ok {
+			snap = s
+		}
+		snaps[i] = snap
+	}
+	if flags.reverse {
+		for i, j := 0, len(periods)-1; i < j; i, j = i+1, j-1 {
+			periods[i], periods[j] = periods[j], periods[i]
+			snaps[i], snaps[j] = snaps[j], snaps[i]
+		}
+	}
+
+	var tableRows [][]string
+	for i, p := range periods {
+		snap := snaps[i]
+		merged := make(map[string]extTotal)
+		for ext, t := range snap {
+			m := merged[shown[ext]]
+			m.files += t.files
+			m.lines += t.lines
+			merged[shown[ext]] = m
+		}
+		for _, ext := range exts {
+			if m := merged[ext]; m.files > 0 {
+				tableRows = append(tableRows, []string{
+					p, ext, strconv.FormatInt(m.files, 10), strconv.FormatInt(m.lines, 10),
+				})
+			}
+		}
+	}
+
+	title := fmt.Sprintf("size: lines of code over %d %ss", len(periods), period)
+	return table.DisplayResults(title, columns, tableRows, flags.displayOpts())
+}
+
+// fileExtension returns the lowercased extension of path, or "(none)".
+func fileExtension(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return "(none)"
+	}
+	return ext
+}
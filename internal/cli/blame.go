@@ -186,9 +186,10 @@ func runBlame(cmd *cobra.Command, args []string) error {
 	}
 
 	// Fill in author/date from commit metadata
+	mm := authorMailmap(ctx, r.DB)
 	for i := range blameLines {
 		if c, ok := commitMap[blameLines[i].commitID]; ok && c != nil {
-			blameLines[i].authorName = c.AuthorName
+			blameLines[i].authorName = mm.ResolveName(c.AuthorName, c.AuthorEmail)
 			blameLines[i].date = c.AuthoredAt
 		}
 	}
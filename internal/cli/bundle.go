@@ -0,0 +1,611 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/bundle"
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/cobra"
+)
+
+func newBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Move commits between databases through a file",
+		Long: `Write commits to a bundle file and apply them to another database,
+for sites that cannot reach the remote.
+
+A bundle holds a range of commits, the file versions they changed, and the
+branches and tags pointing into the range, protected by a checksum. A bundle
+of a partial range needs its prerequisite (the commit before the range) in
+the database it is applied to.
+
+Examples:
+  pgit bundle create full.pgitbundle             # Whole history up to HEAD
+  pgit bundle create week.pgitbundle abc123..HEAD
+  pgit bundle verify week.pgitbundle
+  pgit bundle unbundle week.pgitbundle
+  pgit clone full.pgitbundle myproject`,
+	}
+
+	create := &cobra.Command{
+		Use:   "create <file> [<since>..]<until>",
+		Short: "Write commits to a bundle file (default: all of HEAD)",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  runBundleCreate,
+	}
+
+	cmd.AddCommand(
+		create,
+		&cobra.Command{
+			Use:   "verify <file>",
+			Short: "Check a bundle and whether this repository has its prerequisite",
+			Args:  cobra.ExactArgs(1),
+			RunE:  runBundleVerify,
+		},
+		&cobra.Command{
+			Use:   "unbundle <file>",
+			Short: "Apply a bundle, fast-forwarding HEAD",
+			Args:  cobra.ExactArgs(1),
+			RunE:  runBundleUnbundle,
+		},
+	)
+
+	return cmd
+}
+
+func runBundleCreate(cmd *cobra.Command, args []string) (err error) {
+	path := args[0]
+	rangeSpec := "HEAD"
+	if len(args) > 1 {
+		rangeSpec = args[1]
+	}
+
+	r, err := repo.Open()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTransferTimeout)
+	defer cancel()
+
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Resolve the range
+	sinceRef, untilRef, hasSince := strings.Cut(rangeSpec, "..")
+	if !hasSince {
+		sinceRef, untilRef = "", rangeSpec
+	}
+	if untilRef == "" {
+		untilRef = "HEAD"
+	}
+	untilID, err := resolveCommitRef(ctx, r, untilRef)
+	if err != nil {
+		return err
+	}
+	var sinceID string
+	if sinceRef != "" {
+		if sinceID, err = resolveCommitRef(ctx, r, sinceRef); err != nil {
+			return err
+		}
+	}
+
+	// The range is the history of until back to, but not including, since
+	commits, err := r.DB.CommitsBetween(ctx, untilID, sinceID)
+	if errors.Is(err, db.ErrNotAncestor) {
+		return util.NewError("Nothing to bundle").
+			WithMessage(fmt.Sprintf("%s is not in the history of %s", util.ShortID(sinceID), util.ShortID(untilID))).
+			WithSuggestion("pgit bundle create <file> <older>..<newer>  # The older commit comes first")
+	}
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return util.NewError("Nothing to bundle").
+			WithMessage(fmt.Sprintf("No commits after %s up to %s", util.ShortID(sinceID), util.ShortID(untilID))).
+			WithSuggestion("pgit bundle create <file> <older>..<newer>  # The older commit comes first")
+	}
+
+	inRange := make(map[string]bool, len(commits))
+	for _, c := range commits {
+		inRange[c.ID] = true
+	}
+	allRefs, err := r.DB.GetAllRefs(ctx)
+	if err != nil {
+		return err
+	}
+	var refs []bundle.Ref
+	for _, ref := range allRefs {
+		if ref.Name != "HEAD" && !strings.HasPrefix(ref.Name, "refs/remotes/") && inRange[ref.CommitID] {
+			refs = append(refs, bundle.Ref{Name: ref.Name, CommitID: ref.CommitID})
+		}
+	}
+
+	// Write next to the target and rename at the end, so an interrupted
+	// create never leaves a truncated bundle behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pgitbundle-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w, err := bundle.NewWriter(tmp, &bundle.Manifest{
+		CreatedAt:    time.Now().UTC(),
+		Prerequisite: sinceID,
+		Head:         untilID,
+		Commits:      len(commits),
+		Refs:         refs,
+	})
+	if err != nil {
+		return err
+	}
+
+	files := 0
+	progress := ui.NewProgress("Bundling", len(commits))
+	for i, c := range commits {
+		if err := w.WriteCommit(c); err != nil {
+			return err
+		}
+		blobs, err := r.DB.GetBlobsAtCommit(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		for _, b := range blobs {
+			if err := w.WriteFile(b); err != nil {
+				return err
+			}
+		}
+		files += len(blobs)
+		progress.Update(i + 1)
+	}
+	progress.Done()
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s: %d commit(s), %d file version(s), %s\n",
+		styles.Successf("Created bundle"), styles.Cyan(path), len(commits), files, formatBytes(info.Size()))
+	if sinceID != "" {
+		fmt.Printf("Applying it requires commit %s\n", styles.Yellow(util.ShortID(sinceID)))
+	}
+	return nil
+}
+
+func runBundleVerify(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	m, _, files, err := readBundle(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Head:     %s\n", styles.Yellow(util.ShortID(m.Head)))
+	fmt.Printf("Commits:  %d (%d file version(s))\n", m.Commits, files)
+	fmt.Printf("Created:  %s\n", util.RelativeTime(m.CreatedAt))
+	for _, ref := range m.Refs {
+		fmt.Printf("Ref:      %s -> %s\n", ref.Name, util.ShortID(ref.CommitID))
+	}
+	if m.Prerequisite == "" {
+		fmt.Println("Requires: nothing (full history)")
+		fmt.Println()
+		fmt.Println(styles.Successf("%s is valid", path))
+		return nil
+	}
+	fmt.Printf("Requires: %s\n", styles.Yellow(util.ShortID(m.Prerequisite)))
+
+	// The prerequisite can only be checked inside a repository
+	r, err := repo.Open()
+	if err != nil {
+		fmt.Println()
+		fmt.Println(styles.Successf("%s is valid", path))
+		fmt.Println("Run 'pgit bundle verify' inside a repository to check the prerequisite.")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := checkBundlePrerequisite(ctx, r.DB, m); err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Println(styles.Successf("%s is valid and can be applied to this repository", path))
+	return nil
+}
+
+func runBundleUnbundle(cmd *cobra.Command, args []string) error {
+	path := args[0]
+
+	r, err := repo.Open()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTransferTimeout)
+	defer cancel()
+
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+	defer r.Close()
+
+	transfers, err := r.DB.GetAllTransferProgress(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		if t.Direction != transferPush {
+			return util.NewError("Unbundle rejected: interrupted pull").
+				WithMessage(fmt.Sprintf("A %s from '%s' stopped after %d of %d commit(s)", t.Direction, t.RemoteName, t.Done, t.Total)).
+				WithSuggestion("pgit pull --resume " + t.RemoteName + "  # Finish it first")
+		}
+	}
+
+	m, ids, _, err := readBundle(path)
+	if err != nil {
+		return err
+	}
+	if err := checkBundlePrerequisite(ctx, r.DB, m); err != nil {
+		return err
+	}
+
+	localHeadID, err := r.DB.GetHead(ctx)
+	if err != nil {
+		return err
+	}
+	// A bundle HEAD stored beside local work (by 'pgit fetch') is not
+	// applied yet
+	hasHead := false
+	if localHeadID != "" {
+		if hasHead, err = localHasAncestor(ctx, r.DB, m.Head, localHeadID); err != nil {
+			return err
+		}
+	}
+	if localHeadID == m.Head || (hasHead && localHeadID != m.Prerequisite && !ids[localHeadID]) {
+		fmt.Println("Already up to date")
+		return setBundleRefs(ctx, r.DB, m)
+	}
+
+	// Like a fast-forward pull, the bundle must continue from HEAD, and
+	// nothing else (such as fetched commits) may sit on top of HEAD
+	if localHeadID != m.Prerequisite && !ids[localHeadID] {
+		return util.NewError("Bundle does not fast-forward HEAD").
+			WithMessage(fmt.Sprintf("HEAD is at %s, the bundle continues from %s",
+				util.ShortID(localHeadID), util.ShortID(m.Prerequisite))).
+			WithCauses(
+				"Commits were made here after the bundle's prerequisite",
+				"The bundle was created from a different history",
+			).
+			WithSuggestion("pgit clone " + path + " <directory>  # Start a fresh repository from a full bundle")
+	}
+	ref, err := unmergedFetch(ctx, r.DB, localHeadID)
+	if err != nil {
+		return err
+	}
+	if ref != nil && !ids[ref.CommitID] {
+		return util.NewError("Unbundle rejected: commits on top of HEAD").
+			WithMessage(fmt.Sprintf("Commit %s is ahead of HEAD and not in the bundle", util.ShortID(ref.CommitID))).
+			WithCause("Commits were fetched from a remote but not pulled").
+			WithSuggestion("pgit pull  # Integrate the fetched commits first")
+	}
+
+	fmt.Printf("Fast-forward: %d commit(s) from %s\n", m.Commits, styles.Cyan(filepath.Base(path)))
+	if err := applyBundle(ctx, r.DB, path); err != nil {
+		return err
+	}
+	if err := r.DB.SetHead(ctx, m.Head); err != nil {
+		return err
+	}
+	if err := setBundleRefs(ctx, r.DB, m); err != nil {
+		return err
+	}
+
+	if err := updateWorkingTree(ctx, r, m.Head); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", styles.Successf("Updated to"), styles.Yellow(util.ShortID(m.Head)))
+	return nil
+}
+
+// readBundle verifies the bundle at path. It returns the manifest, the IDs
+// of the commits in it, and the number of file versions.
+func readBundle(path string) (*bundle.Manifest, map[string]bool, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+
+	spinner := ui.NewSpinner("Verifying bundle")
+	spinner.Start()
+	defer spinner.Stop()
+
+	invalid := func(err error) error {
+		e := util.NewError("Invalid bundle").
+			WithMessage(fmt.Sprintf("%s: %v", path, err))
+		if errors.Is(err, bundle.ErrNotBundle) {
+			return e.WithCause("The file was not written by 'pgit bundle create'")
+		}
+		return e.WithCause("The file was truncated or damaged in transit").
+			WithSuggestion("pgit bundle create <file>  # Create it again at the source")
+	}
+
+	rd, err := bundle.NewReader(f)
+	if err != nil {
+		return nil, nil, 0, invalid(err)
+	}
+	ids := make(map[string]bool, rd.Manifest().Commits)
+	files := 0
+	for {
+		c, _, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, 0, invalid(err)
+		}
+		if c != nil {
+			ids[c.ID] = true
+		} else {
+			files++
+		}
+	}
+	return rd.Manifest(), ids, files, nil
+}
+
+// checkBundlePrerequisite checks that database has the commit a bundle
+// continues from.
+func checkBundlePrerequisite(ctx context.Context, database *db.DB, m *bundle.Manifest) error {
+	if m.Prerequisite == "" {
+		return nil
+	}
+	exists, err := database.CommitExists(ctx, m.Prerequisite)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return util.NewError("Missing prerequisite").
+			WithMessage(fmt.Sprintf("The bundle continues from commit %s, which this repository does not have",
+				util.ShortID(m.Prerequisite))).
+			WithCause("An earlier bundle has not been applied yet").
+			WithSuggestion("pgit bundle unbundle <earlier-bundle>  # Apply the earlier bundles first")
+	}
+	return nil
+}
+
+// applyBundle stores the commits and file versions of a verified bundle in
+// database, 100 commits per transaction. Commits database already has are
+// skipped along with their files, so applying a bundle twice is harmless.
+func applyBundle(ctx context.Context, database *db.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rd, err := bundle.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	// Version 1 bundles carry tree hashes from before the Merkle tree
+	// hashes, so their trees are computed from the files in the bundle
+	var trees *bundleTrees
+	if rd.Manifest().Version < 2 {
+		if trees, err = newBundleTrees(path); err != nil {
+			return err
+		}
+	}
+
+	const batchSize = 100
+	var batch, stored []*db.Commit
+	var blobs []*db.Blob
+	done := 0
+	progress := ui.NewProgress("Applying", rd.Manifest().Commits)
+
+	flush := func() error {
+		existing, err := database.ExistingCommitIDs(ctx, commitIDs(batch))
+		if err != nil {
+			return err
+		}
+		if trees != nil {
+			if err := trees.replay(ctx, database, batch, blobs, existing); err != nil {
+				return err
+			}
+		}
+		var missing []*db.Commit
+		for _, c := range batch {
+			if !existing[c.ID] {
+				missing = append(missing, c)
+			}
+		}
+		var missingBlobs []*db.Blob
+		for _, b := range blobs {
+			if !existing[b.CommitID] {
+				missingBlobs = append(missingBlobs, b)
+			}
+		}
+		// Grouped by path for delta compression, oldest version first
+		sort.SliceStable(missingBlobs, func(i, j int) bool { return missingBlobs[i].Path < missingBlobs[j].Path })
+
+		if len(missing) > 0 {
+			if trees != nil {
+				// Version 1 bundles carry no commit hashes to check
+				if err := database.FillCommitHashes(ctx, missing); err != nil {
+					return err
+				}
+			} else if err := verifyCommitHashes(ctx, database, missing); err != nil {
+				return err
+			}
+			err = database.WithTx(ctx, func(tx pgx.Tx) error {
+				if err := database.CreateCommitsBatchTx(ctx, tx, missing); err != nil {
+					return fmt.Errorf("failed to store commits: %w", err)
+				}
+				if err := database.CreateBlobsTx(ctx, tx, missingBlobs); err != nil {
+					return fmt.Errorf("failed to store files: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			stored = append(stored, missing...)
+		}
+
+		done += len(batch)
+		progress.Update(done)
+		batch, blobs = nil, nil
+		return nil
+	}
+
+	for {
+		c, b, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			if len(batch) == batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			batch = append(batch, c)
+		} else {
+			blobs = append(blobs, b)
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	progress.Done()
+	return verifyTreeHashes(ctx, database, stored)
+}
+
+// bundleTrees computes the tree hashes of the commits of a version 1
+// bundle from the file versions in it, replaying each commit on its
+// parent's tree.
+type bundleTrees struct {
+	parents  map[string]string // commit ID → parent ID ("" for a root) of every commit in the bundle
+	trees    *util.TreeReplay
+	replayed map[string]bool
+}
+
+// newBundleTrees reads the commits of the bundle at path to prepare the
+// replay.
+func newBundleTrees(path string) (*bundleTrees, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rd, err := bundle.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string]string, rd.Manifest().Commits)
+	var parentIDs []string
+	for {
+		c, _, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			parentID := ""
+			if c.ParentID != nil {
+				parentID = *c.ParentID
+			}
+			parents[c.ID] = parentID
+			parentIDs = append(parentIDs, parentID)
+		}
+	}
+	return &bundleTrees{parents: parents, trees: util.NewTreeReplay(parentIDs), replayed: make(map[string]bool)}, nil
+}
+
+// replay computes the trees of a batch of commits (in bundle order) from
+// their file versions and sets the tree hash of the ones database doesn't
+// have yet. Parents outside the bundle are read from database.
+func (t *bundleTrees) replay(ctx context.Context, database *db.DB, batch []*db.Commit, blobs []*db.Blob, existing map[string]bool) error {
+	changes := make(map[string][]util.TreeEntry)
+	for _, b := range blobs {
+		changes[b.CommitID] = append(changes[b.CommitID], util.TreeEntry{
+			Path: b.Path, Mode: b.Mode, ContentHash: b.ContentHash, IsSymlink: b.IsSymlink,
+		})
+	}
+
+	for _, c := range batch {
+		parentID := t.parents[c.ID]
+		if parentID != "" && !t.replayed[parentID] {
+			if _, ok := t.parents[parentID]; ok {
+				return fmt.Errorf("corrupt bundle: commit %s comes before its parent %s", c.ID, parentID)
+			}
+			tree, err := database.MerkleTreeAt(ctx, parentID)
+			if err != nil {
+				return err
+			}
+			t.trees.SetBase(parentID, tree)
+			t.replayed[parentID] = true
+		}
+		hash := t.trees.Replay(c.ID, parentID, changes[c.ID])
+		t.replayed[c.ID] = true
+		if !existing[c.ID] {
+			c.TreeHash = hash
+		}
+	}
+	return nil
+}
+
+// setBundleRefs points the branches and tags recorded in a bundle at their
+// commits.
+func setBundleRefs(ctx context.Context, database *db.DB, m *bundle.Manifest) error {
+	for _, ref := range m.Refs {
+		if err := database.SetRef(ctx, ref.Name, ref.CommitID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+)
+
+func TestBundleTreesReplay(t *testing.T) {
+	root, child := "01A", "01B"
+	commits := []*db.Commit{
+		{ID: root, TreeHash: "legacy-a"},
+		{ID: child, ParentID: &root, TreeHash: "legacy-b"},
+	}
+	blobs := []*db.Blob{
+		{Path: "a.txt", CommitID: root, Mode: 0644, ContentHash: []byte{1}},
+		{Path: "old.txt", CommitID: root, Mode: 0644, ContentHash: []byte{2}},
+		{Path: "b/c.txt", CommitID: child, Mode: 0644, ContentHash: []byte{3}},
+		{Path: "old.txt", CommitID: child, Mode: 0644}, // deleted
+	}
+	trees := &bundleTrees{
+		parents:  map[string]string{root: "", child: root},
+		trees:    util.NewTreeReplay([]string{"", root}),
+		replayed: make(map[string]bool),
+	}
+
+	// The root is already in the database and keeps its stored hash; no
+	// parent outside the bundle, so no database is needed
+	if err := trees.replay(t.Context(), nil, commits, blobs, map[string]bool{root: true}); err != nil {
+		t.Fatal(err)
+	}
+	if commits[0].TreeHash != "legacy-a" {
+		t.Errorf("tree hash of a stored commit changed to %s", commits[0].TreeHash)
+	}
+	want := util.ComputeTreeHash([]util.TreeEntry{
+		{Path: "a.txt", Mode: 0644, ContentHash: []byte{1}},
+		{Path: "b/c.txt", Mode: 0644, ContentHash: []byte{3}},
+	})
+	if commits[1].TreeHash != want {
+		t.Errorf("tree hash = %s, want %s", commits[1].TreeHash, want)
+	}
+
+	// A child before its parent can't be replayed
+	trees = &bundleTrees{
+		parents:  map[string]string{root: "", child: root},
+		trees:    util.NewTreeReplay([]string{"", root}),
+		replayed: make(map[string]bool),
+	}
+	if err := trees.replay(t.Context(), nil, commits[1:], nil, nil); err == nil {
+		t.Error("expected an error for a commit before its parent")
+	}
+}
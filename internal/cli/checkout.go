@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/imgajeed76/pgit/v4/internal/config"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
 	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
 	"github.com/imgajeed76/pgit/v4/internal/util"
@@ -24,28 +25,46 @@ Usage:
   pgit checkout <commit> <path>    # Restore file from commit
   pgit checkout -- <path>          # Restore file from HEAD (discard changes)
   pgit checkout <commit> -- <path> # Restore file from specific commit
+  pgit checkout --ours <path>      # Take the local side of a conflict
+  pgit checkout --theirs <path>    # Take the remote side of a conflict
 
 The '--' separates the commit from file paths, useful when restoring
 files from HEAD without specifying a commit.
 
+--ours and --theirs replace a conflicted file with one side of the merge,
+as it was in the local or the remote commit. Stage the result with
+'pgit add' to mark the conflict resolved.
+
 Warning: This will overwrite local changes!`,
 		Args: cobra.ArbitraryArgs,
 		RunE: runCheckout,
 	}
 
 	cmd.Flags().BoolP("force", "f", false, "Force checkout, discarding local changes")
+	cmd.Flags().Bool("ours", false, "Take the local version of conflicted paths")
+	cmd.Flags().Bool("theirs", false, "Take the remote version of conflicted paths")
+	cmd.MarkFlagsMutuallyExclusive("ours", "theirs")
 
 	return cmd
 }
 
 func runCheckout(cmd *cobra.Command, args []string) error {
 	force, _ := cmd.Flags().GetBool("force")
+	ours, _ := cmd.Flags().GetBool("ours")
+	theirs, _ := cmd.Flags().GetBool("theirs")
 
 	r, err := repo.Open()
 	if err != nil {
 		return err
 	}
 
+	if ours {
+		return checkoutStage(r, config.StageOurs, args)
+	}
+	if theirs {
+		return checkoutStage(r, config.StageTheirs, args)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
@@ -219,5 +238,54 @@ func checkoutFull(ctx context.Context, r *repo.Repository, commitID string, forc
 	}
 
 	fmt.Printf("HEAD is now at %s\n", styles.Yellow(util.ShortID(commitID)))
+	refreshSearchIndex(ctx, r.DB)
+	return nil
+}
+
+// checkoutStage replaces conflicted paths with one side of the merge, as
+// saved by the pull that produced the conflict.
+func checkoutStage(r *repo.Repository, stage config.Stage, paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("--%s needs the paths to take from the %s side", stage, stage)
+	}
+
+	mergeState, err := config.LoadMergeState(r.Root)
+	if err != nil {
+		return err
+	}
+	if !mergeState.InProgress {
+		return util.NewError("No merge in progress").
+			WithMessage(fmt.Sprintf("--%s only applies to files conflicted by 'pgit pull'", stage)).
+			WithSuggestion("pgit checkout HEAD -- <path>  # Restore a file from a commit instead")
+	}
+
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := r.RelPath(absPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if !mergeState.IsConflicted(relPath) {
+			return util.NewError("Path is not conflicted").
+				WithMessage(fmt.Sprintf("'%s' has no unresolved conflict", relPath)).
+				WithSuggestion("pgit status  # List unmerged paths")
+		}
+
+		exists, err := config.RestoreStage(r.Root, stage, relPath, r.AbsPath(relPath))
+		if err != nil {
+			return err
+		}
+		if exists {
+			fmt.Printf("Took %s version of '%s'\n", stage, relPath)
+		} else {
+			fmt.Printf("Removed '%s' (deleted on the %s side)\n", relPath, stage)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(styles.MutedMsg("Mark the conflicts resolved with 'pgit add <path>'"))
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/imgajeed76/pgit/v4/internal/bundle"
 	"github.com/imgajeed76/pgit/v4/internal/config"
 	"github.com/imgajeed76/pgit/v4/internal/container"
 	"github.com/imgajeed76/pgit/v4/internal/db"
@@ -23,28 +24,42 @@ var cloneForce bool
 
 func newCloneCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "clone <url> [directory]",
+		Use:   "clone <url|bundle-file> [directory]",
 		Short: "Clone a repository from a remote",
 		Long: `Clone a repository from a remote PostgreSQL database.
 
 The URL should be a PostgreSQL connection string.
-If directory is not specified, uses the database name.`,
+If directory is not specified, uses the database name.
+
+Given a bundle file written by 'pgit bundle create' instead, the clone
+is made from the bundle, which must hold the full history. The clone has
+no 'origin' remote; add one with 'pgit remote add' once it is reachable.`,
 		Args: cobra.RangeArgs(1, 2),
 		RunE: runClone,
 	}
 
 	cmd.Flags().BoolVarP(&cloneForce, "force", "f", false, "Overwrite existing local database without prompting")
+	cmd.Flags().IntP("workers", "w", 0, "Number of parallel workers (default from config, capped at CPU count)")
 
 	return cmd
 }
 
 func runClone(cmd *cobra.Command, args []string) error {
 	url := args[0]
+	workers, _ := cmd.Flags().GetInt("workers")
+	workers = resolveWorkers(workers)
+
+	bundlePath := ""
+	if bundle.IsBundleFile(url) {
+		bundlePath = url
+	}
 
 	// Determine target directory
 	dir := ""
 	if len(args) > 1 {
 		dir = args[1]
+	} else if bundlePath != "" {
+		dir = strings.TrimSuffix(filepath.Base(bundlePath), filepath.Ext(bundlePath))
 	} else {
 		// Extract database name from URL for directory name
 		// Simple extraction - could be improved
@@ -70,6 +85,10 @@ func runClone(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
 	defer cancel()
 
+	if bundlePath != "" {
+		return cloneBundle(ctx, bundlePath, dir, absDir)
+	}
+
 	// Connect to remote first to verify
 	spinner := ui.NewSpinner("Connecting to remote")
 	spinner.Start()
@@ -94,6 +113,11 @@ func runClone(cmd *cobra.Command, args []string) error {
 			).
 			WithSuggestion("pgit init <url>  # Initialize the remote database first")
 	}
+	if err := remoteDB.CheckSchemaVersion(ctx); err != nil {
+		return util.NewError("Remote schema is out of date").
+			WithMessage(err.Error()).
+			WithSuggestion("pgit migrate --remote <name>  # From a repository that has it as a remote")
+	}
 
 	// Get remote HEAD
 	remoteHeadID, err := remoteDB.GetHead(ctx)
@@ -104,43 +128,125 @@ func runClone(cmd *cobra.Command, args []string) error {
 		fmt.Println("Warning: Remote repository is empty (no commits)")
 	}
 
+	r, err := createCloneRepo(ctx, absDir, url)
+	if err != nil || r == nil {
+		return err
+	}
+	defer r.Close()
+
+	// Get all commits from remote — no limit
+	if remoteHeadID != "" {
+		commits, err := remoteDB.GetAllCommits(ctx)
+		if err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+
+		// GetAllCommits returns oldest-first (ORDER BY id), no reversal needed
+
+		fmt.Printf("Cloning %d commit(s)...\n", len(commits))
+
+		// Commits in batches of 100, then file versions by delta group
+		if err := copyCommits(ctx, remoteDB, r.DB, commits, "Cloning", workers, nil); err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+
+		// The clone has the remote's rewritten history, if any
+		rewrites, err := remoteDB.GetRewrites(ctx)
+		if err == nil && len(rewrites) > 0 {
+			err = r.DB.SetRewrites(ctx, rewrites)
+		}
+		if err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+
+		// Set HEAD
+		if err := r.DB.SetHead(ctx, remoteHeadID); err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+
+		// Set sync state
+		if err := r.DB.SetSyncState(ctx, "origin", &remoteHeadID); err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+		if err := r.DB.SetRef(ctx, db.RemoteTrackingRef("origin"), remoteHeadID); err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+
+		// Notes travel with the clone
+		if _, err := syncNotes(ctx, remoteDB, r.DB); err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+
+		if err := checkoutClone(ctx, r, remoteHeadID); err != nil {
+			os.RemoveAll(absDir)
+			return err
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Cloned into '%s'\n", styles.Cyan(dir))
+
+	return nil
+}
+
+// createCloneRepo creates the clone directory with its config and index,
+// starts the local container, and prepares an empty local database.
+// remoteURL, if not empty, becomes the 'origin' remote. The directory is
+// removed again on failure. It returns a nil repository if the user
+// declined to overwrite an existing local database.
+func createCloneRepo(ctx context.Context, absDir, remoteURL string) (_ *repo.Repository, err error) {
+	var r *repo.Repository
+
 	// Create directory
 	if err := os.MkdirAll(absDir, 0755); err != nil {
-		return err
+		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			if r != nil {
+				r.Close()
+			}
+			os.RemoveAll(absDir)
+		}
+	}()
 
 	// Check container runtime
 	runtime := container.DetectRuntime()
 	if runtime == container.RuntimeNone {
-		os.RemoveAll(absDir)
-		return util.ErrNoContainerRuntime
+		return nil, util.ErrNoContainerRuntime
 	}
 
 	// Create .pgit directory
 	pgitDir := filepath.Join(absDir, util.PgitDir)
 	if err := os.MkdirAll(pgitDir, 0755); err != nil {
-		os.RemoveAll(absDir)
-		return err
+		return nil, err
 	}
 
 	// Create config
 	cfg := config.DefaultConfig(absDir)
-	cfg.SetRemote("origin", url)
+	if remoteURL != "" {
+		cfg.SetRemote("origin", remoteURL)
+	}
 
 	if err := cfg.Save(absDir); err != nil {
-		os.RemoveAll(absDir)
-		return err
+		return nil, err
 	}
 
 	// Create empty index
 	idx := config.NewIndex()
 	if err := idx.Save(absDir); err != nil {
-		os.RemoveAll(absDir)
-		return err
+		return nil, err
 	}
 
 	// Create local repository object
-	r := &repo.Repository{
+	r = &repo.Repository{
 		Root:    absDir,
 		Config:  cfg,
 		Runtime: runtime,
@@ -151,22 +257,18 @@ func runClone(cmd *cobra.Command, args []string) error {
 	containerSpinner.Start()
 	if err := r.StartContainer(); err != nil {
 		containerSpinner.Stop()
-		os.RemoveAll(absDir)
-		return err
+		return nil, err
 	}
 	containerSpinner.Stop()
 
 	if err := r.Connect(ctx); err != nil {
-		os.RemoveAll(absDir)
-		return err
+		return nil, err
 	}
-	defer r.Close()
 
 	// Check if local database already has data
 	schemaExists, err := r.DB.SchemaExists(ctx)
 	if err != nil {
-		os.RemoveAll(absDir)
-		return err
+		return nil, err
 	}
 
 	if schemaExists {
@@ -184,9 +286,10 @@ func runClone(cmd *cobra.Command, args []string) error {
 				response = strings.TrimSpace(strings.ToLower(response))
 
 				if response != "y" && response != "yes" {
+					r.Close()
 					os.RemoveAll(absDir)
 					fmt.Println("Clone aborted.")
-					return nil
+					return nil, nil
 				}
 			}
 		}
@@ -194,99 +297,83 @@ func runClone(cmd *cobra.Command, args []string) error {
 
 	// Drop and recreate schema to ensure clean slate
 	if err := r.DB.DropSchema(ctx); err != nil {
-		os.RemoveAll(absDir)
-		return fmt.Errorf("failed to clean local database: %w", err)
+		return nil, fmt.Errorf("failed to clean local database: %w", err)
 	}
 	if err := r.DB.InitSchema(ctx); err != nil {
-		os.RemoveAll(absDir)
-		return fmt.Errorf("failed to init local database: %w", err)
+		return nil, fmt.Errorf("failed to init local database: %w", err)
 	}
 
-	// Get all commits from remote — no limit
-	if remoteHeadID != "" {
-		commits, err := remoteDB.GetAllCommits(ctx)
-		if err != nil {
-			os.RemoveAll(absDir)
-			return err
-		}
-
-		// GetAllCommits returns oldest-first (ORDER BY id), no reversal needed
-
-		fmt.Printf("Cloning %d commit(s)...\n", len(commits))
-
-		// Batched insertion: 100 commits per batch
-		const batchSize = 100
-		progress := ui.NewProgress("Cloning", len(commits))
-
-		for i := 0; i < len(commits); i += batchSize {
-			end := min(i+batchSize, len(commits))
-			batch := commits[i:end]
-
-			// Batch insert commits
-			if err := r.DB.CreateCommitsBatch(ctx, batch); err != nil {
-				os.RemoveAll(absDir)
-				return fmt.Errorf("failed to create commits: %w", err)
-			}
-
-			// Insert blobs per commit
-			for _, commit := range batch {
-				blobs, err := remoteDB.GetBlobsAtCommit(ctx, commit.ID)
-				if err != nil {
-					os.RemoveAll(absDir)
-					return err
-				}
-				if len(blobs) > 0 {
-					if err := r.DB.CreateBlobs(ctx, blobs); err != nil {
-						os.RemoveAll(absDir)
-						return fmt.Errorf("failed to create blobs for %s: %w", util.ShortID(commit.ID), err)
-					}
-				}
-			}
+	return r, nil
+}
 
-			progress.Update(end)
-		}
-		progress.Done()
+// checkoutClone writes the tree at headID into a fresh clone.
+func checkoutClone(ctx context.Context, r *repo.Repository, headID string) error {
+	fmt.Println("Checking out files...")
+	tree, err := r.DB.GetTreeAtCommit(ctx, headID)
+	if err != nil {
+		return err
+	}
 
-		// Set HEAD
-		if err := r.DB.SetHead(ctx, remoteHeadID); err != nil {
-			os.RemoveAll(absDir)
-			return err
+	for _, blob := range tree {
+		if blob.ContentHash == nil {
+			continue
 		}
 
-		// Set sync state
-		if err := r.DB.SetSyncState(ctx, "origin", &remoteHeadID); err != nil {
-			os.RemoveAll(absDir)
-			return err
+		absPath := filepath.Join(r.Root, blob.Path)
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			continue
 		}
 
-		// Checkout working directory
-		fmt.Println("Checking out files...")
-		tree, err := r.DB.GetTreeAtCommit(ctx, remoteHeadID)
-		if err != nil {
-			os.RemoveAll(absDir)
-			return err
+		if blob.IsSymlink && blob.SymlinkTarget != nil {
+			_ = os.Symlink(*blob.SymlinkTarget, absPath)
+		} else {
+			_ = os.WriteFile(absPath, blob.Content, os.FileMode(blob.Mode))
 		}
+	}
+	return nil
+}
 
-		for _, blob := range tree {
-			if blob.ContentHash == nil {
-				continue
-			}
+// cloneBundle clones from a bundle file holding the full history.
+func cloneBundle(ctx context.Context, bundlePath, dir, absDir string) error {
+	m, _, _, err := readBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	if m.Prerequisite != "" {
+		return util.NewError("Cannot clone from a partial bundle").
+			WithMessage(fmt.Sprintf("The bundle continues from commit %s instead of holding the full history",
+				util.ShortID(m.Prerequisite))).
+			WithSuggestions(
+				"pgit bundle create <file>  # At the source: bundle all of HEAD",
+				"pgit bundle unbundle "+bundlePath+"  # Or apply it to a repository that has the prerequisite",
+			)
+	}
 
-			absPath := filepath.Join(absDir, blob.Path)
-			if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-				continue
-			}
+	r, err := createCloneRepo(ctx, absDir, "")
+	if err != nil || r == nil {
+		return err
+	}
+	defer r.Close()
 
-			if blob.IsSymlink && blob.SymlinkTarget != nil {
-				_ = os.Symlink(*blob.SymlinkTarget, absPath)
-			} else {
-				_ = os.WriteFile(absPath, blob.Content, os.FileMode(blob.Mode))
-			}
-		}
+	fmt.Printf("Cloning %d commit(s) from %s...\n", m.Commits, styles.Cyan(filepath.Base(bundlePath)))
+	if err := applyBundle(ctx, r.DB, bundlePath); err != nil {
+		os.RemoveAll(absDir)
+		return err
+	}
+	if err := r.DB.SetHead(ctx, m.Head); err != nil {
+		os.RemoveAll(absDir)
+		return err
+	}
+	if err := setBundleRefs(ctx, r.DB, m); err != nil {
+		os.RemoveAll(absDir)
+		return err
+	}
+	if err := checkoutClone(ctx, r, m.Head); err != nil {
+		os.RemoveAll(absDir)
+		return err
 	}
 
 	fmt.Println()
 	fmt.Printf("Cloned into '%s'\n", styles.Cyan(dir))
-
 	return nil
 }
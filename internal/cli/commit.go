@@ -9,8 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/imgajeed76/pgit/v4/internal/config"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
 	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
 	"github.com/spf13/cobra"
 )
 
@@ -66,13 +68,49 @@ func runCommit(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	// A conflicted merge is committed once every conflict is resolved
+	mergeState, err := config.LoadMergeState(r.Root)
+	if err != nil {
+		return err
+	}
+	if mergeState.HasConflicts() {
+		return util.NewError("Commit rejected: unresolved conflicts").
+			WithMessage(fmt.Sprintf("%d file(s) still conflicted: %s", len(mergeState.ConflictedFiles),
+				strings.Join(mergeState.ConflictedFiles, ", "))).
+			WithSuggestions(
+				"pgit add <file>        # Mark a fixed file resolved",
+				"pgit mergetool         # Resolve with a merge tool",
+				"pgit merge --abort     # Give up the merge",
+			)
+	}
+
 	// Get parent commit BEFORE we create new commit (for diff stats)
 	parentHeadID, _ := r.DB.GetHead(ctx)
-	var parentCommitID string
-	if parentHeadID != "" {
-		parentCommitID = parentHeadID
-	}
 
+	// Fetched commits sit on top of HEAD in the local history; a commit
+	// beside them would turn the next pull from a fast-forward into a merge.
+	if ref, err := unmergedFetch(ctx, r.DB, parentHeadID); err != nil {
+		return err
+	} else if ref != nil {
+		tracking := strings.TrimPrefix(ref.Name, "refs/remotes/")
+		remoteName, _, _ := strings.Cut(tracking, "/")
+		return util.NewError("Commit rejected: fetched commits not integrated").
+			WithMessage(fmt.Sprintf("HEAD is behind '%s', which was fetched but not pulled", tracking)).
+			WithSuggestion("pgit pull " + remoteName + "  # Fast-forward to the fetched commits, then commit")
+	}
+	// Same for an interrupted pull, which leaves part of the remote commits
+	// on top of HEAD (or, for a merge, HEAD on a removed commit)
+	transfers, err := r.DB.GetAllTransferProgress(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		if t.Direction != transferPush {
+			return util.NewError("Commit rejected: interrupted pull").
+				WithMessage(fmt.Sprintf("A %s from '%s' stopped after %d of %d commit(s)", t.Direction, t.RemoteName, t.Done, t.Total)).
+				WithSuggestion("pgit pull --resume " + t.RemoteName + "  # Finish it, then commit")
+		}
+	}
 	// Check if -m was provided but empty
 	messageFlag := cmd.Flags().Lookup("message")
 	messageProvided := messageFlag != nil && messageFlag.Changed
@@ -112,6 +150,11 @@ func runCommit(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if mergeState.InProgress {
+		if err := mergeState.Clear(r.Root); err != nil {
+			return err
+		}
+	}
 
 	// Print commit summary
 	// Format: [hash] message
@@ -119,53 +162,28 @@ func runCommit(cmd *cobra.Command, args []string) error {
 	fmt.Printf("[%s] %s\n", hash, firstLine(commit.Message))
 	fmt.Println()
 
-	// Count changes by type and compute insertion/deletion stats
-	var fileCount int
-	var totalInsertions, totalDeletions int
-
 	for _, c := range staged {
-		fileCount++
-
-		// Count insertions/deletions based on change type
 		switch c.Status {
 		case repo.StatusNew:
-			// New file - count all lines as insertions
-			absPath := r.AbsPath(c.Path)
-			if content, err := os.ReadFile(absPath); err == nil {
-				lines := strings.Count(string(content), "\n")
-				if len(content) > 0 && content[len(content)-1] != '\n' {
-					lines++ // Count last line if no trailing newline
-				}
-				totalInsertions += lines
-			}
 			fmt.Printf(" %s %s\n", styles.Green("create"), c.Path)
-
 		case repo.StatusModified:
-			// Modified - get diff and count (use parent commit, not HEAD which is now the new commit)
-			insertions, deletions := countDiffStats(ctx, r, c.Path, parentCommitID)
-			totalInsertions += insertions
-			totalDeletions += deletions
 			fmt.Printf(" %s %s\n", styles.Yellow("modify"), c.Path)
-
 		case repo.StatusDeleted:
-			// Deleted - count all lines as deletions
-			headID, _ := r.DB.GetHead(ctx)
-			if headID != "" {
-				if blob, err := r.DB.GetFileAtCommit(ctx, c.Path, headID); err == nil && blob != nil {
-					lines := strings.Count(string(blob.Content), "\n")
-					if len(blob.Content) > 0 && blob.Content[len(blob.Content)-1] != '\n' {
-						lines++
-					}
-					totalDeletions += lines
-				}
-			}
 			fmt.Printf(" %s %s\n", styles.Red("delete"), c.Path)
 		}
 	}
 
+	// Insertions and deletions come from the line counts stored with the commit
+	var totalInsertions, totalDeletions int
+	changes, _ := r.DB.GetFileChanges(ctx, []string{commit.ID})
+	for _, c := range changes {
+		totalInsertions += c.Added
+		totalDeletions += c.Removed
+	}
+
 	// Summary line with insertions/deletions
 	fmt.Println()
-	summary := fmt.Sprintf(" %d file(s) changed", fileCount)
+	summary := fmt.Sprintf(" %d file(s) changed", len(staged))
 	if totalInsertions > 0 {
 		summary += fmt.Sprintf(", %s", styles.Green(fmt.Sprintf("%d insertions(+)", totalInsertions)))
 	}
@@ -174,46 +192,10 @@ func runCommit(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Println(summary)
 
+	refreshSearchIndex(ctx, r.DB)
 	return nil
 }
 
-// countDiffStats counts insertions and deletions for a modified file
-// parentCommitID is the commit to compare against (the parent of the new commit)
-func countDiffStats(ctx context.Context, r *repo.Repository, path string, parentCommitID string) (insertions, deletions int) {
-	if parentCommitID == "" {
-		return 0, 0
-	}
-
-	blob, err := r.DB.GetFileAtCommit(ctx, path, parentCommitID)
-	if err != nil || blob == nil {
-		return 0, 0
-	}
-	oldContent := string(blob.Content)
-
-	// Get new content from working directory
-	absPath := r.AbsPath(path)
-	newBytes, err := os.ReadFile(absPath)
-	if err != nil {
-		return 0, 0
-	}
-	newContent := string(newBytes)
-
-	// Generate hunks and count
-	hunks := repo.GenerateHunks(oldContent, newContent, 3)
-	for _, hunk := range hunks {
-		for _, line := range hunk.Lines {
-			switch line.Type {
-			case repo.DiffLineAdd:
-				insertions++
-			case repo.DiffLineDelete:
-				deletions++
-			}
-		}
-	}
-
-	return insertions, deletions
-}
-
 // getCommitMessageFromEditor opens an editor for the user to write a commit message
 func getCommitMessageFromEditor(r *repo.Repository, staged []repo.FileChange) (string, error) {
 	// Determine editor
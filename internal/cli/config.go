@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/imgajeed76/pgit/v4/internal/config"
+	"github.com/imgajeed76/pgit/v4/internal/merge"
 	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
 	"github.com/imgajeed76/pgit/v4/internal/util"
 	"github.com/spf13/cobra"
@@ -23,6 +24,9 @@ Examples:
   pgit config user.name              # Get repo value
   pgit config user.name "John Doe"   # Set repo value
   pgit config --list                 # List repo config
+  pgit config merge.conflict_style merge  # Conflicts without the base section
+  pgit config merge.tool meld        # Tool for 'pgit mergetool'
+  pgit config merge.drivers 'package-lock.json=line'  # Line-merge this file
 
   pgit config --global --list              # List global config
   pgit config --global container.shm_size  # Get global value
@@ -172,6 +176,15 @@ func runRepoConfig(cmd *cobra.Command, args []string, listAll bool) error {
 		if cfg.User.Email != "" {
 			fmt.Printf("user.email=%s\n", cfg.User.Email)
 		}
+		if cfg.Merge.ConflictStyle != "" {
+			fmt.Printf("merge.conflict_style=%s\n", cfg.Merge.ConflictStyle)
+		}
+		if cfg.Merge.Tool != "" {
+			fmt.Printf("merge.tool=%s\n", cfg.Merge.Tool)
+		}
+		if cfg.Merge.Drivers != "" {
+			fmt.Printf("merge.drivers=%s\n", cfg.Merge.Drivers)
+		}
 		for name, remote := range cfg.Remotes {
 			fmt.Printf("remote.%s.url=%s\n", name, remote.URL)
 		}
@@ -218,6 +231,12 @@ func getConfigValue(cfg *config.Config, key string) (string, error) {
 		return cfg.User.Email, nil
 	case "core.local_db", "core.localdb":
 		return cfg.Core.LocalDB, nil
+	case "merge.conflict_style", "merge.conflictstyle":
+		return cfg.GetConflictStyle(), nil
+	case "merge.tool":
+		return cfg.Merge.Tool, nil
+	case "merge.drivers":
+		return cfg.Merge.Drivers, nil
 	default:
 		// Check for remote.*.url pattern
 		if strings.HasPrefix(key, "remote.") && strings.HasSuffix(key, ".url") {
@@ -240,6 +259,18 @@ func setConfigValue(cfg *config.Config, key, value string) error {
 		cfg.User.Name = value
 	case "user.email":
 		cfg.User.Email = value
+	case "merge.conflict_style", "merge.conflictstyle":
+		if _, ok := merge.ParseConflictStyle(value); !ok {
+			return fmt.Errorf("invalid conflict style %q (use diff3 or merge)", value)
+		}
+		cfg.Merge.ConflictStyle = strings.ToLower(value)
+	case "merge.tool":
+		cfg.Merge.Tool = value
+	case "merge.drivers":
+		if _, err := merge.ParseDrivers(value); err != nil {
+			return err
+		}
+		cfg.Merge.Drivers = value
 	default:
 		// Check for remote.*.url pattern
 		if strings.HasPrefix(key, "remote.") && strings.HasSuffix(key, ".url") {
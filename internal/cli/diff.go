@@ -154,7 +154,7 @@ func runDiff(cmd *cobra.Command, args []string) error {
 	}
 
 	if stat {
-		return printDiffStat(results, noColor)
+		return printDiffStat(diffResultStats(results), noColor)
 	}
 
 	for _, result := range results {
@@ -190,6 +190,7 @@ func runCommitDiff(ctx context.Context, r *repo.Repository, fromRef, toRef strin
 	}
 
 	var results []repo.DiffResult
+	var stats []diffStat
 
 	if toID != "" {
 		// Commit-to-commit diff: get only changed paths between the two commits,
@@ -208,6 +209,9 @@ func runCommitDiff(ctx context.Context, r *repo.Repository, fromRef, toRef strin
 			}
 			changedPaths[b.Path] = true
 		}
+		if stat {
+			stats = storedDiffStats(ctx, r.DB, changedMeta, changedPaths)
+		}
 
 		// Parallel fetch with concurrency cap.
 		// Each file's content lives in a delta compression group in xpatch,
@@ -372,13 +376,17 @@ func runCommitDiff(ctx context.Context, r *repo.Repository, fromRef, toRef strin
 		})
 	}
 
-	if len(results) == 0 {
+	if len(results) == 0 && len(stats) == 0 {
 		fmt.Println(styles.Mute("No changes."))
 		return nil
 	}
 
 	if stat {
-		return printDiffStat(results, noColor)
+		stats = append(stats, diffResultStats(results)...)
+		sort.Slice(stats, func(i, j int) bool {
+			return stats[i].Path < stats[j].Path
+		})
+		return printDiffStat(stats, noColor)
 	}
 
 	for _, result := range results {
@@ -403,25 +411,89 @@ func matchesAnyPath(path string, patterns []string) bool {
 	return false
 }
 
-func printDiffStat(results []repo.DiffResult, noColor bool) error {
-	var totalInsertions, totalDeletions int
-
-	for _, result := range results {
-		insertions := 0
-		deletions := 0
+// diffStat is one file of a --stat summary.
+type diffStat struct {
+	Path     string
+	Added    int
+	Removed  int
+	IsBinary bool
+}
 
+// diffResultStats counts the added and removed lines of diff results.
+func diffResultStats(results []repo.DiffResult) []diffStat {
+	stats := make([]diffStat, len(results))
+	for i, result := range results {
+		stats[i].Path = result.Path
 		for _, hunk := range result.Hunks {
 			for _, line := range hunk.Lines {
 				switch line.Type {
 				case repo.DiffLineAdd:
-					insertions++
+					stats[i].Added++
 				case repo.DiffLineDelete:
-					deletions++
+					stats[i].Removed++
 				}
 			}
 		}
+	}
+	return stats
+}
+
+// storedDiffStats answers --stat from pgit_file_changes for the paths
+// changed by a single commit of the range: the line counts stored for that
+// commit are the net change, so no content is read. Those paths are taken
+// out of changedPaths; the rest still need a diff.
+func storedDiffStats(ctx context.Context, database *db.DB, changedMeta []*db.Blob, changedPaths map[string]bool) []diffStat {
+	versions := make(map[string]int)
+	commitOf := make(map[string]string)
+	for _, b := range changedMeta {
+		if changedPaths[b.Path] {
+			versions[b.Path]++
+			commitOf[b.Path] = b.CommitID
+		}
+	}
+	idSet := make(map[string]bool)
+	for path, n := range versions {
+		if n == 1 {
+			idSet[commitOf[path]] = true
+		}
+	}
+	if len(idSet) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+
+	// Rows still missing only mean those paths are diffed after all
+	_ = fillFileChanges(ctx, database, ids)
+	changes, err := database.GetFileChanges(ctx, ids)
+	if err != nil {
+		return nil
+	}
+
+	var stats []diffStat
+	for _, c := range changes {
+		if versions[c.Path] != 1 || commitOf[c.Path] != c.CommitID {
+			continue
+		}
+		delete(changedPaths, c.Path)
+		stats = append(stats, diffStat{Path: c.Path, Added: c.Added, Removed: c.Removed, IsBinary: c.IsBinary})
+	}
+	return stats
+}
+
+func printDiffStat(stats []diffStat, noColor bool) error {
+	var totalInsertions, totalDeletions int
+
+	for _, st := range stats {
+		if st.IsBinary {
+			fmt.Printf(" %s | Bin\n", st.Path)
+			continue
+		}
 
 		// Display stat line
+		insertions, deletions := st.Added, st.Removed
 		total := insertions + deletions
 		barWidth := min(total, 40)
 		addWidth := 0
@@ -436,7 +508,7 @@ func printDiffStat(results []repo.DiffResult, noColor bool) error {
 			bar = styles.Green(strings.Repeat("+", addWidth)) + styles.Red(strings.Repeat("-", delWidth))
 		}
 
-		fmt.Printf(" %s | %d %s\n", result.Path, total, bar)
+		fmt.Printf(" %s | %d %s\n", st.Path, total, bar)
 		totalInsertions += insertions
 		totalDeletions += deletions
 	}
@@ -444,10 +516,10 @@ func printDiffStat(results []repo.DiffResult, noColor bool) error {
 	fmt.Println()
 	if noColor {
 		fmt.Printf(" %d file(s) changed, %d insertions(+), %d deletions(-)\n",
-			len(results), totalInsertions, totalDeletions)
+			len(stats), totalInsertions, totalDeletions)
 	} else {
 		fmt.Printf(" %d file(s) changed, %s, %s\n",
-			len(results),
+			len(stats),
 			styles.Green(fmt.Sprintf("%d insertions(+)", totalInsertions)),
 			styles.Red(fmt.Sprintf("%d deletions(-)", totalDeletions)))
 	}
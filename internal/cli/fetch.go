@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newFetchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fetch [remote]",
+		Short: "Download commits from a remote without integrating them",
+		Long: `Downloads commits and their content from a remote into the local
+database without touching HEAD or the working directory.
+
+The remote's branch is recorded as refs/remotes/<remote>/main, so the
+fetched work can be inspected before merging it:
+
+  pgit log origin/main
+  pgit diff HEAD..origin/main
+  pgit status              # ahead/behind counts
+
+'pgit pull' then integrates the fetched commits without downloading them
+again.
+
+If local and remote have diverged, the remote commits since the last
+commit both share are stored beside the local ones, <remote>/main points
+at the remote HEAD, and fetch reports how far apart the two are. HEAD and
+the working directory stay on the local line; 'pgit pull' does the merge.
+
+If no remote is specified, uses 'origin' by default.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runFetch,
+	}
+
+	cmd.Flags().IntP("workers", "w", 0, "Number of parallel workers (default from config, capped at CPU count)")
+
+	return cmd
+}
+
+func runFetch(cmd *cobra.Command, args []string) error {
+	remoteName := "origin"
+	if len(args) > 0 {
+		remoteName = args[0]
+	}
+	workers, _ := cmd.Flags().GetInt("workers")
+	workers = resolveWorkers(workers)
+
+	r, err := repo.Open()
+	if err != nil {
+		return err
+	}
+
+	remote, exists := r.Config.GetRemote(remoteName)
+	if !exists {
+		return util.RemoteNotFoundError(remoteName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	// Connect to local database
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Connect to remote database
+	spinner := ui.NewSpinner(fmt.Sprintf("Connecting to %s", styles.Cyan(remoteName)))
+	spinner.Start()
+	remoteDB, err := r.ConnectTo(ctx, remote.URL)
+	spinner.Stop()
+	if err != nil {
+		return util.DatabaseConnectionError(remote.URL, err)
+	}
+	defer remoteDB.Close()
+
+	if err := checkRemoteSchema(ctx, remoteDB, remoteName); err != nil {
+		return err
+	}
+
+	remoteHeadID, err := remoteDB.GetHead(ctx)
+	if err != nil {
+		return err
+	}
+	if remoteHeadID == "" {
+		fmt.Println("Remote has no commits")
+		return nil
+	}
+
+	localHeadID, err := r.DB.GetHead(ctx)
+	if err != nil {
+		return err
+	}
+
+	trackingRef := db.RemoteTrackingRef(remoteName)
+	trackingName := remoteName + "/" + db.DefaultBranch
+
+	if localHeadID != "" {
+		localExistsOnRemote, err := remoteDB.CommitExists(ctx, localHeadID)
+		if err != nil {
+			return err
+		}
+		if !localExistsOnRemote {
+			localIsAhead, err := localHasAncestor(ctx, r.DB, remoteHeadID, localHeadID)
+			if err != nil {
+				return err
+			}
+			if localIsAhead {
+				// Local is ahead: nothing to download
+				if err := r.DB.SetRef(ctx, trackingRef, remoteHeadID); err != nil {
+					return err
+				}
+				fmt.Printf("%s is up to date (local is ahead)\n", styles.Cyan(trackingName))
+				return reportNotesSync(ctx, remoteDB, r.DB, "Fetched")
+			}
+			return fetchDiverged(ctx, r, remoteDB, localHeadID, remoteHeadID, remoteName, workers)
+		}
+	}
+
+	// Fast-forward: the remote's history from local HEAD to its HEAD
+	var commits []*db.Commit
+	if localHeadID == "" {
+		commits, err = remoteDB.GetAllCommits(ctx)
+	} else {
+		commits, err = remoteDB.CommitsBetween(ctx, remoteHeadID, localHeadID)
+		if errors.Is(err, db.ErrNotAncestor) {
+			// Local HEAD is on the remote, but not in its history any more
+			return fetchDiverged(ctx, r, remoteDB, localHeadID, remoteHeadID, remoteName, workers)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// A previous fetch may have stored some of them already
+	existing, err := r.DB.ExistingCommitIDs(ctx, commitIDs(commits))
+	if err != nil {
+		return err
+	}
+	var missing []*db.Commit
+	for _, c := range commits {
+		if !existing[c.ID] {
+			missing = append(missing, c)
+		}
+	}
+
+	// Everything is gone over: the files of commits an interrupted fetch
+	// stored may still be missing. What is there already is skipped.
+	if len(commits) > 0 {
+		if err := copyCommits(ctx, remoteDB, r.DB, commits, "Fetching", workers, nil); err != nil {
+			return err
+		}
+	}
+
+	previous, err := r.DB.GetRef(ctx, trackingRef)
+	if err != nil {
+		return err
+	}
+	if err := r.DB.SetRef(ctx, trackingRef, remoteHeadID); err != nil {
+		return err
+	}
+
+	if previous != nil && previous.CommitID == remoteHeadID && len(missing) == 0 {
+		fmt.Printf("%s is up to date\n", styles.Cyan(trackingName))
+	} else {
+		from := "(new)"
+		if previous != nil {
+			from = util.ShortID(previous.CommitID)
+		}
+		fmt.Printf("%s %s -> %s  %s\n", styles.Successf("Fetched"),
+			styles.Yellow(from), styles.Yellow(util.ShortID(remoteHeadID)), styles.Cyan(trackingName))
+	}
+	if len(commits) > 0 {
+		fmt.Printf("Your branch is behind '%s' by %d commit(s). Run 'pgit pull' to fast-forward.\n",
+			trackingName, len(commits))
+	}
+
+	return reportNotesSync(ctx, remoteDB, r.DB, "Fetched")
+}
+
+// fetchDiverged stores the remote commits since the merge base beside the
+// local ones and points the tracking ref at the remote HEAD, so the remote
+// work can be inspected before 'pgit pull' merges it. A commit's tree
+// follows its parents, so the local line is unaffected.
+func fetchDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localHeadID, remoteHeadID, remoteName string, workers int) error {
+	base, err := findCommonAncestorCrossDB(ctx, r.DB, remoteDB, remoteHeadID, localHeadID)
+	if err != nil {
+		return err
+	}
+	commits, err := remoteDB.CommitsBetween(ctx, remoteHeadID, base)
+	if err != nil {
+		return err
+	}
+
+	// A previous fetch may have stored them already; what is there is skipped
+	if len(commits) > 0 {
+		if err := copyCommits(ctx, remoteDB, r.DB, commits, "Fetching", workers, nil); err != nil {
+			return err
+		}
+	}
+
+	trackingRef := db.RemoteTrackingRef(remoteName)
+	previous, err := r.DB.GetRef(ctx, trackingRef)
+	if err != nil {
+		return err
+	}
+	if err := r.DB.SetRef(ctx, trackingRef, remoteHeadID); err != nil {
+		return err
+	}
+	ahead, behind, _, err := r.DB.CompareCommits(ctx, localHeadID, remoteHeadID)
+	if err != nil {
+		return err
+	}
+
+	from := "(new)"
+	if previous != nil {
+		from = util.ShortID(previous.CommitID)
+	}
+	trackingName := remoteName + "/" + db.DefaultBranch
+	fmt.Printf("%s %s -> %s  %s\n", styles.Successf("Fetched"),
+		styles.Yellow(from), styles.Yellow(util.ShortID(remoteHeadID)), styles.Cyan(trackingName))
+	fmt.Println(styles.Warningf("Histories have diverged"))
+	fmt.Printf("Local has %d commit(s) and %s has %d commit(s) the other does not.\n",
+		ahead, trackingName, behind)
+	fmt.Printf("  pgit log %s           # Inspect the remote history\n", trackingName)
+	fmt.Printf("  pgit diff HEAD..%s    # Compare with local\n", trackingName)
+	fmt.Printf("  pgit pull %s               # Merge\n", remoteName)
+	fmt.Printf("  pgit pull --rebase %s      # Replay local commits on top\n", remoteName)
+	return reportNotesSync(ctx, remoteDB, r.DB, "Fetched")
+}
+
+// unmergedFetch returns the remote-tracking ref that points past HEAD, i.e.
+// fetched commits stored on top of HEAD that have not been pulled, or nil.
+// "Past HEAD" is decided by ancestry, not by comparing commit IDs.
+func unmergedFetch(ctx context.Context, database *db.DB, headID string) (*db.Ref, error) {
+	refs, err := database.GetRefsByPrefix(ctx, "refs/remotes/")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.CommitID == headID {
+			continue
+		}
+		if headID == "" {
+			return ref, nil
+		}
+		onTop, err := database.IsAncestor(ctx, headID, ref.CommitID)
+		if err != nil {
+			return nil, err
+		}
+		if onTop {
+			return ref, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"maps"
+	"os/exec"
+	"testing"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+)
+
+func TestFetchDiverged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := t.Context()
+	remoteDB := connectTest(t, testRemote(t))
+	runCommand(t, newImportCmd(), "--remote", "origin", "--all", divergedGitRepo(t))
+
+	// The local repository has main, the remote's HEAD moves to feature
+	mainID, _ := remoteDB.ResolveRefName(ctx, "main")
+	featureID, _ := remoteDB.ResolveRefName(ctx, "feature")
+	local := connectTest(t, testRepoURL(t))
+	if err := local.InitSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mainLine, err := remoteDB.CommitsBetween(ctx, mainID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyCommits(ctx, remoteDB, local, mainLine, "Cloning", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.SetHead(ctx, mainID); err != nil {
+		t.Fatal(err)
+	}
+	if err := remoteDB.SetHead(ctx, featureID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &repo.Repository{DB: local}
+	if err := fetchDiverged(ctx, r, remoteDB, mainID, featureID, "origin", 1); err != nil {
+		t.Fatalf("fetchDiverged: %v", err)
+	}
+
+	tracking, err := local.GetRef(ctx, db.RemoteTrackingRef("origin"))
+	if err != nil || tracking == nil || tracking.CommitID != featureID {
+		t.Fatalf("origin/main = %v, %v; want %s", tracking, err, featureID)
+	}
+	tests := []struct {
+		ref  string
+		want map[string]string
+	}{
+		{"HEAD", map[string]string{"shared.txt": "base\n", "main.txt": "main only\n"}},
+		{"origin/main", map[string]string{"shared.txt": "changed on feature\n", "feature.txt": "feature only\n"}},
+	}
+	for _, tt := range tests {
+		if got := treeFiles(t, local, tt.ref); !maps.Equal(got, tt.want) {
+			t.Errorf("tree at %s = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+
+	// The fetched commits stay off the local line: pull still merges
+	if ahead, err := localHasAncestor(ctx, local, featureID, mainID); err != nil || ahead {
+		t.Errorf("localHasAncestor(feature, main) = %v, %v; want false", ahead, err)
+	}
+	base, err := findCommonAncestorCrossDB(ctx, local, remoteDB, featureID, mainID)
+	if err != nil || base != mainLine[0].ID {
+		t.Fatalf("common ancestor = %s, %v; want %s", base, err, mainLine[0].ID)
+	}
+	localCommits, err := local.CommitsBetween(ctx, mainID, base)
+	if err != nil || len(localCommits) != 1 || localCommits[0].ID != mainID {
+		t.Errorf("local commits since %s = %v, %v; want [%s]", base, localCommits, err, mainID)
+	}
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/filter"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newFilterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "filter",
+		Short: "Permanently remove files or text from all history",
+		Long: `Rewrite history to erase leaked secrets or huge files from every version.
+
+--remove-path removes every version of the matching files from every
+commit. A pattern without a slash matches any file or directory name
+("*.pem", "secrets"); with a slash it matches from the repository root
+("config/prod/*.env", "/build").
+
+--replace-text applies the replacement rules in a file to every version of
+every text file, in the git filter-repo format:
+
+  hunter2                      # replaced with ***REMOVED***
+  hunter2==>[password]         # replaced with [password]
+  regex:ghp_[A-Za-z0-9]{36}==> # regular expression, replaced with nothing
+
+Affected delta chains are re-encoded from the first changed version on,
+content, tree and commit hashes are updated, and the rewrite is recorded
+in the database. Commit IDs and messages don't change. Everything runs in one
+transaction.
+
+A rewrite only affects the database it runs on: apply the same filter to
+every remote (--remote) with the same arguments. Pushes between databases
+that don't share the same rewrites are refused, so a stale clone can't
+bring the data back; other clones have to be cloned again.
+
+Files in your working tree are not changed.
+
+Examples:
+  pgit filter --remove-path '*.pem'
+  pgit filter --replace-text secrets.txt --dry-run
+  pgit filter --remove-path dump.sql --remote origin`,
+		Args: cobra.NoArgs,
+		RunE: runFilter,
+	}
+
+	cmd.Flags().StringArray("remove-path", nil, "Remove every version of files matching this glob (repeatable)")
+	cmd.Flags().String("replace-text", "", "Replace text in every version using the rules in this file")
+	cmd.Flags().String("remote", "", "Rewrite a remote database (e.g. 'origin')")
+	cmd.Flags().BoolP("dry-run", "n", false, "Show what would change, then roll back")
+
+	return cmd
+}
+
+func runFilter(cmd *cobra.Command, args []string) error {
+	removePaths, _ := cmd.Flags().GetStringArray("remove-path")
+	rulesPath, _ := cmd.Flags().GetString("replace-text")
+	remoteName, _ := cmd.Flags().GetString("remote")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	if len(removePaths) == 0 && rulesPath == "" {
+		return util.NewError("Nothing to filter").
+			WithMessage("Give --remove-path, --replace-text or both").
+			WithSuggestion("pgit filter --remove-path '*.pem'")
+	}
+
+	var rules []byte
+	if rulesPath != "" {
+		data, err := os.ReadFile(rulesPath)
+		if err != nil {
+			return util.NewError("Cannot read rules file").WithMessage(err.Error())
+		}
+		rules = data
+	}
+	spec, err := filter.NewSpec(removePaths, rules)
+	if err != nil {
+		return util.NewError("Invalid filter").WithMessage(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	lock, err := r.DB.TryLockPush(ctx)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return util.NewError("Database is busy").
+			WithMessage("A push, gc or another filter is in progress").
+			WithSuggestion("Try again when it finishes")
+	}
+	defer lock.Unlock()
+
+	opts := db.FilterOptions{
+		RemovePath: spec.RemovesPath,
+		Rewrite:    db.Rewrite{ID: spec.ID(), Spec: spec.String(), At: time.Now().UTC()},
+		DryRun:     dryRun,
+	}
+	if spec.Rules != nil {
+		opts.ReplaceText = spec.ReplaceText
+	}
+
+	progress := ui.NewProgress("Rewriting delta groups", 0)
+	opts.OnProgress = func(done, total int) {
+		progress.SetTotal(total)
+		progress.Update(done)
+	}
+	start := time.Now()
+	result, err := r.DB.Filter(ctx, opts)
+	progress.Done()
+	if err != nil {
+		return util.NewError("Filter failed").
+			WithMessage(err.Error()).
+			WithCause("The transaction was rolled back; nothing was changed")
+	}
+
+	verb := "Rewrote"
+	if dryRun {
+		verb = "Would rewrite"
+	}
+	fmt.Printf("%s %d delta group(s): removed %d path(s), %d file ref(s) and %d content version(s), replaced text in %d version(s), updated %d tree hash(es)\n",
+		verb, result.GroupsRewritten, result.PathsRemoved, result.FileRefsRemoved,
+		result.VersionsRemoved, result.VersionsRewritten, result.TreesUpdated)
+	if dryRun {
+		fmt.Println()
+		fmt.Println(styles.MutedMsg("Dry run: nothing was changed."))
+		return nil
+	}
+
+	fmt.Printf("%s in %s (rewrite %s)\n", styles.Successf("Done"), time.Since(start).Round(time.Second), opts.Rewrite.ID)
+	fmt.Println()
+	if remoteName == "" {
+		fmt.Println(styles.MutedMsg("Apply the same filter to each remote before pushing:"))
+		fmt.Println(styles.MutedMsg("  pgit filter --remote <name> " + spec.String()))
+		fmt.Println(styles.MutedMsg("Files in your working tree were not changed."))
+	} else {
+		fmt.Println(styles.MutedMsg("Other clones of this remote have to clone again; their pushes are refused."))
+	}
+	return nil
+}
+
+// checkRewrites refuses a push between databases that have not applied
+// the same 'pgit filter' rewrites. A remote without commits adopts the
+// local rewrites.
+func checkRewrites(ctx context.Context, localDB, remoteDB *db.DB, remoteName, remoteHeadID string) error {
+	local, err := localDB.GetRewrites(ctx)
+	if err != nil {
+		return err
+	}
+	remote, err := remoteDB.GetRewrites(ctx)
+	if err != nil {
+		return err
+	}
+
+	if missing := db.MissingRewrites(local, remote); len(missing) > 0 {
+		return util.NewError("Push rejected (history was rewritten)").
+			WithMessage(fmt.Sprintf("'%s' was rewritten with 'pgit filter %s', and this repository still has the old history",
+				remoteName, missing[0].Spec)).
+			WithCause("Pushing could bring the removed data back").
+			WithSuggestions(
+				"pgit clone <url>  # Clone the rewritten history",
+				"pgit filter <same arguments>  # Or apply the same rewrite locally",
+			)
+	}
+
+	if missing := db.MissingRewrites(remote, local); len(missing) > 0 {
+		if remoteHeadID == "" {
+			return remoteDB.SetRewrites(ctx, local)
+		}
+		return util.NewError("Push rejected (history was rewritten)").
+			WithMessage(fmt.Sprintf("This repository was rewritten with 'pgit filter %s', but '%s' still has the old history",
+				missing[0].Spec, remoteName)).
+			WithSuggestion(fmt.Sprintf("pgit filter --remote %s <same arguments>  # Rewrite the remote too", remoteName))
+	}
+	return nil
+}
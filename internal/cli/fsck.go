@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newFsckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Verify the integrity of the repository database",
+		Long: `Check the repository database for missing, dangling and corrupt objects.
+
+By default, fsck checks the structure of the repository:
+  - every commit's parent, every ref and every file ref names an existing commit
+  - the commit graph agrees with the commits' parents
+  - every file ref has a path and a content row in the right content table
+  - every content row is used by at least one file ref
+  - every commit hash matches the commit and its parent's hash, so history
+    changed after it was written is caught
+
+With --full, it also reads every content version, checks that it hashes
+to the file ref's BLAKE3 content hash, and recomputes the tree hash of
+every commit. Content is read one delta group at a time, several groups
+in parallel.
+
+fsck exits with status 1 if it finds problems.
+
+Examples:
+  pgit fsck                      # Check the local database
+  pgit fsck --full               # Also verify content and tree hashes
+  pgit fsck --remote origin      # Check a remote database
+  pgit fsck --json               # Machine-readable report`,
+		Args: cobra.NoArgs,
+		RunE: runFsck,
+	}
+
+	cmd.Flags().String("remote", "", "Check a remote database (e.g. 'origin')")
+	cmd.Flags().Bool("full", false, "Verify content hashes and tree hashes (reads all content)")
+	cmd.Flags().Bool("json", false, "Output in JSON format")
+	cmd.Flags().IntP("workers", "w", 0, "Number of parallel workers (default from config, capped at CPU count)")
+
+	return cmd
+}
+
+func runFsck(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	full, _ := cmd.Flags().GetBool("full")
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	workers, _ := cmd.Flags().GetInt("workers")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	opts := db.FsckOptions{
+		Full:    full,
+		Workers: resolveWorkers(workers),
+	}
+
+	var progress *ui.Progress
+	if !jsonOutput {
+		progress = ui.NewProgress("Checking", 0)
+		opts.OnProgress = func(done, total int) {
+			progress.SetTotal(total)
+			progress.Update(done)
+		}
+	}
+	start := time.Now()
+	report, err := r.DB.Fsck(ctx, opts)
+	if progress != nil {
+		progress.Done()
+	}
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printFsckReport(report, full, time.Since(start))
+	}
+
+	if len(report.Problems) > 0 {
+		return util.NewError("Repository is inconsistent").
+			WithMessage(fmt.Sprintf("fsck found %d problem(s)", len(report.Problems)))
+	}
+	return nil
+}
+
+func printFsckReport(report *db.FsckReport, full bool, elapsed time.Duration) {
+	for _, p := range report.Problems {
+		var object string
+		switch {
+		case p.Ref != "":
+			object = "ref " + p.Ref
+		case p.GroupID != 0:
+			object = fmt.Sprintf("content %d/%d", p.GroupID, p.VersionID)
+		case p.PathID != 0:
+			object = fmt.Sprintf("path %d", p.PathID)
+		default:
+			object = "commit " + util.ShortID(p.CommitID)
+		}
+		if p.Path != "" {
+			object += " (" + p.Path
+			if p.CommitID != "" {
+				object += " @ " + util.ShortID(p.CommitID)
+			}
+			object += ")"
+		} else if p.PathID != 0 && p.CommitID != "" {
+			object += " @ " + util.ShortID(p.CommitID)
+		}
+		fmt.Printf("%s %s: %s\n", styles.Yellow(p.Kind), object, p.Detail)
+	}
+	if len(report.Problems) > 0 {
+		fmt.Println()
+	}
+
+	fmt.Printf("Checked %d commits, %d file refs, %d content versions in %d delta groups",
+		report.Commits, report.FileRefs, report.Versions, report.Groups)
+	fmt.Printf(" in %s\n", elapsed.Round(time.Millisecond))
+	if full {
+		fmt.Printf("Verified %d content hashes and %d tree hashes\n", report.HashesChecked, report.TreesChecked)
+	}
+
+	if len(report.Problems) == 0 {
+		fmt.Println(styles.Successf("No problems found"))
+	}
+}
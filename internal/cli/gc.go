@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newGCCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove unreachable commits and their content",
+		Long: `Delete commits that no ref can reach anymore, such as the old commits
+left behind by 'pgit push --force' or a diverged 'pgit pull', together
+with their file refs, paths and content versions, then VACUUM the
+affected tables.
+
+A commit is kept if a branch, tag, remote-tracking ref or HEAD reaches
+it, or if an unfinished push or pull still refers to it. pgit keeps no
+reflog, so instead unreachable commits committed within the grace period
+(--prune, default 2 weeks) are kept along with their history.
+
+Content is stored in delta chains, so removing a version rewrites the
+rest of its chain; gc runs in a single transaction and can take a while
+on large repositories.
+
+Examples:
+  pgit gc                        # Prune unreachable commits older than 2 weeks
+  pgit gc --dry-run              # Show what would be removed
+  pgit gc --prune=now            # Prune all unreachable commits
+  pgit gc --prune=3d --remote origin`,
+		Args: cobra.NoArgs,
+		RunE: runGC,
+	}
+
+	cmd.Flags().BoolP("dry-run", "n", false, "Show what would be removed")
+	cmd.Flags().String("prune", "2w", "Keep unreachable commits newer than this (e.g. 12h, 3d, 2w, now, never)")
+	cmd.Flags().String("remote", "", "Clean up a remote database (e.g. 'origin')")
+
+	return cmd
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	pruneFlag, _ := cmd.Flags().GetString("prune")
+	remoteName, _ := cmd.Flags().GetString("remote")
+
+	cutoff, err := parsePruneAge(pruneFlag, time.Now())
+	if err != nil {
+		return util.NewError("Invalid --prune value").
+			WithMessage(err.Error()).
+			WithSuggestion("pgit gc --prune=2w  # A duration (h, d, w), 'now' or 'never'")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if !dryRun {
+		// Pushes and other gc runs write to the chains being rewritten
+		lock, err := r.DB.TryLockPush(ctx)
+		if err != nil {
+			return err
+		}
+		if lock == nil {
+			return util.NewError("Database is busy").
+				WithMessage("A push or another gc is in progress").
+				WithSuggestion("pgit gc" + remoteFlag(remoteName) + "  # Try again when it finishes")
+		}
+		defer lock.Unlock()
+	}
+
+	spinner := ui.NewSpinner("Finding unreachable commits")
+	spinner.Start()
+	plan, err := r.DB.PlanGC(ctx, cutoff)
+	spinner.Stop()
+	if err != nil {
+		return err
+	}
+
+	if plan.Kept > 0 {
+		fmt.Println(styles.MutedMsg(fmt.Sprintf("Keeping %d unreachable commit(s) within the grace period (--prune=%s)",
+			plan.Kept, pruneFlag)))
+	}
+	if len(plan.Commits) == 0 {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+
+	summary := fmt.Sprintf("%d commit(s), %d file ref(s), %d path(s), %d content version(s)",
+		len(plan.Commits), plan.FileRefs, plan.Paths, plan.Versions)
+	if dryRun {
+		fmt.Println("Would remove " + summary + ":")
+		for _, id := range plan.Commits {
+			fmt.Printf("  %s\n", styles.Yellow(util.ShortID(id)))
+		}
+		fmt.Println()
+		fmt.Println(styles.MutedMsg("Dry run: nothing was changed."))
+		return nil
+	}
+
+	start := time.Now()
+	progress := ui.NewProgress("Rewriting delta chains", 0)
+	err = r.DB.GC(ctx, plan, func(done, total int) {
+		progress.SetTotal(total)
+		progress.Update(done)
+	})
+	progress.Done()
+	if err != nil {
+		return util.NewError("gc failed").
+			WithMessage(err.Error()).
+			WithCause("The transaction was rolled back; nothing was removed")
+	}
+
+	fmt.Printf("%s %s in %s\n", styles.Successf("Removed"), summary, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// parsePruneAge converts a --prune value to the cutoff time: commits
+// committed after it are kept. It accepts Go durations and the day (d) and
+// week (w) units, "now" (prune everything unreachable) and "never".
+func parsePruneAge(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "now":
+		return now, nil
+	case "never":
+		// Every commit is newer than the zero time
+		return time.Time{}, nil
+	}
+
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return time.Time{}, fmt.Errorf("invalid age %q", s)
+			}
+			return now.Add(-time.Duration(count) * unit), nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid age %q", s)
+	}
+	return now.Add(-d), nil
+}
@@ -3,8 +3,13 @@ package cli
 import (
 	"context"
 	"fmt"
+	"runtime"
+
+	"github.com/imgajeed76/pgit/v4/internal/config"
+	"github.com/imgajeed76/pgit/v4/internal/db"
 
 	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
 	"github.com/imgajeed76/pgit/v4/internal/util"
 )
 
@@ -50,7 +55,61 @@ func connectForCommand(ctx context.Context, remoteName string) (*repo.Repository
 			WithSuggestion(fmt.Sprintf("pgit push %s  # Push your repository first", remoteName))
 	}
 
+	if err := checkRemoteSchema(ctx, remoteDB, remoteName); err != nil {
+		remoteDB.Close()
+		return nil, err
+	}
+
 	// Swap DB to point at remote
 	r.DB = remoteDB
 	return r, nil
 }
+
+// checkRemoteSchema returns an error telling the user to run 'pgit migrate
+// --remote' when the remote's schema is out of date. A remote without a
+// schema passes; the caller decides what that means.
+func checkRemoteSchema(ctx context.Context, remoteDB *db.DB, remoteName string) error {
+	exists, err := remoteDB.SchemaExists(ctx)
+	if err != nil || !exists {
+		return err
+	}
+	return repo.SchemaError(remoteDB.CheckSchemaVersion(ctx), remoteName)
+}
+
+// resolveWorkers returns the number of parallel workers for import and
+// transfers: the flag value if positive, else the global config default
+// (import.workers), else 4.
+func resolveWorkers(workers int) int {
+	if workers <= 0 {
+		// Use global config default, or fall back to 4
+		if globalCfg, err := config.LoadGlobal(); err == nil && globalCfg.Import.Workers > 0 {
+			workers = globalCfg.Import.Workers
+		} else {
+			workers = 4
+		}
+	}
+	// Cap at number of available CPUs — more workers than cores just adds contention.
+	// The old cap of 16 was based on the default xpatch_insert_cache_slots, but that
+	// setting is configurable and exceeding it only degrades cache hits, not correctness.
+	if maxCPU := runtime.NumCPU(); workers > maxCPU {
+		workers = maxCPU
+	}
+	return workers
+}
+
+// fillFileChanges computes the line counts (pgit_file_changes) missing for
+// commitIDs, or for all commits when nil. A progress bar appears only when
+// there is something to compute.
+func fillFileChanges(ctx context.Context, database *db.DB, commitIDs []string) error {
+	var progress *ui.Progress
+	_, err := database.FillFileChanges(ctx, commitIDs, func(done, total int) {
+		if progress == nil {
+			progress = ui.NewProgress("Line counts", total)
+		}
+		progress.Update(done)
+	})
+	if progress != nil {
+		progress.Done()
+	}
+	return err
+}
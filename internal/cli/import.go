@@ -8,7 +8,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,7 +17,6 @@ import (
 
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/imgajeed76/pgit/v4/internal/config"
 	"github.com/imgajeed76/pgit/v4/internal/db"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
 	"github.com/imgajeed76/pgit/v4/internal/ui"
@@ -30,20 +28,34 @@ import (
 
 func newImportCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "import [git-repo-path]",
+		Use:   "import [git-repo-path | file://url]",
 		Short: "Import a git repository into pgit",
 		Long: `Import an existing git repository into pgit.
 
 This command extracts the commit history and file contents from a git
 repository and stores them in the pgit database with delta compression.
+The source can be a working tree, a bare repository, or a file:// URL
+(mirror-cloned into a temporary directory under .pgit for the import).
 
 By default, imports the current branch. Use --branch to specify a different
 branch, or an interactive picker will be shown if multiple branches exist.
 
+Use --all, --branches <glob>, or --tags to import several refs at once.
+Shared history is stored once, and every branch and tag becomes a pgit ref
+(refs/heads/<name>, refs/tags/<name>) usable wherever a commit is expected.
+HEAD points at --branch, or the current branch if it was selected.
+
 The import uses git fast-export for correct handling of merges, renames,
 and full commit messages. A parallel worker pool imports blob content
 with progress visualization.
 
+Use --update to append only the commits added to the git branch since the
+last import, e.g. to keep an analytics database in sync from a daily job.
+
+Use --stdin (or --fastexport -) to read a fast-export stream from a pipe,
+e.g. from hg-fast-export or git fast-export on another host. No local git
+repository is needed; every branch and tag in the stream becomes a ref.
+
 The current directory must be a pgit repository (run 'pgit init' first).`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: runImport,
@@ -55,7 +67,12 @@ The current directory must be a pgit repository (run 'pgit init' first).`,
 	cmd.Flags().StringP("branch", "b", "", "Branch to import (default: current branch, or interactive picker)")
 	cmd.Flags().String("remote", "", "Import directly into a remote database (e.g. 'origin'), skipping local container")
 	cmd.Flags().Bool("resume", false, "Resume a previously interrupted import")
-	cmd.Flags().String("fastexport", "", "Use a pre-generated git fast-export file instead of re-exporting")
+	cmd.Flags().BoolP("update", "u", false, "Import only git commits added since the last import")
+	cmd.Flags().Bool("all", false, "Import all branches and tags")
+	cmd.Flags().StringSlice("branches", nil, "Import branches matching a glob (repeatable, e.g. 'release/*')")
+	cmd.Flags().Bool("tags", false, "Also import all tags")
+	cmd.Flags().String("fastexport", "", "Use a pre-generated git fast-export file instead of re-exporting ('-' for stdin)")
+	cmd.Flags().Bool("stdin", false, "Read a fast-export stream from standard input (no git repository needed)")
 	cmd.Flags().Duration("timeout", 24*time.Hour, "Maximum time for the import operation (e.g. 2h, 30m, 48h)")
 
 	return cmd
@@ -85,10 +102,11 @@ type commitEntry struct {
 	CommitterEmail     string
 	CommitterTimestamp int64
 	CommitterTZ        string
-	MessageOffset      int64 // byte offset of message in temp file
-	MessageSize        int   // message byte count
-	FromMark           int   // parent commit mark (0 = root commit)
-	MergeMark          int   // merge parent mark (0 = not a merge, only first merge tracked)
+	MessageOffset      int64  // byte offset of message in temp file
+	MessageSize        int    // message byte count
+	FromMark           int    // parent commit mark (0 = root commit)
+	FromSHA            string // parent git SHA when it lies outside the exported range (--update)
+	MergeMark          int    // merge parent mark (0 = not a merge, only first merge tracked)
 	FileOps            []fileOp
 }
 
@@ -119,46 +137,72 @@ func runImport(cmd *cobra.Command, args []string) error {
 		return util.NotARepoError()
 	}
 
-	// Determine git repo path
-	gitPath := "."
-	if len(args) > 0 {
-		gitPath = args[0]
+	fastExportPath, _ := cmd.Flags().GetString("fastexport")
+	fromStdin, _ := cmd.Flags().GetBool("stdin")
+	if fastExportPath == "-" {
+		fromStdin = true
+		fastExportPath = ""
 	}
 
-	gitPath, err = filepath.Abs(gitPath)
-	if err != nil {
-		return err
+	// Determine git source: a working tree, a bare repository, or a
+	// file:// URL (not needed when the stream comes from stdin or a file)
+	source := "."
+	if len(args) > 0 {
+		source = args[0]
 	}
+	gitPath := source
 
-	// Check if it's a git repo
-	gitDir := filepath.Join(gitPath, ".git")
-	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-		return util.NewError("Not a git repository").
-			WithContext(fmt.Sprintf("No .git directory found in '%s'", gitPath)).
-			WithSuggestion("pgit import /path/to/git/repo")
+	if fromStdin {
+		if len(args) > 0 {
+			return util.NewError("Conflicting arguments").
+				WithMessage("--stdin reads the fast-export stream from standard input; no repository path is used").
+				WithSuggestion("hg-fast-export ... | pgit import --stdin")
+		}
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			return util.NewError("No fast-export stream on stdin").
+				WithMessage("--stdin expects a fast-export stream piped into pgit").
+				WithSuggestion("git fast-export --reencode=yes --show-original-ids --all | pgit import --stdin")
+		}
 	}
 
 	// Get flags
 	workers, _ := cmd.Flags().GetInt("workers")
-	if workers <= 0 {
-		// Use global config default, or fall back to 4
-		if globalCfg, err := config.LoadGlobal(); err == nil && globalCfg.Import.Workers > 0 {
-			workers = globalCfg.Import.Workers
-		} else {
-			workers = 4
-		}
-	}
-	// Cap at number of available CPUs — more workers than cores just adds contention.
-	// The old cap of 16 was based on the default xpatch_insert_cache_slots, but that
-	// setting is configurable and exceeding it only degrades cache hits, not correctness.
-	if maxCPU := runtime.NumCPU(); workers > maxCPU {
-		workers = maxCPU
-	}
+	workers = resolveWorkers(workers)
 
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 	force, _ := cmd.Flags().GetBool("force")
 	resume, _ := cmd.Flags().GetBool("resume")
-	fastExportPath, _ := cmd.Flags().GetString("fastexport")
+	update, _ := cmd.Flags().GetBool("update")
+
+	if update && (force || resume || fastExportPath != "" || fromStdin) {
+		return util.NewError("Conflicting flags").
+			WithMessage("--update cannot be combined with --force, --resume, --fastexport, or --stdin").
+			WithSuggestion("pgit import --update /path/to/git/repo")
+	}
+	if update && (cmd.Flags().Changed("all") || cmd.Flags().Changed("branches") || cmd.Flags().Changed("tags")) {
+		return util.NewError("Conflicting flags").
+			WithMessage("--update follows the branch HEAD was imported from; it cannot be combined with --all, --branches, or --tags").
+			WithSuggestion("pgit import --update /path/to/git/repo")
+	}
+	if (fromStdin || fastExportPath != "") && (cmd.Flags().Changed("all") || cmd.Flags().Changed("branches") || cmd.Flags().Changed("tags")) {
+		return util.NewError("Conflicting flags").
+			WithMessage("With --stdin or --fastexport the stream decides which refs are imported; --all, --branches, and --tags do not apply").
+			WithSuggestion("git fast-export --reencode=yes --show-original-ids --all | pgit import --stdin")
+	}
+
+	// A pre-generated stream replaces the export, so the source is never
+	// read (and a file:// URL never cloned)
+	if !fromStdin && fastExportPath == "" {
+		var cleanup func()
+		gitPath, cleanup, err = openGitSource(source, util.PgitPath(r.Root))
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		if !strings.HasPrefix(source, "file://") {
+			source = gitPath // show the absolute path
+		}
+	}
 
 	remoteName, _ := cmd.Flags().GetString("remote")
 	isRemote := remoteName != ""
@@ -198,12 +242,23 @@ func runImport(cmd *cobra.Command, args []string) error {
 				return err
 			}
 		}
+		// --force recreates an out-of-date schema below
+		if !force {
+			if err := checkRemoteSchema(ctx, remoteDB, remoteName); err != nil {
+				return err
+			}
+		}
 	} else {
 		// Local mode (existing behavior)
 		if err := r.StartContainer(); err != nil {
 			return err
 		}
-		if err := r.Connect(ctx); err != nil {
+		connect := r.Connect
+		if force {
+			// --force recreates an out-of-date schema below
+			connect = r.ConnectAnySchema
+		}
+		if err := connect(ctx); err != nil {
 			return err
 		}
 		defer r.Close()
@@ -215,13 +270,24 @@ func runImport(cmd *cobra.Command, args []string) error {
 	}
 	defer func() { _ = r.DB.ResetImportGUCs(ctx) }()
 
-	fmt.Printf("Importing from: %s\n", styles.Cyan(gitPath))
+	if fromStdin {
+		fmt.Printf("Importing from: %s\n", styles.Cyan("stdin"))
+	} else if fastExportPath != "" {
+		fmt.Printf("Importing from: %s\n", styles.Cyan(fastExportPath))
+	} else {
+		fmt.Printf("Importing from: %s\n", styles.Cyan(source))
+	}
 	fmt.Printf("Workers: %d\n", workers)
 
 	if dryRun {
 		fmt.Println(styles.Yellow("Dry run mode - no changes will be made"))
 	}
 
+	if update {
+		branchFlag, _ := cmd.Flags().GetString("branch")
+		return runImportUpdate(ctx, r, gitPath, branchFlag, workers, dryRun, remoteName)
+	}
+
 	// Check if database already has commits and determine resume state
 	var existingCommits int
 	_ = r.DB.QueryRow(ctx, "SELECT COUNT(*) FROM pgit_commits").Scan(&existingCommits)
@@ -282,13 +348,34 @@ func runImport(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Determine branch
+	// Determine branch (or the set of refs for --all/--branches/--tags)
 	branchFlag, _ := cmd.Flags().GetString("branch")
-	selectedBranch, err := selectBranch(gitPath, branchFlag)
-	if err != nil {
-		return err
+	importAll, _ := cmd.Flags().GetBool("all")
+	branchGlobs, _ := cmd.Flags().GetStringSlice("branches")
+	importTags, _ := cmd.Flags().GetBool("tags")
+
+	var selectedBranch, primaryRef string
+	exportArgs := []string{}
+	if fromStdin || fastExportPath != "" {
+		// Refs come from the stream itself; HEAD is chosen after indexing
+	} else if importAll || len(branchGlobs) > 0 || importTags {
+		var refs []string
+		refs, primaryRef, err = selectImportRefs(gitPath, branchFlag, importAll, branchGlobs, importTags)
+		if err != nil {
+			return err
+		}
+		selectedBranch = strings.TrimPrefix(pgitRefName(primaryRef), "refs/heads/")
+		// Signed tags would abort fast-export; the signature is not kept anyway
+		exportArgs = append([]string{"--signed-tags=strip"}, refs...)
+		fmt.Printf("Refs: %s (HEAD: %s)\n", ui.FormatCount(len(refs)), styles.Branch(selectedBranch))
+	} else {
+		selectedBranch, err = selectBranch(gitPath, branchFlag)
+		if err != nil {
+			return err
+		}
+		exportArgs = append(exportArgs, selectedBranch)
+		fmt.Printf("Branch: %s\n", styles.Branch(selectedBranch))
 	}
-	fmt.Printf("Branch: %s\n", styles.Branch(selectedBranch))
 
 	// ═══════════════════════════════════════════════════════════════════════
 	// Step 1: Export to temp file via git fast-export (or use provided file)
@@ -297,7 +384,9 @@ func runImport(cmd *cobra.Command, args []string) error {
 	var tmpPath string
 	ownsTmpFile := false // whether we should clean up the temp file
 
-	if fastExportPath != "" {
+	if fromStdin {
+		// Spooled while indexing in step 2
+	} else if fastExportPath != "" {
 		// Use pre-generated fast-export file
 		info, err := os.Stat(fastExportPath)
 		if err != nil {
@@ -312,7 +401,7 @@ func runImport(cmd *cobra.Command, args []string) error {
 		spinner.Start()
 
 		var exportSize int64
-		tmpPath, exportSize, err = exportToFile(gitPath, selectedBranch, util.PgitPath(r.Root))
+		tmpPath, exportSize, err = exportToFile(gitPath, util.PgitPath(r.Root), exportArgs...)
 		spinner.Stop()
 
 		if err != nil {
@@ -330,7 +419,7 @@ func runImport(cmd *cobra.Command, args []string) error {
 					}
 					return util.NewError(fmt.Sprintf("Branch '%s' not found", selectedBranch)).
 						WithMessage(fmt.Sprintf("Available branches: %s", strings.Join(branchNames, ", "))).
-						WithSuggestion(fmt.Sprintf("pgit import %s --branch %s", gitPath, branchNames[0]))
+						WithSuggestion(fmt.Sprintf("pgit import %s --branch %s", source, branchNames[0]))
 				}
 			}
 			return fmt.Errorf("failed to export git history: %w", err)
@@ -348,14 +437,37 @@ func runImport(cmd *cobra.Command, args []string) error {
 	// Step 2: Index the fast-export stream (single pass)
 	// ═══════════════════════════════════════════════════════════════════════
 
-	idxSpinner := ui.NewSpinner("Indexing fast-export stream")
-	idxSpinner.Start()
+	var commitEntries []commitEntry
+	var blobIndex map[int]*blobEntry
+	var refTips map[string]int
 
-	commitEntries, blobIndex, err := indexFastExport(tmpPath)
-	idxSpinner.Stop()
+	if fromStdin {
+		idxSpinner := ui.NewSpinner("Reading fast-export stream from stdin")
+		idxSpinner.Start()
 
-	if err != nil {
-		return fmt.Errorf("failed to index fast-export: %w", err)
+		var spoolSize int64
+		commitEntries, blobIndex, refTips, tmpPath, spoolSize, err = spoolFastExport(os.Stdin, util.PgitPath(r.Root))
+		idxSpinner.Stop()
+
+		// The spool holds only data payloads, not a replayable stream, so
+		// it is never kept around for --fastexport reuse.
+		if tmpPath != "" {
+			defer os.Remove(tmpPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read fast-export stream: %w", err)
+		}
+		fmt.Printf("Spooled %s of file content and messages\n", formatBytes(spoolSize))
+	} else {
+		idxSpinner := ui.NewSpinner("Indexing fast-export stream")
+		idxSpinner.Start()
+
+		commitEntries, blobIndex, refTips, err = indexFastExport(tmpPath)
+		idxSpinner.Stop()
+
+		if err != nil {
+			return fmt.Errorf("failed to index fast-export: %w", err)
+		}
 	}
 
 	// Count total file ops
@@ -374,14 +486,28 @@ func runImport(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	if fromStdin || fastExportPath != "" {
+		primaryRef, err = streamPrimaryRef(refTips, commitEntries, branchFlag)
+		if err != nil {
+			return err
+		}
+		selectedBranch = strings.TrimPrefix(pgitRefName(primaryRef), "refs/heads/")
+		if selectedBranch != "" {
+			fmt.Printf("Branch: %s\n", styles.Branch(selectedBranch))
+		}
+	}
+
 	if dryRun {
 		fmt.Println("\nDry run complete.")
 		return nil
 	}
 
-	// Clear existing data if --force
-	if existingCommits > 0 && force {
+	// Clear existing data if --force (or an old schema, which only --force
+	// gets this far with)
+	if force && (existingCommits > 0 || r.DB.CheckSchemaVersion(ctx) != nil) {
 		fmt.Println("\nClearing existing data...")
+		// Recreate the tables with the storage backend they had
+		r.DB.UseBackend(r.DB.Backend(ctx))
 		if err := r.DB.DropSchema(ctx); err != nil {
 			return fmt.Errorf("failed to clear database: %w", err)
 		}
@@ -402,7 +528,7 @@ func runImport(cmd *cobra.Command, args []string) error {
 	}
 	defer tmpFile.Close()
 
-	pgitCommits, markToULID, pathOps := prepareCommits(commitEntries, blobIndex, tmpFile)
+	pgitCommits, markToULID, pathOps := prepareCommits(commitEntries, blobIndex, tmpFile, 0, nil)
 
 	// ═══════════════════════════════════════════════════════════════════════
 	// Step 3b + 4: Resume-aware commit handling
@@ -482,6 +608,19 @@ func runImport(cmd *cobra.Command, args []string) error {
 
 		// Insert remaining commits if any
 		if remaining > 0 {
+			fmt.Println("\nHashing trees...")
+			blobHashes, err := hashBlobs(tmpFile, blobIndex, workers)
+			if err != nil {
+				return err
+			}
+			stored, err := r.DB.CommitHashes(ctx, dbCommitIDs)
+			if err != nil {
+				return fmt.Errorf("failed to read existing commits for resume: %w", err)
+			}
+			if err := hashCommits(ctx, nil, pgitCommits, commitEntries, markToULID, blobHashes, stored); err != nil {
+				return err
+			}
+
 			fmt.Println("\nImporting remaining commits...")
 
 			remainingCommits := pgitCommits[alreadyInserted:]
@@ -511,6 +650,15 @@ func runImport(cmd *cobra.Command, args []string) error {
 		_ = r.DB.SetMetadata(ctx, "import_branch", selectedBranch)
 		_ = r.DB.SetMetadata(ctx, "import_expected_commits", fmt.Sprintf("%d", len(pgitCommits)))
 
+		fmt.Println("\nHashing trees...")
+		blobHashes, err := hashBlobs(tmpFile, blobIndex, workers)
+		if err != nil {
+			return err
+		}
+		if err := hashCommits(ctx, nil, pgitCommits, commitEntries, markToULID, blobHashes, nil); err != nil {
+			return err
+		}
+
 		fmt.Println("\nImporting commits...")
 
 		batchSize := 1000
@@ -535,14 +683,36 @@ func runImport(cmd *cobra.Command, args []string) error {
 		_ = r.DB.SetMetadata(ctx, "import_state", "commits_done")
 	}
 
+	// Record git commit SHA → pgit ULID so git hashes can be used as refs.
+	// Idempotent (ON CONFLICT DO NOTHING), so resumed imports just fill gaps.
+	commitMappings := make([]db.GitMapping, 0, len(commitEntries))
+	for _, ce := range commitEntries {
+		if ce.OriginalID == "" {
+			continue
+		}
+		ulid := markToULID[ce.Mark]
+		commitMappings = append(commitMappings, db.GitMapping{
+			GitSHA:   ce.OriginalID,
+			Kind:     db.GitObjectCommit,
+			CommitID: &ulid,
+		})
+	}
+	if err := r.DB.CreateGitMappings(ctx, commitMappings); err != nil {
+		return fmt.Errorf("failed to record git commit SHAs: %w", err)
+	}
+
 	// ═══════════════════════════════════════════════════════════════════════
 	// Step 4b: Build and insert commit graph with binary lifting
 	// ═══════════════════════════════════════════════════════════════════════
 
+	// The entries are kept for the blob phase, where line counts are taken
+	// against the version in each commit's parent tree
+	graphEntries := buildCommitGraph(pgitCommits)
+	ancestry := newCommitAncestry(graphEntries)
+
 	graphState, _ := r.DB.GetMetadata(ctx, "import_graph_state")
 	if graphState != "done" {
 		fmt.Println("\nBuilding commit graph...")
-		graphEntries := buildCommitGraph(pgitCommits)
 		fmt.Printf("  %s entries, max depth %d\n",
 			ui.FormatCount(len(graphEntries)),
 			graphEntries[len(graphEntries)-1].Depth)
@@ -570,8 +740,21 @@ func runImport(cmd *cobra.Command, args []string) error {
 
 	// Save HEAD commit info before releasing pgitCommits.
 	// Only the ID and message are needed for SetHead + final output.
-	headCommitID := pgitCommits[len(pgitCommits)-1].ID
-	headCommitMsg := pgitCommits[len(pgitCommits)-1].Message
+	// With several refs the stream's last commit is not necessarily the
+	// primary branch tip, so look it up by mark.
+	headIdx := len(pgitCommits) - 1
+	if mark, ok := refTips[primaryRef]; ok {
+		for i := range commitEntries {
+			if commitEntries[i].Mark == mark {
+				headIdx = i
+				break
+			}
+		}
+	}
+	headCommitID := pgitCommits[headIdx].ID
+	headCommitMsg := pgitCommits[headIdx].Message
+	headGitSHA := commitEntries[headIdx].OriginalID
+	refsToSet := importedRefs(refTips, markToULID)
 
 	// Free commit objects — messages and struct overhead no longer needed.
 	// At Linux kernel scale this releases ~4-8GB of message strings.
@@ -653,7 +836,7 @@ func runImport(cmd *cobra.Command, args []string) error {
 			fmt.Println(" done")
 		}
 
-		err = importBlobsParallel(ctx, r.DB, tmpPath, pathOps, blobIndex, markToULID, workers, resumeFromBlobs, pathToLocalGroup, commitTimestamps)
+		err = importBlobsParallel(ctx, r.DB, tmpPath, pathOps, blobIndex, markToULID, workers, resumeFromBlobs, pathToLocalGroup, nil, commitTimestamps, ancestry)
 		if err != nil {
 			// Still try to recreate indexes even on error
 			fmt.Print("\nRebuilding indexes...")
@@ -675,9 +858,18 @@ func runImport(cmd *cobra.Command, args []string) error {
 	}
 
 	// ═══════════════════════════════════════════════════════════════════════
-	// Step 6: Set HEAD
+	// Step 6: Set branch/tag refs and HEAD
 	// ═══════════════════════════════════════════════════════════════════════
 
+	for name, commitID := range refsToSet {
+		if err := r.DB.SetRef(ctx, name, commitID); err != nil {
+			return fmt.Errorf("failed to set ref %s: %w", name, err)
+		}
+	}
+	if len(refsToSet) > 1 {
+		fmt.Printf("Created %s refs\n", ui.FormatCount(len(refsToSet)))
+	}
+
 	if err := r.DB.SetHead(ctx, headCommitID); err != nil {
 		return fmt.Errorf("failed to set HEAD: %w", err)
 	}
@@ -711,9 +903,19 @@ func runImport(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Mark import as complete
+	// Mark import as complete. import_git_head is where --update picks up.
+	if headGitSHA != "" {
+		_ = r.DB.SetMetadata(ctx, "import_git_head", headGitSHA)
+	}
 	_ = r.DB.SetMetadata(ctx, "import_state", "complete")
 
+	// Author identity normalization from .mailmap (and .pgit/mailmap)
+	if n, err := syncMailmap(ctx, r); err != nil {
+		fmt.Printf("Warning: failed to load mailmap: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Stored %s mailmap rules\n", ui.FormatCount(n))
+	}
+
 	// Clean up temp file on success (preserved on crash for --fastexport reuse)
 	if ownsTmpFile {
 		os.Remove(tmpPath)
@@ -736,15 +938,414 @@ func runImport(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// ═══════════════════════════════════════════════════════════════════════════
+// Incremental import (--update)
+// ═══════════════════════════════════════════════════════════════════════════
+
+// runImportUpdate appends the git commits added since the last import.
+// It exports only <last>..<branch> with --reference-excluded-parents, so the
+// first new commit names its already-imported parent by SHA, then appends
+// commits, graph entries, and blobs after the existing data.
+func runImportUpdate(ctx context.Context, r *repo.Repository, gitPath, branchFlag string, workers int, dryRun bool, remoteName string) error {
+	isRemote := remoteName != ""
+
+	importState, _ := r.DB.GetMetadata(ctx, "import_state")
+	switch importState {
+	case "complete":
+		// ok
+	case "updating":
+		return util.NewError("Interrupted update detected").
+			WithMessage("A previous 'pgit import --update' did not finish; the database holds a partial update").
+			WithSuggestion("pgit import --force  # Wipe and re-import from scratch")
+	case "":
+		return util.NewError("Nothing to update").
+			WithMessage("This database has no completed git import").
+			WithSuggestion("pgit import /path/to/git/repo")
+	default:
+		return util.NewError("Import not finished").
+			WithMessage("The initial import has not completed yet").
+			WithSuggestion("pgit import --resume  # Finish the initial import first")
+	}
+
+	// Find the last imported git commit
+	lastSHA, _ := r.DB.GetMetadata(ctx, "import_git_head")
+	headID, err := r.DB.GetHead(ctx)
+	if err != nil {
+		return err
+	}
+	if lastSHA == "" && headID != "" {
+		lastSHA, _ = r.DB.GetGitSHA(ctx, headID)
+	}
+	if lastSHA == "" {
+		return util.NewError("No git commit recorded for the last import").
+			WithMessage("The database was imported before pgit recorded git SHAs").
+			WithSuggestion("pgit import --force  # Re-import once; --update works from then on")
+	}
+	lastID, err := r.DB.FindCommitByGitSHA(ctx, lastSHA)
+	if err != nil {
+		return err
+	}
+	if lastID == "" || lastID != headID {
+		return util.NewError("HEAD has moved since the last import").
+			WithMessage(fmt.Sprintf("HEAD is no longer the imported git commit %s", lastSHA[:min(12, len(lastSHA))])).
+			WithCauses("Commits were made with 'pgit commit' or pulled from a remote after importing").
+			WithSuggestion("pgit import --force  # Re-import from the git repository")
+	}
+
+	// Determine branch: explicit flag, else the branch of the original import
+	branch := branchFlag
+	if branch == "" {
+		branch, _ = r.DB.GetMetadata(ctx, "import_branch")
+	}
+	if branch == "" {
+		branch, err = selectBranch(gitPath, "")
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Branch: %s\n", styles.Branch(branch))
+
+	tipSHA, err := gitRevParse(gitPath, branch)
+	if err != nil {
+		return util.NewError(fmt.Sprintf("Branch '%s' not found", branch)).
+			WithMessage(err.Error()).
+			WithSuggestion("pgit import --update --branch <branch>")
+	}
+	if tipSHA == lastSHA {
+		fmt.Println("Already up to date.")
+		return nil
+	}
+	if err := exec.Command("git", "-C", gitPath, "merge-base", "--is-ancestor", lastSHA, tipSHA).Run(); err != nil {
+		return util.NewError("Git history was rewritten").
+			WithMessage(fmt.Sprintf("The last imported commit %s is not an ancestor of '%s'", lastSHA[:min(12, len(lastSHA))], branch)).
+			WithCauses("The branch was rebased or force-pushed", "A different branch was selected").
+			WithSuggestion("pgit import --force  # Re-import from scratch")
+	}
+
+	// Export only the new commits
+	spinner := ui.NewSpinner("Exporting new git commits")
+	spinner.Start()
+	tmpPath, exportSize, err := exportToFile(gitPath, util.PgitPath(r.Root),
+		"--reference-excluded-parents", lastSHA+".."+branch)
+	spinner.Stop()
+	if tmpPath != "" {
+		defer os.Remove(tmpPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export git history: %w", err)
+	}
+	fmt.Printf("Exported %s fast-export stream\n", formatBytes(exportSize))
+
+	commitEntries, blobIndex, refTips, err := indexFastExport(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to index fast-export: %w", err)
+	}
+
+	totalFileOps := 0
+	var parentSHAs []string
+	for _, ce := range commitEntries {
+		totalFileOps += len(ce.FileOps)
+		if ce.FromSHA != "" {
+			parentSHAs = append(parentSHAs, ce.FromSHA)
+		}
+	}
+	fmt.Printf("Found %s new commits, %s file changes, %s blobs\n",
+		ui.FormatCount(len(commitEntries)),
+		ui.FormatCount(totalFileOps),
+		ui.FormatCount(len(blobIndex)))
+
+	if len(commitEntries) == 0 {
+		fmt.Println("Already up to date.")
+		return nil
+	}
+	if dryRun {
+		fmt.Println("\nDry run complete.")
+		return nil
+	}
+
+	// Local working tree is rewritten at the end — refuse to clobber edits
+	if !isRemote {
+		changes, err := r.GetWorkingTreeChanges(ctx)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			return util.NewError("You have uncommitted changes").
+				WithMessage("--update checks out the new HEAD, which would overwrite them").
+				WithSuggestion("pgit checkout -f HEAD  # Discard local changes, then retry")
+		}
+	}
+
+	// Parents outside the exported range must already be imported
+	externalParents, err := r.DB.GetCommitIDsByGitSHA(ctx, parentSHAs)
+	if err != nil {
+		return fmt.Errorf("failed to resolve parent commits: %w", err)
+	}
+	for _, sha := range parentSHAs {
+		if _, ok := externalParents[sha]; !ok {
+			return util.NewError("Parent commit not imported").
+				WithMessage(fmt.Sprintf("New commits build on git commit %s, which is not in this database", sha[:min(12, len(sha))])).
+				WithCauses("The branch merged history that was never imported").
+				WithSuggestion("pgit import --force  # Re-import from scratch")
+		}
+	}
+
+	var commitSeqBase, graphSeqBase int
+	if err := r.DB.QueryRow(ctx, "SELECT COALESCE(MAX(seq), 0) FROM pgit_commits").Scan(&commitSeqBase); err != nil {
+		return fmt.Errorf("failed to read commit seq: %w", err)
+	}
+	if err := r.DB.QueryRow(ctx, "SELECT COALESCE(MAX(seq), 0) FROM pgit_commit_graph").Scan(&graphSeqBase); err != nil {
+		return fmt.Errorf("failed to read commit graph seq: %w", err)
+	}
+
+	tmpFile, err := os.Open(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to reopen temp file: %w", err)
+	}
+	defer tmpFile.Close()
+
+	pgitCommits, markToULID, pathOps := prepareCommits(commitEntries, blobIndex, tmpFile, commitSeqBase, externalParents)
+
+	fmt.Println("\nHashing trees...")
+	blobHashes, err := hashBlobs(tmpFile, blobIndex, workers)
+	if err != nil {
+		return err
+	}
+	parentIDs := make([]string, 0, len(externalParents))
+	for _, id := range externalParents {
+		parentIDs = append(parentIDs, id)
+	}
+	parentHashes, err := r.DB.CommitHashes(ctx, parentIDs)
+	if err != nil {
+		return fmt.Errorf("failed to resolve parent commits: %w", err)
+	}
+	if err := hashCommits(ctx, r.DB, pgitCommits, commitEntries, markToULID, blobHashes, parentHashes); err != nil {
+		return err
+	}
+
+	// From here on the database holds a partial update until we finish
+	_ = r.DB.SetMetadata(ctx, "import_state", "updating")
+
+	fmt.Println("\nImporting commits...")
+	batchSize := 1000
+	commitProgress := ui.NewProgress("Commits", len(pgitCommits))
+	for i := 0; i < len(pgitCommits); i += batchSize {
+		end := min(i+batchSize, len(pgitCommits))
+		if err := r.DB.CreateCommitsBatch(ctx, pgitCommits[i:end]); err != nil {
+			fmt.Println()
+			return fmt.Errorf("failed to insert commits batch: %w", err)
+		}
+		commitProgress.Update(end)
+	}
+	commitProgress.Done()
+
+	commitMappings := make([]db.GitMapping, 0, len(commitEntries))
+	for _, ce := range commitEntries {
+		if ce.OriginalID == "" {
+			continue
+		}
+		ulid := markToULID[ce.Mark]
+		commitMappings = append(commitMappings, db.GitMapping{
+			GitSHA:   ce.OriginalID,
+			Kind:     db.GitObjectCommit,
+			CommitID: &ulid,
+		})
+	}
+	if err := r.DB.CreateGitMappings(ctx, commitMappings); err != nil {
+		return fmt.Errorf("failed to record git commit SHAs: %w", err)
+	}
+
+	graphEntries, err := extendCommitGraph(ctx, r.DB, pgitCommits, int32(graphSeqBase))
+	if err != nil {
+		return fmt.Errorf("failed to build commit graph: %w", err)
+	}
+	if err := r.DB.CreateCommitGraphBatch(ctx, graphEntries); err != nil {
+		return fmt.Errorf("failed to insert commit graph: %w", err)
+	}
+
+	// Path groups: union-find over the new ops, then pin each local group to
+	// the existing delta group of any blob it shares with earlier history.
+	pathToLocalGroup, groupCount := computePathGroups(pathOps, blobIndex)
+	knownGroups, err := knownPathGroups(ctx, r.DB, pathOps, blobIndex, pathToLocalGroup)
+	if err != nil {
+		return fmt.Errorf("failed to look up existing path groups: %w", err)
+	}
+
+	commitTimestamps := make(map[string]int64, len(commitEntries))
+	for _, ce := range commitEntries {
+		commitTimestamps[markToULID[ce.Mark]] = ce.AuthorTimestamp
+	}
+
+	fmt.Printf("\nImporting %s file versions across %s paths (%s groups)...\n",
+		ui.FormatCount(totalFileOps), ui.FormatCount(len(pathOps)), ui.FormatCount(groupCount))
+
+	// Indexes stay in place: an update is small relative to the existing
+	// tables, so rebuilding them would cost far more than it saves.
+	if totalFileOps > 0 {
+		if err := importBlobsParallel(ctx, r.DB, tmpPath, pathOps, blobIndex, markToULID, workers, true, pathToLocalGroup, knownGroups, commitTimestamps, newCommitAncestry(graphEntries)); err != nil {
+			return err
+		}
+	}
+
+	for name, commitID := range importedRefs(refTips, markToULID) {
+		if err := r.DB.SetRef(ctx, name, commitID); err != nil {
+			return fmt.Errorf("failed to set ref %s: %w", name, err)
+		}
+	}
+
+	newHead := pgitCommits[len(pgitCommits)-1]
+	if isRemote {
+		if err := r.DB.SetHead(ctx, newHead.ID); err != nil {
+			return fmt.Errorf("failed to set HEAD: %w", err)
+		}
+	} else {
+		// Writes the new tree, removes files deleted upstream, and moves HEAD
+		fmt.Println("\nChecking out files...")
+		if err := checkoutFull(ctx, r, newHead.ID, true); err != nil {
+			return fmt.Errorf("failed to check out new HEAD: %w", err)
+		}
+	}
+
+	_ = r.DB.SetMetadata(ctx, "import_git_head", commitEntries[len(commitEntries)-1].OriginalID)
+	_ = r.DB.SetMetadata(ctx, "import_branch", branch)
+	_ = r.DB.SetMetadata(ctx, "import_state", "complete")
+
+	// Author identity normalization from .mailmap (and .pgit/mailmap)
+	if n, err := syncMailmap(ctx, r); err != nil {
+		fmt.Printf("Warning: failed to load mailmap: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Stored %s mailmap rules\n", ui.FormatCount(n))
+	}
+
+	fmt.Printf("\n%s Imported %s new commits: %s %s\n",
+		styles.Green("Success!"),
+		ui.FormatCount(len(pgitCommits)),
+		styles.Hash(newHead.ID, true),
+		firstLine(newHead.Message))
+
+	return nil
+}
+
+// knownPathGroups maps local groups to the database group_id already holding
+// one of their blobs, so content shared with earlier history (renames, copies,
+// reverts) keeps delta-compressing against the existing chain.
+func knownPathGroups(
+	ctx context.Context,
+	database *db.DB,
+	pathOpsMap map[string][]pathOp,
+	blobIndex map[int]*blobEntry,
+	pathToLocalGroup map[string]int,
+) (map[int]int32, error) {
+	shaToLocal := make(map[string]int)
+	for path, ops := range pathOpsMap {
+		for _, op := range ops {
+			if op.IsDelete {
+				continue
+			}
+			if be, ok := blobIndex[op.BlobMark]; ok && be.OriginalID != "" && be.OriginalID != emptyBlobSHA {
+				shaToLocal[be.OriginalID] = pathToLocalGroup[path]
+			}
+		}
+	}
+
+	shas := make([]string, 0, len(shaToLocal))
+	for sha := range shaToLocal {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas) // deterministic choice when a group matches several
+
+	blobGroups, err := database.GetBlobGroups(ctx, shas)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]int32)
+	for _, sha := range shas {
+		groupID, ok := blobGroups[sha]
+		if !ok {
+			continue
+		}
+		lg := shaToLocal[sha]
+		if _, exists := known[lg]; !exists {
+			known[lg] = groupID
+		}
+	}
+	return known, nil
+}
+
+// gitRevParse resolves a revision to its full commit SHA.
+func gitRevParse(gitPath, rev string) (string, error) {
+	out, err := exec.Command("git", "-C", gitPath, "rev-parse", "--verify", "--quiet", rev+"^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve '%s' in %s", rev, gitPath)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 // ═══════════════════════════════════════════════════════════════════════════
 // Phase 1: Export to temp file
 // ═══════════════════════════════════════════════════════════════════════════
 
+// openGitSource resolves the import source to a directory git commands can
+// run in. Working trees (with a .git directory) and bare repositories are
+// used in place. file:// URLs are mirror-cloned into a temp directory under
+// tmpDir (the .pgit directory); cleanup removes that clone and is a no-op
+// otherwise.
+func openGitSource(source, tmpDir string) (gitPath string, cleanup func(), err error) {
+	cleanup = func() {}
+
+	if strings.HasPrefix(source, "file://") {
+		mirrorDir, err := os.MkdirTemp(tmpDir, "pgit-mirror-*")
+		if err != nil {
+			return "", cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(mirrorDir) }
+
+		spinner := ui.NewSpinner("Cloning " + source)
+		spinner.Start()
+		out, err := exec.Command("git", "clone", "--mirror", "--quiet", source, mirrorDir).CombinedOutput()
+		spinner.Stop()
+		if err != nil {
+			cleanup()
+			return "", func() {}, util.NewError("Cannot clone repository").
+				WithMessage(fmt.Sprintf("git clone --mirror %s failed", source)).
+				WithContext(strings.TrimSpace(string(out))).
+				WithSuggestion("git ls-remote " + source + "  # Check the URL")
+		}
+		return mirrorDir, cleanup, nil
+	}
+
+	gitPath, err = filepath.Abs(source)
+	if err != nil {
+		return "", cleanup, err
+	}
+
+	out, err := exec.Command("git", "-C", gitPath, "rev-parse", "--is-bare-repository").Output()
+	if err == nil && strings.TrimSpace(string(out)) == "true" {
+		return gitPath, cleanup, nil
+	}
+
+	// Non-bare: the path must be the top of a working tree
+	if _, statErr := os.Stat(filepath.Join(gitPath, ".git")); os.IsNotExist(statErr) {
+		return "", cleanup, util.NewError("Not a git repository").
+			WithContext(fmt.Sprintf("'%s' is neither a bare repository nor contains a .git directory", gitPath)).
+			WithSuggestions(
+				"pgit import /path/to/git/repo",
+				"pgit import file:///path/to/mirror.git",
+				"git fast-export ... | pgit import --stdin  # No local repository",
+			)
+	}
+	return gitPath, cleanup, nil
+}
+
 // exportToFile runs git fast-export and writes the stream to a temp file.
 // tmpDir specifies where to create the temp file (e.g. the .pgit directory).
+// revArgs are passed through to fast-export (a branch, or a range plus
+// --reference-excluded-parents for incremental imports).
 // Returns the temp file path, total bytes written, and error.
-func exportToFile(gitPath, branch, tmpDir string) (string, int64, error) {
-	cmd := exec.Command("git", "fast-export", "--reencode=yes", "--show-original-ids", branch)
+func exportToFile(gitPath, tmpDir string, revArgs ...string) (string, int64, error) {
+	args := append([]string{"fast-export", "--reencode=yes", "--show-original-ids"}, revArgs...)
+	cmd := exec.Command("git", args...)
 	cmd.Dir = gitPath
 
 	stdout, err := cmd.StdoutPipe()
@@ -785,21 +1386,60 @@ func exportToFile(gitPath, branch, tmpDir string) (string, int64, error) {
 // ═══════════════════════════════════════════════════════════════════════════
 
 // indexFastExport does a single-pass scan of the temp file and builds
-// the blob index and commit entry list.
-func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error) {
+// the blob index and commit entry list. refTips maps each git ref named in
+// the stream (commit, reset, and tag commands) to the mark of its final commit.
+func indexFastExport(tmpPath string) (commits []commitEntry, blobIdx map[int]*blobEntry, refTips map[string]int, err error) {
 	f, err := os.Open(tmpPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	defer f.Close()
 
-	reader := bufio.NewReaderSize(f, 4*1024*1024) // 4MB buffer
+	return indexFastExportStream(f, nil)
+}
+
+// spoolFastExport indexes a non-seekable fast-export stream (a pipe).
+// Only blob contents and commit messages are written to a spool file in
+// tmpDir, since those are the only parts read back later; blob and message
+// offsets in the returned index point into the spool instead of the stream.
+// Returns the spool path (set even on error, for cleanup) and its size.
+func spoolFastExport(r io.Reader, tmpDir string) (commits []commitEntry, blobIdx map[int]*blobEntry, refTips map[string]int, spoolPath string, spoolSize int64, err error) {
+	spool, err := os.CreateTemp(tmpDir, "pgit-import-*.spool")
+	if err != nil {
+		return nil, nil, nil, "", 0, err
+	}
+	spoolPath = spool.Name()
+
+	w := bufio.NewWriterSize(spool, 4*1024*1024)
+	commits, blobIdx, refTips, err = indexFastExportStream(r, w)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := spool.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, nil, nil, spoolPath, 0, err
+	}
+
+	if info, statErr := os.Stat(spoolPath); statErr == nil {
+		spoolSize = info.Size()
+	}
+	return commits, blobIdx, refTips, spoolPath, spoolSize, nil
+}
+
+// indexFastExportStream is the parser behind indexFastExport and
+// spoolFastExport. With a nil spool, data offsets are positions in the
+// stream itself; otherwise blob and message payloads are copied to spool
+// and their offsets are positions in the spool.
+func indexFastExportStream(src io.Reader, spool io.Writer) (commits []commitEntry, blobIdx map[int]*blobEntry, refTips map[string]int, err error) {
+	reader := bufio.NewReaderSize(src, 4*1024*1024) // 4MB buffer
 
-	var commits []commitEntry
-	blobIdx := make(map[int]*blobEntry)
+	blobIdx = make(map[int]*blobEntry)
+	refTips = make(map[string]int)
 
-	// Track byte offset in the stream
-	var offset int64
+	// Track byte offset in the stream, and in the spool when spooling
+	var offset, spoolOffset int64
 
 	// readLine reads a line and tracks offset. Returns line without trailing \n.
 	readLine := func() (string, error) {
@@ -812,11 +1452,22 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 	}
 
 	// skipData reads and skips exactly n bytes of data content plus optional trailing LF.
-	// Returns the byte offset where the data starts.
-	skipData := func(n int) (int64, error) {
+	// Returns the byte offset where the data starts. With keep set and a
+	// spool, the content is copied to the spool and the spool offset returned.
+	skipData := func(n int, keep bool) (int64, error) {
 		dataOffset := offset
-		// Skip n bytes
 		remaining := n
+		if keep && spool != nil {
+			dataOffset = spoolOffset
+			copied, err := io.CopyN(spool, reader, int64(n))
+			offset += copied
+			spoolOffset += copied
+			if err != nil {
+				return dataOffset, err
+			}
+			remaining = 0
+		}
+		// Skip n bytes
 		for remaining > 0 {
 			skipped, err := reader.Discard(min(remaining, 4*1024*1024))
 			offset += int64(skipped)
@@ -843,7 +1494,7 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 			break
 		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("read error at offset %d: %w", offset, err)
+			return nil, nil, nil, fmt.Errorf("read error at offset %d: %w", offset, err)
 		}
 
 		switch {
@@ -853,7 +1504,7 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 			for {
 				bline, err := readLine()
 				if err != nil {
-					return nil, nil, fmt.Errorf("unexpected EOF in blob at offset %d", offset)
+					return nil, nil, nil, fmt.Errorf("unexpected EOF in blob at offset %d", offset)
 				}
 				if strings.HasPrefix(bline, "mark :") {
 					be.Mark, _ = strconv.Atoi(bline[6:])
@@ -862,9 +1513,9 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 				} else if strings.HasPrefix(bline, "data ") {
 					size, _ := strconv.Atoi(bline[5:])
 					be.Size = size
-					dataOffset, err := skipData(size)
+					dataOffset, err := skipData(size, true)
 					if err != nil {
-						return nil, nil, fmt.Errorf("error skipping blob data at offset %d: %w", offset, err)
+						return nil, nil, nil, fmt.Errorf("error skipping blob data at offset %d: %w", offset, err)
 					}
 					be.Offset = dataOffset
 					break
@@ -876,11 +1527,12 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 
 		case strings.HasPrefix(line, "commit "):
 			ce := commitEntry{}
+			ref := line[7:]
 			// Read commit metadata
 			for {
 				cline, err := readLine()
 				if err != nil {
-					return nil, nil, fmt.Errorf("unexpected EOF in commit at offset %d", offset)
+					return nil, nil, nil, fmt.Errorf("unexpected EOF in commit at offset %d", offset)
 				}
 
 				if strings.HasPrefix(cline, "mark :") {
@@ -894,9 +1546,9 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 				} else if strings.HasPrefix(cline, "data ") {
 					size, _ := strconv.Atoi(cline[5:])
 					ce.MessageSize = size
-					dataOffset, err := skipData(size)
+					dataOffset, err := skipData(size, true)
 					if err != nil {
-						return nil, nil, fmt.Errorf("error skipping commit message at offset %d: %w", offset, err)
+						return nil, nil, nil, fmt.Errorf("error skipping commit message at offset %d: %w", offset, err)
 					}
 					ce.MessageOffset = dataOffset
 					// After commit message, read file ops and from/merge
@@ -911,7 +1563,7 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 					break
 				}
 				if err != nil {
-					return nil, nil, fmt.Errorf("error reading commit ops at offset %d: %w", offset, err)
+					return nil, nil, nil, fmt.Errorf("error reading commit ops at offset %d: %w", offset, err)
 				}
 
 				if cline == "" {
@@ -921,6 +1573,9 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 
 				if strings.HasPrefix(cline, "from :") {
 					ce.FromMark, _ = strconv.Atoi(cline[6:])
+				} else if strings.HasPrefix(cline, "from ") {
+					// --reference-excluded-parents: parent is referenced by SHA
+					ce.FromSHA = cline[5:]
 				} else if strings.HasPrefix(cline, "merge :") {
 					if ce.MergeMark == 0 {
 						ce.MergeMark, _ = strconv.Atoi(cline[7:])
@@ -956,9 +1611,49 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 			}
 
 			commits = append(commits, ce)
+			if ce.Mark > 0 {
+				refTips[ref] = ce.Mark
+			}
 
 		case strings.HasPrefix(line, "reset "):
-			// reset line — skip
+			// "reset <ref>" optionally followed by "from :<mark>" points a ref
+			// at a commit that was already emitted (e.g. a second branch or a
+			// lightweight tag on shared history).
+			ref := line[6:]
+			if next, _ := reader.Peek(6); string(next) == "from :" {
+				fline, err := readLine()
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("unexpected EOF in reset at offset %d", offset)
+				}
+				if mark, _ := strconv.Atoi(fline[6:]); mark > 0 {
+					refTips[ref] = mark
+				}
+			}
+			continue
+
+		case strings.HasPrefix(line, "tag "):
+			// Annotated tag: read up to and skip its message. The tag points
+			// refs/tags/<name> at the commit named by its "from" line.
+			name := line[4:]
+			target := 0
+			for {
+				tline, err := readLine()
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("unexpected EOF in tag at offset %d", offset)
+				}
+				if strings.HasPrefix(tline, "from :") {
+					target, _ = strconv.Atoi(tline[6:])
+				} else if strings.HasPrefix(tline, "data ") {
+					size, _ := strconv.Atoi(tline[5:])
+					if _, err := skipData(size, false); err != nil {
+						return nil, nil, nil, fmt.Errorf("error skipping tag message at offset %d: %w", offset, err)
+					}
+					break
+				}
+			}
+			if target > 0 {
+				refTips["refs/tags/"+name] = target
+			}
 			continue
 
 		case strings.HasPrefix(line, "progress "):
@@ -973,7 +1668,7 @@ func indexFastExport(tmpPath string) ([]commitEntry, map[int]*blobEntry, error)
 		}
 	}
 
-	return commits, blobIdx, nil
+	return commits, blobIdx, refTips, nil
 }
 
 // parseIdentity parses a fast-export author/committer line.
@@ -1094,10 +1789,16 @@ func unquotePath(s string) string {
 // ═══════════════════════════════════════════════════════════════════════════
 
 // prepareCommits assigns ULIDs, builds db.Commit objects, and groups file ops by path.
+// Tree and commit hashes are filled in by hashCommits.
+// seqBase is the highest seq already in the database (0 for a fresh import).
+// externalParents maps parent git SHAs outside the exported range to their
+// existing pgit IDs (nil for a fresh import).
 func prepareCommits(
 	commitEntries []commitEntry,
 	blobIndex map[int]*blobEntry,
 	tmpFile *os.File,
+	seqBase int,
+	externalParents map[string]string,
 ) ([]*db.Commit, map[int]string, map[string][]pathOp) {
 
 	markToULID := make(map[int]string, len(commitEntries))
@@ -1114,6 +1815,10 @@ func prepareCommits(
 			if pid, ok := markToULID[ce.FromMark]; ok {
 				parentID = &pid
 			}
+		} else if ce.FromSHA != "" {
+			if pid, ok := externalParents[ce.FromSHA]; ok {
+				parentID = &pid
+			}
 		}
 
 		// Read message from temp file
@@ -1123,9 +1828,8 @@ func prepareCommits(
 
 		pgitCommits = append(pgitCommits, &db.Commit{
 			ID:             ulid,
-			Seq:            i + 1, // 1-indexed, matches insertion order
+			Seq:            seqBase + i + 1, // 1-indexed, matches insertion order
 			ParentID:       parentID,
-			TreeHash:       ce.OriginalID[:min(8, len(ce.OriginalID))],
 			Message:        util.ToValidUTF8(string(message)),
 			AuthorName:     util.ToValidUTF8(ce.AuthorName),
 			AuthorEmail:    util.ToValidUTF8(ce.AuthorEmail),
@@ -1162,6 +1866,17 @@ func prepareCommits(
 //
 // The binary lifting table enables O(log N) ancestry lookups for any depth N.
 func buildCommitGraph(commits []*db.Commit) []db.CommitGraphEntry {
+	// No existing graph to consult, so the lookups can never fail.
+	entries, _ := extendCommitGraph(context.Background(), nil, commits, 0)
+	return entries
+}
+
+// extendCommitGraph builds graph entries for commits appended after an existing
+// graph whose highest seq is seqBase. Parents (and their ancestors) that are
+// already in the database are read from pgit_commit_graph on demand, so an
+// incremental import only touches the O(log N) entries it actually jumps to.
+// database may be nil when seqBase is 0.
+func extendCommitGraph(ctx context.Context, database *db.DB, commits []*db.Commit, seqBase int32) ([]db.CommitGraphEntry, error) {
 	// Map commit ID → index in the commits slice (0-indexed)
 	idToIdx := make(map[string]int, len(commits))
 	for i, c := range commits {
@@ -1171,16 +1886,48 @@ func buildCommitGraph(commits []*db.Commit) []db.CommitGraphEntry {
 	// Flat slice — avoids 1.3M individual heap allocations for Linux kernel.
 	entries := make([]db.CommitGraphEntry, len(commits))
 
+	// Existing graph entries fetched from the database, keyed by seq.
+	existing := make(map[int32]*db.CommitGraphEntry)
+	entryBySeq := func(seq int32) (*db.CommitGraphEntry, error) {
+		if seq > seqBase {
+			return &entries[seq-seqBase-1], nil // seq is 1-indexed, slice is 0-indexed
+		}
+		if e, ok := existing[seq]; ok {
+			return e, nil
+		}
+		e, err := database.GetCommitGraphBySeq(ctx, seq)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, fmt.Errorf("commit graph entry seq %d not found", seq)
+		}
+		existing[seq] = e
+		return e, nil
+	}
+
 	for i, c := range commits {
-		seq := int32(i + 1) // 1-indexed
+		seq := seqBase + int32(i+1) // 1-indexed
 
 		var depth int32
-		var parentIdx int = -1
+		var parent *db.CommitGraphEntry
 
 		if c.ParentID != nil {
 			if idx, ok := idToIdx[*c.ParentID]; ok {
-				parentIdx = idx
-				depth = entries[idx].Depth + 1
+				parent = &entries[idx]
+			} else if database != nil {
+				// Parent was imported earlier (incremental import)
+				e, err := database.GetCommitGraphByID(ctx, *c.ParentID)
+				if err != nil {
+					return nil, err
+				}
+				if e != nil {
+					existing[e.Seq] = e
+					parent = e
+				}
+			}
+			if parent != nil {
+				depth = parent.Depth + 1
 			}
 		}
 
@@ -1188,7 +1935,7 @@ func buildCommitGraph(commits []*db.Commit) []db.CommitGraphEntry {
 		// ancestors[0] = parent's seq (2^0 = 1 step)
 		// ancestors[k] = entries[ancestors[k-1]].ancestors[k-1] (2^k steps = two jumps of 2^(k-1))
 		var ancestors []int32
-		if parentIdx >= 0 {
+		if parent != nil {
 			// Maximum levels needed: log2(depth) + 1
 			maxLevel := 0
 			for d := depth; d > 0; d >>= 1 {
@@ -1196,13 +1943,15 @@ func buildCommitGraph(commits []*db.Commit) []db.CommitGraphEntry {
 			}
 
 			ancestors = make([]int32, maxLevel)
-			ancestors[0] = entries[parentIdx].Seq // parent's seq
+			ancestors[0] = parent.Seq
 
 			for k := 1; k < maxLevel; k++ {
 				// To find the 2^k-th ancestor, we jump from the 2^(k-1)-th ancestor
 				// by another 2^(k-1) steps.
-				prevAncestorSeq := ancestors[k-1]
-				prevAncestorEntry := &entries[prevAncestorSeq-1] // seq is 1-indexed, slice is 0-indexed
+				prevAncestorEntry, err := entryBySeq(ancestors[k-1])
+				if err != nil {
+					return nil, err
+				}
 				if k-1 < len(prevAncestorEntry.Ancestors) {
 					ancestors[k] = prevAncestorEntry.Ancestors[k-1]
 				} else {
@@ -1221,7 +1970,71 @@ func buildCommitGraph(commits []*db.Commit) []db.CommitGraphEntry {
 		}
 	}
 
-	return entries
+	return entries, nil
+}
+
+// parentOpScanLimit bounds how many earlier ops of a path parentOp checks
+// for the one in a commit's parent tree. Only heavily branched histories
+// get that far; their line counts are then computed from the database.
+const parentOpScanLimit = 256
+
+// commitAncestry answers first-parent ancestry questions about the commits
+// of an import, using their commit graph entries.
+type commitAncestry struct {
+	entries []db.CommitGraphEntry
+	index   map[string]int // commit ID → position in entries
+}
+
+func newCommitAncestry(entries []db.CommitGraphEntry) *commitAncestry {
+	index := make(map[string]int, len(entries))
+	for i := range entries {
+		index[entries[i].ID] = i
+	}
+	return &commitAncestry{entries: entries, index: index}
+}
+
+// isAncestor reports whether ancestor is a strict first-parent ancestor of
+// id, both being commits of the import. Jumps by binary lifting, so it is
+// O(log N); a jump leaving the import means ancestor isn't on the chain,
+// since everything between an imported ancestor and id is imported too.
+func (a *commitAncestry) isAncestor(ancestor, id string) bool {
+	i, ok := a.index[ancestor]
+	j, ok2 := a.index[id]
+	if !ok || !ok2 {
+		return false
+	}
+	target, e := &a.entries[i], &a.entries[j]
+	if target.Depth >= e.Depth {
+		return false
+	}
+	firstSeq := a.entries[0].Seq
+	for remaining, bit := e.Depth-target.Depth, 0; remaining > 0; bit++ {
+		if remaining&1 == 1 {
+			if bit >= len(e.Ancestors) || e.Ancestors[bit] < firstSeq {
+				return false
+			}
+			e = &a.entries[e.Ancestors[bit]-firstSeq]
+		}
+		remaining >>= 1
+	}
+	return e.ID == ancestor
+}
+
+// parentOp returns the op of a path in the tree of the parent of ops[i]'s
+// commit: the op on the nearest first-parent ancestor, ops being one
+// path's ops in import order. A nil op means no imported ancestor touched
+// the path. found is false when the search gave up (see parentOpScanLimit).
+func (a *commitAncestry) parentOp(ops []pathOp, i int) (op *pathOp, found bool) {
+	// Ancestors come earlier in import order, and a nearer one later than
+	// a farther one, so the first ancestor found going back is the nearest
+	commitID := ops[i].CommitID
+	stop := max(0, i-parentOpScanLimit)
+	for j := i - 1; j >= stop; j-- {
+		if a.isAncestor(ops[j].CommitID, commitID) {
+			return &ops[j], true
+		}
+	}
+	return nil, stop == 0
 }
 
 // readBytesAt reads exactly n bytes from f at the given offset.
@@ -1237,6 +2050,145 @@ func readBytesAt(f *os.File, offset int64, n int) []byte {
 	return buf
 }
 
+// ═══════════════════════════════════════════════════════════════════════════
+// Phase 3b: Tree and commit hashes
+// ═══════════════════════════════════════════════════════════════════════════
+
+// hashBlobs computes the BLAKE3 content hash of every blob in the temp
+// file, workers at a time, keyed by mark.
+func hashBlobs(tmpFile *os.File, blobIndex map[int]*blobEntry, workers int) (map[int][]byte, error) {
+	marks := make(chan int, len(blobIndex))
+	for mark := range blobIndex {
+		marks <- mark
+	}
+	close(marks)
+
+	hashes := make(map[int][]byte, len(blobIndex))
+	var mu sync.Mutex
+	var firstErr atomic.Pointer[error]
+	var wg sync.WaitGroup
+	var done atomic.Int64
+	progress := ui.NewProgress("Hashing", len(blobIndex))
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mark := range marks {
+				if firstErr.Load() != nil {
+					return
+				}
+				be := blobIndex[mark]
+				content := make([]byte, be.Size)
+				if be.Size > 0 {
+					if _, err := tmpFile.ReadAt(content, be.Offset); err != nil {
+						err = fmt.Errorf("failed to read blob content at offset %d: %w", be.Offset, err)
+						firstErr.CompareAndSwap(nil, &err)
+						return
+					}
+				}
+				hash := util.HashBytesBlake3(content)
+				mu.Lock()
+				hashes[mark] = hash
+				mu.Unlock()
+				progress.Update(int(done.Add(1)))
+			}
+		}()
+	}
+	wg.Wait()
+	progress.Done()
+
+	if errPtr := firstErr.Load(); errPtr != nil {
+		return nil, *errPtr
+	}
+	return hashes, nil
+}
+
+// hashCommits sets the tree hash and commit hash of the prepared commits
+// (commits[i] is commitEntries[i]). A commit's tree is its first parent's
+// tree with its file ops applied, as fast-export writes them, so it is the
+// commit's git tree whatever order the commit IDs sort in. Ops on blobs the
+// blob phase skips (submodules) are skipped here too.
+//
+// When appending to existing history (database != nil), the trees of
+// stored parents are read from the database. stored maps commit IDs
+// already in the database to their commit hash; those commits keep it, and
+// new commits chain onto it.
+func hashCommits(
+	ctx context.Context,
+	database *db.DB,
+	commits []*db.Commit,
+	commitEntries []commitEntry,
+	markToULID map[int]string,
+	blobHashes map[int][]byte,
+	stored map[string]string,
+) error {
+	changes := make(map[string][]util.TreeEntry, len(commitEntries))
+	for _, ce := range commitEntries {
+		id := markToULID[ce.Mark]
+		for _, op := range ce.FileOps {
+			e := util.TreeEntry{Path: op.Path}
+			if op.Type != 'D' {
+				hash, ok := blobHashes[op.BlobMark]
+				if !ok {
+					continue
+				}
+				e.Mode, e.ContentHash, e.IsSymlink = op.Mode, hash, op.Mode == 0120000
+			}
+			changes[id] = append(changes[id], e)
+		}
+	}
+
+	isNew := make(map[string]bool, len(commits))
+	parentIDs := make([]string, len(commits))
+	for i, c := range commits {
+		isNew[c.ID] = true
+		if c.ParentID != nil {
+			parentIDs[i] = *c.ParentID
+		}
+	}
+	replay := util.NewTreeReplay(parentIDs)
+	if database != nil {
+		based := make(map[string]bool)
+		for _, parentID := range parentIDs {
+			if parentID == "" || isNew[parentID] || based[parentID] {
+				continue
+			}
+			based[parentID] = true
+			tree, err := database.MerkleTreeAt(ctx, parentID)
+			if err != nil {
+				return fmt.Errorf("failed to read tree: %w", err)
+			}
+			replay.SetBase(parentID, tree)
+		}
+	}
+
+	// fast-export writes parents before their children
+	trees := make(map[string]string, len(commits))
+	for i, c := range commits {
+		trees[c.ID] = replay.Replay(c.ID, parentIDs[i], changes[c.ID])
+	}
+
+	hashes := make(map[string]string, len(stored)+len(commits))
+	for id, hash := range stored {
+		hashes[id] = hash
+	}
+	for _, c := range commits {
+		c.TreeHash = trees[c.ID]
+		if hash, ok := stored[c.ID]; ok {
+			c.CommitHash = hash
+			continue
+		}
+		parentHash := ""
+		if c.ParentID != nil {
+			parentHash = hashes[*c.ParentID]
+		}
+		c.CommitHash = c.ComputeHash(parentHash)
+		hashes[c.ID] = c.CommitHash
+	}
+	return nil
+}
+
 // ═══════════════════════════════════════════════════════════════════════════
 // Phase 4: Path grouping (union-find on content hashes)
 // ═══════════════════════════════════════════════════════════════════════════
@@ -1281,6 +2233,10 @@ func (uf *unionFind) union(x, y int) {
 	}
 }
 
+// emptyBlobSHA is git's SHA-1 of the empty blob. Empty files are excluded
+// from path grouping — they say nothing about a path's lineage.
+const emptyBlobSHA = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
 // computePathGroups analyzes content hashes from the fast-export temp file
 // and returns a map of path → local group index using union-find.
 // Paths sharing non-empty content (same BLAKE3 hash) are assigned the same group.
@@ -1292,9 +2248,6 @@ func computePathGroups(
 	pathOpsMap map[string][]pathOp,
 	blobIndex map[int]*blobEntry,
 ) (map[string]int, int) {
-	// Git SHA-1 of empty blob — excluded from grouping
-	const emptyHash = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
-
 	// Assign each path a numeric index
 	pathList := make([]string, 0, len(pathOpsMap))
 	pathIndex := make(map[string]int, len(pathOpsMap))
@@ -1322,7 +2275,7 @@ func computePathGroups(
 				continue
 			}
 			h, ok := markHash[op.BlobMark]
-			if !ok || h == emptyHash {
+			if !ok || h == emptyBlobSHA {
 				continue
 			}
 			hashToPaths[h] = append(hashToPaths[h], pidx)
@@ -1375,6 +2328,12 @@ type groupOp struct {
 	Mode      int
 	IsDelete  bool
 	Timestamp int64 // commit author timestamp (for sorting)
+
+	// Base is the path's op in the parent commit's tree, nil when no
+	// commit of this import on the first-parent chain touched the path.
+	// BaseUnknown is set when the search for it gave up.
+	Base        *pathOp
+	BaseUnknown bool
 }
 
 // ═══════════════════════════════════════════════════════════════════════════
@@ -1393,6 +2352,12 @@ type groupOp struct {
 //   - Distributes groups (not paths) to workers for correct version ordering
 //   - Sorts operations within each group by commit timestamp
 //   - Heavy groups are interleaved with light ones to prevent tail stall
+//
+// appendVersions continues each group's version_id sequence from what is
+// already in the database (resume and --update). knownGroups optionally pins
+// local groups to existing database groups (see PreRegisterPathsWithGroups).
+// ancestry covers the imported commits, for the line counts of each file
+// version against the parent commit's tree.
 func importBlobsParallel(
 	ctx context.Context,
 	database *db.DB,
@@ -1401,9 +2366,11 @@ func importBlobsParallel(
 	blobIndex map[int]*blobEntry,
 	markToULID map[int]string,
 	workers int,
-	isResume bool,
+	appendVersions bool,
 	pathToLocalGroup map[string]int,
+	knownGroups map[int]int32,
 	commitTimestamps map[string]int64,
+	ancestry *commitAncestry,
 ) error {
 	// Open temp file for concurrent reads
 	tmpFile, err := os.Open(tmpFilePath)
@@ -1421,33 +2388,39 @@ func importBlobsParallel(
 	// Pre-register all paths with their group assignments.
 	// pathToLocalGroup maps path → local group index (0-based).
 	// PreRegisterPaths converts these to database group_ids (auto-assigned per group).
-	pathRegistration, err := database.PreRegisterPaths(ctx, paths, pathToLocalGroup)
+	pathRegistration, err := database.PreRegisterPathsWithGroups(ctx, paths, pathToLocalGroup, knownGroups)
 	if err != nil {
 		return fmt.Errorf("failed to pre-register paths: %w", err)
 	}
 
 	// Build group → []groupOp, collecting all operations across all paths in each group.
 	// Sort each group's ops by commit timestamp for optimal delta compression.
+	// Keyed by the registered database group_id rather than the local group:
+	// on resume or --update, paths that were registered earlier keep their
+	// original group, which may differ from what the local union-find implies.
 	type groupInfo struct {
 		GroupID int32 // database group_id
 		Ops     []groupOp
 	}
-	groupMap := make(map[int]*groupInfo) // keyed by local group index
+	groupMap := make(map[int32]*groupInfo)
 	for path, ops := range pathOpsMap {
-		localGroup := pathToLocalGroup[path]
-		gi, exists := groupMap[localGroup]
+		groupID := pathRegistration[path].GroupID
+		gi, exists := groupMap[groupID]
 		if !exists {
-			gi = &groupInfo{GroupID: pathRegistration[path].GroupID}
-			groupMap[localGroup] = gi
+			gi = &groupInfo{GroupID: groupID}
+			groupMap[groupID] = gi
 		}
-		for _, op := range ops {
+		for i, op := range ops {
+			base, found := ancestry.parentOp(ops, i)
 			gi.Ops = append(gi.Ops, groupOp{
-				Path:      path,
-				CommitID:  op.CommitID,
-				BlobMark:  op.BlobMark,
-				Mode:      op.Mode,
-				IsDelete:  op.IsDelete,
-				Timestamp: commitTimestamps[op.CommitID],
+				Path:        path,
+				CommitID:    op.CommitID,
+				BlobMark:    op.BlobMark,
+				Mode:        op.Mode,
+				IsDelete:    op.IsDelete,
+				Timestamp:   commitTimestamps[op.CommitID],
+				Base:        base,
+				BaseUnknown: !found,
 			})
 		}
 	}
@@ -1465,12 +2438,11 @@ func importBlobsParallel(
 	// Collect groups sorted by operation count descending, then interleave
 	// to prevent tail stall (same strategy as v3 per-path interleaving).
 	type groupWork struct {
-		LocalGroup int
-		Info       *groupInfo
+		Info *groupInfo
 	}
 	groups := make([]groupWork, 0, len(groupMap))
-	for lg, gi := range groupMap {
-		groups = append(groups, groupWork{LocalGroup: lg, Info: gi})
+	for _, gi := range groupMap {
+		groups = append(groups, groupWork{Info: gi})
 	}
 	sort.Slice(groups, func(i, j int) bool {
 		return len(groups[i].Info.Ops) > len(groups[j].Info.Ops)
@@ -1479,17 +2451,13 @@ func importBlobsParallel(
 
 	// Initialize version counters for each database group_id.
 	// For fresh imports: all start at 0 (incremented before use).
-	// For resume: query existing max version_ids.
+	// For resume and --update: query existing max version_ids.
 	versionCounters := make(map[int32]*int32, len(groupMap))
-	if isResume {
-		// Collect unique database group_ids
+	if appendVersions {
+		// Collect database group_ids
 		groupIDs := make([]int32, 0, len(groupMap))
-		seen := make(map[int32]bool)
-		for _, gi := range groupMap {
-			if !seen[gi.GroupID] {
-				seen[gi.GroupID] = true
-				groupIDs = append(groupIDs, gi.GroupID)
-			}
+		for groupID := range groupMap {
+			groupIDs = append(groupIDs, groupID)
 		}
 		// Batch query max version_ids via JOIN through pgit_paths
 		maxVersions := make(map[int32]int32)
@@ -1527,13 +2495,9 @@ func importBlobsParallel(
 		}
 	} else {
 		// Fresh import: all groups start at 0
-		seen := make(map[int32]bool)
-		for _, gi := range groupMap {
-			if !seen[gi.GroupID] {
-				seen[gi.GroupID] = true
-				v := int32(0)
-				versionCounters[gi.GroupID] = &v
-			}
+		for groupID := range groupMap {
+			v := int32(0)
+			versionCounters[groupID] = &v
 		}
 	}
 
@@ -1557,6 +2521,10 @@ func importBlobsParallel(
 	var firstErr atomic.Pointer[error]
 	var wg sync.WaitGroup
 
+	// Commits with line counts left to FillFileChanges
+	var deferredMu sync.Mutex
+	deferred := make(map[string]bool)
+
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
@@ -1570,6 +2538,57 @@ func importBlobsParallel(
 				gi := gw.Info
 				counter := versionCounters[gi.GroupID]
 
+				// Git blob SHAs first seen in this group. The same SHA can land
+				// in a second group only when a resumed or incremental import
+				// keeps an earlier grouping; the first recorded group wins.
+				var blobMappings []db.GitMapping
+				seenMarks := make(map[int]bool)
+
+				// Line counts are taken against the path's version in the
+				// parent commit's tree: usually the version streamed just
+				// before, else read back from the temp file. A version whose
+				// base was stored by an earlier import (when appending), or
+				// wasn't found, is left to FillFileChanges below.
+				type lastVersion struct {
+					commitID string
+					content  []byte
+					isBinary bool
+				}
+				last := make(map[string]*lastVersion)
+				var changes []*db.FileChange
+				var deferredIDs []string
+				recordChange := func(op groupOp, content []byte, isBinary bool) error {
+					prev := last[op.Path]
+					last[op.Path] = &lastVersion{commitID: op.CommitID, content: content, isBinary: isBinary}
+					if op.BaseUnknown || (op.Base == nil && appendVersions) {
+						deferredIDs = append(deferredIDs, op.CommitID)
+						return nil
+					}
+
+					var old []byte
+					var oldBinary bool
+					if base := op.Base; base != nil && !base.IsDelete {
+						if prev != nil && prev.commitID == base.CommitID {
+							old, oldBinary = prev.content, prev.isBinary
+						} else if be, ok := blobIndex[base.BlobMark]; ok {
+							old = make([]byte, be.Size)
+							if _, err := tmpFile.ReadAt(old, be.Offset); err != nil {
+								return fmt.Errorf("failed to read blob content at offset %d: %w", be.Offset, err)
+							}
+							oldBinary = util.DetectBinary(old)
+						}
+					}
+
+					change := &db.FileChange{CommitID: op.CommitID, PathID: pathRegistration[op.Path].PathID}
+					if isBinary || oldBinary {
+						change.IsBinary = true
+					} else {
+						change.Added, change.Removed = db.CountLineChanges(string(old), string(content))
+					}
+					changes = append(changes, change)
+					return nil
+				}
+
 				// Stream blobs in chunks of CopyChunkSize to bound memory.
 				// The nextChunk closure reads blob content from the temp file
 				// on demand — only CopyChunkSize blobs are in memory at a time.
@@ -1597,6 +2616,9 @@ func importBlobsParallel(
 								IsSymlink:   false,
 								IsBinary:    false,
 							})
+							if err := recordChange(op, nil, false); err != nil {
+								return nil, err
+							}
 							continue
 						}
 
@@ -1616,6 +2638,16 @@ func importBlobsParallel(
 						isBinary := util.DetectBinary(content)
 						contentHash := util.HashBytesBlake3(content)
 
+						if be.OriginalID != "" && !seenMarks[op.BlobMark] {
+							seenMarks[op.BlobMark] = true
+							blobMappings = append(blobMappings, db.GitMapping{
+								GitSHA:      be.OriginalID,
+								Kind:        db.GitObjectBlob,
+								ContentHash: contentHash,
+								GroupID:     &gi.GroupID,
+							})
+						}
+
 						blob := &db.Blob{
 							Path:        op.Path,
 							CommitID:    op.CommitID,
@@ -1632,6 +2664,9 @@ func importBlobsParallel(
 						}
 
 						dbBlobs = append(dbBlobs, blob)
+						if err := recordChange(op, content, isBinary); err != nil {
+							return nil, err
+						}
 					}
 					return dbBlobs, nil
 				}
@@ -1643,6 +2678,19 @@ func importBlobsParallel(
 					firstErr.CompareAndSwap(nil, &err)
 					return
 				}
+				if err := database.CreateGitMappings(ctx, blobMappings); err != nil {
+					firstErr.CompareAndSwap(nil, &err)
+					return
+				}
+				if err := database.CreateFileChanges(ctx, changes); err != nil {
+					firstErr.CompareAndSwap(nil, &err)
+					return
+				}
+				deferredMu.Lock()
+				for _, id := range deferredIDs {
+					deferred[id] = true
+				}
+				deferredMu.Unlock()
 			}
 		}()
 	}
@@ -1654,6 +2702,16 @@ func importBlobsParallel(
 		return *errPtr
 	}
 
+	if len(deferred) > 0 {
+		commitIDs := make([]string, 0, len(deferred))
+		for id := range deferred {
+			commitIDs = append(commitIDs, id)
+		}
+		if err := fillFileChanges(ctx, database, commitIDs); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1724,8 +2782,15 @@ func selectBranch(gitPath, branchFlag string) (string, error) {
 		return runBranchPicker(branches)
 	}
 
-	// Non-interactive: use current branch
-	return getCurrentBranch(gitPath), nil
+	// Non-interactive: use current branch, or the first one if HEAD names
+	// a branch that does not exist (unborn default branch of a bare repo)
+	current := getCurrentBranch(gitPath)
+	for _, b := range branches {
+		if b.Name == current {
+			return current, nil
+		}
+	}
+	return branches[0].Name, nil
 }
 
 type gitBranch struct {
@@ -1791,16 +2856,218 @@ func getGitBranches(gitPath string) ([]gitBranch, error) {
 	return branches, nil
 }
 
+// getCurrentBranch returns the branch HEAD points at. In a bare repository
+// that is the default branch, which may be unborn (e.g. HEAD still names
+// master in a mirror that only has main), so callers check it exists.
 func getCurrentBranch(gitPath string) string {
-	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd := exec.Command("git", "symbolic-ref", "--quiet", "--short", "HEAD")
 	cmd.Dir = gitPath
 	output, err := cmd.Output()
 	if err != nil {
-		return "main"
+		// Detached HEAD
+		cmd = exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+		cmd.Dir = gitPath
+		if output, err = cmd.Output(); err != nil {
+			return "main"
+		}
 	}
 	return strings.TrimSpace(string(output))
 }
 
+// ═══════════════════════════════════════════════════════════════════════════
+// Multi-ref selection (--all, --branches, --tags)
+// ═══════════════════════════════════════════════════════════════════════════
+
+// selectImportRefs resolves --all/--branches/--tags into the full git ref
+// names to hand to fast-export, plus the primary ref that becomes HEAD.
+// Without --all or --branches, the primary branch is chosen the usual way
+// (flag, single branch, or picker) and --tags adds every tag on top.
+func selectImportRefs(gitPath, branchFlag string, all bool, branchGlobs []string, tags bool) (refs []string, primary string, err error) {
+	out, err := exec.Command("git", "-C", gitPath, "for-each-ref", "--format=%(refname)",
+		"refs/heads", "refs/remotes", "refs/tags").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	var branchRefs, tagRefs []string
+	for _, ref := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		switch {
+		case ref == "":
+		case strings.HasPrefix(ref, "refs/tags/"):
+			tagRefs = append(tagRefs, ref)
+		case strings.HasPrefix(ref, "refs/remotes/") && strings.HasSuffix(ref, "/HEAD"):
+			// symbolic origin/HEAD duplicates another remote branch
+		default:
+			branchRefs = append(branchRefs, ref)
+		}
+	}
+
+	selected := make(map[string]bool)
+	add := func(ref string) {
+		if !selected[ref] {
+			selected[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	if all || len(branchGlobs) > 0 {
+		for _, ref := range branchRefs {
+			name := strings.TrimPrefix(pgitRefName(ref), "refs/heads/")
+			if all || matchesAnyGlob(branchGlobs, name) {
+				add(ref)
+			}
+		}
+		if len(refs) == 0 {
+			return nil, "", util.NewError("No branches match").
+				WithMessage(fmt.Sprintf("No branch matches %s", strings.Join(branchGlobs, ", "))).
+				WithSuggestion("git branch -a  # List available branches")
+		}
+	}
+
+	// Primary branch: explicit flag, else the current branch if selected,
+	// else the picker (single-branch mode) or the first selected branch.
+	primaryName := branchFlag
+	if primaryName == "" && len(refs) > 0 {
+		current := getCurrentBranch(gitPath)
+		if full := gitFullRefName(gitPath, current); selected[full] {
+			primaryName = current
+		}
+	}
+	if primaryName == "" && len(refs) == 0 {
+		if primaryName, err = selectBranch(gitPath, ""); err != nil {
+			return nil, "", err
+		}
+	}
+	if primaryName != "" {
+		primary = gitFullRefName(gitPath, primaryName)
+		if primary == "" {
+			return nil, "", util.NewError(fmt.Sprintf("Branch '%s' not found", primaryName)).
+				WithSuggestion("git branch -a  # List available branches")
+		}
+		add(primary)
+	} else {
+		primary = refs[0]
+	}
+
+	if all || tags {
+		for _, ref := range tagRefs {
+			add(ref)
+		}
+	}
+
+	return refs, primary, nil
+}
+
+// gitFullRefName expands a short ref (e.g. "main", "origin/dev") to its full
+// name, or returns "" if it does not name a ref.
+func gitFullRefName(gitPath, name string) string {
+	out, err := exec.Command("git", "-C", gitPath, "rev-parse", "--symbolic-full-name", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// pgitRefName maps a git ref to the ref name stored in pgit_refs. Branches
+// and tags keep their names; remote-tracking branches become plain branches
+// (the imported database is a copy, not a clone with remotes). Other refs
+// (notes, stash, ...) are not imported and map to "".
+func pgitRefName(gitRef string) string {
+	switch {
+	case strings.HasPrefix(gitRef, "refs/heads/"), strings.HasPrefix(gitRef, "refs/tags/"):
+		return gitRef
+	case strings.HasPrefix(gitRef, "refs/remotes/"):
+		rest := strings.TrimPrefix(gitRef, "refs/remotes/")
+		if i := strings.Index(rest, "/"); i >= 0 && i < len(rest)-1 {
+			return "refs/heads/" + rest[i+1:]
+		}
+	}
+	return ""
+}
+
+// importedRefs converts the ref tips found in a fast-export stream into
+// pgit ref name → commit ID. Local branches win over remote-tracking
+// branches of the same name.
+func importedRefs(refTips map[string]int, markToULID map[int]string) map[string]string {
+	gitRefs := make([]string, 0, len(refTips))
+	for ref := range refTips {
+		gitRefs = append(gitRefs, ref)
+	}
+	sort.Slice(gitRefs, func(i, j int) bool {
+		ri := strings.HasPrefix(gitRefs[i], "refs/remotes/")
+		rj := strings.HasPrefix(gitRefs[j], "refs/remotes/")
+		if ri != rj {
+			return rj
+		}
+		return gitRefs[i] < gitRefs[j]
+	})
+
+	result := make(map[string]string)
+	for _, gitRef := range gitRefs {
+		name := pgitRefName(gitRef)
+		if name == "" {
+			continue
+		}
+		if _, exists := result[name]; exists {
+			continue
+		}
+		if id, ok := markToULID[refTips[gitRef]]; ok {
+			result[name] = id
+		}
+	}
+	return result
+}
+
+// streamPrimaryRef picks the ref HEAD should follow for a --stdin import,
+// where there is no git repository to ask for its current branch: the
+// --branch flag if given, else the branch whose tip is the stream's last
+// commit, else the first branch by name. Returns "" if the stream names no
+// branch (HEAD then falls back to the last commit).
+func streamPrimaryRef(refTips map[string]int, commits []commitEntry, branchFlag string) (string, error) {
+	var branches []string
+	for ref := range refTips {
+		if strings.HasPrefix(pgitRefName(ref), "refs/heads/") {
+			branches = append(branches, ref)
+		}
+	}
+	sort.Strings(branches)
+
+	if branchFlag != "" {
+		for _, ref := range branches {
+			if ref == branchFlag || ref == "refs/heads/"+branchFlag {
+				return ref, nil
+			}
+		}
+		names := make([]string, len(branches))
+		for i, ref := range branches {
+			names[i] = strings.TrimPrefix(ref, "refs/heads/")
+		}
+		return "", util.NewError(fmt.Sprintf("Branch '%s' not found in stream", branchFlag)).
+			WithMessage(fmt.Sprintf("Branches in stream: %s", strings.Join(names, ", ")))
+	}
+
+	lastMark := commits[len(commits)-1].Mark
+	for _, ref := range branches {
+		if refTips[ref] == lastMark {
+			return ref, nil
+		}
+	}
+	if len(branches) > 0 {
+		return branches[0], nil
+	}
+	return "", nil
+}
+
+// matchesAnyGlob reports whether name matches any of the glob patterns.
+func matchesAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matched, _ := filepath.Match(p, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
 // ═══════════════════════════════════════════════════════════════════════════
 // Branch Picker TUI
 // ═══════════════════════════════════════════════════════════════════════════
@@ -0,0 +1,519 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/config"
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/cobra"
+)
+
+// testDatabaseEnv names a PostgreSQL database tests may create repositories
+// (schemas) in. Tests that need one are skipped without it.
+const testDatabaseEnv = "PGIT_TEST_DATABASE_URL"
+
+// testRemote makes a temporary pgit working directory the current
+// directory, with remote "origin" pointing at a new repository in the test
+// database, and drops that repository when the test ends. Returns the
+// remote's URL.
+func testRemote(t *testing.T) string {
+	t.Helper()
+	url := testRepoURL(t)
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	cfg.SetRemote("origin", url)
+	if err := cfg.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.NewIndex().Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	return url
+}
+
+// testRepoURL returns the URL of a new repository in the test database and
+// drops it when the test ends.
+func testRepoURL(t *testing.T) string {
+	t.Helper()
+	base := os.Getenv(testDatabaseEnv)
+	if base == "" {
+		t.Skipf("%s not set", testDatabaseEnv)
+	}
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	url, err := db.WithRepo(base, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		conn, err := db.Connect(ctx, base)
+		if err != nil {
+			t.Logf("failed to drop %s: %v", name, err)
+			return
+		}
+		defer conn.Close()
+		_ = conn.Exec(ctx, "DROP SCHEMA IF EXISTS "+pgx.Identifier{name}.Sanitize()+" CASCADE")
+	})
+	return url
+}
+
+// runCommand runs a pgit subcommand with args, failing the test on error.
+func runCommand(t *testing.T, cmd *cobra.Command, args ...string) {
+	t.Helper()
+	cmd.SetArgs(args)
+	if err := cmd.ExecuteContext(t.Context()); err != nil {
+		t.Fatalf("%s %s: %v", cmd.Name(), strings.Join(args, " "), err)
+	}
+}
+
+// treeFiles returns the files (path → content) checked out at a ref.
+func treeFiles(t *testing.T, database *db.DB, ref string) map[string]string {
+	t.Helper()
+	commitID, err := database.ResolveRefName(t.Context(), ref)
+	if err != nil || commitID == "" {
+		t.Fatalf("ref %s: %q, %v", ref, commitID, err)
+	}
+	tree, err := database.GetTreeAtCommit(t.Context(), commitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string, len(tree))
+	for _, blob := range tree {
+		files[blob.Path] = string(blob.Content)
+	}
+	return files
+}
+
+// connectTest connects to url, closing the connection when the test ends.
+func connectTest(t *testing.T, url string) *db.DB {
+	t.Helper()
+	database, err := db.Connect(t.Context(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(database.Close)
+	return database
+}
+
+// gitRun runs git in dir with a fixed identity, failing the test on error.
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestSelectBranchBareRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	work := t.TempDir()
+	gitRun(t, work, "init", "--quiet", "--initial-branch=main")
+	gitRun(t, work, "commit", "--quiet", "--allow-empty", "-m", "first")
+	gitRun(t, work, "branch", "feature")
+
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	gitRun(t, work, "clone", "--quiet", "--bare", work, bare)
+
+	gitPath, cleanup, err := openGitSource(bare, t.TempDir())
+	if err != nil {
+		t.Fatalf("openGitSource(bare): %v", err)
+	}
+	cleanup()
+	if gitPath != bare {
+		t.Errorf("openGitSource(bare) = %s, want %s", gitPath, bare)
+	}
+
+	if got := getCurrentBranch(bare); got != "main" {
+		t.Errorf("getCurrentBranch = %q, want main", got)
+	}
+	if got, err := selectBranch(bare, ""); err != nil || got != "main" {
+		t.Errorf("selectBranch = %q, %v; want main", got, err)
+	}
+
+	// HEAD names a default branch that was never created
+	gitRun(t, bare, "symbolic-ref", "HEAD", "refs/heads/master")
+	if got := getCurrentBranch(bare); got != "master" {
+		t.Errorf("getCurrentBranch with unborn HEAD = %q, want master", got)
+	}
+	got, err := selectBranch(bare, "")
+	if err != nil {
+		t.Fatalf("selectBranch with unborn HEAD: %v", err)
+	}
+	// No branch is current, so the first by name is taken
+	if got != "feature" {
+		t.Errorf("selectBranch with unborn HEAD = %q, want feature", got)
+	}
+	if got, _ := selectBranch(bare, "main"); got != "main" {
+		t.Errorf("selectBranch with --branch = %q, want main", got)
+	}
+
+	// A file:// URL is mirror-cloned and removed again by cleanup
+	mirror, cleanup, err := openGitSource("file://"+bare, t.TempDir())
+	if err != nil {
+		t.Fatalf("openGitSource(file://): %v", err)
+	}
+	if got := getCurrentBranch(mirror); got != "master" {
+		t.Errorf("getCurrentBranch of mirror = %q, want master", got)
+	}
+	cleanup()
+	if _, err := os.Stat(mirror); !os.IsNotExist(err) {
+		t.Errorf("mirror %s not removed by cleanup", mirror)
+	}
+}
+
+// divergedGitRepo creates a git repository where feature forks off main's
+// first commit, and its commit is newer than main's tip, so its ID sorts
+// after every main commit. main is checked out.
+//
+//	base ─ main work           (main: shared.txt, main.txt)
+//	   └─ feature work         (feature: shared.txt changed, feature.txt)
+func divergedGitRepo(t *testing.T) string {
+	t.Helper()
+	work := t.TempDir()
+	write := func(path, content string) {
+		if err := os.WriteFile(filepath.Join(work, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(date, msg string) {
+		gitRun(t, work, "add", "-A")
+		gitRun(t, work, "commit", "--quiet", "--date", date, "-m", msg)
+	}
+	gitRun(t, work, "init", "--quiet", "--initial-branch=main")
+	write("shared.txt", "base\n")
+	commit("2024-01-01T00:00:00Z", "base")
+	gitRun(t, work, "branch", "feature")
+	write("main.txt", "main only\n")
+	commit("2024-01-02T00:00:00Z", "main work")
+	gitRun(t, work, "checkout", "--quiet", "feature")
+	write("shared.txt", "changed on feature\n")
+	write("feature.txt", "feature only\n")
+	commit("2024-01-03T00:00:00Z", "feature work")
+	gitRun(t, work, "checkout", "--quiet", "main")
+	return work
+}
+
+func TestImportDivergedBranches(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	url := testRemote(t)
+	work := divergedGitRepo(t)
+
+	runCommand(t, newImportCmd(), "--remote", "origin", "--all", work)
+
+	database := connectTest(t, url)
+	tests := []struct {
+		ref  string
+		want map[string]string
+	}{
+		{"main", map[string]string{"shared.txt": "base\n", "main.txt": "main only\n"}},
+		{"feature", map[string]string{"shared.txt": "changed on feature\n", "feature.txt": "feature only\n"}},
+	}
+	for _, tt := range tests {
+		if got := treeFiles(t, database, tt.ref); !maps.Equal(got, tt.want) {
+			t.Errorf("tree at %s = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestImportUpdate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	url := testRemote(t)
+	ctx := t.Context()
+
+	work := t.TempDir()
+	gitRun(t, work, "init", "--quiet", "--initial-branch=main")
+	for i := range 5 {
+		name := fmt.Sprintf("file%d.txt", i)
+		if err := os.WriteFile(filepath.Join(work, name), []byte(strings.Repeat(name+"\n", i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitRun(t, work, "add", "-A")
+		gitRun(t, work, "commit", "--quiet", "-m", "add "+name)
+	}
+	runCommand(t, newImportCmd(), "--remote", "origin", work)
+
+	// The update renames a file imported before, so its content is already
+	// in a delta group
+	gitRun(t, work, "mv", "file0.txt", "renamed.txt")
+	gitRun(t, work, "commit", "--quiet", "-m", "rename file0")
+	for i := 5; i < 9; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		if err := os.WriteFile(filepath.Join(work, name), []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitRun(t, work, "add", "-A")
+		gitRun(t, work, "commit", "--quiet", "-m", "add "+name)
+	}
+	runCommand(t, newImportCmd(), "--remote", "origin", "--update", work)
+
+	database := connectTest(t, url)
+	headID, err := database.GetHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := database.CommitsBetween(ctx, headID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 10 {
+		t.Fatalf("%d commits after update, want 10", len(chain))
+	}
+
+	// seq continues across the update, in the commits table and the graph
+	for i, c := range chain {
+		var seq int32
+		if err := database.QueryRow(ctx, "SELECT seq FROM pgit_commits WHERE id = $1", c.ID).Scan(&seq); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := database.GetCommitGraphByID(ctx, c.ID)
+		if err != nil || entry == nil {
+			t.Fatalf("graph entry of %s: %v, %v", c.ID, entry, err)
+		}
+		if want := int32(i + 1); seq != want || entry.Seq != want || entry.Depth != want-1 {
+			t.Errorf("commit %d: seq %d, graph seq %d, depth %d; want seq %d, depth %d",
+				i, seq, entry.Seq, entry.Depth, want, want-1)
+		}
+	}
+
+	// Binary lifting jumps from the updated commits back into the first import
+	for n := range len(chain) {
+		got, err := database.GetAncestorID(ctx, headID, n)
+		if err != nil {
+			t.Fatalf("GetAncestorID(HEAD, %d): %v", n, err)
+		}
+		if want := chain[len(chain)-1-n].ID; got != want {
+			t.Errorf("GetAncestorID(HEAD, %d) = %s, want %s", n, got, want)
+		}
+	}
+
+	// The renamed file joins the delta group of its earlier path
+	var oldGroup, newGroup int32
+	err = database.QueryRow(ctx, `
+		SELECT (SELECT group_id FROM pgit_paths WHERE path = 'file0.txt'),
+		       (SELECT group_id FROM pgit_paths WHERE path = 'renamed.txt')`).Scan(&oldGroup, &newGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldGroup != newGroup {
+		t.Errorf("renamed.txt in group %d, want file0.txt's group %d", newGroup, oldGroup)
+	}
+}
+
+func TestSpoolFastExport(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	work := divergedGitRepo(t)
+	// A payload without a trailing newline, and an annotated tag whose
+	// message is skipped rather than spooled
+	if err := os.WriteFile(filepath.Join(work, "raw.bin"), []byte("no newline\x00\xff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, work, "add", "-A")
+	gitRun(t, work, "commit", "--quiet", "-m", "raw\n\nwith a body")
+	gitRun(t, work, "tag", "-a", "v1", "-m", "release notes")
+
+	dir := t.TempDir()
+	streamPath, _, err := exportToFile(work, dir, "--all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, blobs, tips, err := indexFastExport(streamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := os.Open(streamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	// Hide the file's seekability, as with --stdin
+	spCommits, spBlobs, spTips, spoolPath, spoolSize, err := spoolFastExport(io.MultiReader(stream), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool, err := os.Open(spoolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	if len(commits) != 4 || len(blobs) == 0 {
+		t.Fatalf("indexed %d commits and %d blobs, want 4 and some", len(commits), len(blobs))
+	}
+	if !maps.Equal(tips, spTips) {
+		t.Errorf("ref tips = %v, spooled %v", tips, spTips)
+	}
+
+	var want int64
+	for mark, be := range blobs {
+		sp := spBlobs[mark]
+		if sp == nil || sp.Size != be.Size || sp.OriginalID != be.OriginalID {
+			t.Fatalf("blob :%d = %+v, spooled %+v", mark, be, sp)
+		}
+		if got, exp := readBytesAt(spool, sp.Offset, sp.Size), readBytesAt(stream, be.Offset, be.Size); string(got) != string(exp) {
+			t.Errorf("blob :%d spooled as %q, want %q", mark, got, exp)
+		}
+		want += int64(be.Size)
+	}
+	if len(spBlobs) != len(blobs) {
+		t.Errorf("spooled %d blobs, want %d", len(spBlobs), len(blobs))
+	}
+
+	if len(spCommits) != len(commits) {
+		t.Fatalf("spooled %d commits, want %d", len(spCommits), len(commits))
+	}
+	for i, ce := range commits {
+		sp := spCommits[i]
+		if got, exp := readBytesAt(spool, sp.MessageOffset, sp.MessageSize), readBytesAt(stream, ce.MessageOffset, ce.MessageSize); string(got) != string(exp) {
+			t.Errorf("commit :%d message spooled as %q, want %q", ce.Mark, got, exp)
+		}
+		want += int64(ce.MessageSize)
+
+		// Everything but the offsets matches
+		sp.MessageOffset, ce.MessageOffset = 0, 0
+		if !reflect.DeepEqual(sp, ce) {
+			t.Errorf("commit %d = %+v, spooled %+v", i, ce, sp)
+		}
+	}
+
+	// Only blob contents and commit messages are spooled
+	if spoolSize != want {
+		t.Errorf("spool size = %d, want %d", spoolSize, want)
+	}
+}
+
+func TestParentOp(t *testing.T) {
+	// A ─ B ─ C
+	//      └─ X ─ Y     (imported in the order A B X C Y)
+	parents := map[string]string{"B": "A", "X": "B", "C": "B", "Y": "X"}
+	var commits []*db.Commit
+	for _, id := range []string{"A", "B", "X", "C", "Y"} {
+		c := &db.Commit{ID: id}
+		if p, ok := parents[id]; ok {
+			c.ParentID = &p
+		}
+		commits = append(commits, c)
+	}
+	ancestry := newCommitAncestry(buildCommitGraph(commits))
+
+	ops := []pathOp{{CommitID: "A"}, {CommitID: "X"}, {CommitID: "C"}, {CommitID: "Y"}}
+	want := []string{"", "A", "A", "X"}
+	for i, w := range want {
+		op, found := ancestry.parentOp(ops, i)
+		got := ""
+		if op != nil {
+			got = op.CommitID
+		}
+		if !found || got != w {
+			t.Errorf("parentOp(%s) = %q, %v; want %q", ops[i].CommitID, got, found, w)
+		}
+	}
+
+	// Siblings past the scan limit: the search gives up
+	commits = commits[:1]
+	ops = []pathOp{{CommitID: "A"}}
+	for i := range parentOpScanLimit + 1 {
+		id := fmt.Sprintf("S%d", i)
+		commits = append(commits, &db.Commit{ID: id, ParentID: &commits[0].ID})
+		ops = append(ops, pathOp{CommitID: id})
+	}
+	ancestry = newCommitAncestry(buildCommitGraph(commits))
+	if op, found := ancestry.parentOp(ops, 1); !found || op == nil || op.CommitID != "A" {
+		t.Errorf("parentOp within the limit = %v, %v; want A", op, found)
+	}
+	if op, found := ancestry.parentOp(ops, len(ops)-1); found || op != nil {
+		t.Errorf("parentOp past the limit = %v, %v; want not found", op, found)
+	}
+}
+
+func TestImportLineCountsAgainstParentTree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := t.Context()
+	database := connectTest(t, testRemote(t))
+
+	// Both branches change shared.txt; main's change streams in between
+	// base and feature's, but isn't in feature's parent tree
+	work := t.TempDir()
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(work, "shared.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(date, msg string) {
+		gitRun(t, work, "add", "-A")
+		gitRun(t, work, "commit", "--quiet", "--date", date, "-m", msg)
+	}
+	gitRun(t, work, "init", "--quiet", "--initial-branch=main")
+	write("a\nb\n")
+	commit("2024-01-01T00:00:00Z", "base")
+	gitRun(t, work, "branch", "feature")
+	write("a\nb\nmain 1\nmain 2\nmain 3\n")
+	commit("2024-01-02T00:00:00Z", "main work")
+	gitRun(t, work, "checkout", "--quiet", "feature")
+	write("a\nB\n")
+	commit("2024-01-03T00:00:00Z", "feature work")
+	gitRun(t, work, "checkout", "--quiet", "main")
+
+	runCommand(t, newImportCmd(), "--remote", "origin", "--all", work)
+
+	mainID, _ := database.ResolveRefName(ctx, "main")
+	featureID, _ := database.ResolveRefName(ctx, "feature")
+	want := map[string][2]int{mainID: {3, 0}, featureID: {1, 1}}
+	check := func(when string) {
+		t.Helper()
+		changes, err := database.GetFileChanges(ctx, []string{mainID, featureID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 2 {
+			t.Fatalf("%s: %d file changes, want 2", when, len(changes))
+		}
+		for _, c := range changes {
+			if got := [2]int{c.Added, c.Removed}; got != want[c.CommitID] {
+				t.Errorf("%s: %s in %s = +%d -%d, want +%d -%d",
+					when, c.Path, c.CommitID, got[0], got[1], want[c.CommitID][0], want[c.CommitID][1])
+			}
+		}
+	}
+	check("import")
+
+	// Computed again from the stored content
+	if err := database.Exec(ctx, "DELETE FROM pgit_file_changes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.FillFileChanges(ctx, []string{mainID, featureID}, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("fill")
+}
@@ -75,28 +75,38 @@ func runLog(cmd *cobra.Command, args []string) error {
 	}
 	defer r.Close()
 
+	// Follow parent links: other branches (import --all/--branches) and
+	// diverged commits stored by 'pgit fetch' share the database, and a
+	// range scan over IDs would mix their commits into the log.
+	getLog := r.DB.GetCommitLogFirstParent
+
 	var commits []*db.Commit
 	isFromHead := true
+	headID, err := r.DB.GetHead(ctx)
+	if err != nil {
+		return err
+	}
 	if len(args) > 0 {
 		// Start from specified commit
 		commitID, err := resolveCommitRef(ctx, r, args[0])
 		if err != nil {
 			return err
 		}
-		commits, err = r.DB.GetCommitLogFrom(ctx, commitID, maxCount)
+		commits, err = getLog(ctx, commitID, maxCount)
 		if err != nil {
 			return err
 		}
 		// Only show HEAD label if the resolved commit actually is HEAD
-		headID, _ := r.DB.GetHead(ctx)
 		isFromHead = len(commits) > 0 && commits[0].ID == headID
-	} else {
-		commits, err = r.DB.GetCommitLog(ctx, maxCount)
+	} else if headID != "" {
+		commits, err = getLog(ctx, headID, maxCount)
 		if err != nil {
 			return err
 		}
 	}
 
+	applyMailmap(authorMailmap(ctx, r.DB), commits...)
+
 	if len(commits) == 0 {
 		if jsonOutput {
 			fmt.Println("[]")
@@ -108,7 +118,7 @@ func runLog(cmd *cobra.Command, args []string) error {
 
 	// JSON mode
 	if jsonOutput {
-		return printJSONLog(commits)
+		return printJSONLog(ctx, r.DB, commits)
 	}
 
 	// Graph mode - ASCII visualization
@@ -130,12 +140,15 @@ func runLog(cmd *cobra.Command, args []string) error {
 	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
 	accessible := styles.IsAccessible()
 	if !isTTY || noPager || accessible {
-		// Non-interactive full output
+		// Non-interactive full output. Missing notes table (older
+		// remotes) just means no notes are shown.
+		notes, _ := r.DB.GetNotes(ctx, commitIDs(commits))
 		for i, commit := range commits {
 			if i > 0 {
 				fmt.Println()
 			}
 			printCommitFull(commit, isFromHead && i == 0)
+			printNotes(notes[commit.ID])
 		}
 		return nil
 	}
@@ -195,7 +208,10 @@ func printGraphLog(commits []*db.Commit, oneline, isFromHead bool) error {
 type JSONLogEntry struct {
 	ID             string  `json:"id"`
 	ShortID        string  `json:"short_id"`
+	GitSHA         *string `json:"git_sha"`
 	ParentID       *string `json:"parent_id,omitempty"`
+	TreeHash       string  `json:"tree_hash"`
+	CommitHash     string  `json:"commit_hash"`
 	Message        string  `json:"message"`
 	AuthorName     string  `json:"author_name"`
 	AuthorEmail    string  `json:"author_email"`
@@ -203,15 +219,29 @@ type JSONLogEntry struct {
 	CommitterName  string  `json:"committer_name"`
 	CommitterEmail string  `json:"committer_email"`
 	CommittedAt    string  `json:"committed_at"`
+	// Notes by namespace
+	Notes map[string]string `json:"notes,omitempty"`
 }
 
-func printJSONLog(commits []*db.Commit) error {
+func printJSONLog(ctx context.Context, database *db.DB, commits []*db.Commit) error {
+	ids := commitIDs(commits)
+	// Missing mapping table (older databases) just yields null git_sha values
+	gitSHAs, _ := database.GetGitSHAs(ctx, ids)
+	notes, _ := database.GetNotes(ctx, ids)
+
 	entries := make([]JSONLogEntry, len(commits))
 	for i, c := range commits {
+		var gitSHA *string
+		if sha, ok := gitSHAs[c.ID]; ok {
+			gitSHA = &sha
+		}
 		entries[i] = JSONLogEntry{
 			ID:             c.ID,
 			ShortID:        util.ShortID(c.ID),
+			GitSHA:         gitSHA,
 			ParentID:       c.ParentID,
+			TreeHash:       c.TreeHash,
+			CommitHash:     c.CommitHash,
 			Message:        c.Message,
 			AuthorName:     c.AuthorName,
 			AuthorEmail:    c.AuthorEmail,
@@ -220,6 +250,12 @@ func printJSONLog(commits []*db.Commit) error {
 			CommitterEmail: c.CommitterEmail,
 			CommittedAt:    c.CommittedAt.Format(time.RFC3339),
 		}
+		for _, n := range notes[c.ID] {
+			if entries[i].Notes == nil {
+				entries[i].Notes = make(map[string]string)
+			}
+			entries[i].Notes[n.Namespace] = n.Body
+		}
 	}
 
 	enc := json.NewEncoder(os.Stdout)
@@ -651,6 +687,15 @@ func printCommitFull(commit *db.Commit, isHead bool) {
 	}
 }
 
+// commitIDs returns the IDs of commits, in order.
+func commitIDs(commits []*db.Commit) []string {
+	ids := make([]string, len(commits))
+	for i, c := range commits {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
 func splitLines(s string) []string {
 	if s == "" {
 		return []string{""}
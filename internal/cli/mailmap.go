@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/mailmap"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// localMailmapFile is the workspace-local mailmap, applied after .mailmap
+// from the repository so its rules win.
+const localMailmapFile = "mailmap"
+
+func newMailmapCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mailmap",
+		Short: "Manage author identity normalization",
+		Long: `Manage the mapping of author identities to canonical ones.
+
+Rules use git's .mailmap format and are read from two places:
+  - .mailmap in the repository at HEAD
+  - .pgit/mailmap in this workspace (local rules, applied last)
+
+The combined rules are stored in the pgit_mailmap table and applied by
+'pgit analyze authors', 'pgit analyze bus-factor', 'pgit log', 'pgit show',
+and 'pgit blame'. Import stores them automatically; run 'pgit mailmap sync'
+after editing either file.`,
+		RunE: runMailmapList,
+	}
+
+	cmd.PersistentFlags().String("remote", "", "Use a remote database (e.g. 'origin')")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "sync",
+			Short: "Store the rules from .mailmap and .pgit/mailmap in the database",
+			Args:  cobra.NoArgs,
+			RunE:  runMailmapSync,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the stored mailmap rules",
+			Args:  cobra.NoArgs,
+			RunE:  runMailmapList,
+		},
+		newMailmapSuggestCmd(),
+	)
+
+	return cmd
+}
+
+func newMailmapSuggestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "suggest",
+		Short: "Propose identity merges from name and email similarity",
+		Long: `Propose mailmap rules for identities that probably belong to the same
+person: the same email in different case, the same full name, or the same
+distinctive email local part (including GitHub noreply addresses).
+
+Each group maps onto the identity with the most commits. Existing rules are
+applied first, so accepted merges are not proposed again. Review the output,
+then add it to .pgit/mailmap (or pass --write) and run 'pgit mailmap sync'.`,
+		Args: cobra.NoArgs,
+		RunE: runMailmapSuggest,
+	}
+
+	cmd.Flags().Bool("write", false, "Append the suggestions to .pgit/mailmap and sync")
+	return cmd
+}
+
+func runMailmapSync(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	n, err := syncMailmap(ctx, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stored %s mailmap rules\n", ui.FormatCount(n))
+	return nil
+}
+
+func runMailmapList(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	m, err := r.DB.GetMailmap(ctx)
+	if err != nil {
+		return err
+	}
+	if m.Len() == 0 {
+		fmt.Println("No mailmap rules stored")
+		fmt.Println()
+		fmt.Println("Add rules to .mailmap or .pgit/mailmap, then run:")
+		fmt.Println("  pgit mailmap sync")
+		return nil
+	}
+
+	lines := make([]string, 0, m.Len())
+	for _, e := range m.Entries() {
+		lines = append(lines, e.String())
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func runMailmapSuggest(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	write, _ := cmd.Flags().GetBool("write")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	spinner := ui.NewSpinner("Collecting author identities")
+	spinner.Start()
+
+	// Front-to-back sequential scan — optimal xpatch access pattern
+	rows, err := r.DB.Query(ctx, `
+		SELECT author_name, author_email
+		FROM pgit_commits
+		ORDER BY seq ASC
+	`)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+
+	type identityKey struct{ name, email string }
+	counts := make(map[identityKey]int)
+	for rows.Next() {
+		var k identityKey
+		if err := rows.Scan(&k.name, &k.email); err != nil {
+			rows.Close()
+			spinner.Stop()
+			return err
+		}
+		counts[k]++
+	}
+	rows.Close()
+	spinner.Stop()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	identities := make([]mailmap.Identity, 0, len(counts))
+	for k, n := range counts {
+		identities = append(identities, mailmap.Identity{Name: k.name, Email: k.email, Commits: n})
+	}
+
+	m, err := r.DB.GetMailmap(ctx)
+	if err != nil {
+		return err
+	}
+
+	suggestions := mailmap.Suggest(identities, m)
+	if len(suggestions) == 0 {
+		fmt.Printf("No likely duplicates among %s identities\n", ui.FormatCount(len(identities)))
+		return nil
+	}
+
+	var out bytes.Buffer
+	for _, s := range suggestions {
+		fmt.Fprintf(&out, "# %s <%s> (%d commits)\n", s.Canonical.Name, s.Canonical.Email, s.Canonical.Commits)
+		for i, e := range s.Entries() {
+			fmt.Fprintf(&out, "%s  # %d commits\n", e.String(), s.Aliases[i].Commits)
+		}
+		out.WriteByte('\n')
+	}
+
+	if !write {
+		fmt.Print(out.String())
+		fmt.Println(styles.Mute(fmt.Sprintf("%d groups. Append to .pgit/mailmap with: pgit mailmap suggest --write", len(suggestions))))
+		return nil
+	}
+
+	path := filepath.Join(util.PgitPath(r.Root), localMailmapFile)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(out.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	n, err := syncMailmap(ctx, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Appended %d groups to %s, %s rules stored\n",
+		len(suggestions), styles.Mute(".pgit/mailmap"), ui.FormatCount(n))
+	return nil
+}
+
+// ═══════════════════════════════════════════════════════════════════════════
+// Loading and applying
+// ═══════════════════════════════════════════════════════════════════════════
+
+// syncMailmap rebuilds pgit_mailmap in r.DB from .mailmap at HEAD of that
+// database and the workspace's .pgit/mailmap. Returns the number of rules.
+func syncMailmap(ctx context.Context, r *repo.Repository) (int, error) {
+	var entries []mailmap.Entry
+
+	headID, err := r.DB.GetHead(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if headID != "" {
+		blob, err := r.DB.GetFileAtCommit(ctx, ".mailmap", headID)
+		if err != nil {
+			return 0, err
+		}
+		if blob != nil && !blob.IsBinary {
+			parsed, err := mailmap.Parse(bytes.NewReader(blob.Content))
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse .mailmap: %w", err)
+			}
+			entries = append(entries, parsed...)
+		}
+	}
+
+	local, err := os.ReadFile(filepath.Join(util.PgitPath(r.Root), localMailmapFile))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if len(local) > 0 {
+		parsed, err := mailmap.Parse(bytes.NewReader(local))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse .pgit/mailmap: %w", err)
+		}
+		entries = append(entries, parsed...)
+	}
+
+	m := mailmap.New(entries)
+	if err := r.DB.ReplaceMailmap(ctx, m); err != nil {
+		return 0, fmt.Errorf("failed to store mailmap: %w", err)
+	}
+	return m.Len(), nil
+}
+
+// authorMailmap loads the stored identity mapping for display. Errors are
+// not fatal for output commands, so a failed load yields nil, which
+// resolves every identity to itself.
+func authorMailmap(ctx context.Context, database *db.DB) *mailmap.Mailmap {
+	m, err := database.GetMailmap(ctx)
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// applyMailmap rewrites the author and committer identities of each
+// commit in place, for display.
+func applyMailmap(m *mailmap.Mailmap, commits ...*db.Commit) {
+	if m.Len() == 0 {
+		return
+	}
+	for _, c := range commits {
+		if c != nil {
+			c.AuthorName, c.AuthorEmail = m.Resolve(c.AuthorName, c.AuthorEmail)
+			c.CommitterName, c.CommitterEmail = m.Resolve(c.CommitterName, c.CommitterEmail)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/imgajeed76/pgit/v4/internal/config"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newMergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge --abort",
+		Short: "Abort a conflicted merge from 'pgit pull'",
+		Long: `Abort the merge left behind by a 'pgit pull' that stopped with conflicts.
+
+Merges happen in 'pgit pull'. When it stops with conflicts, 'pgit merge
+--abort' puts every file the pull wrote back the way it was before the
+merge: the tree of your local commit, plus any uncommitted changes.
+
+HEAD stays on the remote commit. The local commits were replaced by the
+remote history during the pull, so your local work remains as
+uncommitted changes on top of it; review them with 'pgit status' and
+'pgit diff'.`,
+		Args: cobra.NoArgs,
+		RunE: runMerge,
+	}
+
+	cmd.Flags().Bool("abort", false, "Restore the working directory from before the merge")
+
+	return cmd
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	abort, _ := cmd.Flags().GetBool("abort")
+	if !abort {
+		return util.NewError("Nothing to do").
+			WithMessage("pgit merges remote history with 'pgit pull'").
+			WithSuggestions(
+				"pgit pull [remote]     # Fetch and merge",
+				"pgit merge --abort     # Undo a conflicted merge",
+			)
+	}
+
+	r, err := repo.Open()
+	if err != nil {
+		return err
+	}
+
+	mergeState, err := config.LoadMergeState(r.Root)
+	if err != nil {
+		return err
+	}
+	if !mergeState.InProgress {
+		return util.NewError("No merge to abort").
+			WithMessage("There is no conflicted merge in progress")
+	}
+
+	restored := len(mergeState.TouchedFiles)
+	for _, path := range mergeState.TouchedFiles {
+		if _, err := config.RestoreStage(r.Root, config.StageOriginal, path, r.AbsPath(path)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
+	if err := mergeState.Clear(r.Root); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %d file(s) to the tree of %s\n", styles.Successf("Restored"),
+		restored, styles.Yellow(util.ShortID(mergeState.LocalCommitID)))
+	fmt.Printf("HEAD stays at %s from %s; your local work is now uncommitted changes.\n",
+		styles.Yellow(util.ShortID(mergeState.RemoteCommitID)), styles.Cyan(mergeState.RemoteName))
+	return nil
+}
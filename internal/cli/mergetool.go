@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/config"
+	"github.com/imgajeed76/pgit/v4/internal/merge"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// knownMergeTools maps tool names to their command lines. $BASE, $LOCAL,
+// $REMOTE and $MERGED are replaced by the file paths.
+var knownMergeTools = map[string][]string{
+	"vimdiff":  {"vimdiff", "-f", "-d", "-c", "wincmd J", "$MERGED", "$LOCAL", "$BASE", "$REMOTE"},
+	"nvimdiff": {"nvim", "-d", "-c", "wincmd J", "$MERGED", "$LOCAL", "$BASE", "$REMOTE"},
+	"meld":     {"meld", "$LOCAL", "$BASE", "$REMOTE", "--output", "$MERGED"},
+	"kdiff3":   {"kdiff3", "--auto", "$BASE", "$LOCAL", "$REMOTE", "-o", "$MERGED"},
+	"vscode":   {"code", "--wait", "--merge", "$LOCAL", "$REMOTE", "$BASE", "$MERGED"},
+	"opendiff": {"opendiff", "$LOCAL", "$REMOTE", "-ancestor", "$BASE", "-merge", "$MERGED"},
+}
+
+func newMergetoolCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mergetool [path...]",
+		Short: "Resolve conflicts with an external merge tool",
+		Long: `Run a merge tool on each conflicted file (or the given paths).
+
+The tool gets the common ancestor, local, and remote versions as
+temporary files, and the conflicted file to write the result to. When the
+tool exits successfully and the file no longer contains conflict markers,
+the file is staged and marked resolved.
+
+The tool is taken from --tool, then 'merge.tool' in the repository config,
+then the global config, then $PGIT_MERGETOOL. Known tools: vimdiff,
+nvimdiff, meld, kdiff3, vscode, opendiff. Anything else runs as a shell
+command with $BASE, $LOCAL, $REMOTE and $MERGED set:
+
+  pgit config merge.tool 'mymerge "$BASE" "$LOCAL" "$REMOTE" -o "$MERGED"'`,
+		RunE: runMergetool,
+	}
+
+	cmd.Flags().StringP("tool", "t", "", "Merge tool to use")
+
+	return cmd
+}
+
+func runMergetool(cmd *cobra.Command, args []string) error {
+	tool, _ := cmd.Flags().GetString("tool")
+
+	r, err := repo.Open()
+	if err != nil {
+		return err
+	}
+	if tool == "" {
+		tool = r.Config.GetMergeTool()
+	}
+	if tool == "" {
+		return util.NewError("No merge tool configured").
+			WithSuggestions(
+				"pgit config merge.tool meld         # For this repository",
+				"pgit config --global merge.tool meld  # For all repositories",
+				"pgit mergetool --tool vimdiff       # For this run",
+			)
+	}
+
+	mergeState, err := config.LoadMergeState(r.Root)
+	if err != nil {
+		return err
+	}
+	if !mergeState.HasConflicts() {
+		fmt.Println("No files need merging")
+		return nil
+	}
+
+	paths := mergeState.ConflictedFiles
+	if len(args) > 0 {
+		paths = nil
+		for _, arg := range args {
+			absPath, err := filepath.Abs(arg)
+			if err != nil {
+				return err
+			}
+			relPath, err := r.RelPath(absPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", arg, err)
+			}
+			if !mergeState.IsConflicted(relPath) {
+				return util.NewError("Path is not conflicted").
+					WithMessage(fmt.Sprintf("'%s' has no unresolved conflict", relPath)).
+					WithSuggestion("pgit status  # List unmerged paths")
+			}
+			paths = append(paths, relPath)
+		}
+	}
+	// Resolving removes entries from the list being walked
+	paths = append([]string(nil), paths...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	defer cancel()
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmpDir, err := os.MkdirTemp("", "pgit-mergetool-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	resolved := 0
+	for _, path := range paths {
+		fmt.Printf("Merging %s\n", styles.Cyan(path))
+
+		files := map[string]string{"MERGED": r.AbsPath(path)}
+		name := filepath.Base(path)
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for label, stage := range map[string]config.Stage{
+			"BASE":   config.StageBase,
+			"LOCAL":  config.StageOurs,
+			"REMOTE": config.StageTheirs,
+		} {
+			tmp := filepath.Join(tmpDir, fmt.Sprintf("%s.%s%s", stem, label, ext))
+			exists, err := config.RestoreStage(r.Root, stage, path, tmp)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				// Missing on that side: the tool gets an empty file
+				if err := os.WriteFile(tmp, nil, 0644); err != nil {
+					return err
+				}
+			}
+			files[label] = tmp
+		}
+
+		if err := runMergeTool(tool, files); err != nil {
+			return util.NewError("Merge tool failed").
+				WithMessage(fmt.Sprintf("%s on '%s': %v", tool, path, err)).
+				WithSuggestion("pgit mergetool " + path + "  # Try this file again")
+		}
+
+		content, err := os.ReadFile(files["MERGED"])
+		if err == nil && merge.HasConflictMarkers(content) {
+			fmt.Println(styles.Warningf("  '%s' still has conflict markers, left unresolved", path))
+			continue
+		}
+		if err := r.StageFile(ctx, path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		mergeState.RemoveConflict(path)
+		if err := mergeState.Save(r.Root); err != nil {
+			return err
+		}
+		resolved++
+	}
+
+	fmt.Println()
+	fmt.Printf("Resolved %d of %d file(s)\n", resolved, len(paths))
+	if !mergeState.HasConflicts() {
+		fmt.Println("All conflicts resolved. Complete the merge with 'pgit commit'.")
+	}
+	return nil
+}
+
+// runMergeTool runs tool on files (keyed BASE, LOCAL, REMOTE, MERGED). A
+// known tool name runs directly; anything else is a shell command that
+// sees the paths as environment variables.
+func runMergeTool(tool string, files map[string]string) error {
+	var c *exec.Cmd
+	if argv, ok := knownMergeTools[tool]; ok {
+		args := make([]string, len(argv)-1)
+		for i, arg := range argv[1:] {
+			if strings.HasPrefix(arg, "$") {
+				arg = files[arg[1:]]
+			}
+			args[i] = arg
+		}
+		c = exec.Command(argv[0], args...)
+	} else if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", tool)
+	} else {
+		c = exec.Command("sh", "-c", tool)
+	}
+
+	c.Env = os.Environ()
+	for label, path := range files {
+		c.Env = append(c.Env, label+"="+path)
+	}
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
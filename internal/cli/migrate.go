@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the database schema in place",
+		Long: `Upgrade a database created by an older pgit to the current schema,
+keeping all history.
+
+Each schema version step runs in its own transaction and records the new
+version when it commits, so an interrupted migration leaves the database
+at the last completed step; run 'pgit migrate' again to continue.
+Concurrent migrations of the same database wait for each other.
+
+Databases older than schema version 4 cannot be migrated and have to be
+re-imported with 'pgit import --force'.
+
+Examples:
+  pgit migrate                   # Migrate the local database
+  pgit migrate --remote origin   # Migrate a remote database
+  pgit migrate --dry-run         # List the pending steps`,
+		Args: cobra.NoArgs,
+		RunE: runMigrate,
+	}
+
+	cmd.Flags().String("remote", "", "Migrate a remote database (e.g. 'origin')")
+	cmd.Flags().Bool("dry-run", false, "Show the pending migrations without running them")
+
+	return cmd
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	r, err := repo.Open()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	defer cancel()
+
+	database, where, err := connectForMigrate(ctx, r, remoteName)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	version, pending, err := database.PendingMigrations(ctx)
+	if err != nil {
+		return repo.SchemaError(err, remoteName)
+	}
+	if len(pending) == 0 {
+		fmt.Printf("%s is up to date (schema version %d)\n", where, version)
+		return nil
+	}
+
+	fmt.Printf("%s: schema version %s → %s\n", where,
+		styles.Yellow(fmt.Sprintf("%d", version)), styles.Yellow(fmt.Sprintf("%d", db.SchemaVersion)))
+	for _, m := range pending {
+		fmt.Printf("  %d → %d  %s\n", m.From, m.From+1, m.Description)
+	}
+	if dryRun {
+		fmt.Println()
+		fmt.Println(styles.MutedMsg("Dry run: nothing was changed."))
+		return nil
+	}
+
+	if remoteName != "" {
+		// Pushes write to the tables being rebuilt
+		lock, err := database.TryLockPush(ctx)
+		if err != nil {
+			return err
+		}
+		if lock == nil {
+			return util.NewError("Remote is busy").
+				WithMessage(fmt.Sprintf("A push to '%s' is in progress", remoteName)).
+				WithSuggestion("pgit migrate --remote " + remoteName + "  # Try again when it finishes")
+		}
+		defer lock.Unlock()
+	}
+
+	fmt.Println()
+	start := time.Now()
+	for _, m := range pending {
+		progress := ui.NewProgress(fmt.Sprintf("%d → %d", m.From, m.From+1), 0)
+		ran, err := database.RunMigration(ctx, m, func(done, total int) {
+			progress.SetTotal(total)
+			progress.Update(done)
+		})
+		progress.Done()
+		if err != nil {
+			return util.NewError("Migration failed").
+				WithMessage(fmt.Sprintf("%s: %v", m.Description, err)).
+				WithCause("The step was rolled back; the database is at the last completed version").
+				WithSuggestion("pgit migrate" + remoteFlag(remoteName) + "  # Retry from there")
+		}
+		if !ran {
+			fmt.Println(styles.MutedMsg(fmt.Sprintf("  %d → %d was already done by another session", m.From, m.From+1)))
+		}
+	}
+
+	fmt.Printf("%s %s to schema version %d in %s\n", styles.Successf("Migrated"), where,
+		db.SchemaVersion, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// connectForMigrate connects to the local database or the named remote
+// without rejecting an old schema. It returns the database and a label for
+// messages.
+func connectForMigrate(ctx context.Context, r *repo.Repository, remoteName string) (*db.DB, string, error) {
+	if remoteName == "" {
+		if err := r.ConnectAnySchema(ctx); err != nil {
+			return nil, "", err
+		}
+		return r.DB, "Local database", nil
+	}
+
+	remote, exists := r.Config.GetRemote(remoteName)
+	if !exists {
+		return nil, "", util.RemoteNotFoundError(remoteName)
+	}
+	remoteDB, err := connectRemote(ctx, r, remoteName, remote.URL)
+	if err != nil {
+		return nil, "", err
+	}
+	exists, err = remoteDB.SchemaExists(ctx)
+	if err != nil {
+		remoteDB.Close()
+		return nil, "", err
+	}
+	if !exists {
+		remoteDB.Close()
+		return nil, "", util.NewError("Remote database has no pgit schema").
+			WithMessage(fmt.Sprintf("The remote '%s' exists but has no pgit data", remoteName)).
+			WithSuggestion(fmt.Sprintf("pgit push %s  # Push your repository first", remoteName))
+	}
+	return remoteDB, fmt.Sprintf("Remote '%s'", remoteName), nil
+}
+
+// remoteFlag returns " --remote <name>" for a remote, or "".
+func remoteFlag(remoteName string) string {
+	if remoteName == "" {
+		return ""
+	}
+	return " --remote " + remoteName
+}
@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func newNotesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notes",
+		Short: "Attach notes to existing commits",
+		Long: `Attach notes to commits without rewriting history: CI results, deploy
+markers, review links.
+
+Each commit has at most one note per namespace ('commits' by default).
+Notes are shown by 'pgit log' and 'pgit show', and travel with 'pgit push'
+and 'pgit pull'. When both sides changed the same note, the newer one wins.
+
+Examples:
+  pgit notes add -m "Deployed to production"
+  pgit notes add abc123 --namespace ci -m "build #412 passed"
+  pgit notes show HEAD~2
+  pgit notes list --namespace ci
+  pgit notes remove abc123`,
+		RunE: runNotesList,
+	}
+
+	cmd.PersistentFlags().String("namespace", db.DefaultNotesNamespace, "Notes namespace")
+	cmd.PersistentFlags().String("remote", "", "Use a remote database (e.g. 'origin')")
+
+	add := &cobra.Command{
+		Use:   "add [commit]",
+		Short: "Add a note to a commit (default: HEAD)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runNotesAdd,
+	}
+	add.Flags().StringP("message", "m", "", "Note text")
+	add.Flags().StringP("file", "F", "", "Read the note text from a file ('-' for stdin)")
+	add.Flags().BoolP("force", "f", false, "Replace an existing note")
+
+	cmd.AddCommand(
+		add,
+		&cobra.Command{
+			Use:   "show [commit]",
+			Short: "Show the note on a commit (default: HEAD)",
+			Args:  cobra.MaximumNArgs(1),
+			RunE:  runNotesShow,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List notes, newest first (all namespaces unless --namespace is given)",
+			Args:  cobra.NoArgs,
+			RunE:  runNotesList,
+		},
+		&cobra.Command{
+			Use:   "remove [commit]",
+			Short: "Remove the note from a commit (default: HEAD)",
+			Args:  cobra.MaximumNArgs(1),
+			RunE:  runNotesRemove,
+		},
+	)
+
+	return cmd
+}
+
+func runNotesAdd(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	namespace, _ := cmd.Flags().GetString("namespace")
+	message, _ := cmd.Flags().GetString("message")
+	file, _ := cmd.Flags().GetString("file")
+	force, _ := cmd.Flags().GetBool("force")
+
+	if message != "" && file != "" {
+		return util.NewError("Conflicting flags").
+			WithMessage("Use either -m or -F, not both")
+	}
+	if file != "" {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		message = string(data)
+	}
+	message = strings.TrimRight(message, " \t\r\n")
+	if strings.TrimSpace(message) == "" {
+		return util.NewError("Empty note").
+			WithMessage("Provide the note text with -m or -F").
+			WithSuggestion("pgit notes add -m \"Deployed to production\"")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	commitID, err := resolveCommitRef(ctx, r, refArg(args))
+	if err != nil {
+		return err
+	}
+
+	existing, err := r.DB.GetNote(ctx, commitID, namespace)
+	if err != nil {
+		return err
+	}
+	if existing != nil && !force {
+		return util.NewError("Note already exists").
+			WithMessage(fmt.Sprintf("Commit %s already has a note in namespace '%s'", util.ShortID(commitID), namespace)).
+			WithSuggestions(
+				"pgit notes show "+util.ShortID(commitID)+"  # View it",
+				"pgit notes add -f "+util.ShortID(commitID)+" -m \"...\"  # Replace it",
+			)
+	}
+
+	note := &db.Note{
+		CommitID:  commitID,
+		Namespace: namespace,
+		Body:      message,
+		Author:    fmt.Sprintf("%s <%s>", r.Config.GetUserName(), r.Config.GetUserEmail()),
+		CreatedAt: time.Now(),
+	}
+	if err := r.DB.SetNote(ctx, note); err != nil {
+		return err
+	}
+
+	verb := "Added"
+	if existing != nil {
+		verb = "Replaced"
+	}
+	fmt.Printf("%s note on %s\n", verb, styles.Hash(commitID, true))
+	return nil
+}
+
+func runNotesShow(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	namespace, _ := cmd.Flags().GetString("namespace")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	commitID, err := resolveCommitRef(ctx, r, refArg(args))
+	if err != nil {
+		return err
+	}
+
+	note, err := r.DB.GetNote(ctx, commitID, namespace)
+	if err != nil {
+		return err
+	}
+	if note == nil {
+		return util.NewError("No note found").
+			WithMessage(fmt.Sprintf("Commit %s has no note in namespace '%s'", util.ShortID(commitID), namespace))
+	}
+
+	fmt.Println(note.Body)
+	return nil
+}
+
+func runNotesList(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	namespace := ""
+	if cmd.Flags().Changed("namespace") {
+		namespace, _ = cmd.Flags().GetString("namespace")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	notes, err := r.DB.ListNotes(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if len(notes) == 0 {
+		fmt.Println("No notes")
+		return nil
+	}
+
+	for _, n := range notes {
+		fmt.Printf("%s %s %s  %s\n",
+			styles.Hash(n.CommitID, true),
+			styles.Mute("("+n.Namespace+")"),
+			firstLine(n.Body),
+			styles.MutedMsg(util.RelativeTimeShort(n.CreatedAt)))
+	}
+	return nil
+}
+
+func runNotesRemove(cmd *cobra.Command, args []string) error {
+	remoteName, _ := cmd.Flags().GetString("remote")
+	namespace, _ := cmd.Flags().GetString("namespace")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	commitID, err := resolveCommitRef(ctx, r, refArg(args))
+	if err != nil {
+		return err
+	}
+
+	removed, err := r.DB.DeleteNote(ctx, commitID, namespace, time.Now())
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return util.NewError("No note found").
+			WithMessage(fmt.Sprintf("Commit %s has no note in namespace '%s'", util.ShortID(commitID), namespace))
+	}
+
+	fmt.Printf("Removed note from %s\n", styles.Hash(commitID, true))
+	if remoteName == "" {
+		fmt.Println(styles.Mute("The next push removes it from the remote too"))
+	}
+	return nil
+}
+
+// ═══════════════════════════════════════════════════════════════════════════
+// Display and sync
+// ═══════════════════════════════════════════════════════════════════════════
+
+// refArg returns the commit argument, defaulting to HEAD.
+func refArg(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return "HEAD"
+}
+
+// printNotes prints notes below a commit message the way git log does:
+// a "Notes:" header (with the namespace unless it is the default) followed
+// by the indented note text.
+func printNotes(notes []*db.Note) {
+	for _, n := range notes {
+		fmt.Println()
+		if n.Namespace == db.DefaultNotesNamespace {
+			fmt.Println("Notes:")
+		} else {
+			fmt.Printf("Notes (%s):\n", n.Namespace)
+		}
+		for _, line := range strings.Split(n.Body, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// syncNotes copies the notes and removals of src into dst, keeping the
+// later change where both have one for the same commit and namespace. Notes
+// on commits dst doesn't have are skipped. Returns the number of notes
+// added, updated, or removed.
+func syncNotes(ctx context.Context, src, dst *db.DB) (int, error) {
+	notes, err := src.SyncNotes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read notes: %w", err)
+	}
+	return dst.MergeNotes(ctx, notes)
+}
+
+// reportNotesSync runs syncNotes for push and pull and reports how many
+// notes changed, if any.
+func reportNotesSync(ctx context.Context, src, dst *db.DB, verb string) error {
+	n, err := syncNotes(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		fmt.Printf("%s %d note(s)\n", verb, n)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,7 +12,6 @@ import (
 	"github.com/imgajeed76/pgit/v4/internal/db"
 	"github.com/imgajeed76/pgit/v4/internal/merge"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
-	"github.com/imgajeed76/pgit/v4/internal/ui"
 	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
 	"github.com/imgajeed76/pgit/v4/internal/util"
 	"github.com/spf13/cobra"
@@ -37,21 +37,28 @@ With --rebase, pgit will:
 3. Reset to remote HEAD
 4. Replay local commits on top of remote (creating new commit IDs)
 
-Fix conflicts manually, then 'pgit add <file>' and 'pgit commit' to complete the merge.`,
+Fix conflicts manually, then 'pgit add <file>' and 'pgit commit' to complete the merge.
+
+Dropped connections are retried with backoff. If the pull still fails
+while storing commits, 'pgit pull --resume' finishes it.`,
 		RunE: runPull,
 	}
 
 	cmd.Flags().Bool("rebase", false, "Rebase local commits on top of remote")
+	addTransferFlags(cmd)
 
 	return cmd
 }
 
-func runPull(cmd *cobra.Command, args []string) error {
+func runPull(cmd *cobra.Command, args []string) (err error) {
 	remoteName := "origin"
 	if len(args) > 0 {
 		remoteName = args[0]
 	}
 	useRebase, _ := cmd.Flags().GetBool("rebase")
+	resume, _ := cmd.Flags().GetBool("resume")
+	workers, _ := cmd.Flags().GetInt("workers")
+	workers = resolveWorkers(workers)
 
 	r, err := repo.Open()
 	if err != nil {
@@ -71,9 +78,10 @@ func runPull(cmd *cobra.Command, args []string) error {
 		return util.NewError("Unresolved conflicts from previous pull").
 			WithMessage("Conflicted files:"+conflictList).
 			WithSuggestions(
-				"# Fix conflicts in the listed files, then:",
+				"# Fix conflicts in the listed files (or run 'pgit mergetool'), then:",
 				"pgit add <file>        # Stage resolved file",
 				"pgit commit -m \"...\"   # Complete the merge",
+				"pgit merge --abort     # Or undo the merge",
 			)
 	}
 
@@ -83,7 +91,7 @@ func runPull(cmd *cobra.Command, args []string) error {
 		return util.RemoteNotFoundError(remoteName)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), transferTimeout(cmd))
 	defer cancel()
 
 	// Connect to local database
@@ -91,17 +99,57 @@ func runPull(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer r.Close()
+	// Runs before the deferred Close
+	defer func() {
+		if err == nil {
+			refreshSearchIndex(ctx, r.DB)
+		}
+	}()
+
+	interrupted, err := checkInterruptedTransfer(ctx, r.DB, remoteName, resume, transferPull, transferMerge)
+	if err != nil {
+		return err
+	}
 
 	// Connect to remote database
-	spinner := ui.NewSpinner(fmt.Sprintf("Connecting to %s", styles.Cyan(remoteName)))
-	spinner.Start()
-	remoteDB, err := r.ConnectTo(ctx, remote.URL)
-	spinner.Stop()
+	remoteDB, err := connectRemote(ctx, r, remoteName, remote.URL)
 	if err != nil {
-		return util.DatabaseConnectionError(remote.URL, err)
+		return err
 	}
 	defer remoteDB.Close()
 
+	// An interrupted merge already removed the local commits, so its
+	// progress is kept on any failure: resuming is the only way forward.
+	defer func() {
+		if err != nil && transferStopped(err) {
+			return
+		}
+		if err != nil {
+			if p, _ := r.DB.GetTransferProgress(ctx, remoteName); p != nil && p.Direction == transferMerge {
+				return
+			}
+		}
+		if clearErr := r.DB.ClearTransferProgress(ctx, remoteName); err == nil {
+			err = clearErr
+		}
+	}()
+
+	if err := checkRemoteSchema(ctx, remoteDB, remoteName); err != nil {
+		return err
+	}
+
+	// Notes change independently of commits, so they are synced even when
+	// there are no commits to pull, once the commits they annotate are here.
+	defer func() {
+		if err == nil {
+			err = reportNotesSync(ctx, remoteDB, r.DB, "Pulled")
+		}
+	}()
+
+	if interrupted != nil {
+		return resumePull(ctx, r, remoteDB, interrupted, remoteName, workers)
+	}
+
 	// Get remote HEAD
 	remoteHeadID, err := remoteDB.GetHead(ctx)
 	if err != nil {
@@ -121,7 +169,7 @@ func runPull(cmd *cobra.Command, args []string) error {
 	// Check if already up to date
 	if localHeadID != "" && localHeadID == remoteHeadID {
 		fmt.Println("Already up to date")
-		return nil
+		return r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), remoteHeadID)
 	}
 
 	// Determine relationship between local and remote
@@ -132,7 +180,7 @@ func runPull(cmd *cobra.Command, args []string) error {
 			return err
 		}
 		fmt.Printf("Fast-forward: %d new commit(s)\n", len(newCommits))
-		return pullFastForward(ctx, r, remoteDB, newCommits, remoteName)
+		return pullFastForward(ctx, r, remoteDB, newCommits, remoteName, workers)
 	}
 
 	// Check if this is a fast-forward (local HEAD exists on remote as ancestor)
@@ -142,31 +190,36 @@ func runPull(cmd *cobra.Command, args []string) error {
 	}
 
 	if localExistsOnRemote {
-		// Fast-forward: remote has everything we have, plus more
-		newCommits, err := remoteDB.GetCommitsAfter(ctx, localHeadID)
-		if err != nil {
+		// Fast-forward: remote has everything we have, plus more. A local
+		// HEAD the remote has dropped from its history (force push) is
+		// handled as divergence below.
+		newCommits, err := remoteDB.CommitsBetween(ctx, remoteHeadID, localHeadID)
+		if err != nil && !errors.Is(err, db.ErrNotAncestor) {
 			return err
 		}
-		if len(newCommits) == 0 {
-			fmt.Println("Already up to date")
-			return nil
+		if err == nil {
+			if len(newCommits) == 0 {
+				fmt.Println("Already up to date")
+				return nil
+			}
+			fmt.Printf("Fast-forward: %d new commit(s)\n", len(newCommits))
+			return pullFastForward(ctx, r, remoteDB, newCommits, remoteName, workers)
 		}
-		fmt.Printf("Fast-forward: %d new commit(s)\n", len(newCommits))
-		return pullFastForward(ctx, r, remoteDB, newCommits, remoteName)
 	}
 
-	// Check if remote HEAD exists locally (we're ahead, nothing to pull)
-	remoteExistsLocally, err := r.DB.CommitExists(ctx, remoteHeadID)
+	// Check if remote HEAD is in local history (we're ahead, nothing to
+	// pull). A remote HEAD stored by 'pgit fetch' beside local work is not.
+	localIsAhead, err := localHasAncestor(ctx, r.DB, remoteHeadID, localHeadID)
 	if err != nil {
 		return err
 	}
-	if remoteExistsLocally {
+	if localIsAhead {
 		fmt.Println("Already up to date (local is ahead of remote)")
-		return nil
+		return r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), remoteHeadID)
 	}
 
 	// Diverged: find common ancestor via cross-DB walk
-	commonAncestor, err := findCommonAncestorCrossDB(ctx, r.DB, remoteDB, remoteHeadID)
+	commonAncestor, err := findCommonAncestorCrossDB(ctx, r.DB, remoteDB, remoteHeadID, localHeadID)
 	if err != nil {
 		return err
 	}
@@ -176,103 +229,200 @@ func runPull(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Common ancestor: %s\n", styles.Yellow(util.ShortID(commonAncestor)))
 	}
 
-	// Get new remote commits since common ancestor
-	var newRemoteCommits []*db.Commit
-	if commonAncestor == "" {
-		newRemoteCommits, err = remoteDB.GetAllCommits(ctx)
-	} else {
-		newRemoteCommits, err = remoteDB.GetCommitsAfter(ctx, commonAncestor)
-	}
+	// Get new remote commits since common ancestor (the remote HEAD's
+	// history, found through parents)
+	newRemoteCommits, err := remoteDB.CommitsBetween(ctx, remoteHeadID, commonAncestor)
 	if err != nil {
 		return err
 	}
 
-	// Get local commits since common ancestor
-	var localCommitsAfter []*db.Commit
-	if commonAncestor == "" {
-		localCommitsAfter, err = r.DB.GetAllCommits(ctx)
-	} else {
-		localCommitsAfter, err = r.DB.GetCommitsAfter(ctx, commonAncestor)
-	}
+	// Get local commits since common ancestor, through parents so remote
+	// commits stored by 'pgit fetch' are not taken for local work
+	localCommitsAfter, err := r.DB.CommitsBetween(ctx, localHeadID, commonAncestor)
 	if err != nil {
 		return err
 	}
 
 	if useRebase {
-		return pullRebase(ctx, r, remoteDB, localHeadID, localCommitsAfter, newRemoteCommits, commonAncestor, remoteName)
+		return pullRebase(ctx, r, remoteDB, localHeadID, localCommitsAfter, newRemoteCommits, commonAncestor, remoteName, workers)
 	}
 
-	return pullDiverged(ctx, r, remoteDB, localHeadID, localCommitsAfter, newRemoteCommits, commonAncestor, remoteName)
+	return pullDiverged(ctx, r, remoteDB, localHeadID, localCommitsAfter, newRemoteCommits, commonAncestor, remoteName, workers)
 }
 
-// findCommonAncestorCrossDB finds the latest commit that exists in both databases.
-// Walks remote commits backward (newest first) and checks each against local.
-// Returns the common ancestor ID (may be empty if no common history).
-func findCommonAncestorCrossDB(ctx context.Context, localDB, remoteDB *db.DB, remoteHeadID string) (string, error) {
+// findCommonAncestorCrossDB finds the latest commit of the remote's history
+// that is also in the history of the local HEAD. Walks the remote's
+// first-parent chain from its HEAD and checks each commit against local, a
+// page at a time; commits stored locally by 'pgit fetch' but not behind
+// localHeadID are passed over. Returns the common ancestor ID (may be empty
+// if no common history).
+func findCommonAncestorCrossDB(ctx context.Context, localDB, remoteDB *db.DB, remoteHeadID, localHeadID string) (string, error) {
 	pageSize := 500
 	currentID := remoteHeadID
 
-	for {
+	for currentID != "" {
 		remoteCommits, err := remoteDB.GetCommitLogFrom(ctx, currentID, pageSize)
 		if err != nil {
 			return "", err
 		}
-		if len(remoteCommits) == 0 {
-			return "", nil // No common ancestor found
+		byID := make(map[string]*db.Commit, len(remoteCommits))
+		for _, rc := range remoteCommits {
+			byID[rc.ID] = rc
 		}
 
-		for _, rc := range remoteCommits {
-			exists, err := localDB.CommitExists(ctx, rc.ID)
+		// Follow first parents through this page; a parent that sorts
+		// outside it starts the next page
+		var chain []string
+		rc, ok := byID[currentID]
+		if !ok {
+			return "", fmt.Errorf("commit %s not found on remote", currentID)
+		}
+		for ok {
+			chain = append(chain, rc.ID)
+			currentID = ""
+			if rc.ParentID != nil {
+				currentID = *rc.ParentID
+			}
+			rc, ok = byID[currentID]
+		}
+
+		existing, err := localDB.ExistingCommitIDs(ctx, chain)
+		if err != nil {
+			return "", err
+		}
+		for _, id := range chain {
+			if !existing[id] {
+				continue
+			}
+			ok, err := localDB.IsAncestor(ctx, id, localHeadID)
 			if err != nil {
 				return "", err
 			}
-			if exists {
-				return rc.ID, nil
+			if ok {
+				return id, nil
 			}
 		}
+	}
+	return "", nil // Reached root of remote, no common ancestor
+}
 
-		// Move to next page: oldest commit in this page
-		lastCommit := remoteCommits[len(remoteCommits)-1]
-		if lastCommit.ParentID == nil {
-			return "", nil // Reached root of remote, no common ancestor
+// localHasAncestor reports whether commitID is stored locally and in the
+// history of localHeadID.
+func localHasAncestor(ctx context.Context, localDB *db.DB, commitID, localHeadID string) (bool, error) {
+	exists, err := localDB.CommitExists(ctx, commitID)
+	if err != nil || !exists {
+		return false, err
+	}
+	return localDB.IsAncestor(ctx, commitID, localHeadID)
+}
+
+// divergedCommitIDs collects every commit stored locally after the common
+// ancestor: the local-only commits plus remote commits already there from
+// 'pgit fetch' or a partial pull. Those may be interleaved with the local
+// ones in the xpatch chain, so all of them are cleaned up and the remote
+// ones re-pulled fresh after truncation.
+func divergedCommitIDs(ctx context.Context, database *db.DB, localCommits, remoteCommits []*db.Commit) ([]string, error) {
+	ids := make([]string, 0, len(localCommits)+len(remoteCommits))
+	for _, c := range localCommits {
+		ids = append(ids, c.ID)
+	}
+	remoteIDs := make([]string, len(remoteCommits))
+	for i, c := range remoteCommits {
+		remoteIDs[i] = c.ID
+	}
+	existing, err := database.ExistingCommitIDs(ctx, remoteIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range remoteIDs {
+		if existing[id] {
+			ids = append(ids, id)
 		}
-		currentID = *lastCommit.ParentID
 	}
+	return ids, nil
 }
 
-func pullFastForward(ctx context.Context, r *repo.Repository, remoteDB *db.DB, commits []*db.Commit, remoteName string) error {
-	// Batched insertion: 100 commits per batch
-	const batchSize = 100
-	progress := ui.NewProgress("Pulling", len(commits))
+// resumePull finishes an interrupted pull: it stores the commits still
+// missing up to the HEAD the pull was moving to, then moves HEAD there.
+// A resumed fast-forward updates the working directory as usual. A resumed
+// merge leaves it alone, since it holds the only copy of the local work.
+func resumePull(ctx context.Context, r *repo.Repository, remoteDB *db.DB, p *db.TransferProgress, remoteName string, workers int) error {
+	target, err := remoteDB.GetCommit(ctx, p.TargetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return util.NewError("Cannot resume pull").
+			WithMessage(fmt.Sprintf("Commit %s is no longer on %s", util.ShortID(p.TargetID), remoteName)).
+			WithCause("The remote history was rewritten (force push) since the pull started")
+	}
 
-	for i := 0; i < len(commits); i += batchSize {
-		end := min(i+batchSize, len(commits))
-		batch := commits[i:end]
+	// Commits are stored before their files, so the target's history since
+	// the base is gone over again; what already arrived is skipped. The
+	// remote may have moved on since, so commits are taken by ancestry of
+	// the target, not by ID.
+	commits, err := remoteDB.CommitsBetween(ctx, target.ID, p.BaseID)
+	if errors.Is(err, db.ErrNotAncestor) {
+		return util.NewError("Cannot resume pull").
+			WithMessage(fmt.Sprintf("Commit %s is no longer in the history of %s on %s",
+				util.ShortID(p.BaseID), util.ShortID(target.ID), remoteName)).
+			WithCause("The remote history was rewritten (force push) since the pull started")
+	}
+	if err != nil {
+		return err
+	}
 
-		// Batch insert commits
-		if err := r.DB.CreateCommitsBatch(ctx, batch); err != nil {
-			return fmt.Errorf("failed to create commits: %w", err)
-		}
+	fmt.Printf("Resuming %s from %s (%d of %d commit(s) stored)\n",
+		p.Direction, styles.Cyan(remoteName), p.Done, len(commits))
 
-		// Insert blobs per commit
-		for _, commit := range batch {
-			blobs, err := remoteDB.GetBlobsAtCommit(ctx, commit.ID)
-			if err != nil {
-				return err
-			}
-			if len(blobs) > 0 {
-				if err := r.DB.CreateBlobs(ctx, blobs); err != nil {
-					return fmt.Errorf("failed to create blobs for %s: %w", util.ShortID(commit.ID), err)
-				}
-			}
+	if p.Direction == transferPull {
+		if len(commits) == 0 {
+			// Everything arrived; only HEAD and the working directory are left
+			commits = []*db.Commit{target}
 		}
+		return pullFastForward(ctx, r, remoteDB, commits, remoteName, workers)
+	}
+
+	if err := copyCommits(ctx, remoteDB, r.DB, commits, "Pulling", workers, trackTransfer(ctx, r.DB, p)); err != nil {
+		return err
+	}
+	if err := r.DB.SetHead(ctx, target.ID); err != nil {
+		return err
+	}
+	if err := r.DB.SetSyncState(ctx, remoteName, &target.ID); err != nil {
+		return err
+	}
+	if err := r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), target.ID); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", styles.Successf("Updated to"), styles.Yellow(util.ShortID(target.ID)))
+	fmt.Println("Your local changes from the interrupted merge are still in the working directory.")
+	fmt.Println("Review them with 'pgit status' and 'pgit diff', then commit.")
+	return nil
+}
 
-		progress.Update(end)
+func pullFastForward(ctx context.Context, r *repo.Repository, remoteDB *db.DB, commits []*db.Commit, remoteName string, workers int) error {
+	lastCommit := commits[len(commits)-1]
+	transfer := &db.TransferProgress{
+		RemoteName: remoteName,
+		Direction:  transferPull,
+		TargetID:   lastCommit.ID,
+		Total:      len(commits),
+	}
+	if commits[0].ParentID != nil {
+		transfer.BaseID = *commits[0].ParentID
+	}
+	if err := r.DB.SetTransferProgress(ctx, transfer); err != nil {
+		return err
+	}
+	// Commits and files already downloaded by 'pgit fetch' are skipped
+	if err := copyCommits(ctx, remoteDB, r.DB, commits, "Pulling", workers, trackTransfer(ctx, r.DB, transfer)); err != nil {
+		return err
 	}
-	progress.Done()
 
 	// Update HEAD
-	lastCommit := commits[len(commits)-1]
 	if err := r.DB.SetHead(ctx, lastCommit.ID); err != nil {
 		return err
 	}
@@ -281,10 +431,25 @@ func pullFastForward(ctx context.Context, r *repo.Repository, remoteDB *db.DB, c
 	if err := r.DB.SetSyncState(ctx, remoteName, &lastCommit.ID); err != nil {
 		return err
 	}
+	if err := r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), lastCommit.ID); err != nil {
+		return err
+	}
 
-	// Update working directory
+	if err := updateWorkingTree(ctx, r, lastCommit.ID); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", styles.Successf("Updated to"), styles.Yellow(util.ShortID(lastCommit.ID)))
+
+	return nil
+}
+
+// updateWorkingTree writes the tree at commitID to the working directory
+// after a fast-forward.
+func updateWorkingTree(ctx context.Context, r *repo.Repository, commitID string) error {
 	fmt.Println("Updating working directory...")
-	tree, err := r.DB.GetTreeAtCommit(ctx, lastCommit.ID)
+	tree, err := r.DB.GetTreeAtCommit(ctx, commitID)
 	if err != nil {
 		return err
 	}
@@ -301,10 +466,6 @@ func pullFastForward(ctx context.Context, r *repo.Repository, remoteDB *db.DB, c
 			_ = os.WriteFile(absPath, blob.Content, os.FileMode(blob.Mode))
 		}
 	}
-
-	fmt.Println()
-	fmt.Printf("%s %s\n", styles.Successf("Updated to"), styles.Yellow(util.ShortID(lastCommit.ID)))
-
 	return nil
 }
 
@@ -329,7 +490,7 @@ const (
 	mergeCategoryBinaryConflict                      // both changed a binary file → whole-file conflict
 )
 
-func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localHeadID string, localCommits, remoteCommits []*db.Commit, commonAncestor, remoteName string) error {
+func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localHeadID string, localCommits, remoteCommits []*db.Commit, commonAncestor, remoteName string, workers int) error {
 	fmt.Printf("Local commits since divergence: %d\n", len(localCommits))
 	fmt.Printf("Remote commits to pull: %d\n", len(remoteCommits))
 
@@ -370,6 +531,13 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 	}
 
 	// ─── Phase 2: Three-way merge per file ────────────────────────────
+	style, _ := merge.ParseConflictStyle(r.Config.GetConflictStyle())
+	drivers, err := merge.ParseDrivers(r.Config.Merge.Drivers)
+	if err != nil {
+		return util.NewError("Invalid merge driver configuration").
+			WithMessage(err.Error()).
+			WithSuggestion("pgit config merge.drivers ''  # Use the built-in drivers only")
+	}
 	allPaths := make(map[string]bool)
 	for p := range localFiles {
 		allPaths[p] = true
@@ -458,12 +626,13 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 			continue
 		}
 
-		// Case: text file — run three-way merge
+		// Case: text file — run three-way merge, structured where a driver
+		// matches the path
 		var baseContent []byte
 		if ancestor != nil {
 			baseContent = ancestor.Content
 		}
-		mergeResult := merge.ThreeWay(baseContent, local.Content, remote.Content, remoteName)
+		mergeResult := drivers.Merge(path, baseContent, local.Content, remote.Content, remoteName, style)
 
 		if mergeResult.HasConflicts {
 			results = append(results, mergeFileResult{
@@ -523,28 +692,25 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 
 	// ─── Phase 4: Delete diverged local data and pull remote ──────────
 
-	// Collect ALL commit IDs after common ancestor (local-only commits plus
-	// any previously-pulled remote commits that may be interleaved in the
-	// xpatch chain). We need these to clean up file_refs and content.
-	var allAfterIDs []string
-	for _, c := range localCommits {
-		allAfterIDs = append(allAfterIDs, c.ID)
-	}
-	// Also include any remote commits that already exist locally from a
-	// previous partial pull — they'll be re-pulled fresh after truncation.
-	for _, rc := range remoteCommits {
-		exists, err := r.DB.CommitExists(ctx, rc.ID)
-		if err != nil {
-			return err
-		}
-		if exists {
-			allAfterIDs = append(allAfterIDs, rc.ID)
-		}
+	allAfterIDs, err := divergedCommitIDs(ctx, r.DB, localCommits, remoteCommits)
+	if err != nil {
+		return err
 	}
 
 	// DELETE FIRST, THEN PULL — required by xpatch's append-only delta chain.
 	// Local changes are already loaded in memory (localTree/results) and the
 	// working directory files are untouched, so no data is lost.
+	transfer := &db.TransferProgress{
+		RemoteName: remoteName,
+		Direction:  transferMerge,
+		BaseID:     commonAncestor,
+		TargetID:   remoteHeadCommit.ID,
+		Total:      len(remoteCommits),
+	}
+	if err := r.DB.SetTransferProgress(ctx, transfer); err != nil {
+		return err
+	}
+
 	fmt.Println()
 	fmt.Println("Cleaning up diverged commits...")
 
@@ -560,32 +726,9 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 	// Pull remote commits fresh (they append to the truncated chain)
 	fmt.Println("Pulling remote commits...")
 
-	const batchSize = 100
-	progress := ui.NewProgress("Pulling", len(remoteCommits))
-
-	for i := 0; i < len(remoteCommits); i += batchSize {
-		end := min(i+batchSize, len(remoteCommits))
-		batch := remoteCommits[i:end]
-
-		if err := r.DB.CreateCommitsBatch(ctx, batch); err != nil {
-			return fmt.Errorf("failed to create commits: %w", err)
-		}
-
-		for _, commit := range batch {
-			blobs, err := remoteDB.GetBlobsAtCommit(ctx, commit.ID)
-			if err != nil {
-				return err
-			}
-			if len(blobs) > 0 {
-				if err := r.DB.CreateBlobs(ctx, blobs); err != nil {
-					return fmt.Errorf("failed to create blobs for %s: %w", util.ShortID(commit.ID), err)
-				}
-			}
-		}
-
-		progress.Update(end)
+	if err := copyCommits(ctx, remoteDB, r.DB, remoteCommits, "Pulling", workers, trackTransfer(ctx, r.DB, transfer)); err != nil {
+		return err
 	}
-	progress.Done()
 
 	// Update HEAD to remote
 	if err := r.DB.SetHead(ctx, remoteHeadCommit.ID); err != nil {
@@ -594,6 +737,13 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 	if err := r.DB.SetSyncState(ctx, remoteName, &remoteHeadCommit.ID); err != nil {
 		return err
 	}
+	if err := r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), remoteHeadCommit.ID); err != nil {
+		return err
+	}
+	// The remote commits are in; what follows only touches local state
+	if err := r.DB.ClearTransferProgress(ctx, remoteName); err != nil {
+		return err
+	}
 
 	// ─── Phase 5: Update working directory ────────────────────────────
 	fmt.Println()
@@ -607,6 +757,30 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 		CommonAncestor: commonAncestor,
 	}
 
+	// With conflicts, keep what 'pgit merge --abort', 'pgit checkout
+	// --ours/--theirs' and 'pgit mergetool' need before overwriting files
+	if mergeState.InProgress {
+		if err := config.ResetStages(r.Root); err != nil {
+			return err
+		}
+		for _, res := range results {
+			if res.category == mergeCategoryLocalOnly {
+				continue
+			}
+			if err := config.SaveWorkingFileStage(r.Root, config.StageOriginal, res.path); err != nil {
+				return fmt.Errorf("failed to save %s: %w", res.path, err)
+			}
+			mergeState.AddTouched(res.path)
+
+			switch res.category {
+			case mergeCategoryConflicted, mergeCategoryBinaryConflict, mergeCategoryDeleteLocal, mergeCategoryDeleteRemote:
+				if err := saveMergeStages(r.Root, res.path, ancestorFiles[res.path], localFiles[res.path], remoteFiles[res.path]); err != nil {
+					return fmt.Errorf("failed to save %s: %w", res.path, err)
+				}
+			}
+		}
+	}
+
 	// Process each merge result
 	for _, res := range results {
 		absPath := r.AbsPath(res.path)
@@ -667,14 +841,17 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 			// Binary or symlink conflict — fall back to whole-file markers
 			local := localFiles[res.path]
 			remote := remoteFiles[res.path]
-			var localContent, remoteContent []byte
+			var baseContent, localContent, remoteContent []byte
+			if ancestor := ancestorFiles[res.path]; ancestor != nil {
+				baseContent = ancestor.Content
+			}
 			if local != nil {
 				localContent = local.Content
 			}
 			if remote != nil {
 				remoteContent = remote.Content
 			}
-			if err := config.CreateConflictedFile(absPath, localContent, remoteContent, remoteName); err != nil {
+			if err := config.CreateConflictedFile(absPath, baseContent, localContent, remoteContent, remoteName, style); err != nil {
 				return fmt.Errorf("failed to create conflicted file %s: %w", res.path, err)
 			}
 			mergeState.AddConflict(res.path)
@@ -732,9 +909,12 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 			fmt.Printf("  Auto-merged %d file(s) successfully\n", len(autoMergedFiles))
 		}
 		fmt.Println()
-		fmt.Println("Fix the conflicts, then:")
+		fmt.Println("Fix the conflicts (or run 'pgit mergetool'), then:")
 		fmt.Println("  pgit add <file>        # Stage resolved file")
 		fmt.Println("  pgit commit -m \"...\"   # Complete the merge")
+		fmt.Println()
+		fmt.Println("Take one side with 'pgit checkout --ours|--theirs <file>',")
+		fmt.Println("or undo the merge with 'pgit merge --abort'.")
 	} else if len(autoMergedFiles) > 0 || len(localOnlyFiles) > 0 {
 		fmt.Println(styles.Successf("Merged successfully (no conflicts)"))
 		if len(autoMergedFiles) > 0 {
@@ -762,16 +942,59 @@ func pullDiverged(ctx context.Context, r *repo.Repository, remoteDB *db.DB, loca
 	return nil
 }
 
+// saveMergeStages keeps the ancestor, local and remote versions of a
+// conflicted file. nil means the file doesn't exist on that side.
+func saveMergeStages(root, path string, ancestor, local, remote *db.Blob) error {
+	stages := []struct {
+		stage config.Stage
+		blob  *db.Blob
+	}{
+		{config.StageBase, ancestor},
+		{config.StageOurs, local},
+		{config.StageTheirs, remote},
+	}
+	for _, s := range stages {
+		b := s.blob
+		if b == nil || b.IsDeleted() {
+			continue
+		}
+		content := b.Content
+		if content == nil {
+			content = []byte{}
+		}
+		var target *string
+		if b.IsSymlink {
+			target = b.SymlinkTarget
+		}
+		if err := config.SaveStage(root, s.stage, path, content, os.FileMode(b.Mode), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // pullRebase rebases local commits on top of remote
-func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localHeadID string, localCommits, remoteCommits []*db.Commit, commonAncestor, remoteName string) error {
+func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localHeadID string, localCommits, remoteCommits []*db.Commit, commonAncestor, remoteName string, workers int) error {
 	fmt.Printf("Rebasing %d local commit(s) onto remote\n", len(localCommits))
 
+	remoteHeadCommit := remoteCommits[len(remoteCommits)-1]
+	transfer := &db.TransferProgress{
+		RemoteName: remoteName,
+		Direction:  transferMerge,
+		BaseID:     commonAncestor,
+		TargetID:   remoteHeadCommit.ID,
+		Total:      len(remoteCommits),
+	}
+	if err := r.DB.SetTransferProgress(ctx, transfer); err != nil {
+		return err
+	}
+
 	// Delete local commits after common ancestor.
 	// Must delete blobs first, then truncate the xpatch commit chain.
 	fmt.Println("Resetting to common ancestor...")
-	localIDs := make([]string, len(localCommits))
-	for i, c := range localCommits {
-		localIDs[i] = c.ID
+	localIDs, err := divergedCommitIDs(ctx, r.DB, localCommits, remoteCommits)
+	if err != nil {
+		return err
 	}
 	if err := r.DB.DeleteBlobsForCommits(ctx, localIDs); err != nil {
 		return fmt.Errorf("failed to clean up blobs: %w", err)
@@ -787,35 +1010,11 @@ func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localH
 
 	// Pull remote commits in batches
 	fmt.Println("Pulling remote commits...")
-	const batchSize = 100
-	progress := ui.NewProgress("Pulling", len(remoteCommits))
-
-	for i := 0; i < len(remoteCommits); i += batchSize {
-		end := min(i+batchSize, len(remoteCommits))
-		batch := remoteCommits[i:end]
-
-		if err := r.DB.CreateCommitsBatch(ctx, batch); err != nil {
-			return fmt.Errorf("failed to create commits: %w", err)
-		}
-
-		for _, commit := range batch {
-			blobs, err := remoteDB.GetBlobsAtCommit(ctx, commit.ID)
-			if err != nil {
-				return err
-			}
-			if len(blobs) > 0 {
-				if err := r.DB.CreateBlobs(ctx, blobs); err != nil {
-					return fmt.Errorf("failed to create blobs for %s: %w", util.ShortID(commit.ID), err)
-				}
-			}
-		}
-
-		progress.Update(end)
+	if err := copyCommits(ctx, remoteDB, r.DB, remoteCommits, "Pulling", workers, trackTransfer(ctx, r.DB, transfer)); err != nil {
+		return err
 	}
-	progress.Done()
 
 	// Update HEAD to remote head
-	remoteHeadCommit := remoteCommits[len(remoteCommits)-1]
 	if err := r.DB.SetHead(ctx, remoteHeadCommit.ID); err != nil {
 		return err
 	}
@@ -824,6 +1023,13 @@ func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localH
 	if err := r.DB.SetSyncState(ctx, remoteName, &remoteHeadCommit.ID); err != nil {
 		return err
 	}
+	if err := r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), remoteHeadCommit.ID); err != nil {
+		return err
+	}
+	// The remote commits are in; what follows only touches local state
+	if err := r.DB.ClearTransferProgress(ctx, remoteName); err != nil {
+		return err
+	}
 
 	// Now replay local commits
 	if len(localCommits) > 0 {
@@ -847,10 +1053,31 @@ func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localH
 				parentID = &currentHeadID
 			}
 
+			// The tree is the new parent's with the old commit's changes on
+			// top, and the commit hash chains onto the new parent's
+			tree := util.NewMerkleTree()
+			parentHash := ""
+			if parentID != nil {
+				tree, err = r.DB.MerkleTreeAt(ctx, *parentID)
+				if err != nil {
+					return fmt.Errorf("failed to read tree for replay: %w", err)
+				}
+				hashes, err := r.DB.CommitHashes(ctx, []string{*parentID})
+				if err != nil {
+					return err
+				}
+				parentHash = hashes[*parentID]
+			}
+			for _, blob := range oldBlobs {
+				tree.Set(util.TreeEntry{
+					Path: blob.Path, Mode: blob.Mode, ContentHash: blob.ContentHash, IsSymlink: blob.IsSymlink,
+				})
+			}
+
 			newCommit := &db.Commit{
 				ID:             newCommitID,
 				ParentID:       parentID,
-				TreeHash:       oldCommit.TreeHash,
+				TreeHash:       tree.Hash(),
 				Message:        oldCommit.Message,
 				AuthorName:     oldCommit.AuthorName,
 				AuthorEmail:    oldCommit.AuthorEmail,
@@ -859,6 +1086,7 @@ func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localH
 				CommitterEmail: oldCommit.CommitterEmail,
 				CommittedAt:    time.Now(), // New timestamp for replay
 			}
+			newCommit.CommitHash = newCommit.ComputeHash(parentHash)
 
 			if err := r.DB.CreateCommit(ctx, newCommit); err != nil {
 				return fmt.Errorf("failed to replay commit: %w", err)
@@ -883,6 +1111,8 @@ func pullRebase(ctx context.Context, r *repo.Repository, remoteDB *db.DB, localH
 					return fmt.Errorf("failed to replay blobs: %w", err)
 				}
 			}
+			// Line counts against the new parent (computed later if this fails)
+			_, _ = r.DB.FillFileChanges(ctx, []string{newCommitID}, nil)
 
 			// Update HEAD
 			if err := r.DB.SetHead(ctx, newCommitID); err != nil {
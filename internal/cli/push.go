@@ -3,7 +3,6 @@ package cli
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/imgajeed76/pgit/v4/internal/db"
 	"github.com/imgajeed76/pgit/v4/internal/repo"
@@ -23,17 +22,37 @@ func newPushCmd() *cobra.Command {
 If no remote is specified, uses 'origin' by default.
 
 Note: Push will fail if the remote has commits that you don't have locally.
-In that case, pull first to sync.`,
+In that case, pull first to sync.
+
+Commits are sent in batches of 100, one transaction each, then file
+versions in bulk, one delta group per worker (--workers). Dropped
+connections are retried with backoff; if the push still fails, the
+progress is kept and 'pgit push --resume' continues where it stopped.
+
+The first push to an empty remote creates the pgit tables there, using
+pg_xpatch if the server has it and plain heap tables otherwise
+(--storage chooses explicitly). Pushes work between repositories with
+different storage.`,
 		RunE: runPush,
 	}
 
 	cmd.Flags().BoolP("force", "f", false, "Force push (overwrite remote)")
+	cmd.Flags().String("storage", "auto", "Storage for a new remote: auto, xpatch or heap")
+	addTransferFlags(cmd)
 
 	return cmd
 }
 
-func runPush(cmd *cobra.Command, args []string) error {
+func runPush(cmd *cobra.Command, args []string) (err error) {
 	force, _ := cmd.Flags().GetBool("force")
+	resume, _ := cmd.Flags().GetBool("resume")
+	workers, _ := cmd.Flags().GetInt("workers")
+	workers = resolveWorkers(workers)
+	storageFlag, _ := cmd.Flags().GetString("storage")
+	storage, err := db.ParseBackend(storageFlag)
+	if err != nil {
+		return util.NewError("Invalid --storage value").WithMessage(err.Error())
+	}
 
 	remoteName := "origin"
 	if len(args) > 0 {
@@ -51,7 +70,7 @@ func runPush(cmd *cobra.Command, args []string) error {
 		return util.RemoteNotFoundError(remoteName)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), transferTimeout(cmd))
 	defer cancel()
 
 	// Connect to local database
@@ -60,16 +79,28 @@ func runPush(cmd *cobra.Command, args []string) error {
 	}
 	defer r.Close()
 
+	interrupted, err := checkInterruptedTransfer(ctx, r.DB, remoteName, resume, transferPush)
+	if err != nil {
+		return err
+	}
+
 	// Connect to remote database
-	spinner := ui.NewSpinner(fmt.Sprintf("Connecting to %s", styles.Cyan(remoteName)))
-	spinner.Start()
-	remoteDB, err := r.ConnectTo(ctx, remote.URL)
-	spinner.Stop()
+	remoteDB, err := connectRemote(ctx, r, remoteName, remote.URL)
 	if err != nil {
-		return util.DatabaseConnectionError(remote.URL, err)
+		return err
 	}
 	defer remoteDB.Close()
 
+	// Progress is kept only when the push can be resumed; any other
+	// failure needs the user to act first (e.g. pull).
+	defer func() {
+		if err == nil || !transferStopped(err) {
+			if clearErr := r.DB.ClearTransferProgress(ctx, remoteName); err == nil {
+				err = clearErr
+			}
+		}
+	}()
+
 	// Initialize remote schema if needed
 	exists, err = remoteDB.SchemaExists(ctx)
 	if err != nil {
@@ -77,10 +108,43 @@ func runPush(cmd *cobra.Command, args []string) error {
 	}
 	if !exists {
 		fmt.Println("Initializing remote schema...")
+		remoteDB.UseBackend(storage)
 		if err := remoteDB.InitSchema(ctx); err != nil {
 			return err
 		}
+		if storage == "" && remoteDB.Backend(ctx) == db.BackendHeap {
+			fmt.Println(styles.MutedMsg("pg_xpatch is not installed on the remote; storing content in heap tables"))
+		}
 	}
+	if err := checkRemoteSchema(ctx, remoteDB, remoteName); err != nil {
+		return err
+	}
+
+	// Notes change independently of commits, so they are synced even when
+	// there are no commits to push, once the commits they annotate are there.
+	defer func() {
+		if err == nil {
+			err = reportNotesSync(ctx, r.DB, remoteDB, "Pushed")
+		}
+	}()
+
+	// One push at a time per remote repository. The HEAD read below stays
+	// valid for the whole push, since every pusher holds this lock while
+	// moving it.
+	lock, err := remoteDB.TryLockPush(ctx)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		spinner := ui.NewSpinner(fmt.Sprintf("Waiting for another push to %s", styles.Cyan(remoteName)))
+		spinner.Start()
+		lock, err = remoteDB.LockPush(ctx)
+		spinner.Stop()
+		if err != nil {
+			return err
+		}
+	}
+	defer lock.Unlock()
 
 	// Get local HEAD
 	localHeadID, err := r.DB.GetHead(ctx)
@@ -98,41 +162,47 @@ func runPush(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Both sides must have the same 'pgit filter' rewrites
+	if err := checkRewrites(ctx, r.DB, remoteDB, remoteName, remoteHeadID); err != nil {
+		return err
+	}
+
 	// Check if we need to push
 	if remoteHeadID != "" && remoteHeadID == localHeadID {
 		fmt.Println("Everything up-to-date")
-		return nil
+		return r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), localHeadID)
 	}
 
-	// Check for divergence (no limit — just check if remote HEAD exists locally)
-	if remoteHeadID != "" && !force {
-		localHasRemoteHead, err := r.DB.CommitExists(ctx, remoteHeadID)
+	// Check for divergence: the remote HEAD must be in local history. One
+	// stored by 'pgit fetch' beside local work is not.
+	remoteIsAncestor := false
+	if remoteHeadID != "" {
+		remoteIsAncestor, err = localHasAncestor(ctx, r.DB, remoteHeadID, localHeadID)
 		if err != nil {
 			return err
 		}
-		if !localHasRemoteHead {
-			return util.NewError("Push rejected (non-fast-forward)").
-				WithMessage("Remote has commits that you don't have locally").
-				WithCauses(
-					"Someone else pushed to the remote",
-					"Your local branch is out of date",
-				).
-				WithSuggestions(
-					"pgit pull "+remoteName+"  # Pull first to sync",
-					"pgit push --force "+remoteName+"  # Force push (overwrites remote)",
-				)
-		}
+	}
+	if remoteHeadID != "" && !remoteIsAncestor && !force {
+		return util.NewError("Push rejected (non-fast-forward)").
+			WithMessage("Remote has commits that are not in your history").
+			WithCauses(
+				"Someone else pushed to the remote",
+				"Your local branch is out of date",
+			).
+			WithSuggestions(
+				"pgit pull "+remoteName+"  # Pull first to sync",
+				"pgit push --force "+remoteName+"  # Force push (overwrites remote)",
+			)
 	}
 
-	// Get commits to push — no limit
-	var commitsToPush []*db.Commit
-	if remoteHeadID == "" {
-		// First push: push everything
-		commitsToPush, err = r.DB.GetAllCommits(ctx)
-	} else {
-		// Incremental push: only commits after remote HEAD
-		commitsToPush, err = r.DB.GetCommitsAfter(ctx, remoteHeadID)
+	// Get commits to push — no limit. Only commits after remote HEAD when
+	// it is an ancestor; otherwise (first or forced push) the whole history,
+	// where commits the remote has already are skipped.
+	stopID := ""
+	if remoteIsAncestor {
+		stopID = remoteHeadID
 	}
+	commitsToPush, err := r.DB.CommitsBetween(ctx, localHeadID, stopID)
 	if err != nil {
 		return err
 	}
@@ -142,9 +212,26 @@ func runPush(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	if interrupted != nil {
+		fmt.Printf("Resuming push (%d of %d commit(s) already sent)\n", interrupted.Done, interrupted.Total)
+	}
 	fmt.Printf("Pushing %d commit(s)...\n", len(commitsToPush))
 
-	// Push in batches of 100, each batch wrapped in a transaction
+	// Recorded locally, so a push that dies for good can be resumed.
+	// Commits that already reached the remote are skipped per batch.
+	transfer := &db.TransferProgress{
+		RemoteName: remoteName,
+		Direction:  transferPush,
+		BaseID:     remoteHeadID,
+		TargetID:   localHeadID,
+		Total:      len(commitsToPush),
+	}
+	if err := r.DB.SetTransferProgress(ctx, transfer); err != nil {
+		return err
+	}
+	recordProgress := trackTransfer(ctx, r.DB, transfer)
+
+	// Push commits in batches of 100, each batch wrapped in a transaction
 	const batchSize = 100
 	progress := ui.NewProgress("Pushing", len(commitsToPush))
 
@@ -152,43 +239,62 @@ func runPush(cmd *cobra.Command, args []string) error {
 		end := min(i+batchSize, len(commitsToPush))
 		batch := commitsToPush[i:end]
 
-		err := remoteDB.WithTx(ctx, func(tx pgx.Tx) error {
-			// Insert commits via COPY on tx
-			if err := remoteDB.CreateCommitsBatchTx(ctx, tx, batch); err != nil {
-				return fmt.Errorf("failed to push commits: %w", err)
-			}
-
-			// Insert blobs per commit within same tx
-			for _, commit := range batch {
-				blobs, err := r.DB.GetBlobsAtCommit(ctx, commit.ID)
+		err := db.Retry(ctx, warnRetry, func() error {
+			return storeCommits(ctx, remoteDB, batch, func(tx pgx.Tx) error {
+				// Clients that predate the push lock can still move HEAD.
+				// Stop before adding commits on top of a line that changed.
+				current, err := remoteDB.LockRefTx(ctx, tx, "HEAD")
 				if err != nil {
 					return err
 				}
-				if len(blobs) > 0 {
-					if err := remoteDB.CreateBlobsTx(ctx, tx, blobs); err != nil {
-						return fmt.Errorf("failed to push blobs for %s: %w", util.ShortID(commit.ID), err)
-					}
+				if current != remoteHeadID {
+					return remoteHeadMovedError(remoteName, remoteHeadID, current)
 				}
-			}
-			return nil
+				return nil
+			})
 		})
 		if err != nil {
 			return err
 		}
+		if err := recordProgress(batch[len(batch)-1], end); err != nil {
+			return err
+		}
 
 		progress.Update(end)
 	}
 	progress.Done()
 
-	// Update remote HEAD
-	if err := remoteDB.SetHead(ctx, localHeadID); err != nil {
+	// File versions follow in bulk, by delta group
+	if err := copyFiles(ctx, r.DB, remoteDB, commitsToPush, workers); err != nil {
 		return err
 	}
 
+	// Update remote HEAD, only if it is still where the push started
+	var swapped bool
+	err = db.Retry(ctx, warnRetry, func() error {
+		var err error
+		swapped, err = remoteDB.CompareAndSwapRef(ctx, "HEAD", remoteHeadID, localHeadID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !swapped {
+		// A retried swap whose first attempt went through finds HEAD moved
+		// to the pushed commit already
+		current, _ := remoteDB.GetHead(ctx)
+		if current != localHeadID {
+			return remoteHeadMovedError(remoteName, remoteHeadID, current)
+		}
+	}
+
 	// Update sync state
 	if err := r.DB.SetSyncState(ctx, remoteName, &localHeadID); err != nil {
 		return err
 	}
+	if err := r.DB.SetRef(ctx, db.RemoteTrackingRef(remoteName), localHeadID); err != nil {
+		return err
+	}
 
 	fmt.Println()
 	fmt.Printf("%s %s -> %s\n", styles.Successf("Pushed"),
@@ -197,3 +303,22 @@ func runPush(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// remoteHeadMovedError reports a push that lost a race: the remote HEAD is
+// no longer the commit the push was based on.
+func remoteHeadMovedError(remoteName, expected, actual string) error {
+	from, to := "(none)", "(none)"
+	if expected != "" {
+		from = util.ShortID(expected)
+	}
+	if actual != "" {
+		to = util.ShortID(actual)
+	}
+	return util.NewError("Push rejected (non-fast-forward)").
+		WithMessage(fmt.Sprintf("Remote HEAD moved from %s to %s during the push", from, to)).
+		WithCause("Someone else pushed to the remote at the same time").
+		WithSuggestions(
+			"pgit pull "+remoteName+"  # Pull the new commits first",
+			"pgit push "+remoteName+"  # Then push again",
+		)
+}
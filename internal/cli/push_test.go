@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"maps"
+	"os/exec"
+	"testing"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+)
+
+func TestPushHeapBackend(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := t.Context()
+	source := connectTest(t, testRemote(t))
+	runCommand(t, newImportCmd(), "--remote", "origin", divergedGitRepo(t))
+
+	url := testRepoURL(t)
+	heap := connectTest(t, url)
+	heap.UseBackend(db.BackendHeap)
+	if err := heap.InitSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Push the way runPush does: commits, then file versions, then HEAD
+	headID, err := source.GetHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := source.CommitsBetween(ctx, headID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeCommits(ctx, heap, commits, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFiles(ctx, source, heap, commits, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := heap.CompareAndSwapRef(ctx, "HEAD", "", headID); err != nil || !ok {
+		t.Fatalf("setting HEAD = %v, %v", ok, err)
+	}
+
+	// A new connection reads the backend back from the repository
+	reader := connectTest(t, url)
+	if got := reader.Backend(ctx); got != db.BackendHeap {
+		t.Errorf("Backend = %s, want heap", got)
+	}
+	for _, table := range []string{"pgit_commits", "pgit_text_content", "pgit_binary_content"} {
+		var am string
+		err := reader.QueryRow(ctx, `
+			SELECT a.amname FROM pg_class c JOIN pg_am a ON a.oid = c.relam
+			WHERE c.oid = $1::regclass`, table).Scan(&am)
+		if err != nil || am != "heap" {
+			t.Errorf("%s access method = %q, %v; want heap", table, am, err)
+		}
+	}
+
+	want := map[string]string{"shared.txt": "base\n", "main.txt": "main only\n"}
+	if got := treeFiles(t, reader, "HEAD"); !maps.Equal(got, want) {
+		t.Errorf("tree at HEAD = %v, want %v", got, want)
+	}
+	log, err := reader.CommitsBetween(ctx, headID, "")
+	if err != nil || len(log) != len(commits) {
+		t.Fatalf("history = %d commits, %v; want %d", len(log), err, len(commits))
+	}
+	for i, c := range log {
+		if c.ID != commits[i].ID || c.Message != commits[i].Message {
+			t.Errorf("commit %d = %s %q, want %s %q", i, c.ID, c.Message, commits[i].ID, commits[i].Message)
+		}
+	}
+}
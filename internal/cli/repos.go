@@ -513,7 +513,9 @@ func getRepoInfoForDB(dbName string, port int, searchFS bool, searchPath string,
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		_ = repoDb.QueryRow(ctx, "SELECT total_rows FROM xpatch.stats('pgit_commits')").Scan(&info.Commits)
+		if commits, err := repoDb.GetXpatchStats(ctx, "pgit_commits"); err == nil {
+			info.Commits = commits.TotalRows
+		}
 	}()
 
 	// Table sizes via pg_relation_size - fast
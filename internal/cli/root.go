@@ -83,12 +83,22 @@ func init() {
 		newBlameCmd(),
 		newRemoteCmd(),
 		newPushCmd(),
+		newFetchCmd(),
 		newPullCmd(),
+		newMergeCmd(),
+		newMergetoolCmd(),
 		newCloneCmd(),
+		newBundleCmd(),
 		newImportCmd(),
+		newMigrateCmd(),
+		newFsckCmd(),
+		newGCCmd(),
+		newFilterCmd(),
 		newSQLCmd(),
 		newStatsCmd(),
 		newAnalyzeCmd(),
+		newMailmapCmd(),
+		newNotesCmd(),
 		newSearchCmd(),
 		newGrepCmd(),
 		newCleanCmd(),
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -28,8 +29,19 @@ Examples:
   pgit search "TODO"              # Find all TODOs
   pgit search "func.*Error"       # Regex search
   pgit search -i "fixme"          # Case-insensitive
-  pgit search --path "*.go" "fmt" # Search only Go files`,
+  pgit search --path "*.go" "fmt" # Search only Go files
+  pgit search --indexed "TODO"    # Search HEAD through the search index
+
+--indexed searches a copy of the text files at HEAD kept in a heap table
+with a pg_trgm index. The first --indexed search builds it; after that
+commit, checkout and pull keep it up to date by rewriting only the files
+that changed. Without pg_trgm the table is scanned, and every indexed
+search warns until the extension is installed and the index is added.
+--drop-index removes it again.`,
 		Args: func(cmd *cobra.Command, args []string) error {
+			if drop, _ := cmd.Flags().GetBool("drop-index"); drop && len(args) == 0 {
+				return nil
+			}
 			if len(args) < 1 {
 				return util.MissingArgumentError("pattern", `pgit search "TODO"`)
 			}
@@ -48,6 +60,8 @@ Examples:
 	cmd.Flags().String("commit", "", "Search only at specific commit")
 	cmd.Flags().Bool("no-group", false, "Don't group identical matches across versions (only with --all)")
 	cmd.Flags().String("remote", "", "Search a remote database (e.g. 'origin')")
+	cmd.Flags().Bool("indexed", false, "Search HEAD through the search index, building it if needed")
+	cmd.Flags().Bool("drop-index", false, "Remove the search index")
 
 	return cmd
 }
@@ -63,6 +77,10 @@ type lineResult struct {
 }
 
 func runSearch(cmd *cobra.Command, args []string) error {
+	if drop, _ := cmd.Flags().GetBool("drop-index"); drop {
+		return runDropSearchIndex()
+	}
+
 	pattern := args[0]
 	ignoreCase, _ := cmd.Flags().GetBool("ignore-case")
 	pathFilter, _ := cmd.Flags().GetString("path")
@@ -70,6 +88,7 @@ func runSearch(cmd *cobra.Command, args []string) error {
 	searchAll, _ := cmd.Flags().GetBool("all")
 	commitRef, _ := cmd.Flags().GetString("commit")
 	noGroup, _ := cmd.Flags().GetBool("no-group")
+	indexed, _ := cmd.Flags().GetBool("indexed")
 
 	// Compile regex for Go-side line matching and highlighting
 	goPattern := pattern
@@ -82,6 +101,11 @@ func runSearch(cmd *cobra.Command, args []string) error {
 	}
 
 	remoteName, _ := cmd.Flags().GetString("remote")
+	if indexed && (searchAll || commitRef != "" || remoteName != "") {
+		return util.NewError("--indexed only searches HEAD of the local repository").
+			WithMessage("It can't be combined with --all, --commit or --remote").
+			WithSuggestion(fmt.Sprintf("pgit search --indexed %q", pattern))
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
@@ -111,6 +135,12 @@ func runSearch(cmd *cobra.Command, args []string) error {
 		commitID = headID
 	}
 
+	if indexed {
+		if err := ensureSearchIndex(ctx, r.DB, commitID); err != nil {
+			return err
+		}
+	}
+
 	spinner := ui.NewSpinner("Searching repository")
 	spinner.Start()
 
@@ -124,7 +154,9 @@ func runSearch(cmd *cobra.Command, args []string) error {
 	}
 
 	var searchResults []*db.SearchContentResult
-	if searchAll {
+	if indexed {
+		searchResults, err = r.DB.SearchIndexed(ctx, searchOpts)
+	} else if searchAll {
 		searchOpts.CommitID = "" // Search all versions
 		searchResults, err = r.DB.SearchContent(ctx, searchOpts)
 	} else {
@@ -257,6 +289,78 @@ func runSearch(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// ensureSearchIndex builds the search index if it doesn't exist yet and
+// brings it to headID.
+func ensureSearchIndex(ctx context.Context, database *db.DB, headID string) error {
+	exists, err := database.SearchIndexExists(ctx)
+	if err != nil {
+		return err
+	}
+	trigram := false
+	if exists {
+		if trigram, err = database.SearchIndexHasTrigram(ctx); err != nil {
+			return err
+		}
+	}
+	// Retried on every search until the trigram index exists, so
+	// installing pg_trgm later is picked up without a rebuild
+	if !trigram {
+		err := database.CreateSearchIndex(ctx)
+		if errors.Is(err, db.ErrNoTrigram) {
+			fmt.Println(styles.Warningf("Warning: the search index has no trigram index, so every search scans all of it"))
+			fmt.Println(styles.MutedMsg("  " + err.Error()))
+			fmt.Println(styles.MutedMsg("  Ask a database superuser to run: CREATE EXTENSION pg_trgm SCHEMA public;"))
+		} else if err != nil {
+			return err
+		}
+	}
+
+	progress := ui.NewProgress("Updating search index", 0)
+	_, err = database.UpdateSearchIndex(ctx, headID, func(done, total int) {
+		progress.SetTotal(total)
+		progress.Update(done)
+	})
+	progress.Done()
+	if err != nil {
+		return util.NewError("Cannot update the search index").WithMessage(err.Error())
+	}
+	return nil
+}
+
+// refreshSearchIndex brings the search index, if one was built, to the
+// current HEAD after commit, checkout or pull. A failure only warns: the
+// next 'pgit search --indexed' retries.
+func refreshSearchIndex(ctx context.Context, database *db.DB) {
+	exists, err := database.SearchIndexExists(ctx)
+	if err != nil || !exists {
+		return
+	}
+	headID, err := database.GetHead(ctx)
+	if err == nil {
+		_, err = database.UpdateSearchIndex(ctx, headID, nil)
+	}
+	if err != nil {
+		fmt.Println(styles.WarningMsg("Could not update the search index: " + err.Error()))
+	}
+}
+
+func runDropSearchIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	r, err := connectForCommand(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := r.DB.DropSearchIndex(ctx); err != nil {
+		return err
+	}
+	fmt.Println("Removed the search index")
+	return nil
+}
+
 // printGroupedResults deduplicates identical matches across versions,
 // showing each unique (path, line) once with the commits that contain it.
 func printGroupedResults(results []lineResult, re *regexp.Regexp, limit, resultCount int) error {
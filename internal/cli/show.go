@@ -83,9 +83,13 @@ func showCommitDetails(ctx context.Context, r *repo.Repository, ref string, show
 	if commit == nil {
 		return util.ErrCommitNotFound
 	}
+	applyMailmap(authorMailmap(ctx, r.DB), commit)
 
 	// Print commit header with proper styling
 	fmt.Printf("commit %s\n", styles.Hash(commit.ID, false))
+	if gitSHA, _ := r.DB.GetGitSHA(ctx, commit.ID); gitSHA != "" {
+		fmt.Printf("Git:    %s\n", styles.Mute(gitSHA))
+	}
 	fmt.Printf("Author: %s <%s>\n",
 		styles.Author(commit.AuthorName),
 		commit.AuthorEmail)
@@ -101,11 +105,18 @@ func showCommitDetails(ctx context.Context, r *repo.Repository, ref string, show
 	for _, line := range strings.Split(commit.Message, "\n") {
 		fmt.Printf("    %s\n", line)
 	}
+	if notes, _ := r.DB.GetNotes(ctx, []string{commit.ID}); len(notes) > 0 {
+		printNotes(notes[commit.ID])
+	}
 
 	if noPatch {
 		return nil
 	}
 
+	if showStat {
+		return showCommitStat(ctx, r.DB, commitID)
+	}
+
 	// Get changes in this commit
 	blobs, err := r.DB.GetBlobsAtCommit(ctx, commitID)
 	if err != nil {
@@ -149,11 +160,6 @@ func showCommitDetails(ctx context.Context, r *repo.Repository, ref string, show
 		}
 	}
 
-	if showStat {
-		// Show diffstat summary
-		return showDiffstat(blobs, parentBlobs)
-	}
-
 	// Show full diffs
 	for _, blob := range blobs {
 		var oldContent, newContent string
@@ -189,69 +195,26 @@ func showCommitDetails(ctx context.Context, r *repo.Repository, ref string, show
 	return nil
 }
 
-func showDiffstat(blobs []*db.Blob, parentBlobs map[string][]byte) error {
-	var totalInsertions, totalDeletions int
-
-	for _, blob := range blobs {
-		var oldLines, newLines int
-
-		if parentBlobs != nil {
-			if old, ok := parentBlobs[blob.Path]; ok {
-				oldLines = countLines(string(old))
-			}
-		}
-
-		if blob.Content != nil {
-			newLines = countLines(string(blob.Content))
-		}
-
-		insertions := 0
-		deletions := 0
-
-		if oldLines == 0 && newLines > 0 {
-			// New file
-			insertions = newLines
-			fmt.Printf(" %s | %d %s\n",
-				styles.Green(blob.Path),
-				insertions,
-				styles.Green(strings.Repeat("+", min(insertions, 40))))
-		} else if newLines == 0 && oldLines > 0 {
-			// Deleted file
-			deletions = oldLines
-			fmt.Printf(" %s | %d %s\n",
-				styles.Red(blob.Path),
-				deletions,
-				styles.Red(strings.Repeat("-", min(deletions, 40))))
-		} else {
-			// Modified - simplified count
-			insertions = max(0, newLines-oldLines)
-			deletions = max(0, oldLines-newLines)
-			if insertions == 0 && deletions == 0 {
-				insertions = 1 // At least mark as changed
-			}
-			bar := styles.Green(strings.Repeat("+", min(insertions, 20))) +
-				styles.Red(strings.Repeat("-", min(deletions, 20)))
-			fmt.Printf(" %s | %d %s\n", blob.Path, insertions+deletions, bar)
-		}
-
-		totalInsertions += insertions
-		totalDeletions += deletions
+// showCommitStat prints the diffstat of a commit from its stored line
+// counts, computing them first if the commit has none yet.
+func showCommitStat(ctx context.Context, database *db.DB, commitID string) error {
+	if err := fillFileChanges(ctx, database, []string{commitID}); err != nil {
+		return err
+	}
+	changes, err := database.GetFileChanges(ctx, []string{commitID})
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
 	}
 
-	fmt.Println()
-	fmt.Printf(" %d file(s) changed, %s, %s\n",
-		len(blobs),
-		styles.Green(fmt.Sprintf("%d insertions(+)", totalInsertions)),
-		styles.Red(fmt.Sprintf("%d deletions(-)", totalDeletions)))
-
-	return nil
-}
-
-func countLines(s string) int {
-	if s == "" {
-		return 0
+	stats := make([]diffStat, len(changes))
+	for i, c := range changes {
+		stats[i] = diffStat{Path: c.Path, Added: c.Added, Removed: c.Removed, IsBinary: c.IsBinary}
 	}
-	return strings.Count(s, "\n") + 1
+	fmt.Println()
+	return printDiffStat(stats, styles.NoColor())
 }
 
 func resolveCommitRef(ctx context.Context, r *repo.Repository, ref string) (string, error) {
@@ -330,6 +293,15 @@ func resolveBaseRef(ctx context.Context, r *repo.Repository, ref string) (string
 		return headID, nil
 	}
 
+	// Branch and tag names (refs/heads/<name>, refs/tags/<name>)
+	refID, err := r.DB.ResolveRefName(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if refID != "" {
+		return refID, nil
+	}
+
 	// Normalize to uppercase for ULID matching
 	refUpper := strings.ToUpper(ref)
 
@@ -368,9 +340,38 @@ func resolveBaseRef(ctx context.Context, r *repo.Repository, ref string) (string
 		return commit.ID, nil
 	}
 
+	// Finally, try the git SHA mapping recorded by pgit import. Checked last
+	// because short hex strings can also be valid pgit short IDs.
+	if looksLikeGitSHA(ref) {
+		commitID, err := r.DB.FindCommitByGitSHA(ctx, strings.ToLower(ref))
+		if err != nil {
+			var ambErr *db.AmbiguousCommitError
+			if errors.As(err, &ambErr) {
+				return "", formatAmbiguousError(ctx, r, ambErr)
+			}
+			// Older databases may not have pgit_git_map yet — treat as no match
+		} else if commitID != "" {
+			return commitID, nil
+		}
+	}
+
 	return "", util.ErrCommitNotFound
 }
 
+// looksLikeGitSHA reports whether ref could be a full or abbreviated git
+// object name (4-64 hex digits, covering both SHA-1 and SHA-256 repos).
+func looksLikeGitSHA(ref string) bool {
+	if len(ref) < 4 || len(ref) > 64 {
+		return false
+	}
+	for _, c := range ref {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
 func showFileAtCommit(ctx context.Context, r *repo.Repository, ref, path string) error {
 	commitID, err := resolveCommitRef(ctx, r, ref)
 	if err != nil {
@@ -0,0 +1,26 @@
+package cli
+
+import "testing"
+
+func TestLooksLikeGitSHA(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"abc", false}, // too short to tell from a ref name
+		{"abcd", true},
+		{"ABCDEF12", true},
+		{"da39a3ee5e6b4b0d3255bfef95601890afd80709", true},
+		{"af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262", true}, // SHA-256
+		{"af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f32620", false},
+		{"main", false},
+		{"HEAD~1", false},
+		{"01JAAAAAAAAAAAAAAAAAAAAAAA", false}, // a pgit ULID
+		{"abcg", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeGitSHA(tt.ref); got != tt.want {
+			t.Errorf("looksLikeGitSHA(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
@@ -73,12 +73,12 @@ type columnInfo struct {
 var pgitSchema = []schemaInfo{
 	{
 		Name:        "pgit_commits",
-		Description: "Stores commit metadata (author, message, timestamp, parent relationship). USING xpatch (delta-compressed).",
+		Description: "Stores commit metadata (author, message, timestamp, parent relationship). USING xpatch (delta-compressed), or a heap table on the heap storage backend.",
 		Columns: []columnInfo{
 			{"id", "TEXT PRIMARY KEY", "ULID commit identifier (encodes author timestamp)"},
 			{"seq", "INTEGER NOT NULL", "Insertion order (xpatch order_by column)"},
 			{"parent_id", "TEXT", "Parent commit ID (NULL for root commit)"},
-			{"tree_hash", "TEXT NOT NULL", "Hash identifying the file tree state"},
+			{"tree_hash", "TEXT NOT NULL", "BLAKE3 Merkle hash of the file tree (paths, modes, content hashes)"},
 			{"message", "TEXT NOT NULL", "Commit message"},
 			{"author_name", "TEXT NOT NULL", "Author's name"},
 			{"author_email", "TEXT NOT NULL", "Author's email address"},
@@ -86,6 +86,7 @@ var pgitSchema = []schemaInfo{
 			{"committer_name", "TEXT NOT NULL", "Committer's name"},
 			{"committer_email", "TEXT NOT NULL", "Committer's email address"},
 			{"committed_at", "TIMESTAMPTZ NOT NULL", "Committer timestamp"},
+			{"commit_hash", "TEXT NOT NULL", "BLAKE3 hash of the commit chained over its parent's commit_hash"},
 		},
 	},
 	{
@@ -119,11 +120,13 @@ var pgitSchema = []schemaInfo{
 			{"is_symlink", "BOOLEAN NOT NULL DEFAULT FALSE", "Whether this is a symlink"},
 			{"symlink_target", "TEXT", "Symlink target path (if symlink)"},
 			{"is_binary", "BOOLEAN NOT NULL DEFAULT FALSE", "Whether the file content is binary"},
+			{"size", "BIGINT NOT NULL", "Content size in bytes (0 = deleted)"},
+			{"line_count", "INTEGER", "Number of lines (NULL for binary files)"},
 		},
 	},
 	{
 		Name:        "pgit_text_content",
-		Description: "Text file content, delta-compressed by pg-xpatch. PRIMARY KEY (group_id, version_id). USING xpatch.",
+		Description: "Text file content, delta-compressed by pg-xpatch. PRIMARY KEY (group_id, version_id). USING xpatch, or a heap table on the heap storage backend.",
 		Columns: []columnInfo{
 			{"group_id", "INTEGER NOT NULL", "Delta compression group ID (part of PK, from pgit_paths.group_id)"},
 			{"version_id", "INTEGER NOT NULL", "Version number within the group (part of PK)"},
@@ -132,7 +135,7 @@ var pgitSchema = []schemaInfo{
 	},
 	{
 		Name:        "pgit_binary_content",
-		Description: "Binary file content, delta-compressed by pg-xpatch. PRIMARY KEY (group_id, version_id). USING xpatch.",
+		Description: "Binary file content, delta-compressed by pg-xpatch. PRIMARY KEY (group_id, version_id). USING xpatch, or a heap table on the heap storage backend.",
 		Columns: []columnInfo{
 			{"group_id", "INTEGER NOT NULL", "Delta compression group ID (part of PK, from pgit_paths.group_id)"},
 			{"version_id", "INTEGER NOT NULL", "Version number within the group (part of PK)"},
@@ -143,7 +146,7 @@ var pgitSchema = []schemaInfo{
 		Name:        "pgit_refs",
 		Description: "Named references (branches, tags) pointing to commits",
 		Columns: []columnInfo{
-			{"name", "TEXT PRIMARY KEY", "Reference name (e.g., 'HEAD', 'main')"},
+			{"name", "TEXT PRIMARY KEY", "Reference name (e.g., 'HEAD', 'refs/heads/main', 'refs/remotes/origin/main')"},
 			{"commit_id", "TEXT NOT NULL", "Reference to pgit_commits.id"},
 		},
 	},
@@ -162,6 +165,75 @@ var pgitSchema = []schemaInfo{
 			{"remote_name", "TEXT PRIMARY KEY", "Remote repository name"},
 			{"last_commit_id", "TEXT", "Last synchronized commit ID"},
 			{"synced_at", "TIMESTAMPTZ NOT NULL DEFAULT NOW()", "Last sync timestamp"},
+			{"transfer_direction", "TEXT", "Unfinished transfer: 'push', 'pull' or 'merge' (NULL if none)"},
+			{"transfer_base", "TEXT", "Commit the transferred commits build on"},
+			{"transfer_target", "TEXT", "HEAD the unfinished transfer moves towards"},
+			{"transfer_last", "TEXT", "Last commit stored by the unfinished transfer"},
+			{"transfer_done", "INTEGER", "Commits transferred so far"},
+			{"transfer_total", "INTEGER", "Commits in the transfer"},
+			{"transfer_started_at", "TIMESTAMPTZ", "When the unfinished transfer started"},
+		},
+	},
+	{
+		Name:        "pgit_git_map",
+		Description: "Maps git object SHAs (recorded by pgit import) to pgit commits and content. Heap table.",
+		Columns: []columnInfo{
+			{"git_sha", "TEXT PRIMARY KEY", "Full git object SHA"},
+			{"kind", "TEXT NOT NULL", "Object kind: 'commit' or 'blob'"},
+			{"commit_id", "TEXT", "Reference to pgit_commits.id (commits only)"},
+			{"content_hash", "BYTEA", "BLAKE3 content hash, joins pgit_file_refs.content_hash (blobs only)"},
+			{"group_id", "INTEGER", "Delta compression group holding the content (blobs only)"},
+		},
+	},
+	{
+		Name:        "pgit_mailmap",
+		Description: "Author identity normalization rules from .mailmap and .pgit/mailmap (see pgit mailmap). Heap table.",
+		Columns: []columnInfo{
+			{"commit_email", "TEXT NOT NULL", "Email as recorded in commits, lowercased (part of PK)"},
+			{"commit_name", "TEXT NOT NULL", "Name as recorded in commits, lowercased; '' matches any name (part of PK)"},
+			{"proper_name", "TEXT", "Canonical name (NULL keeps the recorded name)"},
+			{"proper_email", "TEXT", "Canonical email (NULL keeps the recorded email)"},
+		},
+	},
+	{
+		Name:        "pgit_commit_trailers",
+		Description: "Trailers parsed from the last paragraph of commit messages (Co-authored-by, Signed-off-by, Reviewed-by, Fixes, ...). Heap table.",
+		Columns: []columnInfo{
+			{"commit_id", "TEXT NOT NULL", "Commit ULID (part of PK)"},
+			{"key", "TEXT NOT NULL", "Trailer key, lowercased, e.g. 'co-authored-by' (part of PK, indexed)"},
+			{"value", "TEXT NOT NULL", "Trailer value, e.g. 'Jane Doe <jane@example.com>' (part of PK)"},
+		},
+	},
+	{
+		Name:        "pgit_notes",
+		Description: "Notes attached to existing commits (see pgit notes). Synced by push, pull, and clone. Heap table.",
+		Columns: []columnInfo{
+			{"commit_id", "TEXT NOT NULL", "Commit ULID (part of PK)"},
+			{"namespace", "TEXT NOT NULL", "Notes namespace, 'commits' by default (part of PK)"},
+			{"body", "TEXT NOT NULL", "Note text"},
+			{"author", "TEXT NOT NULL", "'Name <email>' of the note's writer"},
+			{"created_at", "TIMESTAMPTZ NOT NULL", "When the note was written (the later change wins when syncing)"},
+			{"deleted_at", "TIMESTAMPTZ", "When the note was removed (NULL for a live note); the row is kept so syncing doesn't restore it"},
+		},
+	},
+	{
+		Name:        "pgit_file_changes",
+		Description: "Lines added and removed per file per commit (numstat), relative to the path's version in the parent commit's tree. Filled by import, commit, and pull. Heap table.",
+		Columns: []columnInfo{
+			{"commit_id", "TEXT NOT NULL", "Commit ULID (part of PK)"},
+			{"path_id", "INTEGER NOT NULL", "References pgit_paths.path_id (part of PK, indexed)"},
+			{"added", "INTEGER", "Lines added (NULL for binary files)"},
+			{"removed", "INTEGER", "Lines removed (NULL for binary files)"},
+		},
+	},
+	{
+		Name:        "pgit_search_index",
+		Description: "Optional copy of the text files at HEAD for 'pgit search --indexed', with a pg_trgm index on content when available. Heap table; only exists once built.",
+		Columns: []columnInfo{
+			{"path", "TEXT PRIMARY KEY", "File path"},
+			{"commit_id", "TEXT NOT NULL", "Commit that last changed the file"},
+			{"content_hash", "BYTEA NOT NULL", "BLAKE3 hash of the content"},
+			{"content", "TEXT NOT NULL", "File content"},
 		},
 	},
 }
@@ -181,6 +253,11 @@ var exampleQueries = []struct {
 		Description: "Files with the most versions (see also: pgit analyze churn)",
 		Query:       "SELECT p.path, COUNT(*) as versions\nFROM pgit_file_refs r\nJOIN pgit_paths p ON p.path_id = r.path_id\nGROUP BY p.path\nORDER BY versions DESC\nLIMIT 10;",
 	},
+	{
+		Title:       "Lines changed per author",
+		Description: "Lines added and removed by each author (see also: pgit analyze churn --by lines)",
+		Query:       "SELECT c.author_name, SUM(f.added) as added, SUM(f.removed) as removed\nFROM pgit_file_changes f\nJOIN pgit_commits c ON c.id = f.commit_id\nGROUP BY c.author_name\nORDER BY added DESC NULLS LAST\nLIMIT 10;",
+	},
 	{
 		Title:       "Files changed together",
 		Description: "File pairs frequently modified in the same commit (see also: pgit analyze coupling)",
@@ -191,6 +268,16 @@ var exampleQueries = []struct {
 		Description: "Full table scan on pgit_commits (slow on large repos, use pgit analyze authors instead)",
 		Query:       "SELECT author_name, author_email, COUNT(*) as commits\nFROM pgit_commits\nGROUP BY author_name, author_email\nORDER BY commits DESC;",
 	},
+	{
+		Title:       "Commits by canonical author",
+		Description: "Commits by author with mailmap rules applied (name-specific rules first)",
+		Query:       "SELECT COALESCE(mn.proper_name, me.proper_name, c.author_name) as author, COUNT(*) as commits\nFROM pgit_commits c\nLEFT JOIN pgit_mailmap mn ON mn.commit_email = lower(c.author_email) AND mn.commit_name = lower(c.author_name)\nLEFT JOIN pgit_mailmap me ON me.commit_email = lower(c.author_email) AND me.commit_name = ''\nGROUP BY 1\nORDER BY commits DESC;",
+	},
+	{
+		Title:       "Co-authors",
+		Description: "People credited via Co-authored-by trailers (see also: pgit analyze authors --include-coauthors)",
+		Query:       "SELECT value as co_author, COUNT(*) as commits\nFROM pgit_commit_trailers\nWHERE key = 'co-authored-by'\nGROUP BY value\nORDER BY commits DESC\nLIMIT 20;",
+	},
 	{
 		Title:       "Commits by day of week",
 		Description: "Full table scan on pgit_commits (see also: pgit analyze activity for time-series)",
@@ -291,7 +378,11 @@ func runSQLSchema(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	return fmt.Errorf("unknown table: %s\n\nAvailable tables: pgit_commits, pgit_commit_graph, pgit_paths, pgit_file_refs, pgit_text_content, pgit_binary_content, pgit_refs, pgit_metadata, pgit_sync_state", args[0])
+	tableNames := make([]string, len(pgitSchema))
+	for i, t := range pgitSchema {
+		tableNames[i] = t.Name
+	}
+	return fmt.Errorf("unknown table: %s\n\nAvailable tables: %s", args[0], strings.Join(tableNames, ", "))
 }
 
 func newSQLTablesCmd() *cobra.Command {
@@ -568,6 +659,7 @@ func runStats(cmd *cobra.Command, args []string) error {
 	fmt.Println()
 	fmt.Println(styles.Boldf("Storage (on disk)"))
 	fmt.Println()
+	fmt.Printf("  Backend:        %s\n", r.DB.Backend(ctx))
 
 	// On-disk: sum of pg_table_size for all pgit tables (no indexes)
 	totalOnDisk := stats.CommitsTableSize + stats.PathsTableSize + stats.FileRefsTableSize +
@@ -718,6 +810,7 @@ type JSONRepoStats struct {
 }
 
 type JSONStorageStats struct {
+	Backend                 string  `json:"backend"`
 	CommitsTableBytes       int64   `json:"commits_table_bytes"`
 	PathsTableBytes         int64   `json:"paths_table_bytes"`
 	FileRefsTableBytes      int64   `json:"file_refs_table_bytes"`
@@ -771,6 +864,7 @@ func printJSONStats(ctx context.Context, r *repo.Repository, stats *db.RepoStats
 			ContentSizeBytes: stats.TotalContentSize,
 		},
 		Storage: JSONStorageStats{
+			Backend:                 string(r.DB.Backend(ctx)),
 			CommitsTableBytes:       stats.CommitsTableSize,
 			PathsTableBytes:         stats.PathsTableSize,
 			FileRefsTableBytes:      stats.FileRefsTableSize,
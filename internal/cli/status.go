@@ -76,15 +76,67 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		conflicts = mergeState.ConflictedFiles
 	}
 
+	var upstream *upstreamStatus
+	if head != nil {
+		upstream = getUpstreamStatus(ctx, r.DB, head.ID)
+	}
+
 	if jsonOutput {
-		return printJSONStatus(staged, unstaged, conflicts, head)
+		return printJSONStatus(staged, unstaged, conflicts, head, upstream)
 	}
 
 	if short {
 		return printShortStatus(staged, unstaged)
 	}
 
-	return printLongStatus(staged, unstaged, head)
+	return printLongStatus(staged, unstaged, head, upstream)
+}
+
+// upstreamStatus is HEAD's position relative to a remote-tracking ref.
+type upstreamStatus struct {
+	Name   string // e.g. "origin/main"
+	Ahead  int
+	Behind int
+}
+
+// getUpstreamStatus compares HEAD with origin's remote-tracking ref, or the
+// first one recorded if there is no origin. Returns nil if no remote has
+// been fetched, pushed or pulled yet.
+func getUpstreamStatus(ctx context.Context, database *db.DB, headID string) *upstreamStatus {
+	refs, err := database.GetRefsByPrefix(ctx, "refs/remotes/")
+	if err != nil || len(refs) == 0 {
+		return nil
+	}
+	ref := refs[0]
+	for _, candidate := range refs {
+		if candidate.Name == db.RemoteTrackingRef("origin") {
+			ref = candidate
+		}
+	}
+
+	ahead, behind, _, err := database.CompareCommits(ctx, headID, ref.CommitID)
+	if err != nil {
+		return nil
+	}
+	return &upstreamStatus{
+		Name:   strings.TrimPrefix(ref.Name, "refs/remotes/"),
+		Ahead:  ahead,
+		Behind: behind,
+	}
+}
+
+// describe returns git's one-line summary of the upstream comparison.
+func (u *upstreamStatus) describe() string {
+	switch {
+	case u.Ahead == 0 && u.Behind == 0:
+		return fmt.Sprintf("Your branch is up to date with '%s'.", u.Name)
+	case u.Behind == 0:
+		return fmt.Sprintf("Your branch is ahead of '%s' by %d commit(s).", u.Name, u.Ahead)
+	case u.Ahead == 0:
+		return fmt.Sprintf("Your branch is behind '%s' by %d commit(s), and can be fast-forwarded.", u.Name, u.Behind)
+	default:
+		return fmt.Sprintf("Your branch and '%s' have diverged, with %d and %d different commit(s) each.", u.Name, u.Ahead, u.Behind)
+	}
 }
 
 // JSONStatus represents status output in JSON format
@@ -95,6 +147,13 @@ type JSONStatus struct {
 	Unstaged  []JSONFileChange `json:"unstaged"`
 	Untracked []string         `json:"untracked"`
 	Conflicts []string         `json:"conflicts,omitempty"`
+	Upstream  *JSONUpstream    `json:"upstream,omitempty"`
+}
+
+type JSONUpstream struct {
+	Name   string `json:"name"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
 }
 
 type JSONCommitBrief struct {
@@ -110,7 +169,7 @@ type JSONFileChange struct {
 	Status string `json:"status"`
 }
 
-func printJSONStatus(staged, unstaged []repo.FileChange, conflicts []string, head *db.Commit) error {
+func printJSONStatus(staged, unstaged []repo.FileChange, conflicts []string, head *db.Commit, upstream *upstreamStatus) error {
 	status := JSONStatus{
 		Branch:    "main",
 		Staged:    make([]JSONFileChange, 0),
@@ -128,6 +187,9 @@ func printJSONStatus(staged, unstaged []repo.FileChange, conflicts []string, hea
 			Timestamp: head.AuthoredAt.Format(time.RFC3339),
 		}
 	}
+	if upstream != nil {
+		status.Upstream = &JSONUpstream{Name: upstream.Name, Ahead: upstream.Ahead, Behind: upstream.Behind}
+	}
 
 	for _, c := range staged {
 		status.Staged = append(status.Staged, JSONFileChange{
@@ -222,13 +284,16 @@ func statusSymbol(status repo.ChangeStatus, staged bool) string {
 	return style(symbol)
 }
 
-func printLongStatus(staged, unstaged []repo.FileChange, head *db.Commit) error {
+func printLongStatus(staged, unstaged []repo.FileChange, head *db.Commit, upstream *upstreamStatus) error {
 	// Branch info
 	fmt.Printf("On branch %s\n", styles.Branch("main"))
 
 	// Show HEAD info if exists
 	if head != nil {
 		fmt.Printf("HEAD: %s %s\n", styles.Hash(head.ID, true), styles.MutedMsg(util.RelativeTime(head.AuthoredAt)))
+		if upstream != nil {
+			fmt.Println(upstream.describe())
+		}
 	} else {
 		fmt.Println()
 		fmt.Println("No commits yet")
@@ -243,6 +308,7 @@ func printLongStatus(staged, unstaged []repo.FileChange, head *db.Commit) error
 			fmt.Println()
 			fmt.Println(styles.Warningf("You have unmerged paths."))
 			fmt.Println(styles.MutedMsg("  (fix conflicts, then \"pgit add <file>\" and \"pgit commit\")"))
+			fmt.Println(styles.MutedMsg("  (use \"pgit mergetool\" to resolve them, \"pgit merge --abort\" to undo the merge)"))
 			fmt.Println()
 			fmt.Println("Unmerged paths:")
 			for _, f := range mergeState.ConflictedFiles {
@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/db"
+	"github.com/imgajeed76/pgit/v4/internal/repo"
+	"github.com/imgajeed76/pgit/v4/internal/ui"
+	"github.com/imgajeed76/pgit/v4/internal/ui/styles"
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/cobra"
+)
+
+// Kinds of transfer recorded in pgit_sync_state while they run. A merge is
+// a pull onto diverged history: local commits were already removed from the
+// database, and the local work only survives in the working directory.
+const (
+	transferPush  = "push"
+	transferPull  = "pull"
+	transferMerge = "merge"
+)
+
+const defaultTransferTimeout = 30 * time.Minute
+
+// addTransferFlags adds the flags shared by push and pull.
+func addTransferFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("timeout", defaultTransferTimeout, "Maximum time for the transfer (e.g. 2h, 30m, 48h)")
+	cmd.Flags().Bool("resume", false, "Continue an interrupted transfer")
+	cmd.Flags().IntP("workers", "w", 0, "Number of parallel workers (default from config, capped at CPU count)")
+}
+
+// transferTimeout returns the --timeout flag, falling back to the default
+// for non-positive values.
+func transferTimeout(cmd *cobra.Command) time.Duration {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		timeout = defaultTransferTimeout
+	}
+	return timeout
+}
+
+// connectRemote connects to a remote database, retrying transient errors.
+func connectRemote(ctx context.Context, r *repo.Repository, remoteName, url string) (*db.DB, error) {
+	spinner := ui.NewSpinner(fmt.Sprintf("Connecting to %s", styles.Cyan(remoteName)))
+	spinner.Start()
+	var remoteDB *db.DB
+	err := db.Retry(ctx, nil, func() error {
+		var err error
+		remoteDB, err = r.ConnectTo(ctx, url)
+		return err
+	})
+	spinner.Stop()
+	if err != nil {
+		return nil, util.DatabaseConnectionError(url, err)
+	}
+	return remoteDB, nil
+}
+
+// checkInterruptedTransfer looks for an unfinished transfer with a remote.
+// It returns the transfer to resume when resume is set and the transfer is
+// one of the given kinds, nil when there is none, and an error when a
+// transfer is pending that this command must not run on top of.
+func checkInterruptedTransfer(ctx context.Context, database *db.DB, remoteName string, resume bool, kinds ...string) (*db.TransferProgress, error) {
+	p, err := database.GetTransferProgress(ctx, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		if resume {
+			fmt.Printf("No interrupted transfer with %s, starting a new one\n", styles.Cyan(remoteName))
+		}
+		return nil, nil
+	}
+
+	command := "pgit pull --resume " + remoteName
+	if p.Direction == transferPush {
+		command = "pgit push --resume " + remoteName
+	}
+	for _, kind := range kinds {
+		if p.Direction == kind {
+			if resume {
+				return p, nil
+			}
+			break
+		}
+	}
+
+	return nil, util.NewError(fmt.Sprintf("Interrupted %s with %s", p.Direction, remoteName)).
+		WithMessage(fmt.Sprintf("The %s stopped after %d of %d commit(s) (started %s)",
+			p.Direction, p.Done, p.Total, util.RelativeTime(p.StartedAt))).
+		WithCause("The connection dropped or the command was stopped").
+		WithSuggestion(command + "  # Finish it first")
+}
+
+// transferStopped reports whether err leaves a transfer worth resuming:
+// the connection dropped for good or the timeout ran out.
+func transferStopped(err error) bool {
+	return db.IsTransient(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// warnRetry reports a transient error before the transfer retries.
+func warnRetry(attempt int, err error) {
+	fmt.Println()
+	fmt.Println(styles.Warningf("Connection problem (%v), retrying (attempt %d)...", err, attempt+1))
+}
+
+// copyCommits stores commits (oldest first) and their content from src in
+// dst. Commits go in batches of 100, one transaction each; commits dst
+// already has are skipped, so a batch that committed just before the
+// connection dropped is not stored twice. onBatch, if not nil, is called
+// after each batch with the newest commit stored and the number of commits
+// done. The file versions follow with copyFiles.
+func copyCommits(ctx context.Context, src, dst *db.DB, commits []*db.Commit, label string, workers int, onBatch func(last *db.Commit, done int) error) error {
+	const batchSize = 100
+	progress := ui.NewProgress(label, len(commits))
+
+	for i := 0; i < len(commits); i += batchSize {
+		end := min(i+batchSize, len(commits))
+		batch := commits[i:end]
+
+		err := db.Retry(ctx, warnRetry, func() error {
+			return storeCommits(ctx, dst, batch, nil)
+		})
+		if err != nil {
+			return err
+		}
+
+		if onBatch != nil {
+			if err := onBatch(batch[len(batch)-1], end); err != nil {
+				return err
+			}
+		}
+		progress.Update(end)
+	}
+	progress.Done()
+
+	return copyFiles(ctx, src, dst, commits, workers)
+}
+
+// storeCommits stores the commits of batch that dst doesn't have yet in a
+// single transaction. check, if not nil, runs first inside the transaction
+// and aborts it on error.
+func storeCommits(ctx context.Context, dst *db.DB, batch []*db.Commit, check func(tx pgx.Tx) error) error {
+	existing, err := dst.ExistingCommitIDs(ctx, commitIDs(batch))
+	if err != nil {
+		return err
+	}
+	var missing []*db.Commit
+	for _, c := range batch {
+		if !existing[c.ID] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := verifyCommitHashes(ctx, dst, missing); err != nil {
+		return err
+	}
+
+	return dst.WithTx(ctx, func(tx pgx.Tx) error {
+		if check != nil {
+			if err := check(tx); err != nil {
+				return err
+			}
+		}
+		if err := dst.CreateCommitsBatchTx(ctx, tx, missing); err != nil {
+			return fmt.Errorf("failed to store commits: %w", err)
+		}
+		return nil
+	})
+}
+
+// verifyCommitHashes checks the hashes of incoming commits against the
+// commits dst already has before they are stored, so history changed on
+// the other side is refused instead of merged.
+func verifyCommitHashes(ctx context.Context, dst *db.DB, commits []*db.Commit) error {
+	err := dst.VerifyCommitHashes(ctx, commits)
+	var hashErr *db.CommitHashError
+	if errors.As(err, &hashErr) {
+		return util.NewError("Commit hash mismatch").
+			WithMessage(fmt.Sprintf("Commit %s does not match its hash", util.ShortID(hashErr.ID))).
+			WithCauses(
+				"The commit or one before it was changed after it was written",
+				"The database the commits came from was tampered with",
+			).
+			WithSuggestion("pgit fsck  # Run on the database the commits came from to find it")
+	}
+	return err
+}
+
+// copyFiles copies the file versions of commits from src to dst with the
+// bulk transfer engine, one delta group per worker at a time. File versions
+// dst already has are skipped, so it also completes an interrupted copy.
+// Their line counts follow with copyFileChanges.
+func copyFiles(ctx context.Context, src, dst *db.DB, commits []*db.Commit, workers int) error {
+	var transfer *db.BlobTransfer
+	err := db.Retry(ctx, warnRetry, func() error {
+		var err error
+		transfer, err = db.PrepareBlobTransfer(ctx, src, dst, commitIDs(commits))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prepare file transfer: %w", err)
+	}
+	if transfer.Count() > 0 {
+		progress := ui.NewProgress("Files", transfer.Count())
+		var done atomic.Int64
+		err = transfer.Run(ctx, workers, func(n int) {
+			progress.Update(int(done.Add(int64(n))))
+		}, warnRetry)
+		progress.Done()
+		if err != nil {
+			return err
+		}
+	}
+
+	copyFileChanges(ctx, src, dst, commitIDs(commits))
+	return verifyTreeHashes(ctx, dst, commits)
+}
+
+// verifyTreeHashes checks the tree hashes of commits whose files were just
+// stored in dst, before any ref moves to them.
+func verifyTreeHashes(ctx context.Context, dst *db.DB, commits []*db.Commit) error {
+	err := db.Retry(ctx, warnRetry, func() error {
+		return dst.VerifyTreeHashes(ctx, commits)
+	})
+	var hashErr *db.TreeHashError
+	if errors.As(err, &hashErr) {
+		return util.NewError("Tree hash mismatch").
+			WithMessage(fmt.Sprintf("The files of commit %s do not match its tree hash", util.ShortID(hashErr.ID))).
+			WithCauses(
+				"File versions were changed or lost in the database the commits came from",
+				"The transfer stored incomplete data",
+			).
+			WithSuggestion("pgit fsck --full  # Run on the database the commits came from to find it")
+	}
+	return err
+}
+
+// copyFileChanges brings the line counts of commits along with their
+// files, computing the ones src lacks (written by an older pgit). They are
+// derived data, so a failure only warns: anything missing is computed
+// again when needed.
+func copyFileChanges(ctx context.Context, src, dst *db.DB, ids []string) {
+	err := db.Retry(ctx, warnRetry, func() error {
+		return db.CopyFileChanges(ctx, src, dst, ids)
+	})
+	if err == nil {
+		err = fillFileChanges(ctx, dst, ids)
+	}
+	if err != nil {
+		fmt.Println(styles.WarningMsg("Could not record line counts: " + err.Error()))
+	}
+}
+
+// trackTransfer returns an onBatch callback for copyCommits that records
+// the progress of p in database after every batch.
+func trackTransfer(ctx context.Context, database *db.DB, p *db.TransferProgress) func(last *db.Commit, done int) error {
+	return func(last *db.Commit, done int) error {
+		p.LastID = last.ID
+		p.Done = done
+		return db.Retry(ctx, nil, func() error {
+			return database.SetTransferProgress(ctx, p)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/imgajeed76/pgit/v4/internal/util"
@@ -12,6 +13,7 @@ import (
 type Config struct {
 	Core    CoreConfig              `toml:"core"`
 	User    UserConfig              `toml:"user"`
+	Merge   MergeConfig             `toml:"merge"`
 	Remotes map[string]RemoteConfig `toml:"remote"`
 }
 
@@ -26,6 +28,13 @@ type UserConfig struct {
 	Email string `toml:"email" config:"user.email" desc:"Author email for commits"`
 }
 
+// MergeConfig contains conflict-resolution settings
+type MergeConfig struct {
+	ConflictStyle string `toml:"conflict_style" config:"merge.conflict_style" default:"diff3" desc:"Conflict markers: diff3 (with base section) or merge"`
+	Tool          string `toml:"tool" config:"merge.tool" desc:"Merge tool for 'pgit mergetool' (overrides the global setting)"`
+	Drivers       string `toml:"drivers" config:"merge.drivers" desc:"Extra merge driver rules, e.g. '*.lock=line,*.jsonc=json'"`
+}
+
 // RemoteConfig contains remote repository settings
 type RemoteConfig struct {
 	URL string `toml:"url"` // PostgreSQL connection URL
@@ -109,6 +118,27 @@ func (c *Config) SetValue(key, value string) error {
 	return setFieldValue(c, key, value)
 }
 
+// GetConflictStyle returns the configured conflict marker style ("diff3"
+// unless set to "merge").
+func (c *Config) GetConflictStyle() string {
+	if strings.EqualFold(c.Merge.ConflictStyle, "merge") {
+		return "merge"
+	}
+	return "diff3"
+}
+
+// GetMergeTool returns the merge tool from the repository config, the global
+// config, or $PGIT_MERGETOOL, in that order.
+func (c *Config) GetMergeTool() string {
+	if c.Merge.Tool != "" {
+		return c.Merge.Tool
+	}
+	if global, err := LoadGlobal(); err == nil && global.Merge.Tool != "" {
+		return global.Merge.Tool
+	}
+	return os.Getenv("PGIT_MERGETOOL")
+}
+
 // GetUserName returns the user name from config or environment
 func (c *Config) GetUserName() string {
 	if c.User.Name != "" {
@@ -11,9 +11,15 @@ import (
 // GlobalConfig represents global pgit settings stored in user's config directory
 // These settings affect all repositories and the local container
 type GlobalConfig struct {
-	Container ContainerConfig  `toml:"container"`
-	Import    ImportConfig     `toml:"import"`
-	User      GlobalUserConfig `toml:"user"`
+	Container ContainerConfig   `toml:"container"`
+	Import    ImportConfig      `toml:"import"`
+	User      GlobalUserConfig  `toml:"user"`
+	Merge     GlobalMergeConfig `toml:"merge"`
+}
+
+// GlobalMergeConfig contains default conflict-resolution settings
+type GlobalMergeConfig struct {
+	Tool string `toml:"tool" config:"merge.tool" desc:"Default merge tool for 'pgit mergetool'"`
 }
 
 // GlobalUserConfig contains default user identity settings
@@ -1,11 +1,11 @@
 package config
 
 import (
-	"bufio"
 	"encoding/json"
 	"os"
 	"path/filepath"
 
+	"github.com/imgajeed76/pgit/v4/internal/merge"
 	"github.com/imgajeed76/pgit/v4/internal/util"
 )
 
@@ -28,10 +28,29 @@ type MergeState struct {
 
 	// ConflictedFiles lists files with merge conflicts
 	ConflictedFiles []string `json:"conflicted_files"`
+
+	// TouchedFiles lists the files the merge wrote, whose previous content
+	// is kept as StageOriginal for 'pgit merge --abort'
+	TouchedFiles []string `json:"touched_files,omitempty"`
 }
 
 const MergeStateFile = "MERGE_STATE"
 
+// MergeStagesDir holds the saved versions of files involved in a merge,
+// one subdirectory per stage. The local commits are gone from the database
+// once a pull merges, so these copies are the only record of them.
+const MergeStagesDir = "merge"
+
+// Stage names a saved version of a file in a merge.
+type Stage string
+
+const (
+	StageBase     Stage = "base"     // common ancestor
+	StageOurs     Stage = "ours"     // local commit
+	StageTheirs   Stage = "theirs"   // remote commit
+	StageOriginal Stage = "original" // working directory before the merge
+)
+
 // MergeStatePath returns the path to the merge state file
 func MergeStatePath(repoRoot string) string {
 	return filepath.Join(repoRoot, util.PgitDir, MergeStateFile)
@@ -75,11 +94,107 @@ func (m *MergeState) Save(repoRoot string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-// Clear removes the merge state
+// Clear removes the merge state and the saved stages
 func (m *MergeState) Clear(repoRoot string) error {
 	m.InProgress = false
 	m.ConflictedFiles = nil
-	return os.Remove(MergeStatePath(repoRoot))
+	m.TouchedFiles = nil
+	if err := os.RemoveAll(filepath.Join(repoRoot, util.PgitDir, MergeStagesDir)); err != nil {
+		return err
+	}
+	if err := os.Remove(MergeStatePath(repoRoot)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ResetStages removes stages left over from an earlier merge.
+func ResetStages(repoRoot string) error {
+	return os.RemoveAll(filepath.Join(repoRoot, util.PgitDir, MergeStagesDir))
+}
+
+// StagePath returns where a stage of a file is kept. path is relative to
+// the repository root.
+func StagePath(repoRoot string, stage Stage, path string) string {
+	return filepath.Join(repoRoot, util.PgitDir, MergeStagesDir, string(stage), filepath.FromSlash(path))
+}
+
+// SaveStage records a version of path. A nil content means the file does
+// not exist in that version and records nothing. A non-nil symlinkTarget
+// saves a symlink instead of content.
+func SaveStage(repoRoot string, stage Stage, path string, content []byte, mode os.FileMode, symlinkTarget *string) error {
+	if content == nil && symlinkTarget == nil {
+		return nil
+	}
+	dest := StagePath(repoRoot, stage, path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if symlinkTarget != nil {
+		return os.Symlink(*symlinkTarget, dest)
+	}
+	return os.WriteFile(dest, content, mode.Perm())
+}
+
+// SaveWorkingFileStage records the current working directory version of
+// path (nothing if it doesn't exist).
+func SaveWorkingFileStage(repoRoot string, stage Stage, path string) error {
+	src := filepath.Join(repoRoot, filepath.FromSlash(path))
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return SaveStage(repoRoot, stage, path, nil, 0, &target)
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return SaveStage(repoRoot, stage, path, content, info.Mode(), nil)
+}
+
+// RestoreStage writes a saved version of path to dest, removing dest if
+// the file doesn't exist in that version. It reports whether it existed.
+func RestoreStage(repoRoot string, stage Stage, path, dest string) (bool, error) {
+	src := StagePath(repoRoot, stage, path)
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, err
+	}
+	// Replace rather than write through, which would follow a symlink
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return false, err
+		}
+		return true, os.Symlink(target, dest)
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(dest, content, info.Mode().Perm())
 }
 
 // HasConflicts returns true if there are unresolved conflicts
@@ -87,6 +202,11 @@ func (m *MergeState) HasConflicts() bool {
 	return m.InProgress && len(m.ConflictedFiles) > 0
 }
 
+// AddTouched records a file the merge wrote
+func (m *MergeState) AddTouched(path string) {
+	m.TouchedFiles = append(m.TouchedFiles, path)
+}
+
 // AddConflict adds a file to the conflict list
 func (m *MergeState) AddConflict(path string) {
 	for _, p := range m.ConflictedFiles {
@@ -118,40 +238,18 @@ func (m *MergeState) IsConflicted(path string) bool {
 	return false
 }
 
-// ConflictMarkers for merge conflicts
-const (
-	ConflictMarkerStart  = "<<<<<<< LOCAL"
-	ConflictMarkerMiddle = "======="
-	ConflictMarkerEnd    = ">>>>>>> REMOTE"
-)
-
-// CreateConflictedFile writes a file with conflict markers
-func CreateConflictedFile(path string, localContent, remoteContent []byte, remoteName string) error {
+// CreateConflictedFile writes a file with whole-file conflict markers. The
+// base section is included for the diff3 style; baseContent is nil if the
+// file didn't exist in the common ancestor.
+func CreateConflictedFile(path string, baseContent, localContent, remoteContent []byte, remoteName string, style merge.ConflictStyle) error {
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
-
-	f, err := os.Create(path)
-	if err != nil {
+	// Replace rather than write through, which would follow a symlink
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	defer f.Close()
-
-	w := bufio.NewWriter(f)
-
-	// Write conflict markers
-	_, _ = w.WriteString(ConflictMarkerStart + "\n")
-	_, _ = w.Write(localContent)
-	if len(localContent) > 0 && localContent[len(localContent)-1] != '\n' {
-		_, _ = w.WriteString("\n")
-	}
-	_, _ = w.WriteString(ConflictMarkerMiddle + "\n")
-	_, _ = w.Write(remoteContent)
-	if len(remoteContent) > 0 && remoteContent[len(remoteContent)-1] != '\n' {
-		_, _ = w.WriteString("\n")
-	}
-	_, _ = w.WriteString(ConflictMarkerEnd + " (" + remoteName + ")\n")
 
-	return w.Flush()
+	return os.WriteFile(path, merge.WholeFile(baseContent, localContent, remoteContent, remoteName, style), 0644)
 }
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Backend is the storage used for pgit_commits and the content tables.
+// Both keep the same columns, so every query works on either; they differ
+// only in how rows are stored.
+type Backend string
+
+const (
+	// BackendXpatch stores the tables with the pg_xpatch table access
+	// method, delta-compressing each chain.
+	BackendXpatch Backend = "xpatch"
+	// BackendHeap stores them as regular heap tables for PostgreSQL servers
+	// without pg_xpatch. Content is compressed by PostgreSQL itself (lz4
+	// where the server supports it, pglz otherwise), without deltas.
+	// Compressing or delta-encoding in Go instead would store content the
+	// server can't read: regex search runs in SQL on the content column,
+	// and pgit sql queries expect plain text there.
+	BackendHeap Backend = "heap"
+)
+
+// MetaKeyBackend records the storage backend in pgit_metadata. Databases
+// created before it existed use pg_xpatch.
+const MetaKeyBackend = "storage_backend"
+
+// ParseBackend parses a --storage value. "auto" and "" return "", which
+// lets InitSchema pick pg_xpatch when the server has it and heap otherwise.
+func ParseBackend(s string) (Backend, error) {
+	switch s {
+	case "", "auto":
+		return "", nil
+	case string(BackendXpatch), string(BackendHeap):
+		return Backend(s), nil
+	}
+	return "", fmt.Errorf("unknown storage backend %q (use auto, xpatch or heap)", s)
+}
+
+// UseBackend sets the backend InitSchema creates the tables with ("" for
+// automatic). It has no effect on an existing schema.
+func (db *DB) UseBackend(b Backend) {
+	db.mu.Lock()
+	db.backend = b
+	db.mu.Unlock()
+}
+
+// Backend returns the storage backend of the database, read from
+// pgit_metadata once and cached.
+func (db *DB) Backend(ctx context.Context) Backend {
+	db.mu.RLock()
+	b := db.backend
+	db.mu.RUnlock()
+	if b != "" {
+		return b
+	}
+
+	value, err := db.GetMetadata(ctx, MetaKeyBackend)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		// No schema yet; don't cache the guess
+		return BackendXpatch
+	}
+	b = BackendXpatch
+	if value == string(BackendHeap) {
+		b = BackendHeap
+	}
+	db.UseBackend(b)
+	return b
+}
+
+// XpatchAvailable reports whether the server can create the pg_xpatch
+// extension.
+func (db *DB) XpatchAvailable(ctx context.Context) (bool, error) {
+	var available bool
+	err := db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'pg_xpatch')",
+	).Scan(&available)
+	return available, err
+}
+
+// chooseBackend returns the backend for a new schema: the one set with
+// UseBackend, else pg_xpatch if the server has it, else heap.
+func (db *DB) chooseBackend(ctx context.Context) (Backend, error) {
+	db.mu.RLock()
+	b := db.backend
+	db.mu.RUnlock()
+	if b != "" {
+		return b, nil
+	}
+	available, err := db.XpatchAvailable(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for pg_xpatch: %w", err)
+	}
+	if available {
+		return BackendXpatch, nil
+	}
+	return BackendHeap, nil
+}
+
+// accessMethod is the USING clause for the commit and content tables.
+func accessMethod(b Backend) string {
+	if b == BackendHeap {
+		return ""
+	}
+	return " USING xpatch"
+}
+
+// compressHeapContent asks PostgreSQL to compress large values of a heap
+// table's columns with lz4. Servers before PostgreSQL 14 or built without
+// lz4 keep the default pglz, which is fine too.
+func (db *DB) compressHeapContent(ctx context.Context, table string, columns ...string) {
+	for _, column := range columns {
+		_ = db.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET COMPRESSION lz4", table, column))
+	}
+}
+
+// refreshXpatchStats refreshes the cached xpatch.stats() of a table. Heap
+// tables have nothing to refresh.
+func (db *DB) refreshXpatchStats(ctx context.Context, table string) {
+	if db.Backend(ctx) == BackendXpatch {
+		_ = db.Exec(ctx, "SELECT xpatch.refresh_stats('"+table+"')")
+	}
+}
+
+// heapStatsSQL computes the columns of xpatch.stats() for a heap table:
+// every row counts as a keyframe, and the compressed size is what
+// PostgreSQL stores for the delta columns.
+func heapStatsSQL(table string) string {
+	if table == "pgit_commits" {
+		return `
+		SELECT COUNT(*), 1, COUNT(*), 0,
+			COALESCE(SUM(octet_length(message) + octet_length(author_name) + octet_length(author_email) +
+				octet_length(committer_name) + octet_length(committer_email)), 0),
+			COALESCE(SUM(pg_column_size(message) + pg_column_size(author_name) + pg_column_size(author_email) +
+				pg_column_size(committer_name) + pg_column_size(committer_email)), 0)
+		FROM pgit_commits`
+	}
+	return fmt.Sprintf(`
+		SELECT COUNT(*), COUNT(DISTINCT group_id), COUNT(*), 0,
+			COALESCE(SUM(octet_length(content)), 0), COALESCE(SUM(pg_column_size(content)), 0)
+		FROM %s`, pgx.Identifier{table}.Sanitize())
+}
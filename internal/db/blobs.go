@@ -32,6 +32,23 @@ func (b *Blob) IsDeleted() bool {
 	return b.ContentHash == nil
 }
 
+// fileRef builds the file ref that records this blob as version versionID
+// of pathID, with its size and line count.
+func (b *Blob) fileRef(pathID, versionID int32) *FileRef {
+	ref := &FileRef{
+		PathID:        pathID,
+		CommitID:      b.CommitID,
+		VersionID:     versionID,
+		ContentHash:   b.ContentHash,
+		Mode:          b.Mode,
+		IsSymlink:     b.IsSymlink,
+		SymlinkTarget: b.SymlinkTarget,
+		IsBinary:      b.IsBinary,
+	}
+	ref.Size, ref.LineCount = contentMetrics(b.Content, b.IsDeleted(), b.IsBinary)
+	return ref
+}
+
 // CreateBlob inserts a new blob into the database.
 // This writes to pgit_paths, pgit_file_refs, and pgit_text_content or pgit_binary_content.
 func (db *DB) CreateBlob(ctx context.Context, b *Blob) error {
@@ -72,16 +89,7 @@ func (db *DB) createBlobTx(ctx context.Context, tx pgx.Tx, b *Blob) error {
 	}
 
 	// 3. Create file ref
-	ref := &FileRef{
-		PathID:        pathID,
-		CommitID:      b.CommitID,
-		VersionID:     versionID,
-		ContentHash:   b.ContentHash,
-		Mode:          b.Mode,
-		IsSymlink:     b.IsSymlink,
-		SymlinkTarget: b.SymlinkTarget,
-		IsBinary:      b.IsBinary,
-	}
+	ref := b.fileRef(pathID, versionID)
 	if err := db.CreateFileRefTx(ctx, tx, ref); err != nil {
 		return err
 	}
@@ -173,16 +181,7 @@ func (db *DB) createBlobsBatchTx(ctx context.Context, tx pgx.Tx, blobs []*Blob)
 		for i, b := range pathBlobs {
 			versionID := baseVersion + int32(i) + 1
 
-			fileRefs = append(fileRefs, &FileRef{
-				PathID:        ids.PathID,
-				CommitID:      b.CommitID,
-				VersionID:     versionID,
-				ContentHash:   b.ContentHash,
-				Mode:          b.Mode,
-				IsSymlink:     b.IsSymlink,
-				SymlinkTarget: b.SymlinkTarget,
-				IsBinary:      b.IsBinary,
-			})
+			fileRefs = append(fileRefs, b.fileRef(ids.PathID, versionID))
 
 			if b.ContentHash != nil {
 				contents = append(contents, &Content{
@@ -206,8 +205,12 @@ func (db *DB) createBlobsBatchTx(ctx context.Context, tx pgx.Tx, blobs []*Blob)
 }
 
 // DeleteBlobsForCommits removes all file_refs and content data for the given
-// commit IDs. For xpatch content tables, it truncates each affected file's
-// chain at the lowest version_id being removed (xpatch cascade-deletes the rest).
+// commit IDs. A content version can be shared by several file refs (a pull
+// points a file that returns to earlier content at the stored version), so
+// only versions no surviving file ref uses are removed. Deleting a row of an
+// xpatch content chain also deletes every later row, so each affected chain
+// is cut at its first removed version and the surviving rows after it are
+// written back, as GC does. Runs in one transaction.
 // This must be called BEFORE DeleteCommits since we need the commit data
 // to identify which content versions to clean up.
 func (db *DB) DeleteBlobsForCommits(ctx context.Context, commitIDs []string) error {
@@ -215,84 +218,93 @@ func (db *DB) DeleteBlobsForCommits(ctx context.Context, commitIDs []string) err
 		return nil
 	}
 
-	// Step 1: Get (group_id, version_id, is_binary) for all file_refs being removed.
-	// This tells us which content chain entries to truncate.
-	type versionInfo struct {
-		groupID   int32
-		versionID int32
-		isBinary  bool
+	// Every file ref with content in the groups the commits touch
+	rows, err := db.Query(ctx, `
+		SELECT p.group_id, r.version_id, r.is_binary, r.commit_id
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE r.content_hash IS NOT NULL AND p.group_id IN (
+			SELECT dp.group_id FROM pgit_file_refs d
+			JOIN pgit_paths dp ON dp.path_id = d.path_id
+			WHERE d.commit_id = ANY($1))`, commitIDs)
+	if err != nil {
+		return fmt.Errorf("failed to query file_refs: %w", err)
 	}
-
-	// Find the minimum version_id per group among the commits being deleted.
-	// Deleting that version from the xpatch content table cascades to all later versions.
-	minVersionByGroup := make(map[int32]versionInfo) // group_id -> lowest versionInfo to delete
-
-	for _, cid := range commitIDs {
-		rows, err := db.Query(ctx,
-			`SELECT p.group_id, r.version_id, r.is_binary
-			 FROM pgit_file_refs r
-			 JOIN pgit_paths p ON p.path_id = r.path_id
-			 WHERE r.commit_id = $1`, cid)
-		if err != nil {
-			return fmt.Errorf("failed to query file_refs for commit %s: %w", cid, err)
-		}
-
-		for rows.Next() {
-			var vi versionInfo
-			if err := rows.Scan(&vi.groupID, &vi.versionID, &vi.isBinary); err != nil {
-				rows.Close()
-				return err
-			}
-			if existing, ok := minVersionByGroup[vi.groupID]; !ok || vi.versionID < existing.versionID {
-				minVersionByGroup[vi.groupID] = vi
-			}
-		}
-		rows.Close()
-		if err := rows.Err(); err != nil {
+	var refs []versionRef
+	for rows.Next() {
+		var ref versionRef
+		if err := rows.Scan(&ref.GroupID, &ref.VersionID, &ref.IsBinary, &ref.CommitID); err != nil {
+			rows.Close()
 			return err
 		}
+		refs = append(refs, ref)
 	}
-
-	// Step 2: Truncate content chains. For each group, delete the row at the
-	// minimum version_id — xpatch cascades to all subsequent versions.
-	for _, vi := range minVersionByGroup {
-		table := "pgit_text_content"
-		if vi.isBinary {
-			table = "pgit_binary_content"
-		}
-		// Only delete if content exists (deleted files have no content row)
-		var exists bool
-		err := db.QueryRow(ctx,
-			fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE group_id = $1 AND version_id = $2)", table),
-			vi.groupID, vi.versionID,
-		).Scan(&exists)
-		if err != nil {
-			return err
-		}
-		if exists {
-			if err := db.Exec(ctx,
-				fmt.Sprintf("DELETE FROM %s WHERE group_id = $1 AND version_id = $2", table),
-				vi.groupID, vi.versionID,
-			); err != nil {
-				return fmt.Errorf("failed to truncate content for group %d: %w", vi.groupID, err)
-			}
-		}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	// Step 3: Delete file_refs (normal heap table, simple delete)
-	for _, cid := range commitIDs {
-		if err := db.Exec(ctx, "DELETE FROM pgit_file_refs WHERE commit_id = $1", cid); err != nil {
-			return fmt.Errorf("failed to delete file_refs for commit %s: %w", cid, err)
-		}
+	removing := make(map[string]bool, len(commitIDs))
+	for _, id := range commitIDs {
+		removing[id] = true
 	}
+	versions := unsharedVersions(refs, removing)
 
 	// Note: xpatch stats for content tables become stale after deletion.
 	// We don't refresh them here since refresh_stats() is table-wide (scans
 	// all groups) and content tables have thousands of groups. The stats
 	// are only used for display (pgit stats) and self-correct on next refresh.
 	// The caller should refresh pgit_commits stats separately (single group, cheap).
+	return db.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := removeVersionsTx(ctx, tx, versions, nil); err != nil {
+			return err
+		}
+		for _, sql := range []string{
+			"DELETE FROM pgit_file_refs WHERE commit_id = ANY($1)",
+			"DELETE FROM pgit_file_changes WHERE commit_id = ANY($1)",
+		} {
+			if _, err := tx.Exec(ctx, sql, commitIDs); err != nil {
+				return fmt.Errorf("failed to delete file refs: %w", err)
+			}
+		}
+		return nil
+	})
+}
 
-	return nil
+// versionRef is a file ref's use of a content version.
+type versionRef struct {
+	GroupID   int32
+	VersionID int32
+	IsBinary  bool
+	CommitID  string
+}
+
+// unsharedVersions returns the content versions used only by file refs of
+// removing commits, ordered by chain and version.
+func unsharedVersions(refs []versionRef, removing map[string]bool) []gcVersion {
+	used := make(map[gcVersion]bool) // version → used by a surviving ref
+	for _, ref := range refs {
+		v := gcVersion{GroupID: ref.GroupID, VersionID: ref.VersionID, IsBinary: ref.IsBinary}
+		used[v] = used[v] || !removing[ref.CommitID]
+	}
+
+	var versions []gcVersion
+	for v, kept := range used {
+		if !kept {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := versions[i], versions[j]
+		if a.GroupID != b.GroupID {
+			return a.GroupID < b.GroupID
+		}
+		if a.IsBinary != b.IsBinary {
+			return !a.IsBinary
+		}
+		return a.VersionID < b.VersionID
+	})
+	return versions
 }
 
 // getOrCreatePathsBatchTx handles multiple paths within a transaction.
@@ -409,13 +421,14 @@ func (db *DB) createFileRefsBatchTx(ctx context.Context, tx pgx.Tx, refs []*File
 		rows[i] = []interface{}{
 			ref.PathID, ref.CommitID, ref.VersionID, ref.ContentHash,
 			ref.Mode, ref.IsSymlink, ref.SymlinkTarget, ref.IsBinary,
+			ref.Size, ref.LineCount,
 		}
 	}
 
 	_, err := tx.CopyFrom(
 		ctx,
 		pgx.Identifier{"pgit_file_refs"},
-		[]string{"path_id", "commit_id", "version_id", "content_hash", "mode", "is_symlink", "symlink_target", "is_binary"},
+		fileRefCopyColumns,
 		pgx.CopyFromRows(rows),
 	)
 	return err
@@ -578,51 +591,36 @@ func (db *DB) GetBlobsAtCommit(ctx context.Context, commitID string) ([]*Blob, e
 }
 
 // GetTreeAtCommit retrieves the full tree (all files) at a commit.
-// Uses a two-step approach: get refs with DISTINCT ON, then batch-fetch content.
+// Uses a two-step approach: get the tree refs, then batch-fetch content.
 func (db *DB) GetTreeAtCommit(ctx context.Context, commitID string) ([]*Blob, error) {
 	// Step 1: Get tree refs with paths and is_binary
-	sql := `
-	SELECT DISTINCT ON (r.path_id)
-		p.path, r.commit_id, r.content_hash, r.mode, r.is_symlink, r.symlink_target,
-		p.group_id, r.version_id, r.is_binary
-	FROM pgit_file_refs r
-	JOIN pgit_paths p ON p.path_id = r.path_id
-	WHERE r.commit_id <= $1
-	ORDER BY r.path_id, r.commit_id DESC`
-
-	rows, err := db.Query(ctx, sql, commitID)
+	refs, err := db.GetTreeRefsAtCommitWithPaths(ctx, commitID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	type treeEntry struct {
 		blob      *Blob
 		groupID   int32
 		versionID int32
 	}
-	var entries []treeEntry
-
-	for rows.Next() {
-		var e treeEntry
-		e.blob = &Blob{}
-		if err := rows.Scan(
-			&e.blob.Path, &e.blob.CommitID, &e.blob.ContentHash,
-			&e.blob.Mode, &e.blob.IsSymlink, &e.blob.SymlinkTarget,
-			&e.groupID, &e.versionID, &e.blob.IsBinary,
-		); err != nil {
-			return nil, err
-		}
-		// Skip deleted files
-		if e.blob.ContentHash != nil {
-			entries = append(entries, e)
+	entries := make([]treeEntry, len(refs))
+	for i, ref := range refs {
+		entries[i] = treeEntry{
+			blob: &Blob{
+				Path:          ref.Path,
+				CommitID:      ref.CommitID,
+				ContentHash:   ref.ContentHash,
+				Mode:          ref.Mode,
+				IsSymlink:     ref.IsSymlink,
+				SymlinkTarget: ref.SymlinkTarget,
+				IsBinary:      ref.IsBinary,
+			},
+			groupID:   ref.GroupID,
+			versionID: ref.VersionID,
 		}
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
 	if len(entries) == 0 {
 		return nil, nil
 	}
@@ -1076,8 +1074,12 @@ func (db *DB) getSearchFileRefs(ctx context.Context, pathPattern, commitID strin
 	}
 
 	if commitID != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("r.commit_id <= $%d", argNum))
-		args = append(args, commitID)
+		chain, err := db.treeChain(ctx, commitID)
+		if err != nil {
+			return nil, err
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf("r.commit_id = ANY($%d)", argNum))
+		args = append(args, chain)
 	}
 
 	whereClause := strings.Join(whereClauses, " AND ")
@@ -1107,10 +1109,15 @@ func (db *DB) getSearchFileRefs(ctx context.Context, pathPattern, commitID strin
 
 // getTreeSearchRefs loads the tree state at a commit (latest version per file).
 func (db *DB) getTreeSearchRefs(ctx context.Context, commitID, pathPattern string) ([]searchRef, error) {
+	chain, err := db.treeChain(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+
 	var args []interface{}
 	argNum := 1
 
-	args = append(args, commitID)
+	args = append(args, chain)
 	argNum++
 
 	pathFilter := ""
@@ -1122,13 +1129,14 @@ func (db *DB) getTreeSearchRefs(ctx context.Context, commitID, pathPattern strin
 		args = append(args, likePattern)
 	}
 
+	// Deleted and binary files are dropped after picking each path's
+	// newest ref, so an older text version doesn't resurface
 	sql := fmt.Sprintf(`
-		SELECT DISTINCT ON (r.path_id)
-			p.group_id, r.version_id, r.commit_id, p.path
-		FROM pgit_file_refs r
-		JOIN pgit_paths p ON p.path_id = r.path_id
-		WHERE r.commit_id <= $1 AND r.content_hash IS NOT NULL AND r.is_binary = FALSE %s
-		ORDER BY r.path_id, r.commit_id DESC`, pathFilter)
+		WITH %s
+		SELECT p.group_id, t.version_id, t.commit_id, p.path
+		FROM tree_refs t
+		JOIN pgit_paths p ON p.path_id = t.path_id
+		WHERE t.content_hash IS NOT NULL AND t.is_binary = FALSE %s`, treeRefsCTE, pathFilter)
 
 	rows, err := db.Query(ctx, sql, args...)
 	if err != nil {
@@ -1395,6 +1403,15 @@ func (db *DB) searchPerVersion(ctx context.Context, refs []searchRef, opts Searc
 // The first path in each local group determines the database group_id (auto-assigned
 // by PostgreSQL's IDENTITY column), and subsequent paths in the group reuse it.
 func (db *DB) PreRegisterPaths(ctx context.Context, paths []string, pathToLocalGroup map[string]int) (map[string]PathIDs, error) {
+	return db.PreRegisterPathsWithGroups(ctx, paths, pathToLocalGroup, nil)
+}
+
+// PreRegisterPathsWithGroups is PreRegisterPaths with a set of known database
+// group_ids for some local groups. Incremental imports use this to place new
+// paths into the existing delta group of content they share (e.g. a file
+// renamed in the new commits). Paths that are already registered still take
+// precedence over knownGroups.
+func (db *DB) PreRegisterPathsWithGroups(ctx context.Context, paths []string, pathToLocalGroup map[string]int, knownGroups map[int]int32) (map[string]PathIDs, error) {
 	if len(paths) == 0 {
 		return make(map[string]PathIDs), nil
 	}
@@ -1458,6 +1475,9 @@ func (db *DB) PreRegisterPaths(ctx context.Context, paths []string, pathToLocalG
 	// Check if any local group already has some paths registered (for resume).
 	// If so, reuse their group_id.
 	localGroupToDBGroup := make(map[int]int32)
+	for lg, groupID := range knownGroups {
+		localGroupToDBGroup[lg] = groupID
+	}
 	for _, path := range paths {
 		if reg, exists := result[path]; exists {
 			lg := pathToLocalGroup[path]
@@ -1597,16 +1617,7 @@ func (db *DB) CreateBlobsForGroup(ctx context.Context, nextChunk func() ([]*Blob
 					versionID = *versionCounter
 				}
 
-				fileRefs = append(fileRefs, &FileRef{
-					PathID:        pathIDs.PathID,
-					CommitID:      b.CommitID,
-					VersionID:     versionID,
-					ContentHash:   b.ContentHash,
-					Mode:          b.Mode,
-					IsSymlink:     b.IsSymlink,
-					SymlinkTarget: b.SymlinkTarget,
-					IsBinary:      b.IsBinary,
-				})
+				fileRefs = append(fileRefs, b.fileRef(pathIDs.PathID, versionID))
 			}
 
 			if err := db.createFileRefsBatchTx(ctx, tx, fileRefs); err != nil {
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
@@ -169,3 +170,223 @@ func (db *DB) CountCommitsFromGraph(ctx context.Context) (int, error) {
 	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM pgit_commit_graph").Scan(&count)
 	return count, err
 }
+
+// GetFirstParentChain returns the IDs on the first-parent chain starting at
+// commitID (inclusive), newest first, up to limit entries (0 = unlimited).
+// Commits missing from the graph (made with pgit commit or pulled) are
+// walked via pgit_commits.parent_id, a page of IDs at a time, until the
+// chain reaches the graph, which is then followed with a recursive CTE over
+// ancestors[1] (the parent seq).
+func (db *DB) GetFirstParentChain(ctx context.Context, commitID string, limit int) ([]string, error) {
+	const pageSize = 500
+
+	var ids []string
+	current := commitID
+	for current != "" && (limit == 0 || len(ids) < limit) {
+		inGraph, err := db.CommitExistsInGraph(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		if inGraph {
+			remaining := 0
+			if limit > 0 {
+				remaining = limit - len(ids)
+			}
+			chain, err := db.graphChain(ctx, current, remaining)
+			if err != nil {
+				return nil, err
+			}
+			return append(ids, chain...), nil
+		}
+
+		// A page holds the commits at or before current in ID order; the
+		// chain is followed through it by parent_id, so a parent that
+		// sorts after its child only costs another page
+		parents, err := db.parentPage(ctx, current, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		parent, ok := parents[current]
+		if !ok {
+			break
+		}
+		for ok && (limit == 0 || len(ids) < limit) {
+			ids = append(ids, current)
+			current = parent
+			parent, ok = parents[current]
+		}
+	}
+	return ids, nil
+}
+
+// parentPage maps up to limit commit IDs at or before id (in ID order) to
+// their first parent ("" for a root commit).
+func (db *DB) parentPage(ctx context.Context, id string, limit int) (map[string]string, error) {
+	rows, err := db.Query(ctx,
+		"SELECT id, parent_id FROM pgit_commits WHERE id <= $1 ORDER BY id DESC LIMIT $2", id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[string]string, limit)
+	for rows.Next() {
+		var cid string
+		var parentID *string
+		if err := rows.Scan(&cid, &parentID); err != nil {
+			return nil, err
+		}
+		parents[cid] = ""
+		if parentID != nil {
+			parents[cid] = *parentID
+		}
+	}
+	return parents, rows.Err()
+}
+
+// CompareCommits counts the commits reachable from a but not from b (ahead)
+// and from b but not from a (behind), following first parents back to the
+// merge base, which is returned ("" for unrelated histories). Both sides
+// step back in turn until one reaches a commit the other has passed, so
+// neither commit IDs nor author times need to be ordered along the
+// history. Cost is at most twice the larger count, not the length of the
+// history.
+func (db *DB) CompareCommits(ctx context.Context, a, b string) (ahead, behind int, base string, err error) {
+	return compareChains(a, b, func(id string) (string, error) { return db.getParentID(ctx, id) })
+}
+
+// compareChains implements CompareCommits over any parent lookup.
+func compareChains(a, b string, parent func(string) (string, error)) (ahead, behind int, base string, err error) {
+	seenA := map[string]int{a: 0}
+	seenB := map[string]int{b: 0}
+	for {
+		if n, ok := seenB[a]; ok {
+			return ahead, n, a, nil
+		}
+		if n, ok := seenA[b]; ok {
+			return n, behind, b, nil
+		}
+		if a == "" && b == "" {
+			return ahead, behind, "", nil
+		}
+		if a != "" {
+			if a, err = parent(a); err != nil {
+				return 0, 0, "", err
+			}
+			ahead++
+			if a != "" {
+				seenA[a] = ahead
+			}
+		}
+		if b != "" {
+			if b, err = parent(b); err != nil {
+				return 0, 0, "", err
+			}
+			behind++
+			if b != "" {
+				seenB[b] = behind
+			}
+		}
+	}
+}
+
+// IsAncestor reports whether ancestor is on the first-parent chain of id
+// (or is id itself).
+func (db *DB) IsAncestor(ctx context.Context, ancestor, id string) (bool, error) {
+	ahead, _, base, err := db.CompareCommits(ctx, ancestor, id)
+	if err != nil {
+		return false, err
+	}
+	return ahead == 0 && base == ancestor, nil
+}
+
+// ErrNotAncestor is returned by CommitsBetween when the stop commit is not
+// on the chain.
+var ErrNotAncestor = errors.New("not an ancestor")
+
+// CommitsBetween returns the commits on the first-parent chain from headID
+// back to, but not including, stopID ("" walks to the root), oldest first.
+// Commits are read a page at a time in ID order and the chain is followed
+// through each page by parent_id, so a parent that sorts after its child
+// only costs an extra page. Returns an error wrapping ErrNotAncestor if
+// stopID is not an ancestor of headID.
+func (db *DB) CommitsBetween(ctx context.Context, headID, stopID string) ([]*Commit, error) {
+	const pageSize = 500
+
+	var chain []*Commit
+	current := headID
+	for current != stopID {
+		if current == "" {
+			return nil, fmt.Errorf("commit %s is not an ancestor of %s: %w", stopID, headID, ErrNotAncestor)
+		}
+		page, err := db.GetCommitLogFrom(ctx, current, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string]*Commit, len(page))
+		for _, c := range page {
+			byID[c.ID] = c
+		}
+		c, ok := byID[current]
+		if !ok {
+			return nil, fmt.Errorf("commit %s not found", current)
+		}
+		for ok && current != stopID {
+			chain = append(chain, c)
+			current = ""
+			if c.ParentID != nil {
+				current = *c.ParentID
+			}
+			c, ok = byID[current]
+		}
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// getParentID returns the first parent of a commit ("" for a root commit).
+func (db *DB) getParentID(ctx context.Context, id string) (string, error) {
+	var parentID *string
+	err := db.QueryRow(ctx, "SELECT parent_id FROM pgit_commits WHERE id = $1", id).Scan(&parentID)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("commit %s not found", id)
+	}
+	if err != nil || parentID == nil {
+		return "", err
+	}
+	return *parentID, nil
+}
+
+// graphChain follows parent pointers in pgit_commit_graph from id.
+func (db *DB) graphChain(ctx context.Context, id string, limit int) ([]string, error) {
+	sql := `
+	WITH RECURSIVE chain AS (
+		SELECT id, ancestors[1] AS parent, 1 AS n
+		FROM pgit_commit_graph WHERE id = $1
+		UNION ALL
+		SELECT g.id, g.ancestors[1], c.n + 1
+		FROM pgit_commit_graph g
+		JOIN chain c ON g.seq = c.parent
+		WHERE $2 = 0 OR c.n < $2
+	)
+	SELECT id FROM chain ORDER BY n`
+
+	rows, err := db.Query(ctx, sql, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var cid string
+		if err := rows.Scan(&cid); err != nil {
+			return nil, err
+		}
+		ids = append(ids, cid)
+	}
+	return ids, rows.Err()
+}
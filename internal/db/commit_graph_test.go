@@ -0,0 +1,56 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompareChains(t *testing.T) {
+	// IDs deliberately don't sort along the history (skewed author times):
+	//
+	//   Z ─ B ─ Y ─ A        (main)
+	//        └─ C ─ X        (fork)
+	//   Q                    (unrelated root)
+	parents := map[string]string{
+		"Z": "", "B": "Z", "Y": "B", "A": "Y",
+		"C": "B", "X": "C",
+		"Q": "",
+	}
+	parent := func(id string) (string, error) {
+		p, ok := parents[id]
+		if !ok {
+			return "", fmt.Errorf("commit %s not found", id)
+		}
+		return p, nil
+	}
+
+	tests := []struct {
+		a, b          string
+		ahead, behind int
+		base          string
+	}{
+		{"A", "A", 0, 0, "A"},
+		{"A", "B", 2, 0, "B"},
+		{"B", "A", 0, 2, "B"},
+		{"Z", "A", 0, 3, "Z"},
+		{"A", "X", 2, 2, "B"},
+		{"X", "Y", 2, 1, "B"},
+		{"A", "Q", 4, 1, ""},
+		{"", "A", 0, 4, ""},
+	}
+
+	for _, tt := range tests {
+		ahead, behind, base, err := compareChains(tt.a, tt.b, parent)
+		if err != nil {
+			t.Fatalf("compareChains(%s, %s): %v", tt.a, tt.b, err)
+		}
+		if ahead != tt.ahead || behind != tt.behind || base != tt.base {
+			t.Errorf("compareChains(%s, %s) = %d, %d, %q; want %d, %d, %q",
+				tt.a, tt.b, ahead, behind, base, tt.ahead, tt.behind, tt.base)
+		}
+	}
+
+	if _, _, _, err := compareChains("A", "missing", parent); err == nil {
+		t.Error("expected an error for a missing commit")
+	}
+}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/jackc/pgx/v5"
+	"github.com/zeebo/blake3"
+)
+
+// ComputeHash returns the commit hash of c: BLAKE3 over its ID, its
+// parent's commit hash ("" for a root commit), its tree hash, author,
+// committer and message. Each commit hash covers the whole history before
+// it, so rewriting any commit changes the hash of every commit after it.
+// Times are hashed in microseconds, the precision PostgreSQL stores.
+func (c *Commit) ComputeHash(parentHash string) string {
+	h := blake3.New()
+	_, _ = fmt.Fprintf(h, "commit %s\nparent %s\ntree %s\n", c.ID, parentHash, c.TreeHash)
+	_, _ = fmt.Fprintf(h, "author %q %q %d\n", c.AuthorName, c.AuthorEmail, c.AuthoredAt.UnixMicro())
+	_, _ = fmt.Fprintf(h, "committer %q %q %d\n\n", c.CommitterName, c.CommitterEmail, c.CommittedAt.UnixMicro())
+	_, _ = h.Write([]byte(c.Message))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CommitHashError is returned when a commit's stored hash doesn't match
+// the one computed from its contents and its parent's hash.
+type CommitHashError struct {
+	ID       string
+	Stored   string
+	Computed string
+}
+
+func (e *CommitHashError) Error() string {
+	return fmt.Sprintf("commit %s has hash %s, but its contents hash to %s", e.ID, e.Stored, e.Computed)
+}
+
+// CommitHashes returns the stored commit hash of each of the given commits
+// that exists.
+func (db *DB) CommitHashes(ctx context.Context, ids []string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	if len(ids) == 0 {
+		return hashes, nil
+	}
+
+	rows, err := db.Query(ctx, "SELECT id, commit_hash FROM pgit_commits WHERE id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, err
+		}
+		hashes[id] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// VerifyCommitHashes checks incoming commits (parents before children)
+// before they are stored: each commit hash must match the one computed from
+// the commit and its parent's hash, taken from the slice or from this
+// database. A commit changed after it was written fails with a
+// *CommitHashError, and so does every commit built on top of one.
+func (db *DB) VerifyCommitHashes(ctx context.Context, commits []*Commit) error {
+	known, err := db.parentCommitHashes(ctx, commits)
+	if err != nil {
+		return err
+	}
+	for _, c := range commits {
+		known[c.ID] = c.CommitHash
+	}
+
+	for _, c := range commits {
+		parentHash := ""
+		if c.ParentID != nil {
+			hash, ok := known[*c.ParentID]
+			if !ok {
+				return fmt.Errorf("commit %s: parent %s not found", c.ID, *c.ParentID)
+			}
+			parentHash = hash
+		}
+		if computed := c.ComputeHash(parentHash); computed != c.CommitHash {
+			return &CommitHashError{ID: c.ID, Stored: c.CommitHash, Computed: computed}
+		}
+	}
+	return nil
+}
+
+// FillCommitHashes sets the commit hash of incoming commits that arrive
+// without one, chained from their parents' hashes. Parents come from the
+// slice, where they must precede their children, or from this database.
+func (db *DB) FillCommitHashes(ctx context.Context, commits []*Commit) error {
+	known, err := db.parentCommitHashes(ctx, commits)
+	if err != nil {
+		return err
+	}
+	for _, c := range commits {
+		parentHash := ""
+		if c.ParentID != nil {
+			hash, ok := known[*c.ParentID]
+			if !ok {
+				return fmt.Errorf("commit %s: parent %s not found", c.ID, *c.ParentID)
+			}
+			parentHash = hash
+		}
+		c.CommitHash = c.ComputeHash(parentHash)
+		known[c.ID] = c.CommitHash
+	}
+	return nil
+}
+
+// parentCommitHashes returns the stored hashes of the parents of commits
+// that are not in the slice themselves.
+func (db *DB) parentCommitHashes(ctx context.Context, commits []*Commit) (map[string]string, error) {
+	inSlice := make(map[string]bool, len(commits))
+	for _, c := range commits {
+		inSlice[c.ID] = true
+	}
+	var external []string
+	for _, c := range commits {
+		if c.ParentID != nil && !inSlice[*c.ParentID] {
+			external = append(external, *c.ParentID)
+		}
+	}
+	return db.CommitHashes(ctx, external)
+}
+
+// TreeHashError reports a commit whose files don't hash to its tree hash.
+type TreeHashError struct {
+	ID       string
+	Stored   string
+	Computed string
+}
+
+func (e *TreeHashError) Error() string {
+	return fmt.Sprintf("commit %s has tree hash %s, but its files hash to %s", e.ID, e.Stored, e.Computed)
+}
+
+// VerifyTreeHashes checks the tree hash of commits whose file refs were
+// just stored: each commit's tree is its parent's (from the slice, or
+// read from this database) with its own file refs applied. The tips of
+// the slice, which refs are about to point at, are hashed once more from
+// the files checkout reads (TreeEntriesAt). The first mismatch fails with
+// a *TreeHashError.
+func (db *DB) VerifyTreeHashes(ctx context.Context, commits []*Commit) error {
+	list := make([]fsckCommit, len(commits))
+	inSlice := make(map[string]bool, len(commits))
+	for i, c := range commits {
+		list[i] = fsckCommit{ID: c.ID, ParentID: c.ParentID, TreeHash: c.TreeHash}
+		inSlice[c.ID] = true
+	}
+	ordered := ancestryOrder(list)
+	parentIDs := make([]string, len(ordered))
+	for i, c := range ordered {
+		if c.ParentID != nil {
+			parentIDs[i] = *c.ParentID
+		}
+	}
+
+	replay := util.NewTreeReplay(parentIDs)
+	based := make(map[string]bool)
+	for _, parentID := range parentIDs {
+		if parentID == "" || inSlice[parentID] || based[parentID] {
+			continue
+		}
+		based[parentID] = true
+		tree, err := db.MerkleTreeAt(ctx, parentID)
+		if err != nil {
+			return err
+		}
+		replay.SetBase(parentID, tree)
+	}
+
+	const batchSize = 1000
+	for start := 0; start < len(ordered); start += batchSize {
+		batch := ordered[start:min(start+batchSize, len(ordered))]
+		ids := make([]string, len(batch))
+		for i, c := range batch {
+			ids[i] = c.ID
+		}
+		changes, err := treeChanges(ctx, db, "r.commit_id = ANY($1)", ids)
+		if err != nil {
+			return err
+		}
+		for i, c := range batch {
+			if got := replay.Replay(c.ID, parentIDs[start+i], changes[c.ID]); got != c.TreeHash {
+				return &TreeHashError{ID: c.ID, Stored: c.TreeHash, Computed: got}
+			}
+		}
+	}
+
+	isParent := make(map[string]bool, len(parentIDs))
+	for _, parentID := range parentIDs {
+		isParent[parentID] = true
+	}
+	for _, c := range ordered {
+		if isParent[c.ID] {
+			continue
+		}
+		got, err := db.TreeHashAtCommit(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if got != c.TreeHash {
+			return &TreeHashError{ID: c.ID, Stored: c.TreeHash, Computed: got}
+		}
+	}
+	return nil
+}
+
+// TreeEntriesAt returns the files of the tree at commitID as tree entries,
+// sorted by path. They are read with GetTreeRefsAtCommitWithPaths, like the
+// files checkout writes and a new commit starts from, so a tree hash always
+// covers the files pgit checks out.
+func (db *DB) TreeEntriesAt(ctx context.Context, commitID string) ([]util.TreeEntry, error) {
+	refs, err := db.GetTreeRefsAtCommitWithPaths(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]util.TreeEntry, len(refs))
+	for i, ref := range refs {
+		entries[i] = util.TreeEntry{
+			Path:        ref.Path,
+			Mode:        ref.Mode,
+			ContentHash: ref.ContentHash,
+			IsSymlink:   ref.IsSymlink,
+		}
+	}
+	// ORDER BY path follows the database collation, not byte order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// MerkleTreeAt returns the tree at commitID (see TreeEntriesAt) as a
+// MerkleTree, to replay later commits on.
+func (db *DB) MerkleTreeAt(ctx context.Context, commitID string) (*util.MerkleTree, error) {
+	entries, err := db.TreeEntriesAt(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+	tree := util.NewMerkleTree()
+	for _, e := range entries {
+		tree.Set(e)
+	}
+	return tree, nil
+}
+
+// TreeHashAtCommit computes the tree hash of the tree at commitID from its
+// file refs.
+func (db *DB) TreeHashAtCommit(ctx context.Context, commitID string) (string, error) {
+	entries, err := db.TreeEntriesAt(ctx, commitID)
+	if err != nil {
+		return "", err
+	}
+	return util.ComputeTreeHash(entries), nil
+}
+
+// rehashCommits copies the commit rows of src (a table with the columns of
+// pgit_commits) into pgit_commits in seq order, replacing tree hashes with
+// the ones in trees (where present) and recomputing every commit hash.
+// parentHashes holds the hashes of parents that are not in src and is
+// extended with the new hashes as rows are written. onBatch (may be nil)
+// receives the number of rows written so far.
+func rehashCommits(ctx context.Context, tx pgx.Tx, src string, trees, parentHashes map[string]string, onBatch func(done int)) error {
+	const batchSize = 1000
+
+	if _, err := tx.Exec(ctx, `
+		DECLARE pgit_rehash CURSOR FOR
+		SELECT id, seq, parent_id, tree_hash, message, author_name, author_email, authored_at,
+		       committer_name, committer_email, committed_at
+		FROM `+src+` ORDER BY seq`); err != nil {
+		return err
+	}
+	defer func() { _, _ = tx.Exec(ctx, "CLOSE pgit_rehash") }()
+
+	done := 0
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM pgit_rehash", batchSize))
+		if err != nil {
+			return err
+		}
+		var batch [][]any
+		for rows.Next() {
+			c := &Commit{}
+			if err := rows.Scan(&c.ID, &c.Seq, &c.ParentID, &c.TreeHash, &c.Message,
+				&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
+				&c.CommitterName, &c.CommitterEmail, &c.CommittedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			if tree, ok := trees[c.ID]; ok {
+				c.TreeHash = tree
+			}
+			parentHash := ""
+			if c.ParentID != nil {
+				hash, ok := parentHashes[*c.ParentID]
+				if !ok {
+					rows.Close()
+					return fmt.Errorf("commit %s: parent %s has no commit hash yet", c.ID, *c.ParentID)
+				}
+				parentHash = hash
+			}
+			c.CommitHash = c.ComputeHash(parentHash)
+			parentHashes[c.ID] = c.CommitHash
+			batch = append(batch, []any{
+				c.ID, c.Seq, c.ParentID, c.TreeHash, c.Message,
+				c.AuthorName, c.AuthorEmail, c.AuthoredAt,
+				c.CommitterName, c.CommitterEmail, c.CommittedAt, c.CommitHash,
+			})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"pgit_commits"}, commitColumns, pgx.CopyFromRows(batch)); err != nil {
+			return err
+		}
+		done += len(batch)
+		if onBatch != nil {
+			onBatch(done)
+		}
+	}
+}
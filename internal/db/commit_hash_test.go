@@ -0,0 +1,179 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+)
+
+func TestCommitHash(t *testing.T) {
+	when := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	c := &Commit{
+		ID: "01ROOT", TreeHash: "t1", Message: "first",
+		AuthorName: "A", AuthorEmail: "a@x", AuthoredAt: when,
+		CommitterName: "A", CommitterEmail: "a@x", CommittedAt: when,
+	}
+	base := c.ComputeHash("")
+
+	// PostgreSQL keeps microseconds; a commit read back hashes the same
+	stored := *c
+	stored.AuthoredAt = when.Truncate(time.Microsecond)
+	stored.CommittedAt = when.Truncate(time.Microsecond)
+	if got := stored.ComputeHash(""); got != base {
+		t.Errorf("hash changed by microsecond truncation: %s != %s", got, base)
+	}
+
+	changed := *c
+	changed.Message = "first!"
+	if changed.ComputeHash("") == base {
+		t.Error("message change did not change the hash")
+	}
+	if c.ComputeHash("parent") == base {
+		t.Error("parent hash did not change the hash")
+	}
+}
+
+func TestVerifyCommitHashesChain(t *testing.T) {
+	when := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	root := &Commit{ID: "01A", TreeHash: "t1", Message: "a", AuthoredAt: when, CommittedAt: when}
+	root.CommitHash = root.ComputeHash("")
+	id := root.ID
+	child := &Commit{ID: "01B", ParentID: &id, TreeHash: "t2", Message: "b", AuthoredAt: when, CommittedAt: when}
+	child.CommitHash = child.ComputeHash(root.CommitHash)
+
+	// Parents in the slice need no database
+	var db *DB
+	if err := db.VerifyCommitHashes(t.Context(), []*Commit{root, child}); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+
+	root.Message = "tampered"
+	err := db.VerifyCommitHashes(t.Context(), []*Commit{root, child})
+	if hashErr, ok := err.(*CommitHashError); !ok || hashErr.ID != root.ID {
+		t.Errorf("expected CommitHashError for %s, got %v", root.ID, err)
+	}
+}
+
+func TestTreeHashCanonicalModes(t *testing.T) {
+	hash := []byte{1, 2, 3}
+	native := util.ComputeTreeHash([]util.TreeEntry{
+		{Path: "src/main.go", Mode: 0644, ContentHash: hash},
+		{Path: "run.sh", Mode: 0755, ContentHash: hash},
+		{Path: "link", Mode: 0777, ContentHash: hash, IsSymlink: true},
+	})
+	imported := util.ComputeTreeHash([]util.TreeEntry{
+		{Path: "link", Mode: 0120000, ContentHash: hash},
+		{Path: "run.sh", Mode: 0100755, ContentHash: hash},
+		{Path: "src/main.go", Mode: 0100644, ContentHash: hash},
+	})
+	if native != imported {
+		t.Errorf("native tree %s != imported tree %s", native, imported)
+	}
+
+	// Incremental updates match hashing from scratch
+	tree := util.NewMerkleTree()
+	tree.Set(util.TreeEntry{Path: "src/old.go", Mode: 0644, ContentHash: hash})
+	tree.Set(util.TreeEntry{Path: "src/main.go", Mode: 0644, ContentHash: []byte{9}})
+	_ = tree.Hash()
+	tree.Set(util.TreeEntry{Path: "src/old.go"})
+	tree.Set(util.TreeEntry{Path: "src/main.go", Mode: 0644, ContentHash: hash})
+	tree.Set(util.TreeEntry{Path: "run.sh", Mode: 0755, ContentHash: hash})
+	tree.Set(util.TreeEntry{Path: "link", Mode: 0777, ContentHash: hash, IsSymlink: true})
+	if got := tree.Hash(); got != native {
+		t.Errorf("incremental tree %s != %s", got, native)
+	}
+}
+
+func TestTreeReplayFollowsAncestry(t *testing.T) {
+	file := func(path string, hash byte) util.TreeEntry {
+		return util.TreeEntry{Path: path, Mode: 0644, ContentHash: []byte{hash}}
+	}
+	// IDs sort against the history: the side branch C sorts before B, its
+	// sibling on main, and D builds on B
+	//
+	//   A ─ B ─ D
+	//    └─ C
+	commits := []struct {
+		id, parent string
+		changes    []util.TreeEntry
+	}{
+		{"01A", "", []util.TreeEntry{file("a.txt", 1), file("dir/b.txt", 2)}},
+		{"01C", "01A", []util.TreeEntry{file("side.txt", 3), {Path: "dir/b.txt"}}},
+		{"01B", "01A", []util.TreeEntry{file("a.txt", 4)}},
+		{"01D", "01B", []util.TreeEntry{file("dir/d.txt", 5)}},
+	}
+	parentIDs := make([]string, len(commits))
+	for i, c := range commits {
+		parentIDs[i] = c.parent
+	}
+	replay := util.NewTreeReplay(parentIDs)
+	got := make(map[string]string)
+	for _, c := range commits {
+		got[c.id] = replay.Replay(c.id, c.parent, c.changes)
+	}
+
+	want := map[string]string{
+		"01A": util.ComputeTreeHash([]util.TreeEntry{file("a.txt", 1), file("dir/b.txt", 2)}),
+		"01C": util.ComputeTreeHash([]util.TreeEntry{file("a.txt", 1), file("side.txt", 3)}),
+		"01B": util.ComputeTreeHash([]util.TreeEntry{file("a.txt", 4), file("dir/b.txt", 2)}),
+		"01D": util.ComputeTreeHash([]util.TreeEntry{file("a.txt", 4), file("dir/b.txt", 2), file("dir/d.txt", 5)}),
+	}
+	for id, hash := range want {
+		if got[id] != hash {
+			t.Errorf("tree of %s = %s, want %s", id, got[id], hash)
+		}
+	}
+
+	// A clone doesn't see changes made to the original afterwards
+	tree := util.NewMerkleTree()
+	tree.Set(file("dir/x.txt", 1))
+	clone := tree.Clone()
+	tree.Set(file("dir/x.txt", 2))
+	tree.Remove("dir/x.txt")
+	if got, want := clone.Hash(), util.ComputeTreeHash([]util.TreeEntry{file("dir/x.txt", 1)}); got != want {
+		t.Errorf("clone changed with the original: %s != %s", got, want)
+	}
+	if got, want := tree.Hash(), util.ComputeTreeHash(nil); got != want {
+		t.Errorf("original after removal = %s, want the empty tree %s", got, want)
+	}
+}
+
+func TestAncestryOrder(t *testing.T) {
+	parent := func(id string) *string { return &id }
+	// Given in seq order with a parent stored after its child
+	commits := []fsckCommit{
+		{ID: "01A"},
+		{ID: "01C", ParentID: parent("01B")},
+		{ID: "01B", ParentID: parent("01A")},
+		{ID: "01D", ParentID: parent("01A")},
+		{ID: "01E", ParentID: parent("01GONE")},
+	}
+	var got []string
+	for _, c := range ancestryOrder(commits) {
+		got = append(got, c.ID)
+	}
+	want := []string{"01A", "01B", "01C", "01D", "01E"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ancestryOrder = %v, want %v", got, want)
+	}
+}
+
+func TestFillCommitHashes(t *testing.T) {
+	when := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	root := &Commit{ID: "01A", TreeHash: "t1", Message: "a", AuthoredAt: when, CommittedAt: when}
+	id := root.ID
+	child := &Commit{ID: "01B", ParentID: &id, TreeHash: "t2", Message: "b", AuthoredAt: when, CommittedAt: when}
+
+	var db *DB
+	if err := db.FillCommitHashes(t.Context(), []*Commit{root, child}); err != nil {
+		t.Fatal(err)
+	}
+	if root.CommitHash != root.ComputeHash("") || child.CommitHash != child.ComputeHash(root.CommitHash) {
+		t.Error("filled hashes don't chain")
+	}
+	if err := db.VerifyCommitHashes(t.Context(), []*Commit{root, child}); err != nil {
+		t.Errorf("filled hashes don't verify: %v", err)
+	}
+}
@@ -21,21 +21,33 @@ type Commit struct {
 	CommitterName  string
 	CommitterEmail string
 	CommittedAt    time.Time
+	CommitHash     string // chained hash, see ComputeHash
 }
 
+// commitColumns are the pgit_commits columns written by COPY, in the order
+// of the row values built from a Commit.
+var commitColumns = []string{"id", "seq", "parent_id", "tree_hash", "message",
+	"author_name", "author_email", "authored_at",
+	"committer_name", "committer_email", "committed_at", "commit_hash"}
+
 // CreateCommit inserts a new commit into the database
 func (db *DB) CreateCommit(ctx context.Context, c *Commit) error {
 	sql := `
-	INSERT INTO pgit_commits (id, seq, parent_id, tree_hash, message, author_name, author_email, authored_at, committer_name, committer_email, committed_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	INSERT INTO pgit_commits (id, seq, parent_id, tree_hash, message, author_name, author_email, authored_at, committer_name, committer_email, committed_at, commit_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 
-	return db.Exec(ctx, sql, c.ID, c.Seq, c.ParentID, c.TreeHash, c.Message,
+	err := db.Exec(ctx, sql, c.ID, c.Seq, c.ParentID, c.TreeHash, c.Message,
 		c.AuthorName, c.AuthorEmail, c.AuthoredAt,
-		c.CommitterName, c.CommitterEmail, c.CommittedAt)
+		c.CommitterName, c.CommitterEmail, c.CommittedAt, c.CommitHash)
+	if err != nil {
+		return err
+	}
+	return db.createCommitTrailers(ctx, []*Commit{c})
 }
 
 // CreateCommitsBatch inserts multiple commits using pgx.CopyFrom for speed
 // Commits must be in order (parents before children)
+// Their trailers are parsed into pgit_commit_trailers as well.
 func (db *DB) CreateCommitsBatch(ctx context.Context, commits []*Commit) error {
 	if len(commits) == 0 {
 		return nil
@@ -46,19 +58,20 @@ func (db *DB) CreateCommitsBatch(ctx context.Context, commits []*Commit) error {
 		rows[i] = []interface{}{
 			c.ID, c.Seq, c.ParentID, c.TreeHash, c.Message,
 			c.AuthorName, c.AuthorEmail, c.AuthoredAt,
-			c.CommitterName, c.CommitterEmail, c.CommittedAt,
+			c.CommitterName, c.CommitterEmail, c.CommittedAt, c.CommitHash,
 		}
 	}
 
 	_, err := db.pool.CopyFrom(
 		ctx,
 		pgx.Identifier{"pgit_commits"},
-		[]string{"id", "seq", "parent_id", "tree_hash", "message",
-			"author_name", "author_email", "authored_at",
-			"committer_name", "committer_email", "committed_at"},
+		commitColumns,
 		pgx.CopyFromRows(rows),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return db.createCommitTrailers(ctx, commits)
 }
 
 // CreateCommitsBatchTx inserts multiple commits within an existing transaction.
@@ -72,26 +85,27 @@ func (db *DB) CreateCommitsBatchTx(ctx context.Context, tx pgx.Tx, commits []*Co
 		rows[i] = []interface{}{
 			c.ID, c.Seq, c.ParentID, c.TreeHash, c.Message,
 			c.AuthorName, c.AuthorEmail, c.AuthoredAt,
-			c.CommitterName, c.CommitterEmail, c.CommittedAt,
+			c.CommitterName, c.CommitterEmail, c.CommittedAt, c.CommitHash,
 		}
 	}
 
 	_, err := tx.CopyFrom(
 		ctx,
 		pgx.Identifier{"pgit_commits"},
-		[]string{"id", "seq", "parent_id", "tree_hash", "message",
-			"author_name", "author_email", "authored_at",
-			"committer_name", "committer_email", "committed_at"},
+		commitColumns,
 		pgx.CopyFromRows(rows),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return db.CreateCommitTrailersTx(ctx, tx, commits)
 }
 
 // GetCommit retrieves a commit by ID
 func (db *DB) GetCommit(ctx context.Context, id string) (*Commit, error) {
 	sql := `
 	SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-	       committer_name, committer_email, committed_at
+	       committer_name, committer_email, committed_at, commit_hash
 	FROM pgit_commits
 	WHERE id = $1`
 
@@ -99,7 +113,7 @@ func (db *DB) GetCommit(ctx context.Context, id string) (*Commit, error) {
 	err := db.QueryRow(ctx, sql, id).Scan(
 		&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 		&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-		&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+		&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -114,7 +128,7 @@ func (db *DB) GetCommit(ctx context.Context, id string) (*Commit, error) {
 func (db *DB) GetHeadCommit(ctx context.Context) (*Commit, error) {
 	sql := `
 	SELECT c.id, c.parent_id, c.tree_hash, c.message, c.author_name, c.author_email, c.authored_at,
-	       c.committer_name, c.committer_email, c.committed_at
+	       c.committer_name, c.committer_email, c.committed_at, c.commit_hash
 	FROM pgit_commits c
 	JOIN pgit_refs r ON r.commit_id = c.id
 	WHERE r.name = 'HEAD'`
@@ -123,7 +137,7 @@ func (db *DB) GetHeadCommit(ctx context.Context) (*Commit, error) {
 	err := db.QueryRow(ctx, sql).Scan(
 		&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 		&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-		&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+		&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -155,7 +169,7 @@ func (db *DB) GetCommitLog(ctx context.Context, limit int) ([]*Commit, error) {
 func (db *DB) GetCommitLogFrom(ctx context.Context, commitID string, limit int) ([]*Commit, error) {
 	sql := `
 	SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-	       committer_name, committer_email, committed_at
+	       committer_name, committer_email, committed_at, commit_hash
 	FROM pgit_commits
 	WHERE id <= $1
 	ORDER BY id DESC
@@ -173,7 +187,7 @@ func (db *DB) GetCommitLogFrom(ctx context.Context, commitID string, limit int)
 		if err := rows.Scan(
 			&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 			&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 		); err != nil {
 			return nil, err
 		}
@@ -183,11 +197,34 @@ func (db *DB) GetCommitLogFrom(ctx context.Context, commitID string, limit int)
 	return commits, rows.Err()
 }
 
+// GetCommitLogFirstParent retrieves up to limit commits on the first-parent
+// chain from commitID, newest first. Unlike GetCommitLogFrom this follows
+// real ancestry, so it stays correct when several branches share a database.
+func (db *DB) GetCommitLogFirstParent(ctx context.Context, commitID string, limit int) ([]*Commit, error) {
+	ids, err := db.GetFirstParentChain(ctx, commitID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	byID, err := db.GetCommitsBatch(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]*Commit, 0, len(ids))
+	for _, id := range ids {
+		if c, ok := byID[id]; ok {
+			commits = append(commits, c)
+		}
+	}
+	return commits, nil
+}
+
 // GetAllCommits retrieves all commits ordered by ID
 func (db *DB) GetAllCommits(ctx context.Context) ([]*Commit, error) {
 	sql := `
 	SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-	       committer_name, committer_email, committed_at
+	       committer_name, committer_email, committed_at, commit_hash
 	FROM pgit_commits
 	ORDER BY id`
 
@@ -203,7 +240,7 @@ func (db *DB) GetAllCommits(ctx context.Context) ([]*Commit, error) {
 		if err := rows.Scan(
 			&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 			&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 		); err != nil {
 			return nil, err
 		}
@@ -222,11 +259,11 @@ func (db *DB) GetCommitsAfter(ctx context.Context, afterID string) ([]*Commit, e
 
 	if afterID == "" {
 		query = `SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-		                committer_name, committer_email, committed_at
+		                committer_name, committer_email, committed_at, commit_hash
 		         FROM pgit_commits ORDER BY id`
 	} else {
 		query = `SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-		                committer_name, committer_email, committed_at
+		                committer_name, committer_email, committed_at, commit_hash
 		         FROM pgit_commits WHERE id > $1 ORDER BY id`
 		args = []interface{}{afterID}
 	}
@@ -243,7 +280,7 @@ func (db *DB) GetCommitsAfter(ctx context.Context, afterID string) ([]*Commit, e
 		if err := rows.Scan(
 			&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 			&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 		); err != nil {
 			return nil, err
 		}
@@ -265,7 +302,8 @@ func (db *DB) CountCommits(ctx context.Context) (int, error) {
 // DeleteCommits deletes the given commits from the xpatch chain by PK.
 // In xpatch, deleting a row cascade-deletes all rows with higher _xp_seq
 // in the same group. So deleting the earliest commit in the list effectively
-// truncates the chain from that point forward.
+// truncates the chain from that point forward. The delete names the later
+// rows itself, so heap tables are truncated the same way.
 //
 // The caller should pass ALL commit IDs that need to be removed (local-only
 // commits, plus any previously-pulled remote commits that are interleaved).
@@ -283,7 +321,16 @@ func (db *DB) DeleteCommits(ctx context.Context, commitIDs []string) error {
 		if !exists {
 			continue
 		}
-		if err := db.Exec(ctx, "DELETE FROM pgit_commits WHERE id = $1", id); err != nil {
+		// Trailers and notes of every commit about to go, before the
+		// commits themselves
+		for _, table := range []string{"pgit_commit_trailers", "pgit_notes"} {
+			if err := db.Exec(ctx, "DELETE FROM "+table+` WHERE commit_id IN (
+				SELECT id FROM pgit_commits WHERE seq >= (SELECT seq FROM pgit_commits WHERE id = $1))`, id); err != nil {
+				return err
+			}
+		}
+		if err := db.Exec(ctx,
+			"DELETE FROM pgit_commits WHERE seq >= (SELECT seq FROM pgit_commits WHERE id = $1)", id); err != nil {
 			return err
 		}
 		deleted = true
@@ -291,7 +338,7 @@ func (db *DB) DeleteCommits(ctx context.Context, commitIDs []string) error {
 
 	// Refresh xpatch stats after deletion (stats are invalidated by deletes)
 	if deleted {
-		_ = db.Exec(ctx, "SELECT xpatch.refresh_stats('pgit_commits')")
+		db.refreshXpatchStats(ctx, "pgit_commits")
 	}
 	return nil
 }
@@ -303,6 +350,29 @@ func (db *DB) CommitExists(ctx context.Context, id string) (bool, error) {
 	return exists, err
 }
 
+// ExistingCommitIDs returns which of the given commit IDs are stored.
+func (db *DB) ExistingCommitIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	rows, err := db.Query(ctx, "SELECT id FROM pgit_commits WHERE id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+	return existing, rows.Err()
+}
+
 // GetLatestCommitID returns the ID of the latest commit (by ID order)
 func (db *DB) GetLatestCommitID(ctx context.Context) (string, error) {
 	var id string
@@ -445,7 +515,7 @@ func (db *DB) GetCommitsBatch(ctx context.Context, ids []string) (map[string]*Co
 
 	sql := `
 	SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-	       committer_name, committer_email, committed_at
+	       committer_name, committer_email, committed_at, commit_hash
 	FROM pgit_commits
 	WHERE id = ANY($1)`
 
@@ -461,7 +531,7 @@ func (db *DB) GetCommitsBatch(ctx context.Context, ids []string) (map[string]*Co
 		if err := rows.Scan(
 			&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 			&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 		); err != nil {
 			return nil, err
 		}
@@ -498,7 +568,7 @@ func (db *DB) GetCommitsBatchByRange(ctx context.Context, ids []string) (map[str
 	// This decompresses the chain segment once vs random-access per ID.
 	sql := `
 	SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
-	       committer_name, committer_email, committed_at
+	       committer_name, committer_email, committed_at, commit_hash
 	FROM pgit_commits
 	WHERE id >= $1 AND id <= $2
 	ORDER BY id`
@@ -515,7 +585,7 @@ func (db *DB) GetCommitsBatchByRange(ctx context.Context, ids []string) (map[str
 		if err := rows.Scan(
 			&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
 			&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
-			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt,
+			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash,
 		); err != nil {
 			return nil, err
 		}
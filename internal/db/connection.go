@@ -3,6 +3,9 @@ package db
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,8 +17,89 @@ import (
 type DB struct {
 	pool       *pgxpool.Pool
 	url        string
+	schema     string  // repository schema from ?pgit_repo=, "" for the default
+	backend    Backend // storage backend, "" until known (see Backend)
 	mu         sync.RWMutex
 	importGUCs []string // GUCs to apply to new connections during import
+
+	chainMu sync.Mutex
+	chains  map[string][]string // recent first-parent chains (see treeChain)
+}
+
+// RepoParam is the connection URL parameter that selects a repository
+// when several share one database, e.g. postgres://host/db?pgit_repo=web.
+// Each repository lives in its own PostgreSQL schema of that name.
+const RepoParam = "pgit_repo"
+
+var repoNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// ValidateRepoName checks that name can be used as a repository schema.
+func ValidateRepoName(name string) error {
+	if !repoNameRe.MatchString(name) || strings.HasPrefix(name, "pg_") {
+		return fmt.Errorf("invalid repository name %q: use up to 63 lowercase letters, digits and underscores, starting with a letter and not with pg_", name)
+	}
+	return nil
+}
+
+// SplitRepoURL removes the pgit_repo parameter from a connection URL and
+// returns the plain PostgreSQL URL and the repository name ("" if none).
+// Key/value connection strings are returned unchanged.
+func SplitRepoURL(connURL string) (string, string, error) {
+	if !strings.HasPrefix(connURL, "postgres://") && !strings.HasPrefix(connURL, "postgresql://") {
+		return connURL, "", nil
+	}
+	u, err := url.Parse(connURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	if !query.Has(RepoParam) {
+		return connURL, "", nil
+	}
+	name := query.Get(RepoParam)
+	if err := ValidateRepoName(name); err != nil {
+		return "", "", err
+	}
+	query.Del(RepoParam)
+	u.RawQuery = query.Encode()
+	return u.String(), name, nil
+}
+
+// WithRepo returns connURL with the pgit_repo parameter set to name.
+func WithRepo(connURL, name string) (string, error) {
+	base, _, err := SplitRepoURL(connURL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", fmt.Errorf("a repository can only be selected in a postgres:// URL")
+	}
+	query := u.Query()
+	query.Set(RepoParam, name)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// parseConfig parses a connection URL. With ?pgit_repo= the repository's
+// schema is the only schema in every connection's search_path, so all pgit
+// tables and locks resolve to that repository and never fall back to
+// another one in public. Extension objects are schema-qualified instead:
+// pg_xpatch functions live in xpatch, and pg_trgm's operator class is
+// looked up in whichever schema the extension was installed into.
+func parseConfig(connURL string) (*pgxpool.Config, string, error) {
+	base, schema, err := SplitRepoURL(connURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid connection URL: %w", err)
+	}
+	config, err := pgxpool.ParseConfig(base)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid connection URL: %w", err)
+	}
+	if schema != "" {
+		config.ConnConfig.RuntimeParams["search_path"] = pgx.Identifier{schema}.Sanitize()
+	}
+	return config, schema, nil
 }
 
 // Global database instance for convenience
@@ -23,9 +107,9 @@ var defaultDB *DB
 
 // Connect establishes a connection to the database with a full connection pool
 func Connect(ctx context.Context, url string) (*DB, error) {
-	config, err := pgxpool.ParseConfig(url)
+	config, schema, err := parseConfig(url)
 	if err != nil {
-		return nil, fmt.Errorf("invalid connection URL: %w", err)
+		return nil, err
 	}
 
 	// Configure pool. MaxConns must stay below PostgreSQL's max_connections
@@ -38,7 +122,8 @@ func Connect(ctx context.Context, url string) (*DB, error) {
 	config.MaxConnIdleTime = 30 * time.Minute
 
 	db := &DB{
-		url: url,
+		url:    url,
+		schema: schema,
 	}
 
 	// Register AfterConnect hook to apply import GUCs to new connections.
@@ -78,9 +163,9 @@ func Connect(ctx context.Context, url string) (*DB, error) {
 // ConnectLite establishes a lightweight connection (single connection, no pool)
 // Use this for quick operations like metadata lookups
 func ConnectLite(ctx context.Context, url string) (*DB, error) {
-	config, err := pgxpool.ParseConfig(url)
+	config, schema, err := parseConfig(url)
 	if err != nil {
-		return nil, fmt.Errorf("invalid connection URL: %w", err)
+		return nil, err
 	}
 
 	// Minimal pool - just 1 connection for quick operations
@@ -101,8 +186,9 @@ func ConnectLite(ctx context.Context, url string) (*DB, error) {
 	}
 
 	db := &DB{
-		pool: pool,
-		url:  url,
+		pool:   pool,
+		url:    url,
+		schema: schema,
 	}
 
 	return db, nil
@@ -128,6 +214,12 @@ func (db *DB) Close() {
 	}
 }
 
+// Schema returns the repository schema selected with ?pgit_repo=, or ""
+// when the repository uses the database's default schema.
+func (db *DB) Schema() string {
+	return db.schema
+}
+
 // Pool returns the underlying connection pool
 func (db *DB) Pool() *pgxpool.Pool {
 	db.mu.RLock()
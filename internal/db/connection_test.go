@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// testDatabaseEnv names a PostgreSQL database tests may create repositories
+// (schemas) in. Tests that need one are skipped without it.
+const testDatabaseEnv = "PGIT_TEST_DATABASE_URL"
+
+// testDatabase returns the test database URL, skipping the test without one.
+func testDatabase(t *testing.T) string {
+	t.Helper()
+	base := os.Getenv(testDatabaseEnv)
+	if base == "" {
+		t.Skipf("%s not set", testDatabaseEnv)
+	}
+	return base
+}
+
+// testRepo connects to a new, initialized repository in the test database
+// and drops it when the test ends.
+func testRepo(t *testing.T) *DB {
+	t.Helper()
+	base := testDatabase(t)
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	url, err := WithRepo(base, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := Connect(t.Context(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+		dropRepo(t, base, name)
+	})
+	if err := database.InitSchema(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// dropRepo drops a repository's schema, as an administrator would.
+func dropRepo(t *testing.T, base, name string) {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := Connect(ctx, base)
+	if err != nil {
+		t.Logf("failed to drop %s: %v", name, err)
+		return
+	}
+	defer conn.Close()
+	if err := conn.Exec(ctx, "DROP SCHEMA IF EXISTS "+pgx.Identifier{name}.Sanitize()+" CASCADE"); err != nil {
+		t.Logf("failed to drop %s: %v", name, err)
+	}
+}
+
+func TestSplitRepoURL(t *testing.T) {
+	tests := []struct {
+		in, url, repo string
+	}{
+		{"postgres://u@h/db", "postgres://u@h/db", ""},
+		{"postgres://u@h/db?pgit_repo=web", "postgres://u@h/db", "web"},
+		{"postgresql://u@h/db?sslmode=require&pgit_repo=api_2", "postgresql://u@h/db?sslmode=require", "api_2"},
+		{"host=h dbname=db", "host=h dbname=db", ""},
+	}
+	for _, tt := range tests {
+		url, repo, err := SplitRepoURL(tt.in)
+		if err != nil || url != tt.url || repo != tt.repo {
+			t.Errorf("SplitRepoURL(%q) = %q, %q, %v; want %q, %q", tt.in, url, repo, err, tt.url, tt.repo)
+		}
+	}
+
+	for _, bad := range []string{"postgres://h/db?pgit_repo=", "postgres://h/db?pgit_repo=Web", "postgres://h/db?pgit_repo=pg_x", "postgres://h/db?pgit_repo=a-b"} {
+		if _, _, err := SplitRepoURL(bad); err == nil {
+			t.Errorf("SplitRepoURL(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestWithRepo(t *testing.T) {
+	got, err := WithRepo("postgres://u@h/db?pgit_repo=old&sslmode=disable", "web")
+	if err != nil || got != "postgres://u@h/db?pgit_repo=web&sslmode=disable" {
+		t.Errorf("WithRepo = %q, %v", got, err)
+	}
+	if _, err := WithRepo("host=h dbname=db", "web"); err == nil {
+		t.Error("expected an error for a key/value connection string")
+	}
+}
+
+func TestDropRepoKeepsOthers(t *testing.T) {
+	ctx := t.Context()
+	first := testRepo(t)
+	second := testRepo(t)
+	backend := first.Backend(ctx)
+
+	dropRepo(t, testDatabase(t), first.Schema())
+
+	// The extension doesn't live in the dropped schema
+	if backend == BackendXpatch {
+		var installed bool
+		err := second.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_xpatch')").Scan(&installed)
+		if err != nil || !installed {
+			t.Fatalf("pg_xpatch installed after dropping a repository: %v, %v", installed, err)
+		}
+	}
+
+	// The other repository still stores commits, and a new one can be made
+	now := time.Now().UTC().Truncate(time.Second)
+	c := &Commit{
+		ID: "01JAAAAAAAAAAAAAAAAAAAAAAA", Seq: 1, TreeHash: "t", Message: "m",
+		AuthorName: "a", AuthorEmail: "a@example.com", AuthoredAt: now,
+		CommitterName: "a", CommitterEmail: "a@example.com", CommittedAt: now, CommitHash: "h",
+	}
+	if err := second.CreateCommit(ctx, c); err != nil {
+		t.Fatalf("CreateCommit in the remaining repository: %v", err)
+	}
+	if got, err := second.GetCommit(ctx, c.ID); err != nil || got == nil || got.Message != "m" {
+		t.Fatalf("GetCommit = %v, %v", got, err)
+	}
+	third := testRepo(t)
+	if got := third.Backend(ctx); got != backend {
+		t.Errorf("new repository backend = %s, want %s", got, backend)
+	}
+}
@@ -0,0 +1,465 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// fileChangesBatchSize is how many file versions are diffed and written at
+// a time when line counts are computed from stored content.
+const fileChangesBatchSize = 500
+
+// FileChange is the numstat of one file in one commit: the lines added and
+// removed relative to the path's version in the parent commit's tree.
+// Binary files have no line counts.
+type FileChange struct {
+	CommitID string
+	PathID   int32
+	Path     string // filled by GetFileChanges
+	Added    int
+	Removed  int
+	IsBinary bool
+}
+
+// createFileChangesTable creates the numstat table.
+// There is one row per file ref; added and removed are NULL for binary
+// files. Rows are derived data: refs without one are computed on demand
+// by FillFileChanges.
+func (db *DB) createFileChangesTable(ctx context.Context) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS pgit_file_changes (
+		commit_id  TEXT NOT NULL,
+		path_id    INTEGER NOT NULL,
+		added      INTEGER,
+		removed    INTEGER,
+		PRIMARY KEY (commit_id, path_id)
+	)`
+
+	if err := db.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create pgit_file_changes: %w", err)
+	}
+
+	_ = db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_file_changes_path ON pgit_file_changes(path_id)")
+
+	return nil
+}
+
+// CountLineChanges returns the lines added and removed between two versions
+// of a text file, counted the same way as the hunks of 'pgit diff'.
+func CountLineChanges(oldContent, newContent string) (added, removed int) {
+	switch {
+	case oldContent == newContent:
+		return 0, 0
+	case oldContent == "":
+		return diffLineCount(newContent), 0
+	case newContent == "":
+		return 0, diffLineCount(oldContent)
+	}
+
+	dmp := diffmatchpatch.New()
+	oldRunes, newRunes, lineArray := dmp.DiffLinesToRunes(oldContent, newContent)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(oldRunes, newRunes, false), lineArray)
+	for _, d := range diffs {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			added += diffLineCount(d.Text)
+		case diffmatchpatch.DiffDelete:
+			removed += diffLineCount(d.Text)
+		}
+	}
+	return added, removed
+}
+
+// diffLineCount counts the lines of a diff chunk; a last line without a
+// trailing newline counts too.
+func diffLineCount(text string) int {
+	n := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		n++
+	}
+	return n
+}
+
+// fileChangesInsert builds the statement storing changes. Existing rows are
+// left untouched, so re-inserting is safe.
+func fileChangesInsert(changes []*FileChange) (string, []any) {
+	commitIDs := make([]string, len(changes))
+	pathIDs := make([]int32, len(changes))
+	added := make([]*int32, len(changes))
+	removed := make([]*int32, len(changes))
+	for i, c := range changes {
+		commitIDs[i], pathIDs[i] = c.CommitID, c.PathID
+		if !c.IsBinary {
+			a, r := int32(c.Added), int32(c.Removed)
+			added[i], removed[i] = &a, &r
+		}
+	}
+	sql := `
+		INSERT INTO pgit_file_changes (commit_id, path_id, added, removed)
+		SELECT * FROM unnest($1::text[], $2::int[], $3::int[], $4::int[])
+		ON CONFLICT DO NOTHING`
+	return sql, []any{commitIDs, pathIDs, added, removed}
+}
+
+// CreateFileChanges stores numstat rows computed elsewhere (during import,
+// where the contents are at hand anyway).
+func (db *DB) CreateFileChanges(ctx context.Context, changes []*FileChange) error {
+	for start := 0; start < len(changes); start += CopyChunkSize {
+		sql, args := fileChangesInsert(changes[start:min(start+CopyChunkSize, len(changes))])
+		if err := db.Exec(ctx, sql, args...); err != nil {
+			return fmt.Errorf("failed to insert file changes: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetFileChanges returns the stored numstat of commits, by commit and path.
+// File refs without a row are left out; FillFileChanges computes them.
+func (db *DB) GetFileChanges(ctx context.Context, commitIDs []string) ([]*FileChange, error) {
+	rows, err := db.Query(ctx, `
+		SELECT c.commit_id, c.path_id, p.path, c.added, c.removed
+		FROM pgit_file_changes c
+		JOIN pgit_paths p ON p.path_id = c.path_id
+		WHERE c.commit_id = ANY($1)
+		ORDER BY c.commit_id, p.path`, commitIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*FileChange
+	for rows.Next() {
+		c := &FileChange{}
+		var added, removed *int32
+		if err := rows.Scan(&c.CommitID, &c.PathID, &c.Path, &added, &removed); err != nil {
+			return nil, err
+		}
+		if added == nil || removed == nil {
+			c.IsBinary = true
+		} else {
+			c.Added, c.Removed = int(*added), int(*removed)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// MissingFileChanges counts the file refs that have no numstat row yet:
+// databases created before pgit_file_changes existed, or commits received
+// from a remote that lacked them.
+func (db *DB) MissingFileChanges(ctx context.Context) (int64, error) {
+	var n int64
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM pgit_file_refs r
+		WHERE NOT EXISTS (
+			SELECT 1 FROM pgit_file_changes c
+			WHERE c.commit_id = r.commit_id AND c.path_id = r.path_id)`).Scan(&n)
+	return n, err
+}
+
+// pendingFileChange is a file ref without a numstat row, together with
+// the version of its path in the parent commit's tree.
+type pendingFileChange struct {
+	commitID    string
+	pathID      int32
+	groupID     int32
+	versionID   int32
+	deleted     bool
+	isBinary    bool
+	prevVersion *int32 // nil when the path is new
+	prevDeleted bool
+	prevBinary  bool
+}
+
+// FillFileChanges computes the numstat rows missing for commitIDs (all
+// commits when nil) from the stored content. Versions are read in delta
+// chain order, and only text versions are decoded. onProgress (may be nil)
+// receives the file versions done so far and the total. It returns how
+// many rows were written.
+func (db *DB) FillFileChanges(ctx context.Context, commitIDs []string, onProgress func(done, total int)) (int, error) {
+	var pending []*pendingFileChange
+	if commitIDs == nil {
+		p, err := db.pendingFileChanges(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		pending = p
+	}
+	const chunkSize = 1000
+	for i := 0; i < len(commitIDs); i += chunkSize {
+		p, err := db.pendingFileChanges(ctx, commitIDs[i:min(i+chunkSize, len(commitIDs))])
+		if err != nil {
+			return 0, err
+		}
+		pending = append(pending, p...)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].groupID != pending[j].groupID {
+			return pending[i].groupID < pending[j].groupID
+		}
+		return pending[i].versionID < pending[j].versionID
+	})
+
+	for start := 0; start < len(pending); start += fileChangesBatchSize {
+		batch := pending[start:min(start+fileChangesBatchSize, len(pending))]
+		changes, err := db.computeFileChanges(ctx, batch)
+		if err != nil {
+			return start, err
+		}
+		sql, args := fileChangesInsert(changes)
+		if err := db.Exec(ctx, sql, args...); err != nil {
+			return start, fmt.Errorf("failed to insert file changes: %w", err)
+		}
+		if onProgress != nil {
+			onProgress(start+len(batch), len(pending))
+		}
+	}
+	return len(pending), nil
+}
+
+// exactParentVersionsLimit is how many commits pendingFileChanges looks up
+// parent trees for without first checking whether the history is linear.
+const exactParentVersionsLimit = 100
+
+// pendingFileChanges loads the file refs of commitIDs (all when nil) that
+// have no numstat row, with the version of each path in the parent
+// commit's tree. The query takes the path's ref with the next lower commit
+// ID, which is that version on a linear history; otherwise the parent
+// trees are looked up (see parentVersions).
+func (db *DB) pendingFileChanges(ctx context.Context, commitIDs []string) ([]*pendingFileChange, error) {
+	rows, err := db.Query(ctx, `
+		SELECT r.commit_id, r.path_id, p.group_id, r.version_id, r.content_hash IS NULL, r.is_binary,
+		       prev.version_id, prev.content_hash IS NULL, prev.is_binary
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		LEFT JOIN LATERAL (
+			SELECT version_id, content_hash, is_binary
+			FROM pgit_file_refs
+			WHERE path_id = r.path_id AND commit_id < r.commit_id
+			ORDER BY commit_id DESC
+			LIMIT 1
+		) prev ON true
+		WHERE ($1::text[] IS NULL OR r.commit_id = ANY($1))
+		  AND NOT EXISTS (
+			SELECT 1 FROM pgit_file_changes c
+			WHERE c.commit_id = r.commit_id AND c.path_id = r.path_id)`, commitIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []*pendingFileChange
+	for rows.Next() {
+		p := &pendingFileChange{}
+		var prevDeleted, prevBinary *bool
+		if err := rows.Scan(&p.commitID, &p.pathID, &p.groupID, &p.versionID, &p.deleted, &p.isBinary,
+			&p.prevVersion, &prevDeleted, &prevBinary); err != nil {
+			return nil, err
+		}
+		if p.prevVersion != nil {
+			p.prevDeleted, p.prevBinary = *prevDeleted, *prevBinary
+		}
+		pending = append(pending, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	byCommit := make(map[string][]*pendingFileChange)
+	for _, p := range pending {
+		byCommit[p.commitID] = append(byCommit[p.commitID], p)
+	}
+	if len(byCommit) > exactParentVersionsLimit {
+		linear, err := db.linearHistory(ctx)
+		if err != nil || linear {
+			return pending, err
+		}
+	}
+	if err := db.parentVersions(ctx, byCommit); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// linearHistory reports whether the commits form a single chain: one root
+// and no commit with two children. Every older commit is then an ancestor,
+// and a path's ref with the next lower commit ID is in the parent's tree.
+func (db *DB) linearHistory(ctx context.Context) (bool, error) {
+	var linear bool
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE parent_id IS NULL) <= 1
+		   AND COUNT(parent_id) = COUNT(DISTINCT parent_id)
+		FROM pgit_commits`).Scan(&linear)
+	return linear, err
+}
+
+// parentVersions replaces the previous versions of pending file changes,
+// grouped by commit, with the versions in the tree of each commit's first
+// parent. Each commit costs a walk of its parent's chain.
+func (db *DB) parentVersions(ctx context.Context, byCommit map[string][]*pendingFileChange) error {
+	commitIDs := make([]string, 0, len(byCommit))
+	for id := range byCommit {
+		commitIDs = append(commitIDs, id)
+	}
+	rows, err := db.Query(ctx, "SELECT id, parent_id FROM pgit_commits WHERE id = ANY($1)", commitIDs)
+	if err != nil {
+		return err
+	}
+	parents := make(map[string]string, len(commitIDs))
+	for rows.Next() {
+		var id string
+		var parentID *string
+		if err := rows.Scan(&id, &parentID); err != nil {
+			rows.Close()
+			return err
+		}
+		if parentID != nil {
+			parents[id] = *parentID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sql := `
+	WITH ` + chainCTE + `
+	SELECT DISTINCT ON (r.path_id) r.path_id, r.version_id, r.content_hash IS NULL, r.is_binary
+	FROM pgit_file_refs r
+	JOIN chain c ON c.id = r.commit_id
+	WHERE r.path_id = ANY($2)
+	ORDER BY r.path_id, c.n`
+
+	for commitID, changes := range byCommit {
+		byPath := make(map[int32]*pendingFileChange, len(changes))
+		pathIDs := make([]int32, len(changes))
+		for i, p := range changes {
+			p.prevVersion, p.prevDeleted, p.prevBinary = nil, false, false
+			byPath[p.pathID] = p
+			pathIDs[i] = p.pathID
+		}
+		parentID := parents[commitID]
+		if parentID == "" {
+			continue
+		}
+
+		chain, err := db.treeChain(ctx, parentID)
+		if err != nil {
+			return err
+		}
+		rows, err := db.Query(ctx, sql, chain, pathIDs)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var pathID, version int32
+			var deleted, binary bool
+			if err := rows.Scan(&pathID, &version, &deleted, &binary); err != nil {
+				rows.Close()
+				return err
+			}
+			p := byPath[pathID]
+			p.prevVersion, p.prevDeleted, p.prevBinary = &version, deleted, binary
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// computeFileChanges fetches the text versions a batch needs and counts
+// the changed lines of each file.
+func (db *DB) computeFileChanges(ctx context.Context, batch []*pendingFileChange) ([]*FileChange, error) {
+	var keys []ContentKey
+	changes := make([]*FileChange, len(batch))
+	for i, p := range batch {
+		changes[i] = &FileChange{CommitID: p.commitID, PathID: p.pathID}
+		hasPrev := p.prevVersion != nil && !p.prevDeleted
+		if (!p.deleted && p.isBinary) || (hasPrev && p.prevBinary) {
+			changes[i].IsBinary = true
+			continue
+		}
+		if !p.deleted {
+			keys = append(keys, ContentKey{GroupID: p.groupID, VersionID: p.versionID})
+		}
+		if hasPrev {
+			keys = append(keys, ContentKey{GroupID: p.groupID, VersionID: *p.prevVersion})
+		}
+	}
+
+	contents, err := db.GetContentsBatch(ctx, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range batch {
+		if changes[i].IsBinary {
+			continue
+		}
+		var oldContent, newContent string
+		if !p.deleted {
+			newContent = string(contents[ContentKey{GroupID: p.groupID, VersionID: p.versionID}])
+		}
+		if p.prevVersion != nil && !p.prevDeleted {
+			oldContent = string(contents[ContentKey{GroupID: p.groupID, VersionID: *p.prevVersion}])
+		}
+		changes[i].Added, changes[i].Removed = CountLineChanges(oldContent, newContent)
+	}
+	return changes, nil
+}
+
+// CopyFileChanges copies the numstat rows of commitIDs from src to dst,
+// matching paths by name. Rows dst already has are kept.
+func CopyFileChanges(ctx context.Context, src, dst *DB, commitIDs []string) error {
+	const chunkSize = 1000
+	for i := 0; i < len(commitIDs); i += chunkSize {
+		rows, err := src.Query(ctx, `
+			SELECT c.commit_id, p.path, c.added, c.removed
+			FROM pgit_file_changes c
+			JOIN pgit_paths p ON p.path_id = c.path_id
+			WHERE c.commit_id = ANY($1)`, commitIDs[i:min(i+chunkSize, len(commitIDs))])
+		if err != nil {
+			return err
+		}
+		var ids, paths []string
+		var added, removed []*int32
+		for rows.Next() {
+			var id, path string
+			var a, r *int32
+			if err := rows.Scan(&id, &path, &a, &r); err != nil {
+				rows.Close()
+				return err
+			}
+			ids, paths = append(ids, id), append(paths, path)
+			added, removed = append(added, a), append(removed, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		err = dst.Exec(ctx, `
+			INSERT INTO pgit_file_changes (commit_id, path_id, added, removed)
+			SELECT t.commit_id, p.path_id, t.added, t.removed
+			FROM unnest($1::text[], $2::text[], $3::int[], $4::int[]) AS t(commit_id, path, added, removed)
+			JOIN pgit_paths p ON p.path = t.path
+			ON CONFLICT DO NOTHING`, ids, paths, added, removed)
+		if err != nil {
+			return fmt.Errorf("failed to copy file changes: %w", err)
+		}
+	}
+	return nil
+}
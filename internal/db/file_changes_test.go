@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestCountLineChanges(t *testing.T) {
+	tests := []struct {
+		name           string
+		old, new       string
+		added, removed int
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", 0, 0},
+		{"new file", "", "a\nb\nc\n", 3, 0},
+		{"deleted file", "a\nb\n", "", 0, 2},
+		{"no trailing newline", "", "a\nb", 2, 0},
+		{"modified line", "a\nb\nc\n", "a\nB\nc\n", 1, 1},
+		{"appended", "a\n", "a\nb\nc\n", 2, 0},
+		{"removed middle", "a\nb\nc\n", "a\nc\n", 0, 1},
+		{"newline at end added", "a", "a\n", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := CountLineChanges(tt.old, tt.new)
+			if added != tt.added || removed != tt.removed {
+				t.Errorf("CountLineChanges(%q, %q) = +%d -%d, want +%d -%d",
+					tt.old, tt.new, added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
+
+func TestLineCountMatchesDiff(t *testing.T) {
+	for _, content := range []string{"", "\n", "a", "a\n", "a\nb", "a\nb\n", "\n\n\n"} {
+		added, _ := CountLineChanges("", content)
+		if got := LineCount([]byte(content)); got != added {
+			t.Errorf("LineCount(%q) = %d, want %d lines a diff would add", content, got, added)
+		}
+	}
+}
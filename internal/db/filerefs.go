@@ -1,6 +1,7 @@
 package db
 
 import (
+	"bytes"
 	"context"
 
 	"github.com/jackc/pgx/v5"
@@ -19,6 +20,8 @@ type FileRef struct {
 	IsSymlink     bool
 	SymlinkTarget *string
 	IsBinary      bool
+	Size          int64  // content bytes, 0 for deletions
+	LineCount     *int32 // nil for binary files
 }
 
 // FileRefWithPath combines FileRef with resolved path and group info.
@@ -41,23 +44,23 @@ type FileRefWithPath struct {
 // CreateFileRef inserts a new file reference.
 func (db *DB) CreateFileRef(ctx context.Context, ref *FileRef) error {
 	sql := `
-	INSERT INTO pgit_file_refs (path_id, commit_id, version_id, content_hash, mode, is_symlink, symlink_target, is_binary)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	INSERT INTO pgit_file_refs (path_id, commit_id, version_id, content_hash, mode, is_symlink, symlink_target, is_binary, size, line_count)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
 	return db.Exec(ctx, sql,
 		ref.PathID, ref.CommitID, ref.VersionID, ref.ContentHash,
-		ref.Mode, ref.IsSymlink, ref.SymlinkTarget, ref.IsBinary)
+		ref.Mode, ref.IsSymlink, ref.SymlinkTarget, ref.IsBinary, ref.Size, ref.LineCount)
 }
 
 // CreateFileRefTx inserts a new file reference within a transaction.
 func (db *DB) CreateFileRefTx(ctx context.Context, tx pgx.Tx, ref *FileRef) error {
 	sql := `
-	INSERT INTO pgit_file_refs (path_id, commit_id, version_id, content_hash, mode, is_symlink, symlink_target, is_binary)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	INSERT INTO pgit_file_refs (path_id, commit_id, version_id, content_hash, mode, is_symlink, symlink_target, is_binary, size, line_count)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
 	_, err := tx.Exec(ctx, sql,
 		ref.PathID, ref.CommitID, ref.VersionID, ref.ContentHash,
-		ref.Mode, ref.IsSymlink, ref.SymlinkTarget, ref.IsBinary)
+		ref.Mode, ref.IsSymlink, ref.SymlinkTarget, ref.IsBinary, ref.Size, ref.LineCount)
 	return err
 }
 
@@ -72,20 +75,77 @@ func (db *DB) CreateFileRefsBatch(ctx context.Context, refs []*FileRef) error {
 		rows[i] = []interface{}{
 			ref.PathID, ref.CommitID, ref.VersionID, ref.ContentHash,
 			ref.Mode, ref.IsSymlink, ref.SymlinkTarget, ref.IsBinary,
+			ref.Size, ref.LineCount,
 		}
 	}
 
 	_, err := db.pool.CopyFrom(
 		ctx,
 		pgx.Identifier{"pgit_file_refs"},
-		[]string{"path_id", "commit_id", "version_id", "content_hash", "mode", "is_symlink", "symlink_target", "is_binary"},
+		fileRefCopyColumns,
 		pgx.CopyFromRows(rows),
 	)
 	return err
 }
 
 // fileRefColumns is the standard column list for FileRef queries.
-const fileRefColumns = `path_id, commit_id, version_id, content_hash, mode, is_symlink, symlink_target, is_binary`
+const fileRefColumns = `path_id, commit_id, version_id, content_hash, mode, is_symlink, symlink_target, is_binary, size, line_count`
+
+// fileRefCopyColumns is the column list for COPY into pgit_file_refs.
+var fileRefCopyColumns = []string{
+	"path_id", "commit_id", "version_id", "content_hash", "mode",
+	"is_symlink", "symlink_target", "is_binary", "size", "line_count",
+}
+
+// chainCTE numbers the commits of a first-parent chain, passed newest first
+// as the text[] parameter $1, by their distance from its head. A commit's
+// tree is the newest file ref per path along its chain, so picking refs
+// with DISTINCT ON (path_id) ... ORDER BY chain.n keeps commits on other
+// branches out of it, whatever their IDs.
+const chainCTE = `chain AS (
+		SELECT id, n FROM unnest($1::text[]) WITH ORDINALITY AS c(id, n)
+	)`
+
+// treeRefsCTE defines tree_refs, the file refs making up the tree of the
+// chain in $1: the newest ref per path, deletions included. Every query
+// for the files of a tree (checkout, commit, tree hashes, search) selects
+// from it.
+const treeRefsCTE = chainCTE + `,
+	tree_refs AS (
+		SELECT DISTINCT ON (r.path_id) r.*
+		FROM pgit_file_refs r
+		JOIN chain c ON c.id = r.commit_id
+		ORDER BY r.path_id, c.n
+	)`
+
+// treeChainCacheSize bounds the chains treeChain remembers. Commands look up
+// many paths in the trees of one or two commits (diff, blame, show).
+const treeChainCacheSize = 4
+
+// treeChain returns the first-parent chain of commitID (inclusive), newest
+// first: the commits whose file refs make up its tree. A commit's chain
+// never changes, so the last few are cached.
+func (db *DB) treeChain(ctx context.Context, commitID string) ([]string, error) {
+	db.chainMu.Lock()
+	chain, ok := db.chains[commitID]
+	db.chainMu.Unlock()
+	if ok {
+		return chain, nil
+	}
+
+	chain, err := db.GetFirstParentChain(ctx, commitID, 0)
+	if err != nil || len(chain) == 0 {
+		return chain, err
+	}
+
+	db.chainMu.Lock()
+	defer db.chainMu.Unlock()
+	if db.chains == nil || len(db.chains) >= treeChainCacheSize {
+		db.chains = make(map[string][]string, treeChainCacheSize)
+	}
+	db.chains[commitID] = chain
+	return chain, nil
+}
 
 // scanFileRef scans a row into a FileRef.
 func scanFileRef(scanner interface{ Scan(dest ...any) error }) (*FileRef, error) {
@@ -93,6 +153,7 @@ func scanFileRef(scanner interface{ Scan(dest ...any) error }) (*FileRef, error)
 	err := scanner.Scan(
 		&ref.PathID, &ref.CommitID, &ref.VersionID, &ref.ContentHash,
 		&ref.Mode, &ref.IsSymlink, &ref.SymlinkTarget, &ref.IsBinary,
+		&ref.Size, &ref.LineCount,
 	)
 	return ref, err
 }
@@ -173,23 +234,23 @@ func (db *DB) GetFileRefsAtCommitWithPaths(ctx context.Context, commitID string)
 	return refs, rows.Err()
 }
 
-// GetTreeRefsAtCommit retrieves the full tree (latest version per path <= commitID).
+// GetTreeRefsAtCommit retrieves the full tree (latest version per path along
+// commitID's first-parent chain).
 // This is the core query for getting the state of the repository at a commit.
 func (db *DB) GetTreeRefsAtCommit(ctx context.Context, commitID string) ([]*FileRef, error) {
+	chain, err := db.treeChain(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
-	WITH latest_versions AS (
-		SELECT DISTINCT ON (path_id)
-			` + fileRefColumns + `
-		FROM pgit_file_refs
-		WHERE commit_id <= $1
-		ORDER BY path_id, commit_id DESC
-	)
+	WITH ` + treeRefsCTE + `
 	SELECT ` + fileRefColumns + `
-	FROM latest_versions
+	FROM tree_refs
 	WHERE content_hash IS NOT NULL
 	ORDER BY path_id`
 
-	rows, err := db.Query(ctx, sql, commitID)
+	rows, err := db.Query(ctx, sql, chain)
 	if err != nil {
 		return nil, err
 	}
@@ -207,24 +268,24 @@ func (db *DB) GetTreeRefsAtCommit(ctx context.Context, commitID string) ([]*File
 	return refs, rows.Err()
 }
 
-// GetTreeRefsAtCommitWithPaths retrieves the full tree with resolved paths.
-// This is a metadata-only query - no content is fetched.
+// GetTreeRefsAtCommitWithPaths retrieves the full tree with resolved paths,
+// sorted by path. This is a metadata-only query - no content is fetched.
+// Checkout, commit and tree hashes all read a commit's files through it.
 func (db *DB) GetTreeRefsAtCommitWithPaths(ctx context.Context, commitID string) ([]*FileRefWithPath, error) {
+	chain, err := db.treeChain(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
-	WITH latest_versions AS (
-		SELECT DISTINCT ON (r.path_id)
-			r.path_id, r.commit_id, r.version_id, r.content_hash, r.mode, r.is_symlink, r.symlink_target, r.is_binary
-		FROM pgit_file_refs r
-		WHERE r.commit_id <= $1
-		ORDER BY r.path_id, r.commit_id DESC
-	)
-	SELECT p.path, p.path_id, p.group_id, lv.commit_id, lv.version_id, lv.content_hash, lv.mode, lv.is_symlink, lv.symlink_target, lv.is_binary
-	FROM latest_versions lv
-	JOIN pgit_paths p ON p.path_id = lv.path_id
-	WHERE lv.content_hash IS NOT NULL
+	WITH ` + treeRefsCTE + `
+	SELECT p.path, p.path_id, p.group_id, t.commit_id, t.version_id, t.content_hash, t.mode, t.is_symlink, t.symlink_target, t.is_binary
+	FROM tree_refs t
+	JOIN pgit_paths p ON p.path_id = t.path_id
+	WHERE t.content_hash IS NOT NULL
 	ORDER BY p.path`
 
-	rows, err := db.Query(ctx, sql, commitID)
+	rows, err := db.Query(ctx, sql, chain)
 	if err != nil {
 		return nil, err
 	}
@@ -271,16 +332,24 @@ func (db *DB) GetFileRefHistory(ctx context.Context, pathID int32) ([]*FileRef,
 	return refs, rows.Err()
 }
 
-// GetFileRefAtCommit retrieves a file ref at or before a specific commit.
+// GetFileRefAtCommit retrieves a file ref at a specific commit or its
+// nearest first-parent ancestor that changed the path.
 func (db *DB) GetFileRefAtCommit(ctx context.Context, pathID int32, commitID string) (*FileRef, error) {
+	chain, err := db.treeChain(ctx, commitID)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
-	SELECT ` + fileRefColumns + `
-	FROM pgit_file_refs
-	WHERE path_id = $1 AND commit_id <= $2
-	ORDER BY commit_id DESC
+	WITH ` + chainCTE + `
+	SELECT r.path_id, r.commit_id, r.version_id, r.content_hash, r.mode, r.is_symlink, r.symlink_target, r.is_binary, r.size, r.line_count
+	FROM pgit_file_refs r
+	JOIN chain c ON c.id = r.commit_id
+	WHERE r.path_id = $2
+	ORDER BY c.n
 	LIMIT 1`
 
-	ref, err := scanFileRef(db.QueryRow(ctx, sql, pathID, commitID))
+	ref, err := scanFileRef(db.QueryRow(ctx, sql, chain, pathID))
 
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -347,13 +416,18 @@ func (db *DB) GetNextVersionIDTx(ctx context.Context, tx pgx.Tx, groupID int32)
 
 // GetChangedFileRefs returns file refs that changed between two commits.
 func (db *DB) GetChangedFileRefs(ctx context.Context, fromCommit, toCommit string) ([]*FileRef, error) {
+	commits, err := db.commitsBetweenTrees(ctx, fromCommit, toCommit)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
 	SELECT ` + fileRefColumns + `
 	FROM pgit_file_refs
-	WHERE commit_id > $1 AND commit_id <= $2
+	WHERE commit_id = ANY($1)
 	ORDER BY path_id, commit_id`
 
-	rows, err := db.Query(ctx, sql, fromCommit, toCommit)
+	rows, err := db.Query(ctx, sql, commits)
 	if err != nil {
 		return nil, err
 	}
@@ -373,14 +447,19 @@ func (db *DB) GetChangedFileRefs(ctx context.Context, fromCommit, toCommit strin
 
 // GetChangedFileRefsWithPaths returns file refs with paths that changed between two commits.
 func (db *DB) GetChangedFileRefsWithPaths(ctx context.Context, fromCommit, toCommit string) ([]*FileRefWithPath, error) {
+	commits, err := db.commitsBetweenTrees(ctx, fromCommit, toCommit)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
 	SELECT p.path, p.path_id, p.group_id, r.commit_id, r.version_id, r.content_hash, r.mode, r.is_symlink, r.symlink_target, r.is_binary
 	FROM pgit_file_refs r
 	JOIN pgit_paths p ON p.path_id = r.path_id
-	WHERE r.commit_id > $1 AND r.commit_id <= $2
+	WHERE r.commit_id = ANY($1)
 	ORDER BY p.path, r.commit_id`
 
-	rows, err := db.Query(ctx, sql, fromCommit, toCommit)
+	rows, err := db.Query(ctx, sql, commits)
 	if err != nil {
 		return nil, err
 	}
@@ -401,6 +480,43 @@ func (db *DB) GetChangedFileRefsWithPaths(ctx context.Context, fromCommit, toCom
 	return refs, rows.Err()
 }
 
+// commitsBetweenTrees returns the commits on exactly one of the two
+// commits' first-parent chains: those since the merge base on either side.
+// Only paths they touch can differ between the two trees.
+func (db *DB) commitsBetweenTrees(ctx context.Context, fromCommit, toCommit string) ([]string, error) {
+	from, err := db.treeChain(ctx, fromCommit)
+	if err != nil {
+		return nil, err
+	}
+	to, err := db.treeChain(ctx, toCommit)
+	if err != nil {
+		return nil, err
+	}
+	return chainDifference(from, to), nil
+}
+
+// chainDifference returns the IDs in exactly one of a and b.
+func chainDifference(a, b []string) []string {
+	inA := make(map[string]bool, len(a))
+	for _, id := range a {
+		inA[id] = true
+	}
+	var diff []string
+	for _, id := range b {
+		if inA[id] {
+			delete(inA, id)
+		} else {
+			diff = append(diff, id)
+		}
+	}
+	for _, id := range a {
+		if inA[id] {
+			diff = append(diff, id)
+		}
+	}
+	return diff
+}
+
 // CountFileRefs returns the total number of file refs.
 func (db *DB) CountFileRefs(ctx context.Context) (int64, error) {
 	var count int64
@@ -416,3 +532,27 @@ func (db *DB) FileRefExists(ctx context.Context, pathID int32, commitID string)
 		pathID, commitID).Scan(&exists)
 	return exists, err
 }
+
+// LineCount counts the lines of file content the way diffs do: a last line
+// without a trailing newline counts too.
+func LineCount(content []byte) int {
+	n := bytes.Count(content, []byte{'\n'})
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// contentMetrics returns the size and line count stored with a file ref.
+// Deletions are empty; binary files have no line count.
+func contentMetrics(content []byte, deleted, isBinary bool) (int64, *int32) {
+	if deleted {
+		var zero int32
+		return 0, &zero
+	}
+	if isBinary {
+		return int64(len(content)), nil
+	}
+	lines := int32(LineCount(content))
+	return int64(len(content)), &lines
+}
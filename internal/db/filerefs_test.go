@@ -0,0 +1,35 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChainDifference(t *testing.T) {
+	//   A ─ B ─ C        (main)
+	//        └─ X ─ Y    (fork)
+	main := []string{"C", "B", "A"}
+	fork := []string{"Y", "X", "B", "A"}
+
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{"same commit", main, main, nil},
+		{"ancestor to descendant", []string{"B", "A"}, main, []string{"C"}},
+		{"descendant to ancestor", main, []string{"B", "A"}, []string{"C"}},
+		{"diverged", main, fork, []string{"C", "X", "Y"}},
+		{"unrelated", []string{"A"}, []string{"Q"}, []string{"A", "Q"}},
+		{"empty side", nil, main, []string{"A", "B", "C"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chainDifference(tt.a, tt.b)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("chainDifference = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,561 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/jackc/pgx/v5"
+)
+
+// MetaKeyRewrites holds the history rewrites applied by 'pgit filter', as
+// a JSON array of Rewrite.
+const MetaKeyRewrites = "rewrites"
+
+// Rewrite records one history rewrite. Databases holding the same history
+// must have applied the same rewrites, or a push could bring removed data
+// back.
+type Rewrite struct {
+	ID   string    `json:"id"`
+	Spec string    `json:"spec"`
+	At   time.Time `json:"at"`
+}
+
+// GetRewrites returns the rewrites applied to the database, oldest first.
+func (db *DB) GetRewrites(ctx context.Context) ([]Rewrite, error) {
+	return getRewrites(ctx, db)
+}
+
+func getRewrites(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}) ([]Rewrite, error) {
+	var value string
+	err := q.QueryRow(ctx, "SELECT value FROM pgit_metadata WHERE key = $1", MetaKeyRewrites).Scan(&value)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rewrites []Rewrite
+	if err := json.Unmarshal([]byte(value), &rewrites); err != nil {
+		return nil, fmt.Errorf("invalid %s metadata: %w", MetaKeyRewrites, err)
+	}
+	return rewrites, nil
+}
+
+// SetRewrites replaces the recorded rewrites.
+func (db *DB) SetRewrites(ctx context.Context, rewrites []Rewrite) error {
+	value, err := json.Marshal(rewrites)
+	if err != nil {
+		return err
+	}
+	return db.SetMetadata(ctx, MetaKeyRewrites, string(value))
+}
+
+// MissingRewrites returns the rewrites in want that are not in have.
+func MissingRewrites(have, want []Rewrite) []Rewrite {
+	seen := make(map[string]bool, len(have))
+	for _, r := range have {
+		seen[r.ID] = true
+	}
+	var missing []Rewrite
+	for _, r := range want {
+		if !seen[r.ID] {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// FilterOptions describes a history rewrite.
+type FilterOptions struct {
+	// RemovePath reports whether every version of a path is removed.
+	RemovePath func(path string) bool
+
+	// ReplaceText, if set, rewrites text content. It returns the input and
+	// false when nothing changes.
+	ReplaceText func(content []byte) ([]byte, bool)
+
+	// Rewrite is recorded in MetaKeyRewrites.
+	Rewrite Rewrite
+
+	// DryRun rolls the rewrite back after counting what it changes.
+	DryRun bool
+
+	// OnProgress is called with the number of delta groups examined.
+	OnProgress func(done, total int)
+}
+
+// FilterResult counts what Filter changed.
+type FilterResult struct {
+	PathsRemoved      int
+	FileRefsRemoved   int
+	VersionsRemoved   int
+	VersionsRewritten int
+	GroupsRewritten   int
+	TreesUpdated      int
+}
+
+// errFilterDryRun rolls back a dry run.
+var errFilterDryRun = errors.New("dry run")
+
+// filterBatchSize is the number of content versions written back per COPY.
+const filterBatchSize = 100
+
+// Filter permanently rewrites history: it removes every file ref, path and
+// content version of the paths opts.RemovePath selects, applies
+// opts.ReplaceText to every text version, updates the content hashes of
+// the file refs and the tree hashes of commits that change (and with them
+// the commit hashes from the first such commit on), and records
+// opts.Rewrite. Commit IDs stay the same.
+//
+// Content is stored in xpatch delta chains, where deleting a row deletes
+// the rest of the chain, so each affected chain is re-encoded from its
+// first changed version onward. The rewrite runs in one transaction; the
+// caller should hold the push lock.
+func (db *DB) Filter(ctx context.Context, opts FilterOptions) (*FilterResult, error) {
+	if opts.RemovePath == nil {
+		opts.RemovePath = func(string) bool { return false }
+	}
+	if opts.OnProgress == nil {
+		opts.OnProgress = func(int, int) {}
+	}
+	result := &FilterResult{}
+
+	err := db.WithTx(ctx, func(tx pgx.Tx) error {
+		for _, sql := range []string{
+			"CREATE TEMP TABLE pgit_filter_text (version_id INTEGER PRIMARY KEY, content TEXT) ON COMMIT DROP",
+			"CREATE TEMP TABLE pgit_filter_binary (version_id INTEGER PRIMARY KEY, content BYTEA) ON COMMIT DROP",
+		} {
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return err
+			}
+		}
+
+		commits, err := readFsckCommits(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to read commits: %w", err)
+		}
+		removedPaths, groupIDs, err := filterTargets(ctx, tx, opts)
+		if err != nil {
+			return err
+		}
+		result.PathsRemoved = len(removedPaths)
+
+		var oldHashes [][]byte
+		for i, groupID := range groupIDs {
+			hashes, err := db.filterGroup(ctx, tx, groupID, removedPaths, opts, result)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite group %d: %w", groupID, err)
+			}
+			oldHashes = append(oldHashes, hashes...)
+			opts.OnProgress(i+1, len(groupIDs))
+		}
+
+		// Line counts of rewritten files are stale; they are computed again
+		// from the new content when next needed
+		_, err = tx.Exec(ctx, `
+			DELETE FROM pgit_file_changes
+			WHERE path_id IN (SELECT path_id FROM pgit_paths WHERE group_id = ANY($1))`, groupIDs)
+		if err != nil {
+			return err
+		}
+
+		if len(removedPaths) > 0 {
+			ids := make([]int32, 0, len(removedPaths))
+			for id := range removedPaths {
+				ids = append(ids, id)
+			}
+			tag, err := tx.Exec(ctx, "DELETE FROM pgit_file_refs WHERE path_id = ANY($1)", ids)
+			if err != nil {
+				return err
+			}
+			result.FileRefsRemoved = int(tag.RowsAffected())
+			if _, err := tx.Exec(ctx, "DELETE FROM pgit_paths WHERE path_id = ANY($1)", ids); err != nil {
+				return err
+			}
+		}
+
+		// git blob SHAs of content that no longer exists
+		if len(oldHashes) > 0 {
+			_, err := tx.Exec(ctx, `
+				DELETE FROM pgit_git_map
+				WHERE kind = 'blob' AND content_hash = ANY($1)
+				  AND content_hash NOT IN (
+					SELECT content_hash FROM pgit_file_refs WHERE content_hash = ANY($1))`, oldHashes)
+			if err != nil {
+				return err
+			}
+		}
+
+		newTrees, err := treeHashes(ctx, tx, commits)
+		if err != nil {
+			return fmt.Errorf("failed to compute tree hashes: %w", err)
+		}
+		if err := filterTreeHashes(ctx, tx, commits, newTrees, result); err != nil {
+			return fmt.Errorf("failed to update tree hashes: %w", err)
+		}
+
+		rewrites, err := getRewrites(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(MissingRewrites(rewrites, []Rewrite{opts.Rewrite})) > 0 {
+			rewrites = append(rewrites, opts.Rewrite)
+		}
+		value, err := json.Marshal(rewrites)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO pgit_metadata (key, value) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`,
+			MetaKeyRewrites, string(value))
+		if err != nil {
+			return err
+		}
+
+		// The search index holds copies of the old content; empty it so the
+		// next update rebuilds it from the rewritten versions
+		var indexed bool
+		if err := tx.QueryRow(ctx, "SELECT to_regclass('pgit_search_index') IS NOT NULL").Scan(&indexed); err != nil {
+			return err
+		}
+		if indexed {
+			if _, err := tx.Exec(ctx, "TRUNCATE pgit_search_index"); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "DELETE FROM pgit_metadata WHERE key = $1", MetaKeySearchIndexCommit); err != nil {
+				return err
+			}
+		}
+
+		if opts.DryRun {
+			return errFilterDryRun
+		}
+		return nil
+	})
+	if err == errFilterDryRun {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db.vacuum(ctx, []string{"pgit_commits", "pgit_file_refs", "pgit_paths",
+		"pgit_text_content", "pgit_binary_content", "pgit_git_map", "pgit_file_changes"})
+	return result, nil
+}
+
+// filterTargets returns the path IDs to remove and the delta groups to
+// examine: the groups of those paths, plus every group with text content
+// when text is replaced.
+func filterTargets(ctx context.Context, tx pgx.Tx, opts FilterOptions) (map[int32]bool, []int32, error) {
+	removed := make(map[int32]bool)
+	groups := make(map[int32]bool)
+
+	rows, err := tx.Query(ctx, "SELECT path_id, group_id, path FROM pgit_paths")
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var pathID, groupID int32
+		var path string
+		if err := rows.Scan(&pathID, &groupID, &path); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if opts.RemovePath(path) {
+			removed[pathID] = true
+			groups[groupID] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.ReplaceText != nil {
+		rows, err := tx.Query(ctx, "SELECT DISTINCT group_id FROM pgit_text_content")
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var groupID int32
+			if err := rows.Scan(&groupID); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			groups[groupID] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ids := make([]int32, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sortInt32s(ids)
+	return removed, ids, nil
+}
+
+// filterRewrite is what a text version becomes under the replace rules.
+type filterRewrite struct {
+	hash  []byte
+	size  int64
+	lines int32
+}
+
+// filterGroup rewrites the text and binary chains of one delta group and
+// returns the content hashes that were removed or replaced.
+func (db *DB) filterGroup(ctx context.Context, tx pgx.Tx, groupID int32, removedPaths map[int32]bool, opts FilterOptions, result *FilterResult) ([][]byte, error) {
+	type use struct {
+		kept, removed, symlink bool
+		hash                   []byte
+	}
+	uses := map[bool]map[int32]*use{false: {}, true: {}}
+
+	rows, err := tx.Query(ctx, `
+		SELECT r.path_id, r.version_id, r.content_hash, r.is_binary, r.is_symlink
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE p.group_id = $1 AND r.content_hash IS NOT NULL`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var pathID, versionID int32
+		var hash []byte
+		var isBinary, isSymlink bool
+		if err := rows.Scan(&pathID, &versionID, &hash, &isBinary, &isSymlink); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		u := uses[isBinary][versionID]
+		if u == nil {
+			u = &use{hash: hash}
+			uses[isBinary][versionID] = u
+		}
+		if removedPaths[pathID] {
+			u.removed = true
+		} else {
+			u.kept = true
+		}
+		u.symlink = u.symlink || isSymlink
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var oldHashes [][]byte
+	rewritten := false
+	for _, isBinary := range []bool{false, true} {
+		table, temp := "pgit_text_content", "pgit_filter_text"
+		if isBinary {
+			table, temp = "pgit_binary_content", "pgit_filter_binary"
+		}
+
+		// Versions only removed paths use go away
+		var drop []int32
+		for versionID, u := range uses[isBinary] {
+			if u.removed && !u.kept {
+				drop = append(drop, versionID)
+				oldHashes = append(oldHashes, u.hash)
+			}
+		}
+
+		// Text versions the rules change, measured without keeping the content
+		newHashes := make(map[int32]filterRewrite)
+		if !isBinary && opts.ReplaceText != nil {
+			rows, err := tx.Query(ctx, "SELECT version_id, content FROM "+table+" WHERE group_id = $1 ORDER BY version_id", groupID)
+			if err != nil {
+				return nil, err
+			}
+			for rows.Next() {
+				var versionID int32
+				var content string
+				if err := rows.Scan(&versionID, &content); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				u := uses[false][versionID]
+				if u == nil || !u.kept || u.symlink {
+					continue
+				}
+				if out, changed := opts.ReplaceText([]byte(content)); changed {
+					newHashes[versionID] = filterRewrite{
+						hash: util.HashBytesBlake3(out), size: int64(len(out)), lines: int32(LineCount(out)),
+					}
+					oldHashes = append(oldHashes, u.hash)
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(drop) == 0 && len(newHashes) == 0 {
+			continue
+		}
+		first := int32(-1)
+		for _, v := range drop {
+			if first < 0 || v < first {
+				first = v
+			}
+		}
+		for v := range newHashes {
+			if first < 0 || v < first {
+				first = v
+			}
+		}
+
+		// Cut the chain at the first changed version and write the rest back
+		_, err := tx.Exec(ctx, "INSERT INTO "+temp+" SELECT version_id, content FROM "+table+
+			" WHERE group_id = $1 AND version_id >= $2 AND version_id <> ALL($3)", groupID, first, drop)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE group_id = $1 AND version_id >= $2", groupID, first); err != nil {
+			return nil, err
+		}
+		last := first - 1
+		for {
+			batch, err := readFilterBatch(ctx, tx, temp, last, isBinary)
+			if err != nil {
+				return nil, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			for _, c := range batch {
+				c.GroupID = groupID
+				if _, ok := newHashes[c.VersionID]; ok {
+					c.Content, _ = opts.ReplaceText(c.Content)
+				}
+				last = c.VersionID
+			}
+			if err := db.createContentsBatchTx(ctx, tx, batch); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(ctx, "TRUNCATE "+temp); err != nil {
+			return nil, err
+		}
+
+		if len(newHashes) > 0 {
+			versions := make([]int32, 0, len(newHashes))
+			hashes := make([][]byte, 0, len(newHashes))
+			sizes := make([]int64, 0, len(newHashes))
+			lines := make([]int32, 0, len(newHashes))
+			for v, rw := range newHashes {
+				versions = append(versions, v)
+				hashes = append(hashes, rw.hash)
+				sizes = append(sizes, rw.size)
+				lines = append(lines, rw.lines)
+			}
+			_, err := tx.Exec(ctx, `
+				UPDATE pgit_file_refs r SET content_hash = u.hash, size = u.size, line_count = u.lines
+				FROM pgit_paths p, unnest($2::int[], $3::bytea[], $4::bigint[], $5::int[]) AS u(version_id, hash, size, lines)
+				WHERE p.path_id = r.path_id AND p.group_id = $1
+				  AND r.version_id = u.version_id AND NOT r.is_binary AND r.content_hash IS NOT NULL`,
+				groupID, versions, hashes, sizes, lines)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result.VersionsRemoved += len(drop)
+		result.VersionsRewritten += len(newHashes)
+		rewritten = true
+	}
+	if rewritten {
+		result.GroupsRewritten++
+	}
+	return oldHashes, nil
+}
+
+// readFilterBatch reads the next versions after 'after' from a temp table.
+func readFilterBatch(ctx context.Context, tx pgx.Tx, temp string, after int32, isBinary bool) ([]*Content, error) {
+	rows, err := tx.Query(ctx, "SELECT version_id, content FROM "+temp+
+		" WHERE version_id > $1 ORDER BY version_id LIMIT $2", after, filterBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []*Content
+	for rows.Next() {
+		c := &Content{IsBinary: isBinary}
+		if isBinary {
+			if err := rows.Scan(&c.VersionID, &c.Content); err != nil {
+				return nil, err
+			}
+		} else {
+			var text string
+			if err := rows.Scan(&c.VersionID, &text); err != nil {
+				return nil, err
+			}
+			c.Content = []byte(text)
+		}
+		batch = append(batch, c)
+	}
+	return batch, rows.Err()
+}
+
+// filterTreeHashes stores the new tree hash of every commit whose tree
+// changed. pgit_commits is a single xpatch chain ordered by seq, so it is
+// re-encoded from the first changed commit onward; the commit hashes of
+// those commits are computed again, as each covers its parent's.
+func filterTreeHashes(ctx context.Context, tx pgx.Tx, commits []fsckCommit, newTrees map[string]string, result *FilterResult) error {
+	var changed []string
+	parentHashes := make(map[string]string, len(commits))
+	for _, c := range commits {
+		if newTrees[c.ID] != c.TreeHash {
+			changed = append(changed, c.ID)
+		}
+		parentHashes[c.ID] = c.CommitHash
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	result.TreesUpdated = len(changed)
+
+	var first int
+	if err := tx.QueryRow(ctx, "SELECT MIN(seq) FROM pgit_commits WHERE id = ANY($1)", changed).Scan(&first); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE pgit_filter_commits ON COMMIT DROP AS
+		SELECT id, seq, parent_id, tree_hash, message, author_name, author_email,
+			authored_at, committer_name, committer_email, committed_at
+		FROM pgit_commits WITH NO DATA`)
+	if err != nil {
+		return err
+	}
+	for _, sql := range []string{
+		`INSERT INTO pgit_filter_commits
+		 SELECT id, seq, parent_id, tree_hash, message, author_name, author_email,
+			authored_at, committer_name, committer_email, committed_at
+		 FROM pgit_commits WHERE seq >= $1`,
+		"DELETE FROM pgit_commits WHERE seq >= $1",
+	} {
+		if _, err := tx.Exec(ctx, sql, first); err != nil {
+			return err
+		}
+	}
+	return rehashCommits(ctx, tx, "pgit_filter_commits", newTrees, parentHashes, nil)
+}
+
+func sortInt32s(s []int32) {
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+}
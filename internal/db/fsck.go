@@ -0,0 +1,699 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/errgroup"
+)
+
+// Kinds of problems reported by Fsck.
+const (
+	FsckMissingCommit  = "missing-commit"   // a ref, file ref or parent_id names a commit that doesn't exist
+	FsckBadGraph       = "bad-graph"        // a pgit_commit_graph row disagrees with pgit_commits
+	FsckMissingPath    = "missing-path"     // a file ref's path_id is not in pgit_paths
+	FsckMissingContent = "missing-content"  // a file ref's (group_id, version_id) has no content row
+	FsckCorruptContent = "corrupt-content"  // stored content doesn't hash to the file ref's content_hash
+	FsckDangling       = "dangling-content" // a content row no file ref points to
+	FsckBadTreeHash    = "bad-tree-hash"    // a commit's tree_hash doesn't match its files
+	FsckBadCommitHash  = "bad-commit-hash"  // a commit's commit_hash doesn't match its contents and parent
+)
+
+// FsckOptions configures Fsck.
+type FsckOptions struct {
+	// Full also reads and hashes every content version and recomputes the
+	// tree hash of every commit.
+	Full bool
+
+	// Workers is the number of delta groups checked in parallel.
+	Workers int
+
+	// OnProgress is called with the number of delta groups checked so far.
+	OnProgress func(done, total int)
+}
+
+// FsckProblem is one inconsistency found by Fsck. Only the fields that
+// identify the object are set.
+type FsckProblem struct {
+	Kind      string `json:"kind"`
+	CommitID  string `json:"commit,omitempty"`
+	Ref       string `json:"ref,omitempty"`
+	Path      string `json:"path,omitempty"`
+	PathID    int32  `json:"path_id,omitempty"`
+	GroupID   int32  `json:"group_id,omitempty"`
+	VersionID int32  `json:"version_id,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// FsckReport is the result of Fsck.
+type FsckReport struct {
+	Commits       int           `json:"commits"`
+	FileRefs      int           `json:"file_refs"`
+	Groups        int           `json:"groups"`
+	Versions      int           `json:"versions"`
+	HashesChecked int           `json:"hashes_checked"`
+	TreesChecked  int           `json:"trees_checked"`
+	Problems      []FsckProblem `json:"problems"`
+}
+
+// fsckCommit is the part of a pgit_commits row Fsck checks.
+type fsckCommit struct {
+	ID         string
+	ParentID   *string
+	TreeHash   string
+	CommitHash string
+}
+
+// fsckRef is the part of a pgit_file_refs row Fsck checks.
+type fsckRef struct {
+	PathID      int32
+	Path        string
+	CommitID    string
+	VersionID   int32
+	ContentHash []byte
+	IsBinary    bool
+}
+
+// Fsck verifies the consistency of the repository: commit parents and the
+// commit graph, refs, file refs against paths and content, and (with
+// opts.Full) content hashes and tree hashes. Content is checked one delta
+// group at a time, opts.Workers groups in parallel, so every group's delta
+// chain is decoded front to back exactly once.
+func (db *DB) Fsck(ctx context.Context, opts FsckOptions) (*FsckReport, error) {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	report := &FsckReport{Problems: []FsckProblem{}}
+
+	commits, err := readFsckCommits(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commits: %w", err)
+	}
+	report.Commits = len(commits)
+	commitSet := make(map[string]bool, len(commits))
+	for _, c := range commits {
+		commitSet[c.ID] = true
+	}
+	for _, c := range commits {
+		if c.ParentID != nil && !commitSet[*c.ParentID] {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:     FsckMissingCommit,
+				CommitID: c.ID,
+				Detail:   fmt.Sprintf("parent %s does not exist", *c.ParentID),
+			})
+		}
+	}
+
+	graph, err := db.fsckGraph(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit graph: %w", err)
+	}
+	parents := make(map[string]*string, len(commits))
+	for _, c := range commits {
+		parents[c.ID] = c.ParentID
+	}
+	report.Problems = append(report.Problems, checkGraph(graph, parents)...)
+
+	hashProblems, err := db.fsckCommitHashes(ctx, commits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check commit hashes: %w", err)
+	}
+	report.Problems = append(report.Problems, hashProblems...)
+
+	refs, err := db.GetAllRefs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.CommitID != "" && !commitSet[ref.CommitID] {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:     FsckMissingCommit,
+				Ref:      ref.Name,
+				CommitID: ref.CommitID,
+				Detail:   "ref points to a commit that does not exist",
+			})
+		}
+	}
+
+	orphans, err := db.fsckRefsWithoutPath(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file refs: %w", err)
+	}
+	report.Problems = append(report.Problems, orphans...)
+	report.FileRefs += len(orphans)
+
+	groupIDs, err := db.fsckGroupIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta groups: %w", err)
+	}
+	report.Groups = len(groupIDs)
+
+	var mu sync.Mutex
+	done := 0
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.Workers)
+	for _, groupID := range groupIDs {
+		g.Go(func() error {
+			r, err := db.fsckGroup(gctx, groupID, commitSet, opts.Full)
+			if err != nil {
+				return fmt.Errorf("failed to check group %d: %w", groupID, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.FileRefs += r.FileRefs
+			report.Versions += r.Versions
+			report.HashesChecked += r.HashesChecked
+			report.Problems = append(report.Problems, r.Problems...)
+			done++
+			if opts.OnProgress != nil {
+				opts.OnProgress(done, len(groupIDs))
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if opts.Full {
+		problems, err := db.fsckTreeHashes(ctx, commits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check tree hashes: %w", err)
+		}
+		report.Problems = append(report.Problems, problems...)
+		report.TreesChecked = len(commits)
+	}
+
+	sortFsckProblems(report.Problems)
+	return report, nil
+}
+
+// sortFsckProblems orders problems by kind, then by the object they name,
+// so the output is stable across runs and worker counts.
+func sortFsckProblems(problems []FsckProblem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.GroupID != b.GroupID {
+			return a.GroupID < b.GroupID
+		}
+		if a.VersionID != b.VersionID {
+			return a.VersionID < b.VersionID
+		}
+		if a.CommitID != b.CommitID {
+			return a.CommitID < b.CommitID
+		}
+		return a.Path < b.Path
+	})
+}
+
+func readFsckCommits(ctx context.Context, q querier) ([]fsckCommit, error) {
+	rows, err := q.Query(ctx, "SELECT id, parent_id, tree_hash, commit_hash FROM pgit_commits ORDER BY seq")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commits []fsckCommit
+	for rows.Next() {
+		var c fsckCommit
+		if err := rows.Scan(&c.ID, &c.ParentID, &c.TreeHash, &c.CommitHash); err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+	}
+	return commits, rows.Err()
+}
+
+func (db *DB) fsckGraph(ctx context.Context) ([]CommitGraphEntry, error) {
+	rows, err := db.Query(ctx, "SELECT seq, id, depth, ancestors FROM pgit_commit_graph ORDER BY seq")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []CommitGraphEntry
+	for rows.Next() {
+		var e CommitGraphEntry
+		if err := rows.Scan(&e.Seq, &e.ID, &e.Depth, &e.Ancestors); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// checkGraph verifies the commit graph against the commits' parent_id
+// (parents maps every commit ID to its parent). Only imported commits have
+// graph entries; a commit whose parent has none is a root of the graph.
+// Each entry must have depth = parent depth + 1 and the binary lifting
+// table the import builds: Ancestors[0] is the parent and Ancestors[k] is
+// Ancestors[k-1] of the entry at Ancestors[k-1].
+func checkGraph(entries []CommitGraphEntry, parents map[string]*string) []FsckProblem {
+	var problems []FsckProblem
+	bad := func(e *CommitGraphEntry, format string, args ...any) {
+		problems = append(problems, FsckProblem{
+			Kind:     FsckBadGraph,
+			CommitID: e.ID,
+			Detail:   fmt.Sprintf("seq %d: ", e.Seq) + fmt.Sprintf(format, args...),
+		})
+	}
+
+	bySeq := make(map[int32]*CommitGraphEntry, len(entries))
+	byID := make(map[string]*CommitGraphEntry, len(entries))
+	for i := range entries {
+		bySeq[entries[i].Seq] = &entries[i]
+		byID[entries[i].ID] = &entries[i]
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		parentID, exists := parents[e.ID]
+		if !exists {
+			bad(e, "commit does not exist")
+			continue
+		}
+
+		var parent *CommitGraphEntry
+		if parentID != nil {
+			parent = byID[*parentID]
+		}
+		if parent == nil {
+			if e.Depth != 0 || len(e.Ancestors) != 0 {
+				bad(e, "root entry has depth %d and %d ancestors", e.Depth, len(e.Ancestors))
+			}
+			continue
+		}
+
+		if e.Depth != parent.Depth+1 {
+			bad(e, "depth is %d, parent's is %d", e.Depth, parent.Depth)
+		}
+
+		// Rebuild the lifting table the way the import does
+		want := []int32{parent.Seq}
+		for k := 1; e.Depth>>k > 0; k++ {
+			prev := bySeq[want[k-1]]
+			if prev == nil || k-1 >= len(prev.Ancestors) {
+				break
+			}
+			want = append(want, prev.Ancestors[k-1])
+		}
+		if !equalSeqs(e.Ancestors, want) {
+			bad(e, "ancestors are %v, want %v", e.Ancestors, want)
+		}
+	}
+	return problems
+}
+
+func equalSeqs(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fsckRefsWithoutPath returns a problem for every file ref whose path_id
+// is not in pgit_paths. Such refs belong to no delta group, so the group
+// checks never see them.
+func (db *DB) fsckRefsWithoutPath(ctx context.Context) ([]FsckProblem, error) {
+	rows, err := db.Query(ctx, `
+		SELECT r.path_id, r.commit_id
+		FROM pgit_file_refs r
+		LEFT JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE p.path_id IS NULL
+		ORDER BY r.path_id, r.commit_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []FsckProblem
+	for rows.Next() {
+		p := FsckProblem{Kind: FsckMissingPath, Detail: "file ref has no path"}
+		if err := rows.Scan(&p.PathID, &p.CommitID); err != nil {
+			return nil, err
+		}
+		problems = append(problems, p)
+	}
+	return problems, rows.Err()
+}
+
+// fsckGroupIDs returns every delta group that has paths or content.
+func (db *DB) fsckGroupIDs(ctx context.Context) ([]int32, error) {
+	rows, err := db.Query(ctx, `
+		SELECT group_id FROM pgit_paths
+		UNION SELECT DISTINCT group_id FROM pgit_text_content
+		UNION SELECT DISTINCT group_id FROM pgit_binary_content
+		ORDER BY group_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// fsckGroup checks the file refs and content versions of one delta group.
+func (db *DB) fsckGroup(ctx context.Context, groupID int32, commits map[string]bool, full bool) (*FsckReport, error) {
+	rows, err := db.Query(ctx, `
+		SELECT r.path_id, p.path, r.commit_id, r.version_id, r.content_hash, r.is_binary
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE p.group_id = $1`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	var refs []fsckRef
+	for rows.Next() {
+		var ref fsckRef
+		if err := rows.Scan(&ref.PathID, &ref.Path, &ref.CommitID, &ref.VersionID, &ref.ContentHash, &ref.IsBinary); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	text, err := db.fsckVersions(ctx, "pgit_text_content", groupID, false, full)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := db.fsckVersions(ctx, "pgit_binary_content", groupID, true, full)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FsckReport{
+		FileRefs: len(refs),
+		Versions: len(text) + len(binary),
+	}
+	if full {
+		report.HashesChecked = len(text) + len(binary)
+	}
+	for _, ref := range refs {
+		if !commits[ref.CommitID] {
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind:     FsckMissingCommit,
+				CommitID: ref.CommitID,
+				Path:     ref.Path,
+				Detail:   "file ref belongs to a commit that does not exist",
+			})
+		}
+	}
+	report.Problems = append(report.Problems, checkGroupContent(groupID, refs, text, binary)...)
+	return report, nil
+}
+
+// fsckVersions reads the version IDs of one group from a content table in
+// delta chain order. With hash set, it also reads the content and maps each
+// version to its BLAKE3 hash; otherwise the values are nil. Content is
+// hashed as it streams in so only one version is held at a time.
+func (db *DB) fsckVersions(ctx context.Context, table string, groupID int32, isBinary, hash bool) (map[int32][]byte, error) {
+	columns := "version_id"
+	if hash {
+		columns = "version_id, content"
+	}
+	rows, err := db.Query(ctx,
+		"SELECT "+columns+" FROM "+table+" WHERE group_id = $1 ORDER BY version_id ASC", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int32][]byte)
+	for rows.Next() {
+		var versionID int32
+		switch {
+		case !hash:
+			if err := rows.Scan(&versionID); err != nil {
+				return nil, err
+			}
+			versions[versionID] = nil
+		case isBinary:
+			var content []byte
+			if err := rows.Scan(&versionID, &content); err != nil {
+				return nil, err
+			}
+			versions[versionID] = util.HashBytesBlake3(content)
+		default:
+			var content string
+			if err := rows.Scan(&versionID, &content); err != nil {
+				return nil, err
+			}
+			versions[versionID] = util.HashBytesBlake3([]byte(content))
+		}
+	}
+	return versions, rows.Err()
+}
+
+// checkGroupContent checks one group's file refs against the versions in
+// its text and binary content tables (version → hash, nil when content
+// wasn't hashed). Every live file ref needs a version in the table matching
+// its is_binary flag, with a matching hash when one was computed; every
+// version needs at least one live file ref. Deleted file refs (nil
+// content_hash) have no content.
+func checkGroupContent(groupID int32, refs []fsckRef, text, binary map[int32][]byte) []FsckProblem {
+	var problems []FsckProblem
+	usedText := make(map[int32]bool)
+	usedBinary := make(map[int32]bool)
+
+	for _, ref := range refs {
+		if ref.ContentHash == nil {
+			continue
+		}
+		table, versions, used := "pgit_text_content", text, usedText
+		if ref.IsBinary {
+			table, versions, used = "pgit_binary_content", binary, usedBinary
+		}
+		used[ref.VersionID] = true
+
+		stored, ok := versions[ref.VersionID]
+		if !ok {
+			problems = append(problems, FsckProblem{
+				Kind:      FsckMissingContent,
+				CommitID:  ref.CommitID,
+				Path:      ref.Path,
+				GroupID:   groupID,
+				VersionID: ref.VersionID,
+				Detail:    "no row in " + table,
+			})
+			continue
+		}
+		if stored != nil && !util.ContentHashEqual(stored, ref.ContentHash) {
+			problems = append(problems, FsckProblem{
+				Kind:      FsckCorruptContent,
+				CommitID:  ref.CommitID,
+				Path:      ref.Path,
+				GroupID:   groupID,
+				VersionID: ref.VersionID,
+				Detail: fmt.Sprintf("content hashes to %s, file ref has %s",
+					util.ContentHashToHex(stored), util.ContentHashToHex(ref.ContentHash)),
+			})
+		}
+	}
+
+	dangling := func(table string, versions map[int32][]byte, used map[int32]bool) {
+		ids := make([]int32, 0, len(versions))
+		for id := range versions {
+			if !used[id] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			problems = append(problems, FsckProblem{
+				Kind:      FsckDangling,
+				GroupID:   groupID,
+				VersionID: id,
+				Detail:    "no file ref points to this row in " + table,
+			})
+		}
+	}
+	dangling("pgit_text_content", text, usedText)
+	dangling("pgit_binary_content", binary, usedBinary)
+
+	return problems
+}
+
+// fsckTreeHashes compares the tree hash of every commit with the one
+// recomputed from its files.
+func (db *DB) fsckTreeHashes(ctx context.Context, commits []fsckCommit) ([]FsckProblem, error) {
+	hashes, err := treeHashes(ctx, db, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []FsckProblem
+	for _, c := range commits {
+		if got := hashes[c.ID]; got != c.TreeHash {
+			problems = append(problems, FsckProblem{
+				Kind:     FsckBadTreeHash,
+				CommitID: c.ID,
+				Detail:   fmt.Sprintf("tree_hash is %s, files hash to %s", c.TreeHash, got),
+			})
+		}
+	}
+	return problems, nil
+}
+
+// fsckCommitHashes recomputes the commit hash of every commit from its row
+// and its parent's stored hash. Only the first commit changed after it was
+// written is reported: its children still match the hash it had.
+func (db *DB) fsckCommitHashes(ctx context.Context, commits []fsckCommit) ([]FsckProblem, error) {
+	stored := make(map[string]string, len(commits))
+	for _, c := range commits {
+		stored[c.ID] = c.CommitHash
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, parent_id, tree_hash, message, author_name, author_email, authored_at,
+		       committer_name, committer_email, committed_at, commit_hash
+		FROM pgit_commits ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []FsckProblem
+	for rows.Next() {
+		c := &Commit{}
+		if err := rows.Scan(&c.ID, &c.ParentID, &c.TreeHash, &c.Message,
+			&c.AuthorName, &c.AuthorEmail, &c.AuthoredAt,
+			&c.CommitterName, &c.CommitterEmail, &c.CommittedAt, &c.CommitHash); err != nil {
+			return nil, err
+		}
+		parentHash := ""
+		if c.ParentID != nil {
+			parentHash = stored[*c.ParentID]
+		}
+		if got := c.ComputeHash(parentHash); got != c.CommitHash {
+			problems = append(problems, FsckProblem{
+				Kind:     FsckBadCommitHash,
+				CommitID: c.ID,
+				Detail:   fmt.Sprintf("commit_hash is %s, contents hash to %s", c.CommitHash, got),
+			})
+		}
+	}
+	return problems, rows.Err()
+}
+
+// querier runs queries on a *DB or inside a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// treeHashes computes the tree hash of every commit from its files. A
+// commit's tree is its parent's tree with the commit's file refs applied,
+// so trees follow the ancestry even where commit IDs don't sort along it.
+// File refs are read a batch of commits at a time, and trees are passed
+// from parent to child (see util.TreeReplay) so each hash costs about as
+// much as the changes of its commit.
+func treeHashes(ctx context.Context, q querier, commits []fsckCommit) (map[string]string, error) {
+	const batchSize = 1000
+
+	ordered := ancestryOrder(commits)
+	parentIDs := make([]string, len(ordered))
+	for i, c := range ordered {
+		if c.ParentID != nil {
+			parentIDs[i] = *c.ParentID
+		}
+	}
+	replay := util.NewTreeReplay(parentIDs)
+	hashes := make(map[string]string, len(commits))
+
+	for start := 0; start < len(ordered); start += batchSize {
+		batch := ordered[start:min(start+batchSize, len(ordered))]
+		ids := make([]string, len(batch))
+		for i, c := range batch {
+			ids[i] = c.ID
+		}
+
+		changes, err := treeChanges(ctx, q, "r.commit_id = ANY($1)", ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, c := range batch {
+			hashes[c.ID] = replay.Replay(c.ID, parentIDs[start+i], changes[c.ID])
+		}
+	}
+	return hashes, nil
+}
+
+// ancestryOrder returns commits in their given order, except that a commit
+// whose parent comes later is moved after it, so every parent precedes its
+// children.
+func ancestryOrder(commits []fsckCommit) []fsckCommit {
+	byID := make(map[string]int, len(commits))
+	for i, c := range commits {
+		byID[c.ID] = i
+	}
+	ordered := make([]fsckCommit, 0, len(commits))
+	placed := make([]bool, len(commits))
+	for i := range commits {
+		// Collect the ancestors not placed yet, then place them oldest first
+		var chain []int
+		inChain := make(map[int]bool)
+		for j, ok := i, true; ok && !placed[j] && !inChain[j]; {
+			chain = append(chain, j)
+			inChain[j] = true
+			if commits[j].ParentID == nil {
+				break
+			}
+			j, ok = byID[*commits[j].ParentID]
+		}
+		for k := len(chain) - 1; k >= 0; k-- {
+			placed[chain[k]] = true
+			ordered = append(ordered, commits[chain[k]])
+		}
+	}
+	return ordered
+}
+
+// treeChanges returns the file refs matching where (a condition on the
+// file refs r) as tree entries, keyed by commit ID. Deleted files have a
+// nil ContentHash.
+func treeChanges(ctx context.Context, q querier, where string, args ...any) (map[string][]util.TreeEntry, error) {
+	rows, err := q.Query(ctx, `
+		SELECT r.commit_id, p.path, r.mode, r.content_hash, r.is_symlink
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make(map[string][]util.TreeEntry)
+	for rows.Next() {
+		var commitID string
+		var e util.TreeEntry
+		if err := rows.Scan(&commitID, &e.Path, &e.Mode, &e.ContentHash, &e.IsSymlink); err != nil {
+			return nil, err
+		}
+		changes[commitID] = append(changes[commitID], e)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestCheckGraph(t *testing.T) {
+	// Linear history a ← b ← c ← d ← e, as the import builds it
+	parents := map[string]*string{
+		"a": nil, "b": strPtr("a"), "c": strPtr("b"), "d": strPtr("c"), "e": strPtr("d"),
+	}
+	entries := []CommitGraphEntry{
+		{Seq: 1, ID: "a", Depth: 0},
+		{Seq: 2, ID: "b", Depth: 1, Ancestors: []int32{1}},
+		{Seq: 3, ID: "c", Depth: 2, Ancestors: []int32{2, 1}},
+		{Seq: 4, ID: "d", Depth: 3, Ancestors: []int32{3, 2}},
+		{Seq: 5, ID: "e", Depth: 4, Ancestors: []int32{4, 3, 1}},
+	}
+	if problems := checkGraph(entries, parents); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+
+	entries[3].Ancestors = []int32{3, 1}
+	entries[4].Depth = 5
+	problems := checkGraph(entries, parents)
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %+v", problems)
+	}
+	for _, p := range problems {
+		if p.Kind != FsckBadGraph {
+			t.Errorf("Kind = %q, want %q", p.Kind, FsckBadGraph)
+		}
+	}
+	if problems[0].CommitID != "d" || problems[1].CommitID != "e" {
+		t.Errorf("flagged %s and %s, want d and e", problems[0].CommitID, problems[1].CommitID)
+	}
+
+	// A graph entry for a commit that isn't in pgit_commits
+	delete(parents, "a")
+	if problems := checkGraph(entries[:1], parents); len(problems) != 1 {
+		t.Fatalf("expected the missing commit to be flagged, got %+v", problems)
+	}
+}
+
+func TestCheckGraph_NativeParent(t *testing.T) {
+	// An imported commit on top of a native one (no graph entry) is a root
+	parents := map[string]*string{"n": nil, "i": strPtr("n")}
+	entries := []CommitGraphEntry{{Seq: 1, ID: "i", Depth: 0}}
+	if problems := checkGraph(entries, parents); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+}
+
+func TestCheckGroupContent(t *testing.T) {
+	hashA := util.HashBytesBlake3([]byte("a"))
+	hashB := util.HashBytesBlake3([]byte("b"))
+	refs := []fsckRef{
+		{Path: "f.txt", CommitID: "c1", VersionID: 1, ContentHash: hashA},
+		{Path: "g.txt", CommitID: "c1", VersionID: 1, ContentHash: hashA}, // shares version 1
+		{Path: "f.txt", CommitID: "c2", VersionID: 2, ContentHash: hashB},
+		{Path: "f.txt", CommitID: "c3", VersionID: 3},                                     // deleted
+		{Path: "f.bin", CommitID: "c4", VersionID: 4, ContentHash: hashA, IsBinary: true}, // missing
+	}
+
+	// Without content hashes only presence is checked
+	text := map[int32][]byte{1: nil, 2: nil, 5: nil}
+	problems := checkGroupContent(7, refs, text, map[int32][]byte{})
+	kinds := make(map[string]int32)
+	for _, p := range problems {
+		kinds[p.Kind] = p.VersionID
+	}
+	if len(problems) != 2 || kinds[FsckMissingContent] != 4 || kinds[FsckDangling] != 5 {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+
+	// With hashes, version 2 holds the wrong content
+	text = map[int32][]byte{1: hashA, 2: hashA}
+	binary := map[int32][]byte{4: hashA}
+	problems = checkGroupContent(7, refs, text, binary)
+	if len(problems) != 1 || problems[0].Kind != FsckCorruptContent || problems[0].VersionID != 2 {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+	if problems[0].GroupID != 7 || problems[0].Path != "f.txt" {
+		t.Errorf("problem names %d/%s, want 7/f.txt", problems[0].GroupID, problems[0].Path)
+	}
+}
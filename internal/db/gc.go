@@ -0,0 +1,399 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GCPlan lists what GC would remove.
+type GCPlan struct {
+	// Commits to prune, in seq order.
+	Commits []string
+
+	// Kept is the number of unreachable commits kept because they (or a
+	// descendant) were committed after the cutoff.
+	Kept int
+
+	FileRefs int
+	Paths    int
+	Versions int // content versions no surviving file ref uses
+
+	versions []gcVersion
+}
+
+// gcCommit is the part of a pgit_commits row GC needs.
+type gcCommit struct {
+	ID          string
+	ParentID    *string
+	CommittedAt time.Time
+}
+
+// gcVersion is a content row to remove.
+type gcVersion struct {
+	GroupID   int32
+	VersionID int32
+	IsBinary  bool
+}
+
+// GCProgress reports progress while GC rewrites delta chains.
+type GCProgress func(done, total int)
+
+// PlanGC finds the commits that are not reachable from any ref and were
+// committed before cutoff, and counts the file refs, paths and content
+// versions that go with them. Commits a resumable transfer still refers to
+// (pgit_sync_state) count as reachable. pgit keeps no reflog, so an
+// unreachable commit newer than cutoff keeps itself and its ancestors.
+func (db *DB) PlanGC(ctx context.Context, cutoff time.Time) (*GCPlan, error) {
+	commits, err := db.gcCommits(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commits: %w", err)
+	}
+	roots, err := db.gcRoots(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs: %w", err)
+	}
+
+	plan := &GCPlan{}
+	plan.Commits, plan.Kept = unreachableCommits(commits, roots, cutoff)
+	if len(plan.Commits) == 0 {
+		return plan, nil
+	}
+
+	err = db.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT r.path_id) FILTER (WHERE NOT EXISTS (
+			SELECT 1 FROM pgit_file_refs k
+			WHERE k.path_id = r.path_id AND k.commit_id <> ALL($1)))
+		FROM pgit_file_refs r
+		WHERE r.commit_id = ANY($1)`, plan.Commits).Scan(&plan.FileRefs, &plan.Paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count file refs: %w", err)
+	}
+
+	// Versions can be shared by several file refs; only those no surviving
+	// file ref uses go
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT p.group_id, r.version_id, r.is_binary
+		FROM pgit_file_refs r
+		JOIN pgit_paths p ON p.path_id = r.path_id
+		WHERE r.commit_id = ANY($1) AND r.content_hash IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM pgit_file_refs k
+			JOIN pgit_paths kp ON kp.path_id = k.path_id
+			WHERE kp.group_id = p.group_id AND k.version_id = r.version_id
+			  AND k.is_binary = r.is_binary AND k.content_hash IS NOT NULL
+			  AND k.commit_id <> ALL($1))
+		ORDER BY 1, 2`, plan.Commits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find content versions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v gcVersion
+		if err := rows.Scan(&v.GroupID, &v.VersionID, &v.IsBinary); err != nil {
+			return nil, err
+		}
+		plan.versions = append(plan.versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	plan.Versions = len(plan.versions)
+	return plan, nil
+}
+
+// unreachableCommits returns the commits (in the order given) that are not
+// ancestors of any root or of any commit committed after cutoff, and the
+// number of commits only the cutoff kept.
+func unreachableCommits(commits []gcCommit, roots []string, cutoff time.Time) ([]string, int) {
+	parents := make(map[string]*string, len(commits))
+	for _, c := range commits {
+		parents[c.ID] = c.ParentID
+	}
+
+	marked := make(map[string]bool, len(commits))
+	mark := func(id string) int {
+		n := 0
+		for {
+			if marked[id] {
+				return n
+			}
+			parent, exists := parents[id]
+			if !exists {
+				return n
+			}
+			marked[id] = true
+			n++
+			if parent == nil {
+				return n
+			}
+			id = *parent
+		}
+	}
+
+	for _, id := range roots {
+		mark(id)
+	}
+	kept := 0
+	for _, c := range commits {
+		if !marked[c.ID] && c.CommittedAt.After(cutoff) {
+			kept += mark(c.ID)
+		}
+	}
+
+	var prune []string
+	for _, c := range commits {
+		if !marked[c.ID] {
+			prune = append(prune, c.ID)
+		}
+	}
+	return prune, kept
+}
+
+func (db *DB) gcCommits(ctx context.Context) ([]gcCommit, error) {
+	rows, err := db.Query(ctx, "SELECT id, parent_id, committed_at FROM pgit_commits ORDER BY seq")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commits []gcCommit
+	for rows.Next() {
+		var c gcCommit
+		if err := rows.Scan(&c.ID, &c.ParentID, &c.CommittedAt); err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+	}
+	return commits, rows.Err()
+}
+
+// gcRoots returns the commits GC must keep with their history: every ref
+// and every commit recorded in pgit_sync_state.
+func (db *DB) gcRoots(ctx context.Context) ([]string, error) {
+	rows, err := db.Query(ctx, `
+		SELECT commit_id FROM pgit_refs
+		UNION
+		SELECT unnest(ARRAY[last_commit_id, transfer_base, transfer_target, transfer_last])
+		FROM pgit_sync_state`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roots []string
+	for rows.Next() {
+		var id *string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if id != nil {
+			roots = append(roots, *id)
+		}
+	}
+	return roots, rows.Err()
+}
+
+// GC removes the commits in plan together with their file refs, trailers,
+// notes, graph entries and git mappings, the paths left without file refs,
+// and the content versions in plan. Content and commits are xpatch delta
+// chains, where deleting a row also deletes every later row of the chain,
+// so each affected chain is cut at its first removed row and the rows
+// after it that survive are written back. Everything happens in one
+// transaction; the caller should hold the push lock. Afterwards the tables
+// are vacuumed.
+func (db *DB) GC(ctx context.Context, plan *GCPlan, progress GCProgress) error {
+	if len(plan.Commits) == 0 {
+		return nil
+	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	err := db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "CREATE TEMP TABLE pgit_gc_prune (id TEXT PRIMARY KEY) ON COMMIT DROP"); err != nil {
+			return err
+		}
+		ids := make([][]interface{}, len(plan.Commits))
+		for i, id := range plan.Commits {
+			ids[i] = []interface{}{id}
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"pgit_gc_prune"}, []string{"id"}, pgx.CopyFromRows(ids)); err != nil {
+			return err
+		}
+
+		if err := removeVersionsTx(ctx, tx, plan.versions, progress); err != nil {
+			return err
+		}
+
+		var pathIDs []int32
+		rows, err := tx.Query(ctx, "SELECT DISTINCT path_id FROM pgit_file_refs WHERE commit_id IN (SELECT id FROM pgit_gc_prune)")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int32
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			pathIDs = append(pathIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, sql := range []string{
+			"DELETE FROM pgit_file_refs WHERE commit_id IN (SELECT id FROM pgit_gc_prune)",
+			"DELETE FROM pgit_file_changes WHERE commit_id IN (SELECT id FROM pgit_gc_prune)",
+			"DELETE FROM pgit_commit_trailers WHERE commit_id IN (SELECT id FROM pgit_gc_prune)",
+			"DELETE FROM pgit_notes WHERE commit_id IN (SELECT id FROM pgit_gc_prune)",
+			"DELETE FROM pgit_commit_graph WHERE id IN (SELECT id FROM pgit_gc_prune)",
+			"DELETE FROM pgit_git_map WHERE kind = 'commit' AND commit_id IN (SELECT id FROM pgit_gc_prune)",
+		} {
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(ctx, `
+			DELETE FROM pgit_paths p
+			WHERE p.path_id = ANY($1)
+			  AND NOT EXISTS (SELECT 1 FROM pgit_file_refs r WHERE r.path_id = p.path_id)`, pathIDs)
+		if err != nil {
+			return err
+		}
+
+		// pgit_commits is a single chain ordered by seq
+		var firstSeq int
+		err = tx.QueryRow(ctx, "SELECT MIN(seq) FROM pgit_commits WHERE id IN (SELECT id FROM pgit_gc_prune)").Scan(&firstSeq)
+		if err != nil {
+			return err
+		}
+		// CREATE TABLE AS takes no parameters, so the table is filled separately
+		_, err = tx.Exec(ctx, `
+			CREATE TEMP TABLE pgit_gc_commits ON COMMIT DROP AS
+			SELECT id, seq, parent_id, tree_hash, message, author_name, author_email,
+				authored_at, committer_name, committer_email, committed_at, commit_hash
+			FROM pgit_commits WITH NO DATA`)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite commits: %w", err)
+		}
+		for _, sql := range []string{
+			`INSERT INTO pgit_gc_commits
+			 SELECT id, seq, parent_id, tree_hash, message, author_name, author_email,
+				authored_at, committer_name, committer_email, committed_at, commit_hash
+			 FROM pgit_commits
+			 WHERE seq > $1 AND id NOT IN (SELECT id FROM pgit_gc_prune)`,
+			"DELETE FROM pgit_commits WHERE seq >= $1",
+		} {
+			if _, err := tx.Exec(ctx, sql, firstSeq); err != nil {
+				return fmt.Errorf("failed to rewrite commits: %w", err)
+			}
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO pgit_commits (id, seq, parent_id, tree_hash, message, author_name, author_email,
+				authored_at, committer_name, committer_email, committed_at, commit_hash)
+			SELECT * FROM pgit_gc_commits ORDER BY seq`)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite commits: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.vacuum(ctx, gcTables)
+	return nil
+}
+
+// removeVersionsTx deletes content versions (ordered by chain and version,
+// as PlanGC and unsharedVersions return them) from their delta chains.
+// Deleting a row of an xpatch chain also deletes every later row, so each
+// chain is cut at its first removed version and the rows after it that
+// survive are written back. progress (may be nil) counts chains.
+func removeVersionsTx(ctx context.Context, tx pgx.Tx, versions []gcVersion, progress GCProgress) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	// Removed versions per delta chain
+	type chain struct {
+		groupID  int32
+		isBinary bool
+	}
+	var chains []chain
+	removed := make(map[chain][]int32)
+	for _, v := range versions {
+		c := chain{v.GroupID, v.IsBinary}
+		if _, ok := removed[c]; !ok {
+			chains = append(chains, c)
+		}
+		removed[c] = append(removed[c], v.VersionID)
+	}
+
+	for _, sql := range []string{
+		"CREATE TEMP TABLE IF NOT EXISTS pgit_gc_text (group_id INTEGER, version_id INTEGER, content TEXT) ON COMMIT DROP",
+		"CREATE TEMP TABLE IF NOT EXISTS pgit_gc_binary (group_id INTEGER, version_id INTEGER, content BYTEA) ON COMMIT DROP",
+	} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+
+	progress(0, len(chains))
+	for i, c := range chains {
+		table, temp := "pgit_text_content", "pgit_gc_text"
+		if c.isBinary {
+			table, temp = "pgit_binary_content", "pgit_gc_binary"
+		}
+		versions := removed[c]
+		first := versions[0]
+		_, err := tx.Exec(ctx, "INSERT INTO "+temp+" SELECT group_id, version_id, content FROM "+table+
+			" WHERE group_id = $1 AND version_id > $2 AND version_id <> ALL($3)", c.groupID, first, versions)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite group %d: %w", c.groupID, err)
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM "+table+" WHERE group_id = $1 AND version_id >= $2", c.groupID, first)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite group %d: %w", c.groupID, err)
+		}
+		for _, sql := range []string{
+			"INSERT INTO " + table + " (group_id, version_id, content) SELECT group_id, version_id, content FROM " + temp + " ORDER BY version_id",
+			"TRUNCATE " + temp,
+		} {
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return fmt.Errorf("failed to rewrite group %d: %w", c.groupID, err)
+			}
+		}
+		progress(i+1, len(chains))
+	}
+	return nil
+}
+
+// gcTables are the tables GC deletes from.
+var gcTables = []string{
+	"pgit_commits", "pgit_file_refs", "pgit_paths", "pgit_text_content", "pgit_binary_content",
+	"pgit_file_changes", "pgit_commit_trailers", "pgit_notes", "pgit_commit_graph", "pgit_git_map",
+}
+
+// vacuum refreshes the xpatch stats (invalidated by deletes) and runs
+// VACUUM ANALYZE on the given tables after a rewrite. VACUUM can't run in
+// a transaction, and failures are ignored: the rewrite already committed.
+func (db *DB) vacuum(ctx context.Context, tables []string) {
+	for _, table := range tables {
+		switch table {
+		case "pgit_commits", "pgit_text_content", "pgit_binary_content":
+			db.refreshXpatchStats(ctx, table)
+		}
+	}
+	for _, table := range tables {
+		_ = db.Exec(ctx, "VACUUM (ANALYZE) "+table)
+	}
+}
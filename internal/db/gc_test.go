@@ -0,0 +1,74 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnreachableCommits(t *testing.T) {
+	now := time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-30 * 24 * time.Hour)
+
+	// main: a ← b ← c; a force push left b' ← c' behind on top of a, and
+	// d' (recent) on top of c'
+	commits := []gcCommit{
+		{ID: "a", CommittedAt: old},
+		{ID: "b", ParentID: strPtr("a"), CommittedAt: old},
+		{ID: "b'", ParentID: strPtr("a"), CommittedAt: old},
+		{ID: "c'", ParentID: strPtr("b'"), CommittedAt: old},
+		{ID: "c", ParentID: strPtr("b"), CommittedAt: old},
+		{ID: "x", CommittedAt: old}, // unrelated root
+	}
+
+	prune, kept := unreachableCommits(commits, []string{"c", "missing"}, now.Add(-14*24*time.Hour))
+	if want := []string{"b'", "c'", "x"}; !reflect.DeepEqual(prune, want) || kept != 0 {
+		t.Fatalf("got %v (kept %d), want %v", prune, kept, want)
+	}
+
+	// A recent unreachable commit keeps its ancestors
+	commits = append(commits, gcCommit{ID: "d'", ParentID: strPtr("c'"), CommittedAt: now})
+	prune, kept = unreachableCommits(commits, []string{"c"}, now.Add(-14*24*time.Hour))
+	if want := []string{"x"}; !reflect.DeepEqual(prune, want) || kept != 3 {
+		t.Fatalf("got %v (kept %d), want %v (kept 3)", prune, kept, want)
+	}
+
+	// --prune=now
+	prune, _ = unreachableCommits(commits, []string{"c"}, now.Add(time.Hour))
+	if want := []string{"b'", "c'", "x", "d'"}; !reflect.DeepEqual(prune, want) {
+		t.Fatalf("got %v, want %v", prune, want)
+	}
+}
+
+func TestUnsharedVersionsRevertThenDivergedPull(t *testing.T) {
+	// One file in group 7. The ancestor a stored version 1, a pulled commit
+	// p changed it (version 2), and a later pulled commit r reverted it to
+	// a's content, so the transfer pointed r's file ref at version 1. The
+	// local commit l changed it again (version 3). A diverged pull then
+	// removes p, r, and l, which must leave version 1 to a.
+	refs := []versionRef{
+		{GroupID: 7, VersionID: 1, CommitID: "a"},
+		{GroupID: 7, VersionID: 2, CommitID: "p"},
+		{GroupID: 7, VersionID: 1, CommitID: "r"},
+		{GroupID: 7, VersionID: 3, CommitID: "l"},
+		{GroupID: 9, VersionID: 1, IsBinary: true, CommitID: "l"},
+		{GroupID: 9, VersionID: 1, CommitID: "a"},
+	}
+	removing := map[string]bool{"p": true, "r": true, "l": true}
+
+	got := unsharedVersions(refs, removing)
+	want := []gcVersion{
+		{GroupID: 7, VersionID: 2},
+		{GroupID: 7, VersionID: 3},
+		{GroupID: 9, VersionID: 1, IsBinary: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unsharedVersions = %v, want %v", got, want)
+	}
+
+	// Removing only p leaves version 1 to a
+	got = unsharedVersions(refs[:2], map[string]bool{"p": true})
+	if want := []gcVersion{{GroupID: 7, VersionID: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsharedVersions = %v, want %v", got, want)
+	}
+}
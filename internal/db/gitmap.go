@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Git object kinds stored in pgit_git_map
+const (
+	GitObjectCommit = "commit"
+	GitObjectBlob   = "blob"
+)
+
+// GitMapping maps a full git object SHA to its pgit counterpart.
+// Commits map to a pgit commit ULID, blobs map to the BLAKE3 content hash
+// stored in pgit_file_refs.
+type GitMapping struct {
+	GitSHA      string
+	Kind        string // GitObjectCommit or GitObjectBlob
+	CommitID    *string
+	ContentHash []byte
+	GroupID     *int32 // delta group holding the blob's content (blobs only)
+}
+
+// gitMapInsertChunk bounds the array parameter size of a single statement.
+const gitMapInsertChunk = 5000
+
+// createGitMapTable creates the git SHA mapping table. Databases from
+// before schema v8 get it from migrateV7ToV8.
+func (db *DB) createGitMapTable(ctx context.Context) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS pgit_git_map (
+		git_sha       TEXT PRIMARY KEY,
+		kind          TEXT NOT NULL,
+		commit_id     TEXT,
+		content_hash  BYTEA,
+		group_id      INTEGER
+	)`
+
+	if err := db.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create pgit_git_map: %w", err)
+	}
+
+	_ = db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_git_map_commit ON pgit_git_map(commit_id) WHERE commit_id IS NOT NULL")
+
+	return nil
+}
+
+// CreateGitMappings inserts git SHA mappings in chunks.
+// Existing SHAs are left untouched, so re-running an import (or resuming one)
+// is safe.
+func (db *DB) CreateGitMappings(ctx context.Context, mappings []GitMapping) error {
+	for start := 0; start < len(mappings); start += gitMapInsertChunk {
+		end := start + gitMapInsertChunk
+		if end > len(mappings) {
+			end = len(mappings)
+		}
+		chunk := mappings[start:end]
+
+		shas := make([]string, len(chunk))
+		kinds := make([]string, len(chunk))
+		commitIDs := make([]*string, len(chunk))
+		hashes := make([][]byte, len(chunk))
+		groupIDs := make([]*int32, len(chunk))
+		for i, m := range chunk {
+			shas[i] = m.GitSHA
+			kinds[i] = m.Kind
+			commitIDs[i] = m.CommitID
+			hashes[i] = m.ContentHash
+			groupIDs[i] = m.GroupID
+		}
+
+		err := db.Exec(ctx, `
+			INSERT INTO pgit_git_map (git_sha, kind, commit_id, content_hash, group_id)
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::bytea[], $5::int4[])
+			ON CONFLICT (git_sha) DO NOTHING`,
+			shas, kinds, commitIDs, hashes, groupIDs)
+		if err != nil {
+			return fmt.Errorf("failed to insert git mappings: %w", err)
+		}
+	}
+	return nil
+}
+
+// shaPrefixRange returns the bounds [lo, hi) of the SHAs starting with a
+// hex prefix. hi is the prefix incremented as a hex number, so both bounds
+// are hex digits, which sort the same under every collation ("ab9" → "aba",
+// "abf" → "ac"). hi is "" when nothing sorts above the prefix ("fff").
+func shaPrefixRange(prefix string) (lo, hi string) {
+	lo = strings.ToLower(prefix)
+	b := []byte(lo)
+	for i := len(b) - 1; i >= 0; i-- {
+		switch b[i] {
+		case 'f':
+			continue
+		case '9':
+			b[i] = 'a'
+		default:
+			b[i]++
+		}
+		return lo, string(b[:i+1])
+	}
+	return lo, ""
+}
+
+// FindCommitByGitSHA resolves a full or abbreviated git commit SHA to a
+// pgit commit ID. Returns "" if nothing matches, or an AmbiguousCommitError
+// (listing pgit IDs) if the prefix matches more than one commit.
+func (db *DB) FindCommitByGitSHA(ctx context.Context, shaPrefix string) (string, error) {
+	lo, hi := shaPrefixRange(shaPrefix)
+	sql := `
+	SELECT commit_id FROM pgit_git_map
+	WHERE git_sha >= $1 AND ($2 = '' OR git_sha < $2) AND kind = 'commit'
+	LIMIT 10`
+
+	rows, err := db.Query(ctx, sql, lo, hi)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var matchIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", err
+		}
+		matchIDs = append(matchIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	switch len(matchIDs) {
+	case 0:
+		return "", nil
+	case 1:
+		return matchIDs[0], nil
+	default:
+		return "", &AmbiguousCommitError{PartialID: shaPrefix, MatchIDs: matchIDs}
+	}
+}
+
+// GetGitSHA returns the git commit SHA a pgit commit was imported from,
+// or "" if the commit has no git origin.
+func (db *DB) GetGitSHA(ctx context.Context, commitID string) (string, error) {
+	var sha string
+	err := db.QueryRow(ctx,
+		"SELECT git_sha FROM pgit_git_map WHERE commit_id = $1", commitID,
+	).Scan(&sha)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// GetGitSHAs returns the git commit SHAs for a set of pgit commit IDs.
+// Commits without a git origin are absent from the returned map.
+func (db *DB) GetGitSHAs(ctx context.Context, commitIDs []string) (map[string]string, error) {
+	result := make(map[string]string, len(commitIDs))
+	if len(commitIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Query(ctx,
+		"SELECT commit_id, git_sha FROM pgit_git_map WHERE commit_id = ANY($1)", commitIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, sha string
+		if err := rows.Scan(&id, &sha); err != nil {
+			return nil, err
+		}
+		result[id] = sha
+	}
+	return result, rows.Err()
+}
+
+// GetCommitIDsByGitSHA resolves full git commit SHAs to pgit commit IDs.
+// SHAs that were never imported are absent from the returned map.
+func (db *DB) GetCommitIDsByGitSHA(ctx context.Context, shas []string) (map[string]string, error) {
+	result := make(map[string]string, len(shas))
+	if len(shas) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Query(ctx,
+		"SELECT git_sha, commit_id FROM pgit_git_map WHERE git_sha = ANY($1) AND kind = 'commit'", shas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sha, id string
+		if err := rows.Scan(&sha, &id); err != nil {
+			return nil, err
+		}
+		result[sha] = id
+	}
+	return result, rows.Err()
+}
+
+// GetBlobGroups returns the delta group_id already holding each git blob SHA.
+// Blobs that were never imported (or were recorded without a group) are
+// absent from the returned map.
+func (db *DB) GetBlobGroups(ctx context.Context, shas []string) (map[string]int32, error) {
+	result := make(map[string]int32)
+	for start := 0; start < len(shas); start += gitMapInsertChunk {
+		end := start + gitMapInsertChunk
+		if end > len(shas) {
+			end = len(shas)
+		}
+
+		rows, err := db.Query(ctx,
+			`SELECT git_sha, group_id FROM pgit_git_map
+			 WHERE git_sha = ANY($1) AND kind = 'blob' AND group_id IS NOT NULL`,
+			shas[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var sha string
+			var groupID int32
+			if err := rows.Scan(&sha, &groupID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[sha] = groupID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
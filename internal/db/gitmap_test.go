@@ -0,0 +1,72 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestShaPrefixRange(t *testing.T) {
+	tests := []struct {
+		prefix, lo, hi string
+	}{
+		{"abc1", "abc1", "abc2"},
+		{"ab9", "ab9", "aba"},
+		{"abf", "abf", "ac"},
+		{"9fff", "9fff", "a"},
+		{"ffff", "ffff", ""},
+		{"ABC", "abc", "abd"},
+	}
+	for _, tt := range tests {
+		lo, hi := shaPrefixRange(tt.prefix)
+		if lo != tt.lo || hi != tt.hi {
+			t.Errorf("shaPrefixRange(%q) = %q, %q; want %q, %q", tt.prefix, lo, hi, tt.lo, tt.hi)
+		}
+	}
+}
+
+func TestFindCommitByGitSHA(t *testing.T) {
+	ctx := t.Context()
+	database := testRepo(t)
+
+	sha := func(prefix string) string { return prefix + strings.Repeat("0", 40-len(prefix)) }
+	commits := map[string]string{
+		sha("abc123"): "C1",
+		sha("abc456"): "C2",
+		sha("ab9f"):   "C3",
+		sha("aba0"):   "C4",
+		sha("ffff"):   "C5",
+	}
+	var mappings []GitMapping
+	for s, id := range commits {
+		mappings = append(mappings, GitMapping{GitSHA: s, Kind: GitObjectCommit, CommitID: &id})
+	}
+	mappings = append(mappings, GitMapping{GitSHA: sha("dead"), Kind: GitObjectBlob, ContentHash: []byte{1}})
+	if err := database.CreateGitMappings(ctx, mappings); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefix, want string
+	}{
+		{"abc1", "C1"},             // short and unique
+		{sha("abc456"), "C2"},      // full SHA
+		{"ab9", "C3"},              // the bound after 9 is a, not ':'
+		{"ffff", "C5"},             // no upper bound
+		{"abd", ""},                // no match
+		{"dead", ""},               // blobs don't resolve as commits
+		{sha("abc123")[:39], "C1"}, // one digit short of full
+	}
+	for _, tt := range tests {
+		got, err := database.FindCommitByGitSHA(ctx, tt.prefix)
+		if err != nil || got != tt.want {
+			t.Errorf("FindCommitByGitSHA(%q) = %q, %v; want %q", tt.prefix, got, err, tt.want)
+		}
+	}
+
+	var ambiguous *AmbiguousCommitError
+	_, err := database.FindCommitByGitSHA(ctx, "abc")
+	if !errors.As(err, &ambiguous) || len(ambiguous.MatchIDs) != 2 {
+		t.Errorf("FindCommitByGitSHA(abc) = %v, want an AmbiguousCommitError with 2 matches", err)
+	}
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pushLockKey identifies the advisory lock serializing pushes. Advisory
+// locks are visible to every session on the database, so the key is tied to
+// current_schema(), the schema the pgit tables are resolved in.
+const pushLockKey = `hashtext('pgit:push:' || current_schema())`
+
+// PushLock is a held push lock. It lives on a dedicated connection, since
+// advisory locks belong to the session that took them.
+type PushLock struct {
+	conn *pgxpool.Conn
+}
+
+// TryLockPush takes the push lock without waiting. Returns nil if another
+// session holds it.
+func (db *DB) TryLockPush(ctx context.Context) (*PushLock, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock("+pushLockKey+")").Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to take push lock: %w", err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, nil
+	}
+	return &PushLock{conn: conn}, nil
+}
+
+// LockPush takes the push lock, waiting until the session holding it
+// releases it or ctx is done.
+func (db *DB) LockPush(ctx context.Context) (*PushLock, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock("+pushLockKey+")"); err != nil {
+		// A cancelled wait may leave the connection mid-query
+		_ = conn.Hijack().Close(context.Background())
+		return nil, fmt.Errorf("failed to take push lock: %w", err)
+	}
+	return &PushLock{conn: conn}, nil
+}
+
+// Unlock releases the push lock. If the unlock cannot be sent, the
+// connection is closed instead, which releases the lock server-side.
+func (l *PushLock) Unlock() {
+	ctx := context.Background()
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock("+pushLockKey+")"); err != nil {
+		_ = l.conn.Hijack().Close(ctx)
+		return
+	}
+	l.conn.Release()
+}
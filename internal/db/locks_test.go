@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connectAgain opens a second client of the same repository.
+func connectAgain(t *testing.T, database *DB) *DB {
+	t.Helper()
+	other, err := Connect(t.Context(), database.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(other.Close)
+	return other
+}
+
+func TestCompareAndSwapRefRace(t *testing.T) {
+	ctx := t.Context()
+	a := testRepo(t)
+	b := connectAgain(t, a)
+
+	if err := a.SetRef(ctx, "HEAD", "BASE"); err != nil {
+		t.Fatal(err)
+	}
+	for round := range 20 {
+		// Both pushes read the same HEAD, then move it at the same time
+		expected, err := a.GetHead(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			wg    sync.WaitGroup
+			start = make(chan struct{})
+			won   [2]bool
+			errs  [2]error
+		)
+		for i, client := range []*DB{a, b} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				won[i], errs[i] = client.CompareAndSwapRef(ctx, "HEAD", expected, fmt.Sprintf("R%d-%d", round, i))
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if errs[0] != nil || errs[1] != nil {
+			t.Fatalf("round %d: %v, %v", round, errs[0], errs[1])
+		}
+		if won[0] == won[1] {
+			t.Fatalf("round %d: swaps won = %v, want exactly one", round, won)
+		}
+		winner := 0
+		if won[1] {
+			winner = 1
+		}
+		if head, _ := a.GetHead(ctx); head != fmt.Sprintf("R%d-%d", round, winner) {
+			t.Fatalf("round %d: HEAD = %s after client %d won", round, head, winner)
+		}
+	}
+
+	// A ref that must not exist yet is created once
+	okA, errA := a.CompareAndSwapRef(ctx, "refs/heads/new", "", "X")
+	okB, errB := b.CompareAndSwapRef(ctx, "refs/heads/new", "", "Y")
+	if errA != nil || errB != nil || !okA || okB {
+		t.Errorf("creating a ref twice = %v, %v (%v, %v); want true, false", okA, okB, errA, errB)
+	}
+}
+
+func TestPushLock(t *testing.T) {
+	ctx := t.Context()
+	a := testRepo(t)
+	b := connectAgain(t, a)
+
+	lock, err := a.TryLockPush(ctx)
+	if err != nil || lock == nil {
+		t.Fatalf("TryLockPush = %v, %v", lock, err)
+	}
+	if other, err := b.TryLockPush(ctx); err != nil || other != nil {
+		t.Fatalf("TryLockPush while held = %v, %v; want nil", other, err)
+	}
+
+	// LockPush waits for the holder
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := b.LockPush(waitCtx); err == nil {
+		t.Fatal("LockPush returned while the lock was held")
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		other, err := b.LockPush(ctx)
+		if err == nil {
+			other.Unlock()
+		}
+		acquired <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	lock.Unlock()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("LockPush after unlock: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockPush did not return after the lock was released")
+	}
+}
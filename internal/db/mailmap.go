@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/imgajeed76/pgit/v4/internal/mailmap"
+	"github.com/jackc/pgx/v5"
+)
+
+// createMailmapTable creates the author identity mapping table.
+// commit_email and commit_name hold the lowercased identity as
+// recorded in commits (an empty commit_name matches any name); proper_name and
+// proper_email are the canonical values, NULL meaning "keep the original".
+func (db *DB) createMailmapTable(ctx context.Context) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS pgit_mailmap (
+		commit_email  TEXT NOT NULL,
+		commit_name   TEXT NOT NULL DEFAULT '',
+		proper_name   TEXT,
+		proper_email  TEXT,
+		PRIMARY KEY (commit_email, commit_name)
+	)`
+
+	if err := db.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create pgit_mailmap: %w", err)
+	}
+	return nil
+}
+
+// GetMailmap loads the stored identity mapping. An empty table yields an
+// empty Mailmap that resolves every identity to itself.
+func (db *DB) GetMailmap(ctx context.Context) (*mailmap.Mailmap, error) {
+	rows, err := db.Query(ctx, `
+		SELECT commit_email, commit_name, COALESCE(proper_name, ''), COALESCE(proper_email, '')
+		FROM pgit_mailmap`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []mailmap.Entry
+	for rows.Next() {
+		var e mailmap.Entry
+		if err := rows.Scan(&e.CommitEmail, &e.CommitName, &e.ProperName, &e.ProperEmail); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mailmap.New(entries), nil
+}
+
+// ReplaceMailmap replaces the stored identity mapping with m in one
+// transaction.
+func (db *DB) ReplaceMailmap(ctx context.Context, m *mailmap.Mailmap) error {
+	return db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM pgit_mailmap"); err != nil {
+			return err
+		}
+
+		entries := m.Entries()
+		if len(entries) == 0 {
+			return nil
+		}
+
+		emails := make([]string, len(entries))
+		names := make([]string, len(entries))
+		properNames := make([]*string, len(entries))
+		properEmails := make([]*string, len(entries))
+		for i, e := range entries {
+			emails[i] = strings.ToLower(e.CommitEmail)
+			names[i] = strings.ToLower(e.CommitName)
+			if e.ProperName != "" {
+				properNames[i] = &entries[i].ProperName
+			}
+			if e.ProperEmail != "" {
+				properEmails[i] = &entries[i].ProperEmail
+			}
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pgit_mailmap (commit_email, commit_name, proper_name, proper_email)
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::text[])`,
+			emails, names, properNames, properEmails)
+		return err
+	})
+}
@@ -0,0 +1,468 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MinMigratableVersion is the oldest schema version that can be migrated in
+// place. Older databases have to be re-imported.
+const MinMigratableVersion = 4
+
+// migrateLockKey identifies the advisory lock serializing migrations of one
+// repository, like pushLockKey does for pushes.
+const migrateLockKey = `hashtext('pgit:migrate:' || current_schema())`
+
+// SchemaVersionError is returned for a database whose schema version
+// differs from SchemaVersion.
+type SchemaVersionError struct {
+	Version int
+}
+
+func (e *SchemaVersionError) Error() string {
+	if e.Version > SchemaVersion {
+		return fmt.Sprintf("schema version %d is newer than this pgit supports (%d); upgrade pgit", e.Version, SchemaVersion)
+	}
+	if e.Version < MinMigratableVersion {
+		return fmt.Sprintf("schema version %d is too old to migrate (current is %d); re-import with 'pgit import --force'", e.Version, SchemaVersion)
+	}
+	return fmt.Sprintf("schema version %d is out of date (current is %d); run 'pgit migrate'", e.Version, SchemaVersion)
+}
+
+// Migratable reports whether 'pgit migrate' can bring the database up to date.
+func (e *SchemaVersionError) Migratable() bool {
+	return e.Version >= MinMigratableVersion && e.Version < SchemaVersion
+}
+
+// MigrationProgress reports progress within a migration step: done of
+// total units (commits, files, ...).
+type MigrationProgress func(done, total int)
+
+// Migration upgrades the schema from version From to From+1. Run executes
+// inside a transaction that also records the new version, so a failed
+// migration leaves the database as it was.
+type Migration struct {
+	From        int
+	Description string
+	Run         func(ctx context.Context, tx pgx.Tx, progress MigrationProgress) error
+}
+
+// migrations lists every in-place migration, oldest first. A schema bump
+// adds one here along with the new SchemaVersion.
+var migrations = []Migration{
+	{From: 4, Description: "Add seq ordering to pgit_commits", Run: migrateV4ToV5},
+	{From: 5, Description: "Add sizes and line counts to pgit_file_refs", Run: migrateV5ToV6},
+	{From: 6, Description: "Canonical tree hashes and chained commit hashes", Run: migrateV6ToV7},
+	{From: 7, Description: "Version the git SHA map, mailmap, trailer, note and numstat tables", Run: migrateV7ToV8},
+}
+
+// CheckSchemaVersion returns a *SchemaVersionError unless the database
+// schema is at SchemaVersion.
+func (db *DB) CheckSchemaVersion(ctx context.Context) error {
+	version, err := db.GetSchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if version != SchemaVersion {
+		return &SchemaVersionError{Version: version}
+	}
+	return nil
+}
+
+// PendingMigrations returns the current schema version and the migrations
+// needed to reach SchemaVersion. It returns a *SchemaVersionError if the
+// database cannot be migrated.
+func (db *DB) PendingMigrations(ctx context.Context) (int, []Migration, error) {
+	version, err := db.GetSchemaVersion(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if version == SchemaVersion {
+		return version, nil, nil
+	}
+	if version > SchemaVersion || version < MinMigratableVersion {
+		return version, nil, &SchemaVersionError{Version: version}
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.From >= version {
+			pending = append(pending, m)
+		}
+	}
+	return version, pending, nil
+}
+
+// errMigrated reports that another session ran a migration first.
+var errMigrated = errors.New("migrated concurrently")
+
+// RunMigration runs one migration in a transaction and sets the schema
+// version to m.From+1. A concurrent migration of the same database waits
+// for the first; if that one already did the step, RunMigration returns
+// (false, nil).
+func (db *DB) RunMigration(ctx context.Context, m Migration, progress MigrationProgress) (bool, error) {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	err := db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock("+migrateLockKey+")"); err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		var value string
+		if err := tx.QueryRow(ctx, "SELECT value FROM pgit_metadata WHERE key = 'schema_version'").Scan(&value); err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		if value != fmt.Sprintf("%d", m.From) {
+			return errMigrated
+		}
+
+		if err := m.Run(ctx, tx, progress); err != nil {
+			return fmt.Errorf("migration to schema version %d failed: %w", m.From+1, err)
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pgit_metadata (key, value) VALUES ('schema_version', $1)
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`,
+			fmt.Sprintf("%d", m.From+1))
+		return err
+	})
+	if err == errMigrated {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ═══════════════════════════════════════════════════════════════════════════
+// Migrations
+// ═══════════════════════════════════════════════════════════════════════════
+
+// Each migration creates tables from its own DDL, frozen at the version it
+// produces, so later schema changes don't alter what an old step does.
+
+// commitsTableV5SQL is pgit_commits as of schema v5 (and v6).
+const commitsTableV5SQL = `
+	CREATE TABLE pgit_commits (
+		id              TEXT PRIMARY KEY,
+		seq             INTEGER NOT NULL,
+		parent_id       TEXT,
+		tree_hash       TEXT NOT NULL,
+		message         TEXT NOT NULL,
+		author_name     TEXT NOT NULL,
+		author_email    TEXT NOT NULL,
+		authored_at     TIMESTAMPTZ NOT NULL,
+		committer_name  TEXT NOT NULL,
+		committer_email TEXT NOT NULL,
+		committed_at    TIMESTAMPTZ NOT NULL
+	)`
+
+// commitsTableV7SQL is pgit_commits as of schema v7.
+const commitsTableV7SQL = `
+	CREATE TABLE pgit_commits (
+		id              TEXT PRIMARY KEY,
+		seq             INTEGER NOT NULL,
+		parent_id       TEXT,
+		tree_hash       TEXT NOT NULL,
+		message         TEXT NOT NULL,
+		author_name     TEXT NOT NULL,
+		author_email    TEXT NOT NULL,
+		authored_at     TIMESTAMPTZ NOT NULL,
+		committer_name  TEXT NOT NULL,
+		committer_email TEXT NOT NULL,
+		committed_at    TIMESTAMPTZ NOT NULL,
+		commit_hash     TEXT NOT NULL
+	)`
+
+// commitsXpatchV5SQL is the xpatch configuration of pgit_commits as of
+// schema v5, unchanged through v7.
+const commitsXpatchV5SQL = `
+	SELECT xpatch.configure('pgit_commits',
+		order_by => 'seq',
+		delta_columns => ARRAY['message', 'author_name', 'author_email',
+		                       'committer_name', 'committer_email'],
+		keyframe_every => 100,
+		compress_depth => 50
+	)`
+
+// migrateV4ToV5 rebuilds pgit_commits with the seq column and the xpatch
+// order_by changed from authored_at to seq. xpatch can't change the order
+// of an existing delta chain, so the commits are copied into a new table in
+// commit graph order (the order they were stored in), then the old one is
+// dropped.
+func migrateV4ToV5(ctx context.Context, tx pgx.Tx, progress MigrationProgress) error {
+	const batchSize = 1000
+
+	// The v4 indexes carry the names the new table needs
+	for _, sql := range []string{
+		"DROP INDEX IF EXISTS idx_commits_parent",
+		"DROP INDEX IF EXISTS idx_commits_authored",
+		"ALTER TABLE pgit_commits RENAME TO pgit_commits_v4",
+		// Schema v4 predates the heap backend
+		commitsTableV5SQL + " USING xpatch",
+		commitsXpatchV5SQL,
+		`CREATE TEMP TABLE pgit_migrate_order ON COMMIT DROP AS
+		 SELECT c.id, ROW_NUMBER() OVER (ORDER BY g.seq NULLS LAST, c.authored_at, c.id)::int AS seq
+		 FROM pgit_commits_v4 c LEFT JOIN pgit_commit_graph g ON g.id = c.id`,
+		"CREATE INDEX ON pgit_migrate_order (seq)",
+	} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+
+	var total int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM pgit_migrate_order").Scan(&total); err != nil {
+		return err
+	}
+	progress(0, total)
+
+	for done := 0; done < total; done += batchSize {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pgit_commits (id, seq, parent_id, tree_hash, message, author_name, author_email,
+				authored_at, committer_name, committer_email, committed_at)
+			SELECT c.id, o.seq, c.parent_id, c.tree_hash, c.message, c.author_name, c.author_email,
+				c.authored_at, c.committer_name, c.committer_email, c.committed_at
+			FROM pgit_migrate_order o
+			JOIN pgit_commits_v4 c ON c.id = o.id
+			WHERE o.seq > $1 AND o.seq <= $2
+			ORDER BY o.seq`,
+			done, done+batchSize)
+		if err != nil {
+			return err
+		}
+		progress(min(done+batchSize, total), total)
+	}
+
+	for _, sql := range []string{
+		"DROP TABLE pgit_commits_v4",
+		"CREATE INDEX IF NOT EXISTS idx_commits_parent ON pgit_commits(parent_id)",
+		"CREATE INDEX IF NOT EXISTS idx_commits_authored ON pgit_commits(authored_at DESC)",
+	} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineCountSQL counts the lines of a text content column server-side, the
+// same way LineCount does.
+const lineCountSQL = `CASE WHEN content = '' THEN 0
+	ELSE length(content) - length(replace(content, E'\n', ''))
+		+ CASE WHEN right(content, 1) = E'\n' THEN 0 ELSE 1 END END`
+
+// migrateV5ToV6 adds size and line_count to pgit_file_refs and fills them
+// from the content tables, a batch of delta groups at a time so each chain
+// is decoded front to back once. Sizes and line counts are computed by the
+// server; no content leaves the database.
+func migrateV5ToV6(ctx context.Context, tx pgx.Tx, progress MigrationProgress) error {
+	const batchSize = 200
+
+	for _, sql := range []string{
+		"ALTER TABLE pgit_file_refs ADD COLUMN IF NOT EXISTS size BIGINT, ADD COLUMN IF NOT EXISTS line_count INTEGER",
+		"UPDATE pgit_file_refs SET size = 0, line_count = 0 WHERE content_hash IS NULL",
+	} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+
+	var groups []int32
+	rows, err := tx.Query(ctx, "SELECT DISTINCT group_id FROM pgit_paths ORDER BY group_id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	progress(0, len(groups))
+
+	for start := 0; start < len(groups); start += batchSize {
+		batch := groups[start:min(start+batchSize, len(groups))]
+		for _, sql := range []string{
+			`UPDATE pgit_file_refs r SET size = c.size, line_count = c.lines
+			 FROM pgit_paths p, (
+				SELECT group_id, version_id, octet_length(content)::bigint AS size, (` + lineCountSQL + `)::int AS lines
+				FROM pgit_text_content WHERE group_id = ANY($1)
+			 ) c
+			 WHERE p.path_id = r.path_id AND c.group_id = p.group_id AND c.version_id = r.version_id
+			   AND NOT r.is_binary AND r.content_hash IS NOT NULL`,
+			`UPDATE pgit_file_refs r SET size = c.size, line_count = NULL
+			 FROM pgit_paths p, (
+				SELECT group_id, version_id, octet_length(content)::bigint AS size
+				FROM pgit_binary_content WHERE group_id = ANY($1)
+			 ) c
+			 WHERE p.path_id = r.path_id AND c.group_id = p.group_id AND c.version_id = r.version_id
+			   AND r.is_binary AND r.content_hash IS NOT NULL`,
+		} {
+			if _, err := tx.Exec(ctx, sql, batch); err != nil {
+				return err
+			}
+		}
+		progress(start+len(batch), len(groups))
+	}
+
+	// A ref whose content is missing is fsck's to report; record it as
+	// empty rather than failing the migration.
+	for _, sql := range []string{
+		"UPDATE pgit_file_refs SET size = 0 WHERE size IS NULL",
+		"ALTER TABLE pgit_file_refs ALTER COLUMN size SET NOT NULL",
+	} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateV6ToV7 replaces every commit's tree hash with the canonical one
+// computed from its files (imported commits had an abbreviated git SHA)
+// and adds the chained commit hash. Both change every row, which xpatch
+// can't update in place, so the commits are copied into a new table in seq
+// order with their new hashes, then the old one is dropped.
+func migrateV6ToV7(ctx context.Context, tx pgx.Tx, progress MigrationProgress) error {
+	backend := BackendXpatch
+	var value string
+	err := tx.QueryRow(ctx, "SELECT value FROM pgit_metadata WHERE key = $1", MetaKeyBackend).Scan(&value)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if value == string(BackendHeap) {
+		backend = BackendHeap
+	}
+
+	commits, err := readFsckCommits(ctx, tx)
+	if err != nil {
+		return err
+	}
+	progress(0, len(commits))
+	trees, err := treeHashes(ctx, tx, commits)
+	if err != nil {
+		return fmt.Errorf("failed to compute tree hashes: %w", err)
+	}
+
+	// The v6 indexes carry the names the new table needs
+	steps := []string{
+		"DROP INDEX IF EXISTS idx_commits_parent",
+		"DROP INDEX IF EXISTS idx_commits_authored",
+		"DROP INDEX IF EXISTS idx_commits_seq",
+		"ALTER TABLE pgit_commits RENAME TO pgit_commits_v6",
+	}
+	if backend == BackendHeap {
+		steps = append(steps, commitsTableV7SQL, "CREATE UNIQUE INDEX idx_commits_seq ON pgit_commits(seq)")
+	} else {
+		steps = append(steps, commitsTableV7SQL+" USING xpatch", commitsXpatchV5SQL)
+	}
+	for _, sql := range steps {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+	if backend == BackendHeap {
+		// As in createCommitsTable, lz4 is optional; a savepoint keeps a
+		// server without it from aborting the migration
+		if _, err := tx.Exec(ctx, "SAVEPOINT pgit_lz4"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "ALTER TABLE pgit_commits ALTER COLUMN message SET COMPRESSION lz4"); err != nil {
+			if _, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT pgit_lz4"); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = rehashCommits(ctx, tx, "pgit_commits_v6", trees, make(map[string]string, len(commits)), func(done int) {
+		progress(done, len(commits))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sql := range []string{
+		"DROP TABLE pgit_commits_v6",
+		"CREATE INDEX IF NOT EXISTS idx_commits_parent ON pgit_commits(parent_id)",
+		"CREATE INDEX IF NOT EXISTS idx_commits_authored ON pgit_commits(authored_at DESC)",
+	} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateV7ToV8 versions the side tables older pgit created on every
+// connect. Each was created with IF NOT EXISTS, and some gained columns
+// later, so a database may have any of them in any earlier shape: the
+// tables are created if missing and the later columns added if missing.
+func migrateV7ToV8(ctx context.Context, tx pgx.Tx, progress MigrationProgress) error {
+	steps := []string{
+		`CREATE TABLE IF NOT EXISTS pgit_git_map (
+			git_sha       TEXT PRIMARY KEY,
+			kind          TEXT NOT NULL,
+			commit_id     TEXT,
+			content_hash  BYTEA,
+			group_id      INTEGER
+		)`,
+		"ALTER TABLE pgit_git_map ADD COLUMN IF NOT EXISTS group_id INTEGER",
+		"CREATE INDEX IF NOT EXISTS idx_git_map_commit ON pgit_git_map(commit_id) WHERE commit_id IS NOT NULL",
+		`CREATE TABLE IF NOT EXISTS pgit_mailmap (
+			commit_email  TEXT NOT NULL,
+			commit_name   TEXT NOT NULL DEFAULT '',
+			proper_name   TEXT,
+			proper_email  TEXT,
+			PRIMARY KEY (commit_email, commit_name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS pgit_commit_trailers (
+			commit_id  TEXT NOT NULL,
+			key        TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			PRIMARY KEY (commit_id, key, value)
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_commit_trailers_key ON pgit_commit_trailers(key)",
+		`CREATE TABLE IF NOT EXISTS pgit_notes (
+			commit_id   TEXT NOT NULL,
+			namespace   TEXT NOT NULL DEFAULT 'commits',
+			body        TEXT NOT NULL,
+			author      TEXT NOT NULL,
+			created_at  TIMESTAMPTZ NOT NULL,
+			deleted_at  TIMESTAMPTZ,
+			PRIMARY KEY (commit_id, namespace)
+		)`,
+		"ALTER TABLE pgit_notes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ",
+		`CREATE TABLE IF NOT EXISTS pgit_file_changes (
+			commit_id  TEXT NOT NULL,
+			path_id    INTEGER NOT NULL,
+			added      INTEGER,
+			removed    INTEGER,
+			PRIMARY KEY (commit_id, path_id)
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_file_changes_path ON pgit_file_changes(path_id)",
+		`ALTER TABLE pgit_sync_state
+			ADD COLUMN IF NOT EXISTS transfer_direction  TEXT,
+			ADD COLUMN IF NOT EXISTS transfer_base       TEXT,
+			ADD COLUMN IF NOT EXISTS transfer_target     TEXT,
+			ADD COLUMN IF NOT EXISTS transfer_last       TEXT,
+			ADD COLUMN IF NOT EXISTS transfer_done       INTEGER,
+			ADD COLUMN IF NOT EXISTS transfer_total      INTEGER,
+			ADD COLUMN IF NOT EXISTS transfer_started_at TIMESTAMPTZ`,
+	}
+	progress(0, len(steps))
+	for i, sql := range steps {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+		progress(i+1, len(steps))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestMigrationsReachSchemaVersion(t *testing.T) {
+	want := MinMigratableVersion
+	for _, m := range migrations {
+		if m.From != want {
+			t.Fatalf("migration %q starts at version %d, want %d", m.Description, m.From, want)
+		}
+		if m.Run == nil || m.Description == "" {
+			t.Fatalf("migration from version %d is incomplete", m.From)
+		}
+		want++
+	}
+	if want != SchemaVersion {
+		t.Fatalf("migrations end at version %d, SchemaVersion is %d", want, SchemaVersion)
+	}
+}
+
+func TestSchemaVersionError(t *testing.T) {
+	tests := []struct {
+		version    int
+		migratable bool
+	}{
+		{1, false},
+		{MinMigratableVersion - 1, false},
+		{MinMigratableVersion, true},
+		{SchemaVersion - 1, true},
+		{SchemaVersion + 1, false},
+	}
+	for _, tt := range tests {
+		e := &SchemaVersionError{Version: tt.version}
+		if e.Migratable() != tt.migratable {
+			t.Errorf("version %d: Migratable() = %v, want %v", tt.version, e.Migratable(), tt.migratable)
+		}
+	}
+}
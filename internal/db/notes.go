@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultNotesNamespace is the namespace used when none is given,
+// matching git's refs/notes/commits.
+const DefaultNotesNamespace = "commits"
+
+// Note is a piece of text attached to an existing commit after the fact
+// (CI results, deploy markers, review links). A commit has at most one
+// note per namespace.
+//
+// Removing a note keeps its row as a tombstone (DeletedAt set), so that
+// syncing with a database that still has the note doesn't bring it back.
+type Note struct {
+	CommitID  string
+	Namespace string
+	Body      string
+	Author    string // "Name <email>"
+	CreatedAt time.Time
+	DeletedAt *time.Time // nil unless the note was removed
+}
+
+// ChangedAt is when the note was last written or removed.
+func (n *Note) ChangedAt() time.Time {
+	if n.DeletedAt != nil && n.DeletedAt.After(n.CreatedAt) {
+		return *n.DeletedAt
+	}
+	return n.CreatedAt
+}
+
+type noteKey struct {
+	commitID  string
+	namespace string
+}
+
+// notesToMerge returns the incoming notes (and tombstones) that replace
+// what existing holds for the same commit and namespace: those changed
+// later, and those existing has no row for.
+func notesToMerge(existing map[noteKey]*Note, incoming []*Note) []*Note {
+	var result []*Note
+	for _, n := range incoming {
+		cur, ok := existing[noteKey{n.CommitID, n.Namespace}]
+		if !ok || n.ChangedAt().After(cur.ChangedAt()) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// createNotesTable creates the commit notes table.
+func (db *DB) createNotesTable(ctx context.Context) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS pgit_notes (
+		commit_id   TEXT NOT NULL,
+		namespace   TEXT NOT NULL DEFAULT 'commits',
+		body        TEXT NOT NULL,
+		author      TEXT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL,
+		deleted_at  TIMESTAMPTZ,
+		PRIMARY KEY (commit_id, namespace)
+	)`
+
+	if err := db.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create pgit_notes: %w", err)
+	}
+	return nil
+}
+
+// SetNote stores n, replacing any note (or tombstone) in the same namespace
+// on the commit.
+func (db *DB) SetNote(ctx context.Context, n *Note) error {
+	sql := `
+	INSERT INTO pgit_notes (commit_id, namespace, body, author, created_at, deleted_at)
+	VALUES ($1, $2, $3, $4, $5, NULL)
+	ON CONFLICT (commit_id, namespace) DO UPDATE
+	SET body = EXCLUDED.body, author = EXCLUDED.author, created_at = EXCLUDED.created_at,
+	    deleted_at = NULL`
+
+	return db.Exec(ctx, sql, n.CommitID, n.Namespace, n.Body, n.Author, n.CreatedAt)
+}
+
+// GetNote returns the note on a commit in namespace, or nil if there is none.
+func (db *DB) GetNote(ctx context.Context, commitID, namespace string) (*Note, error) {
+	n := &Note{}
+	err := db.QueryRow(ctx, `
+		SELECT commit_id, namespace, body, author, created_at
+		FROM pgit_notes WHERE commit_id = $1 AND namespace = $2 AND deleted_at IS NULL`,
+		commitID, namespace,
+	).Scan(&n.CommitID, &n.Namespace, &n.Body, &n.Author, &n.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// GetNotes returns the notes of every namespace attached to the given
+// commits, keyed by commit ID. Each commit's notes are ordered by namespace,
+// with the default namespace first.
+func (db *DB) GetNotes(ctx context.Context, commitIDs []string) (map[string][]*Note, error) {
+	result := make(map[string][]*Note)
+	if len(commitIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT commit_id, namespace, body, author, created_at
+		FROM pgit_notes
+		WHERE commit_id = ANY($1) AND deleted_at IS NULL
+		ORDER BY namespace <> $2, namespace`,
+		commitIDs, DefaultNotesNamespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n := &Note{}
+		if err := rows.Scan(&n.CommitID, &n.Namespace, &n.Body, &n.Author, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		result[n.CommitID] = append(result[n.CommitID], n)
+	}
+	return result, rows.Err()
+}
+
+// ListNotes returns the notes in namespace, newest first. An empty
+// namespace lists all of them.
+func (db *DB) ListNotes(ctx context.Context, namespace string) ([]*Note, error) {
+	rows, err := db.Query(ctx, `
+		SELECT commit_id, namespace, body, author, created_at
+		FROM pgit_notes
+		WHERE ($1 = '' OR namespace = $1) AND deleted_at IS NULL
+		ORDER BY created_at DESC, commit_id DESC`,
+		namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*Note
+	for rows.Next() {
+		n := &Note{}
+		if err := rows.Scan(&n.CommitID, &n.Namespace, &n.Body, &n.Author, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// DeleteNote removes the note on a commit in namespace, leaving a tombstone
+// dated at that removes the note from other databases on the next sync.
+// Returns false if there was none.
+func (db *DB) DeleteNote(ctx context.Context, commitID, namespace string, at time.Time) (bool, error) {
+	tag, err := db.pool.Exec(ctx,
+		"UPDATE pgit_notes SET deleted_at = $3 WHERE commit_id = $1 AND namespace = $2 AND deleted_at IS NULL",
+		commitID, namespace, at)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SyncNotes returns every note for syncing to another database, including
+// the tombstones of removed notes.
+func (db *DB) SyncNotes(ctx context.Context) ([]*Note, error) {
+	rows, err := db.Query(ctx, `
+		SELECT commit_id, namespace, body, author, created_at, deleted_at
+		FROM pgit_notes`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*Note
+	for rows.Next() {
+		n := &Note{}
+		if err := rows.Scan(&n.CommitID, &n.Namespace, &n.Body, &n.Author, &n.CreatedAt, &n.DeletedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// MergeNotes copies notes and tombstones (from SyncNotes) from another
+// database. One replaces what is stored for the same commit and namespace
+// only if it changed later, so a removal wins over the older note and a
+// note added again after a removal wins over the tombstone. Notes on
+// commits this database doesn't have are skipped. Returns the number of
+// notes added, updated, or removed.
+func (db *DB) MergeNotes(ctx context.Context, notes []*Note) (int, error) {
+	if len(notes) == 0 {
+		return 0, nil
+	}
+
+	existing, err := db.SyncNotes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read notes: %w", err)
+	}
+	stored := make(map[noteKey]*Note, len(existing))
+	for _, n := range existing {
+		stored[noteKey{n.CommitID, n.Namespace}] = n
+	}
+	notes = notesToMerge(stored, notes)
+	if len(notes) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(notes))
+	namespaces := make([]string, len(notes))
+	bodies := make([]string, len(notes))
+	authors := make([]string, len(notes))
+	times := make([]time.Time, len(notes))
+	deleted := make([]*time.Time, len(notes))
+	for i, n := range notes {
+		ids[i] = n.CommitID
+		namespaces[i] = n.Namespace
+		bodies[i] = n.Body
+		authors[i] = n.Author
+		times[i] = n.CreatedAt
+		deleted[i] = n.DeletedAt
+	}
+
+	sql := `
+	INSERT INTO pgit_notes (commit_id, namespace, body, author, created_at, deleted_at)
+	SELECT u.commit_id, u.namespace, u.body, u.author, u.created_at, u.deleted_at
+	FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[], $6::timestamptz[])
+		AS u(commit_id, namespace, body, author, created_at, deleted_at)
+	WHERE EXISTS (SELECT 1 FROM pgit_commits c WHERE c.id = u.commit_id)
+	ON CONFLICT (commit_id, namespace) DO UPDATE
+	SET body = EXCLUDED.body, author = EXCLUDED.author, created_at = EXCLUDED.created_at,
+	    deleted_at = EXCLUDED.deleted_at`
+
+	tag, err := db.pool.Exec(ctx, sql, ids, namespaces, bodies, authors, times, deleted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge notes: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
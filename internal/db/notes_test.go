@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotesToMerge(t *testing.T) {
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+	removedAt := func(minutes int) *time.Time { tm := at(minutes); return &tm }
+	note := func(body string, created int) *Note {
+		return &Note{CommitID: "01A", Namespace: DefaultNotesNamespace, Body: body, CreatedAt: at(created)}
+	}
+	tombstone := func(created, removed int) *Note {
+		n := note("old", created)
+		n.DeletedAt = removedAt(removed)
+		return n
+	}
+
+	tests := []struct {
+		name     string
+		existing *Note // nil: no row for the commit yet
+		incoming *Note
+		want     bool // incoming replaces existing
+	}{
+		{"new note", nil, note("a", 0), true},
+		{"newer note wins", note("a", 0), note("b", 5), true},
+		{"older note loses", note("a", 5), note("b", 0), false},
+		{"same note again", note("a", 0), note("a", 0), false},
+		{"removal reaches a copy", note("a", 0), tombstone(0, 10), true},
+		{"removal is not undone by the old copy", tombstone(0, 10), note("a", 0), false},
+		{"note written again after removal", tombstone(0, 10), note("b", 20), true},
+		{"removal older than the new note", note("b", 20), tombstone(0, 10), false},
+		{"tombstone for a note never seen", nil, tombstone(0, 10), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := map[noteKey]*Note{}
+			if tt.existing != nil {
+				existing[noteKey{tt.existing.CommitID, tt.existing.Namespace}] = tt.existing
+			}
+			got := notesToMerge(existing, []*Note{tt.incoming})
+			if (len(got) == 1) != tt.want {
+				t.Errorf("notesToMerge replaced = %v, want %v", len(got) == 1, tt.want)
+			}
+		})
+	}
+
+	// Namespaces are merged independently
+	existing := map[noteKey]*Note{{"01A", "ci"}: tombstone(0, 10)}
+	if got := notesToMerge(existing, []*Note{note("a", 0)}); len(got) != 1 {
+		t.Errorf("note in the default namespace blocked by a tombstone in another")
+	}
+}
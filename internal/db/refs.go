@@ -12,6 +12,15 @@ type Ref struct {
 	CommitID string
 }
 
+// DefaultBranch is the name of the branch HEAD is on.
+const DefaultBranch = "main"
+
+// RemoteTrackingRef returns the ref recording where a remote's branch was
+// at the last fetch, push or pull: refs/remotes/<remote>/main.
+func RemoteTrackingRef(remoteName string) string {
+	return "refs/remotes/" + remoteName + "/" + DefaultBranch
+}
+
 // GetRef retrieves a ref by name
 func (db *DB) GetRef(ctx context.Context, name string) (*Ref, error) {
 	sql := `SELECT name, commit_id FROM pgit_refs WHERE name = $1`
@@ -36,6 +45,55 @@ func (db *DB) SetRef(ctx context.Context, name, commitID string) error {
 	return db.Exec(ctx, sql, name, commitID)
 }
 
+// CompareAndSwapRef points a ref at newID only if it still points at
+// expected (an empty expected means the ref must not exist yet). Returns
+// false, changing nothing, if the ref was moved by someone else.
+func (db *DB) CompareAndSwapRef(ctx context.Context, name, expected, newID string) (bool, error) {
+	var sql string
+	args := []any{name, newID}
+	if expected == "" {
+		sql = `INSERT INTO pgit_refs (name, commit_id) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING`
+	} else {
+		sql = `UPDATE pgit_refs SET commit_id = $2 WHERE name = $1 AND commit_id = $3`
+		args = append(args, expected)
+	}
+
+	tag, err := db.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// LockRefTx reads a ref within a transaction and locks its row until the
+// transaction ends, so it cannot move underneath the transaction. Returns
+// "" if the ref doesn't exist.
+func (db *DB) LockRefTx(ctx context.Context, tx pgx.Tx, name string) (string, error) {
+	var commitID string
+	err := tx.QueryRow(ctx, "SELECT commit_id FROM pgit_refs WHERE name = $1 FOR UPDATE", name).Scan(&commitID)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return commitID, err
+}
+
+// ResolveRefName resolves a branch, tag or remote-tracking name to a commit
+// ID, trying the name as given, then refs/heads/<name>, refs/tags/<name>
+// and refs/remotes/<name> (so "origin/main" works). Returns "" if no ref
+// matches.
+func (db *DB) ResolveRefName(ctx context.Context, name string) (string, error) {
+	for _, candidate := range []string{name, "refs/heads/" + name, "refs/tags/" + name, "refs/remotes/" + name} {
+		ref, err := db.GetRef(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if ref != nil {
+			return ref.CommitID, nil
+		}
+	}
+	return "", nil
+}
+
 // DeleteRef deletes a ref
 func (db *DB) DeleteRef(ctx context.Context, name string) error {
 	return db.Exec(ctx, "DELETE FROM pgit_refs WHERE name = $1", name)
@@ -43,9 +101,15 @@ func (db *DB) DeleteRef(ctx context.Context, name string) error {
 
 // GetAllRefs retrieves all refs
 func (db *DB) GetAllRefs(ctx context.Context) ([]*Ref, error) {
-	sql := `SELECT name, commit_id FROM pgit_refs ORDER BY name`
+	return db.GetRefsByPrefix(ctx, "")
+}
+
+// GetRefsByPrefix retrieves the refs whose name starts with prefix
+// (e.g. "refs/remotes/"), ordered by name.
+func (db *DB) GetRefsByPrefix(ctx context.Context, prefix string) ([]*Ref, error) {
+	sql := `SELECT name, commit_id FROM pgit_refs WHERE starts_with(name, $1) ORDER BY name`
 
-	rows, err := db.Query(ctx, sql)
+	rows, err := db.Query(ctx, sql, prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RepoInfo describes one pgit repository in a shared database.
+type RepoInfo struct {
+	Name    string // schema name; "public" holds the repository without ?pgit_repo=
+	Commits int64
+	Version int // schema version, 0 if unknown
+}
+
+// ListRepos returns the pgit repositories in the database: every schema
+// that has a pgit_commits table, in name order.
+func (db *DB) ListRepos(ctx context.Context) ([]RepoInfo, error) {
+	rows, err := db.Query(ctx, `
+		SELECT table_schema FROM information_schema.tables
+		WHERE table_name = 'pgit_commits'
+		ORDER BY table_schema`)
+	if err != nil {
+		return nil, err
+	}
+	var repos []RepoInfo
+	for rows.Next() {
+		var info RepoInfo
+		if err := rows.Scan(&info.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		repos = append(repos, info)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Best effort: a repository from an older pgit may lack its metadata
+	for i := range repos {
+		schema := pgx.Identifier{repos[i].Name}.Sanitize()
+		var version string
+		backend := BackendXpatch
+		rows, err := db.Query(ctx,
+			"SELECT key, value FROM "+schema+".pgit_metadata WHERE key IN ('schema_version', $1)", MetaKeyBackend)
+		if err == nil {
+			for rows.Next() {
+				var key, value string
+				if rows.Scan(&key, &value) != nil {
+					break
+				}
+				if key == MetaKeyBackend {
+					backend = Backend(value)
+				} else {
+					version = value
+				}
+			}
+			rows.Close()
+		}
+		_, _ = fmt.Sscanf(version, "%d", &repos[i].Version)
+
+		// xpatch.stats() only knows xpatch tables
+		if backend == BackendHeap {
+			_ = db.QueryRow(ctx, "SELECT COUNT(*) FROM "+schema+".pgit_commits").Scan(&repos[i].Commits)
+		} else {
+			_ = db.QueryRow(ctx, "SELECT total_rows FROM xpatch.stats($1)",
+				schema+".pgit_commits").Scan(&repos[i].Commits)
+		}
+	}
+	return repos, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Retry policy for transfers over unreliable links: 5 attempts, waiting
+// 1s, 2s, 4s, 8s in between (capped at 30s).
+const retryAttempts = 5
+
+var (
+	retryBaseWait = time.Second
+	retryMaxWait  = 30 * time.Second
+)
+
+// retryWait is the wait after the given failed attempt (1-based).
+func retryWait(attempt int) time.Duration {
+	wait := retryBaseWait
+	for i := 1; i < attempt && wait < retryMaxWait; i++ {
+		wait *= 2
+	}
+	return min(wait, retryMaxWait)
+}
+
+// IsTransient reports whether err is worth retrying: the connection was
+// lost or refused, or the server aborted the work for reasons unrelated to
+// the statement itself (serialization failure, deadlock, shutdown).
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"): // connection_exception
+			return true
+		case pgErr.Code == "40001", pgErr.Code == "40P01": // serialization_failure, deadlock_detected
+			return true
+		case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03": // server shutting down or starting
+			return true
+		case pgErr.Code == "53300": // too_many_connections
+			return true
+		}
+		return false
+	}
+
+	if pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// Retry runs fn until it succeeds, fails with a non-transient error, or the
+// attempts run out, backing off exponentially between attempts. onRetry, if
+// not nil, is called before each wait. fn must be safe to run again, e.g. a
+// single transaction.
+func Retry(ctx context.Context, onRetry func(attempt int, err error), fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == retryAttempts || !IsTransient(err) {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryWait(attempt)):
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("copy: %w", context.DeadlineExceeded), false},
+		{"connection exception", &pgconn.PgError{Code: "08006"}, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"syntax error", fmt.Errorf("query: %w", &pgconn.PgError{Code: "42601"}), false},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"connection reset", fmt.Errorf("write: %w", syscall.ECONNRESET), true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"network error", &net.OpError{Op: "read", Err: errors.New("i/o timeout")}, true},
+		{"plain error", errors.New("commit not found"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, w := range want {
+		if got := retryWait(i + 1); got != w {
+			t.Errorf("retryWait(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(base time.Duration) { retryBaseWait = base }(retryBaseWait)
+	retryBaseWait = time.Millisecond
+
+	transient := &pgconn.PgError{Code: "40001"}
+
+	tests := []struct {
+		name      string
+		failures  []error // errors returned by the first calls, then success
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", nil, 1, nil},
+		{"transient then success", []error{transient, transient}, 3, nil},
+		{"permanent error", []error{errors.New("bad query")}, 1, nil},
+		{"attempts exhausted", []error{transient, transient, transient, transient, transient, transient}, retryAttempts, transient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var retried []int
+			err := Retry(t.Context(), func(attempt int, err error) {
+				retried = append(retried, attempt)
+			}, func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("fn called %d times, want %d", calls, tt.wantCalls)
+			}
+			if len(retried) != calls-1 {
+				t.Errorf("onRetry called %d times for %d calls", len(retried), calls)
+			}
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("Retry() = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && calls > len(tt.failures) && err != nil:
+				t.Errorf("Retry() = %v, want success", err)
+			case tt.wantErr == nil && calls <= len(tt.failures) && err != tt.failures[calls-1]:
+				t.Errorf("Retry() = %v, want %v", err, tt.failures[calls-1])
+			}
+		})
+	}
+
+	// A canceled context stops waiting and returns the last error
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	retryBaseWait = time.Hour
+	calls := 0
+	err := Retry(ctx, nil, func() error { calls++; return transient })
+	if calls != 1 || !errors.Is(err, transient) {
+		t.Errorf("Retry with canceled context: %d calls, err %v", calls, err)
+	}
+}
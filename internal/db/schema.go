@@ -9,7 +9,18 @@ import (
 )
 
 // SchemaVersion is the current schema version.
-// Version 5 introduces:
+// Version 8 introduces:
+// - pgit_git_map, pgit_mailmap, pgit_commit_trailers, pgit_notes, pgit_file_changes
+// - transfer progress columns on pgit_sync_state (older pgit added both on connect)
+//
+// Version 7 introduced:
+// - canonical Merkle tree hashes for every commit, imported ones included
+// - commit_hash column on pgit_commits (chained over the parent's hash)
+//
+// Version 6 introduced:
+// - size and line_count columns on pgit_file_refs (read by analyze size)
+//
+// Version 5 introduced:
 // - seq INTEGER NOT NULL column on pgit_commits for deterministic xpatch ordering
 // - xpatch order_by changed from 'authored_at' to 'seq' (fixes non-monotonic timestamps)
 // - All analyze queries use ORDER BY seq ASC for optimal delta chain access
@@ -20,7 +31,7 @@ import (
 // - group_id remains for delta compression grouping in content tables
 // - compress_depth increased to 10 for better deduplication
 // - Removed reset and resolve commands (v4 is append-only)
-const SchemaVersion = 5
+const SchemaVersion = 8
 
 // InitSchema creates the pgit schema in the database
 func (db *DB) InitSchema(ctx context.Context) error {
@@ -37,27 +48,47 @@ func (db *DB) InitSchema(ctx context.Context) error {
 			return fmt.Errorf("failed to get schema version: %w", err)
 		}
 
-		if version < SchemaVersion {
-			return fmt.Errorf("schema version %d detected (current is %d).\n\n"+
-				"The database schema has changed. Please re-import your repository:\n"+
-				"  pgit import --force /path/to/git/repo\n\n"+
-				"This will recreate the database with the new optimized schema.",
-				version, SchemaVersion)
+		if version != SchemaVersion {
+			return &SchemaVersionError{Version: version}
 		}
 
 		// Schema is up to date, nothing to do
 		return nil
 	}
 
-	// Create extension first
-	if err := db.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_xpatch"); err != nil {
-		return fmt.Errorf("failed to create pg_xpatch extension: %w", err)
+	// A repository selected with ?pgit_repo= lives in its own schema
+	if db.schema != "" {
+		if err := db.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{db.schema}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to create schema %s: %w", db.schema, err)
+		}
+	}
+
+	backend, err := db.chooseBackend(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Create extension first, in public like pg_trgm (see CreateSearchIndex):
+	// without a SCHEMA clause it would land in the first schema of the
+	// search_path, which is this repository's, and dropping the repository
+	// would take it from every other one. An extension that fixes its own
+	// schema rejects the clause and is created where it wants.
+	if backend == BackendXpatch {
+		if err := db.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_xpatch SCHEMA public"); err != nil {
+			if err := db.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_xpatch"); err != nil {
+				return fmt.Errorf("failed to create pg_xpatch extension: %w", err)
+			}
+		}
 	}
+	db.UseBackend(backend)
 
 	// Create tables in order (respecting dependencies)
 	if err := db.createMetadataTable(ctx); err != nil {
 		return err
 	}
+	if err := db.SetMetadata(ctx, MetaKeyBackend, string(backend)); err != nil {
+		return err
+	}
 	if err := db.createCommitsTable(ctx); err != nil {
 		return err
 	}
@@ -82,12 +113,32 @@ func (db *DB) InitSchema(ctx context.Context) error {
 	if err := db.createCommitGraphTable(ctx); err != nil {
 		return err
 	}
+	if err := db.createGitMapTable(ctx); err != nil {
+		return err
+	}
+	if err := db.createMailmapTable(ctx); err != nil {
+		return err
+	}
+	if err := db.createCommitTrailersTable(ctx); err != nil {
+		return err
+	}
+	if err := db.createNotesTable(ctx); err != nil {
+		return err
+	}
+	if err := db.createFileChangesTable(ctx); err != nil {
+		return err
+	}
 
 	// Set schema version
 	if err := db.SetSchemaVersion(ctx, SchemaVersion); err != nil {
 		return fmt.Errorf("failed to set schema version: %w", err)
 	}
 
+	// A fresh database records trailers for every commit as it is inserted
+	if err := db.SetMetadata(ctx, trailersIndexedKey, "1"); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -105,9 +156,10 @@ func (db *DB) createMetadataTable(ctx context.Context) error {
 	return nil
 }
 
-func (db *DB) createCommitsTable(ctx context.Context) error {
-	// Create table with committer fields and seq for xpatch ordering
-	sql := `
+// commitsTableSQL creates pgit_commits, with committer fields, seq for
+// xpatch ordering and the chained commit hash (see Commit.ComputeHash).
+// The access method (see accessMethod) is appended.
+const commitsTableSQL = `
 	CREATE TABLE IF NOT EXISTS pgit_commits (
 		id              TEXT PRIMARY KEY,
 		seq             INTEGER NOT NULL,
@@ -119,15 +171,12 @@ func (db *DB) createCommitsTable(ctx context.Context) error {
 		authored_at     TIMESTAMPTZ NOT NULL,
 		committer_name  TEXT NOT NULL,
 		committer_email TEXT NOT NULL,
-		committed_at    TIMESTAMPTZ NOT NULL
-	) USING xpatch`
-
-	if err := db.Exec(ctx, sql); err != nil {
-		return fmt.Errorf("failed to create pgit_commits: %w", err)
-	}
+		committed_at    TIMESTAMPTZ NOT NULL,
+		commit_hash     TEXT NOT NULL
+	)`
 
-	// Configure xpatch
-	configSQL := `
+// commitsXpatchSQL configures delta compression for pgit_commits.
+const commitsXpatchSQL = `
 	SELECT xpatch.configure('pgit_commits',
 		order_by => 'seq',
 		delta_columns => ARRAY['message', 'author_name', 'author_email',
@@ -136,8 +185,20 @@ func (db *DB) createCommitsTable(ctx context.Context) error {
 		compress_depth => 50
 	)`
 
-	// Ignore error if already configured
-	_ = db.Exec(ctx, configSQL)
+func (db *DB) createCommitsTable(ctx context.Context) error {
+	backend := db.Backend(ctx)
+	if err := db.Exec(ctx, commitsTableSQL+accessMethod(backend)); err != nil {
+		return fmt.Errorf("failed to create pgit_commits: %w", err)
+	}
+
+	if backend == BackendHeap {
+		// xpatch keeps the chain in seq order; a heap table needs an index
+		_ = db.Exec(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS idx_commits_seq ON pgit_commits(seq)")
+		db.compressHeapContent(ctx, "pgit_commits", "message")
+	} else {
+		// Ignore error if already configured
+		_ = db.Exec(ctx, commitsXpatchSQL)
+	}
 
 	// Create indexes
 	_ = db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_commits_parent ON pgit_commits(parent_id)")
@@ -179,6 +240,8 @@ func (db *DB) createFileRefsTable(ctx context.Context) error {
 		is_symlink      BOOLEAN NOT NULL DEFAULT FALSE,
 		symlink_target  TEXT,
 		is_binary       BOOLEAN NOT NULL DEFAULT FALSE,
+		size            BIGINT NOT NULL,
+		line_count      INTEGER,
 		PRIMARY KEY (path_id, commit_id)
 	)`
 
@@ -200,11 +263,15 @@ func (db *DB) createTextContentTable(ctx context.Context) error {
 		version_id  INTEGER NOT NULL,
 		content     TEXT NOT NULL DEFAULT '',
 		PRIMARY KEY (group_id, version_id)
-	) USING xpatch`
+	)` + accessMethod(db.Backend(ctx))
 
 	if err := db.Exec(ctx, sql); err != nil {
 		return fmt.Errorf("failed to create pgit_text_content: %w", err)
 	}
+	if db.Backend(ctx) == BackendHeap {
+		db.compressHeapContent(ctx, "pgit_text_content", "content")
+		return nil
+	}
 
 	configSQL := `
 	SELECT xpatch.configure('pgit_text_content',
@@ -228,11 +295,15 @@ func (db *DB) createBinaryContentTable(ctx context.Context) error {
 		version_id  INTEGER NOT NULL,
 		content     BYTEA NOT NULL DEFAULT ''::bytea,
 		PRIMARY KEY (group_id, version_id)
-	) USING xpatch`
+	)` + accessMethod(db.Backend(ctx))
 
 	if err := db.Exec(ctx, sql); err != nil {
 		return fmt.Errorf("failed to create pgit_binary_content: %w", err)
 	}
+	if db.Backend(ctx) == BackendHeap {
+		db.compressHeapContent(ctx, "pgit_binary_content", "content")
+		return nil
+	}
 
 	configSQL := `
 	SELECT xpatch.configure('pgit_binary_content',
@@ -265,9 +336,16 @@ func (db *DB) createRefsTable(ctx context.Context) error {
 func (db *DB) createSyncStateTable(ctx context.Context) error {
 	sql := `
 	CREATE TABLE IF NOT EXISTS pgit_sync_state (
-		remote_name     TEXT PRIMARY KEY,
-		last_commit_id  TEXT,
-		synced_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		remote_name         TEXT PRIMARY KEY,
+		last_commit_id      TEXT,
+		synced_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		transfer_direction  TEXT,
+		transfer_base       TEXT,
+		transfer_target     TEXT,
+		transfer_last       TEXT,
+		transfer_done       INTEGER,
+		transfer_total      INTEGER,
+		transfer_started_at TIMESTAMPTZ
 	)`
 
 	if err := db.Exec(ctx, sql); err != nil {
@@ -455,13 +533,14 @@ func (db *DB) CreateBlobPhaseIndexes(ctx context.Context) error {
 	return g.Wait()
 }
 
-// SchemaExists checks if the pgit schema exists
+// SchemaExists checks if the pgit schema exists in the repository's
+// PostgreSQL schema (see RepoParam)
 func (db *DB) SchemaExists(ctx context.Context) (bool, error) {
 	var exists bool
 	err := db.QueryRow(ctx, `
 		SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_name = 'pgit_commits'
+			SELECT FROM information_schema.tables
+			WHERE table_name = 'pgit_commits' AND table_schema = current_schema()
 		)
 	`).Scan(&exists)
 	return exists, err
@@ -513,6 +592,12 @@ func (db *DB) DropSchema(ctx context.Context) error {
 		"pgit_file_refs",
 		"pgit_paths",
 		"pgit_commit_graph",
+		"pgit_git_map",
+		"pgit_mailmap",
+		"pgit_commit_trailers",
+		"pgit_notes",
+		"pgit_search_index",
+		"pgit_file_changes",
 		"pgit_commits",
 		// Legacy table from schema v1 (may not exist)
 		"pgit_blobs",
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MetaKeySearchIndexCommit records the commit pgit_search_index reflects.
+// Rewrites that change content without moving HEAD delete it, so the next
+// update compares the whole tree again.
+const MetaKeySearchIndexCommit = "search_index_commit"
+
+// searchIndexBatchSize is how many files are fetched and written at a time.
+const searchIndexBatchSize = 500
+
+// SearchIndexUpdate counts what UpdateSearchIndex changed.
+type SearchIndexUpdate struct {
+	Added   int
+	Updated int
+	Removed int
+}
+
+// searchIndexEntry is a text file of the tree being indexed.
+type searchIndexEntry struct {
+	Path        string
+	CommitID    string
+	GroupID     int32
+	VersionID   int32
+	ContentHash []byte
+}
+
+// SearchIndexExists reports whether the search index has been built.
+func (db *DB) SearchIndexExists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT FROM information_schema.tables
+			WHERE table_name = 'pgit_search_index' AND table_schema = current_schema()
+		)`).Scan(&exists)
+	return exists, err
+}
+
+// ErrNoTrigram is returned by CreateSearchIndex when the search index
+// exists but its pg_trgm index could not be built.
+var ErrNoTrigram = errors.New("no trigram index on the search index")
+
+// SearchIndexHasTrigram reports whether the search index has its pg_trgm
+// index.
+func (db *DB) SearchIndexHasTrigram(ctx context.Context) (bool, error) {
+	var exists bool
+	err := db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT FROM pg_indexes
+			WHERE indexname = 'idx_search_index_trgm' AND schemaname = current_schema()
+		)`).Scan(&exists)
+	return exists, err
+}
+
+// CreateSearchIndex creates the search index table if needed, empty, and
+// the pg_trgm GIN index on its content. When pg_trgm can't be installed or
+// the index can't be built, the table is still usable (searches scan it)
+// and an error wrapping ErrNoTrigram says why. Calling it again after the
+// extension was installed adds the missing index.
+func (db *DB) CreateSearchIndex(ctx context.Context) error {
+	err := db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS pgit_search_index (
+			path         TEXT PRIMARY KEY,
+			commit_id    TEXT NOT NULL,
+			content_hash BYTEA NOT NULL,
+			content      TEXT NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create pgit_search_index: %w", err)
+	}
+
+	// In public, not the repository's schema: the extension is shared by
+	// every repository in the database, and dropping one schema must not
+	// take it along. The search_path only holds the repository's schema,
+	// so the operator class is schema-qualified.
+	if err := db.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public"); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoTrigram, err)
+	}
+	trgmSchema, err := db.extensionSchema(ctx, "pg_trgm")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoTrigram, err)
+	}
+	if err := db.Exec(ctx,
+		"CREATE INDEX IF NOT EXISTS idx_search_index_trgm ON pgit_search_index USING gin (content "+
+			pgx.Identifier{trgmSchema, "gin_trgm_ops"}.Sanitize()+")",
+	); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoTrigram, err)
+	}
+	return nil
+}
+
+// extensionSchema returns the schema an installed extension's objects live
+// in, which a repository's search_path doesn't include.
+func (db *DB) extensionSchema(ctx context.Context, name string) (string, error) {
+	var schema string
+	err := db.QueryRow(ctx, `
+		SELECT n.nspname FROM pg_extension e
+		JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE e.extname = $1`, name).Scan(&schema)
+	if err != nil {
+		return "", fmt.Errorf("extension %s is not installed: %w", name, err)
+	}
+	return schema, nil
+}
+
+// DropSearchIndex removes the search index.
+func (db *DB) DropSearchIndex(ctx context.Context) error {
+	if err := db.Exec(ctx, "DROP TABLE IF EXISTS pgit_search_index"); err != nil {
+		return err
+	}
+	return db.DeleteMetadata(ctx, MetaKeySearchIndexCommit)
+}
+
+// UpdateSearchIndex brings the search index to the tree at commitID. Only
+// files whose content hash differs from the indexed one are fetched and
+// written, so moving HEAD by a few commits costs a few files, in whatever
+// direction HEAD moved. onProgress (may be nil) receives the files written
+// so far and the total.
+func (db *DB) UpdateSearchIndex(ctx context.Context, commitID string, onProgress func(done, total int)) (*SearchIndexUpdate, error) {
+	update := &SearchIndexUpdate{}
+	indexed, err := db.GetMetadata(ctx, MetaKeySearchIndexCommit)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if indexed == commitID {
+		return update, nil
+	}
+
+	var tree []searchIndexEntry
+	if commitID != "" {
+		refs, err := db.GetTreeRefsAtCommitWithPaths(ctx, commitID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			if !ref.IsBinary {
+				tree = append(tree, searchIndexEntry{
+					Path: ref.Path, CommitID: ref.CommitID, GroupID: ref.GroupID,
+					VersionID: ref.VersionID, ContentHash: ref.ContentHash,
+				})
+			}
+		}
+	}
+
+	current := make(map[string][]byte)
+	rows, err := db.Query(ctx, "SELECT path, content_hash FROM pgit_search_index")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var path string
+		var hash []byte
+		if err := rows.Scan(&path, &hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		current[path] = hash
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	upsert, remove := diffSearchIndex(current, tree)
+	for _, e := range upsert {
+		if _, ok := current[e.Path]; ok {
+			update.Updated++
+		} else {
+			update.Added++
+		}
+	}
+	update.Removed = len(remove)
+
+	err = db.WithTx(ctx, func(tx pgx.Tx) error {
+		if len(remove) > 0 {
+			if _, err := tx.Exec(ctx, "DELETE FROM pgit_search_index WHERE path = ANY($1)", remove); err != nil {
+				return err
+			}
+		}
+		for start := 0; start < len(upsert); start += searchIndexBatchSize {
+			batch := upsert[start:min(start+searchIndexBatchSize, len(upsert))]
+			if err := db.writeSearchIndexBatch(ctx, tx, batch); err != nil {
+				return err
+			}
+			if onProgress != nil {
+				onProgress(start+len(batch), len(upsert))
+			}
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pgit_metadata (key, value) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`,
+			MetaKeySearchIndexCommit, commitID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// writeSearchIndexBatch fetches the content of a batch of files and
+// upserts it into the index.
+func (db *DB) writeSearchIndexBatch(ctx context.Context, tx pgx.Tx, batch []searchIndexEntry) error {
+	keys := make([]ContentKey, len(batch))
+	for i, e := range batch {
+		keys[i] = ContentKey{GroupID: e.GroupID, VersionID: e.VersionID}
+	}
+	contents, err := db.GetContentsBatch(ctx, keys, nil)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, len(batch))
+	commits := make([]string, len(batch))
+	hashes := make([][]byte, len(batch))
+	texts := make([]string, len(batch))
+	for i, e := range batch {
+		paths[i], commits[i], hashes[i] = e.Path, e.CommitID, e.ContentHash
+		texts[i] = string(contents[keys[i]])
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO pgit_search_index (path, commit_id, content_hash, content)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::bytea[], $4::text[])
+		ON CONFLICT (path) DO UPDATE SET
+			commit_id = EXCLUDED.commit_id,
+			content_hash = EXCLUDED.content_hash,
+			content = EXCLUDED.content`,
+		paths, commits, hashes, texts)
+	return err
+}
+
+// diffSearchIndex compares the indexed content hashes by path with a tree
+// and returns the files to write and the paths to remove.
+func diffSearchIndex(current map[string][]byte, tree []searchIndexEntry) ([]searchIndexEntry, []string) {
+	var upsert []searchIndexEntry
+	inTree := make(map[string]bool, len(tree))
+	for _, e := range tree {
+		inTree[e.Path] = true
+		if hash, ok := current[e.Path]; !ok || !bytes.Equal(hash, e.ContentHash) {
+			upsert = append(upsert, e)
+		}
+	}
+	var remove []string
+	for path := range current {
+		if !inTree[path] {
+			remove = append(remove, path)
+		}
+	}
+	return upsert, remove
+}
+
+// SearchIndexed searches the text files in the search index with a
+// server-side regular expression (and a glob on the path), using the
+// trigram index where one exists. CommitID in the results is the commit
+// that last changed each file.
+func (db *DB) SearchIndexed(ctx context.Context, opts SearchContentOptions) ([]*SearchContentResult, error) {
+	op := "~"
+	if opts.IgnoreCase {
+		op = "~*"
+	}
+	args := []any{opts.Pattern}
+	where := "content " + op + " $1"
+	if opts.PathPattern != "" {
+		like := strings.ReplaceAll(strings.ReplaceAll(opts.PathPattern, "*", "%"), "?", "_")
+		args = append(args, like)
+		where += " AND path LIKE $2"
+	}
+	sql := "SELECT path, commit_id, content FROM pgit_search_index WHERE " + where + " ORDER BY path"
+	if opts.Limit > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchContentResult
+	for rows.Next() {
+		r := &SearchContentResult{}
+		if err := rows.Scan(&r.Path, &r.CommitID, &r.Content); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestDiffSearchIndex(t *testing.T) {
+	current := map[string][]byte{
+		"same.go":    {1},
+		"changed.go": {2},
+		"gone.go":    {3},
+	}
+	tree := []searchIndexEntry{
+		{Path: "same.go", ContentHash: []byte{1}},
+		{Path: "changed.go", ContentHash: []byte{9}},
+		{Path: "new.go", ContentHash: []byte{4}},
+	}
+
+	upsert, remove := diffSearchIndex(current, tree)
+	var paths []string
+	for _, e := range upsert {
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+	if len(paths) != 2 || paths[0] != "changed.go" || paths[1] != "new.go" {
+		t.Errorf("upsert = %v, want [changed.go new.go]", paths)
+	}
+	if len(remove) != 1 || remove[0] != "gone.go" {
+		t.Errorf("remove = %v, want [gone.go]", remove)
+	}
+
+	upsert, remove = diffSearchIndex(current, nil)
+	if len(upsert) != 0 || len(remove) != 3 {
+		t.Errorf("empty tree: got %d upserts and %d removals, want 0 and 3", len(upsert), len(remove))
+	}
+}
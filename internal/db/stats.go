@@ -76,29 +76,39 @@ func (db *DB) GetRepoStatsFast(ctx context.Context) (*RepoStats, error) {
 		mu.Unlock()
 	}
 
+	// Resolve the backend once, before the queries run concurrently
+	db.Backend(ctx)
+
 	// Query 1: Commit stats from xpatch.stats() - O(1)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := db.QueryRow(ctx, "SELECT total_rows FROM xpatch.stats('pgit_commits')").Scan(&stats.TotalCommits)
+		commits, err := db.GetXpatchStats(ctx, "pgit_commits")
 		if err != nil {
 			setErr(err)
+			return
 		}
+		mu.Lock()
+		stats.TotalCommits = commits.TotalRows
+		stats.XpatchCompressedCommits = commits.CompressedBytes
+		mu.Unlock()
 	}()
 
-	// Query 2: xpatch stats for all 3 tables - raw + compressed sizes - O(1) each
+	// Query 2: xpatch stats for the content tables - raw + compressed sizes - O(1) each
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		var textRaw, textComp, binaryRaw, binaryComp, commitRaw, commitComp int64
-		_ = db.QueryRow(ctx, "SELECT raw_size_bytes, compressed_size_bytes FROM xpatch.stats('pgit_text_content')").Scan(&textRaw, &textComp)
-		_ = db.QueryRow(ctx, "SELECT raw_size_bytes, compressed_size_bytes FROM xpatch.stats('pgit_binary_content')").Scan(&binaryRaw, &binaryComp)
-		_ = db.QueryRow(ctx, "SELECT raw_size_bytes, compressed_size_bytes FROM xpatch.stats('pgit_commits')").Scan(&commitRaw, &commitComp)
+		var textRaw, textComp, binaryRaw, binaryComp int64
+		if text, err := db.GetXpatchStats(ctx, "pgit_text_content"); err == nil {
+			textRaw, textComp = text.RawSizeBytes, text.CompressedBytes
+		}
+		if binary, err := db.GetXpatchStats(ctx, "pgit_binary_content"); err == nil {
+			binaryRaw, binaryComp = binary.RawSizeBytes, binary.CompressedBytes
+		}
 		mu.Lock()
 		stats.TotalContentSize = textRaw + binaryRaw
 		stats.XpatchCompressedText = textComp
 		stats.XpatchCompressedBinary = binaryComp
-		stats.XpatchCompressedCommits = commitComp
 		mu.Unlock()
 	}()
 
@@ -187,10 +197,30 @@ func (db *DB) GetRepoStatsFast(ctx context.Context) (*RepoStats, error) {
 	return stats, nil
 }
 
-// GetXpatchStats retrieves compression statistics for a table
+// GetXpatchStats retrieves compression statistics for a table. On the heap
+// backend they are computed from the table (a full scan), with every row
+// a keyframe and no cache counters.
 func (db *DB) GetXpatchStats(ctx context.Context, tableName string) (*XpatchStats, error) {
 	stats := &XpatchStats{}
 
+	if db.Backend(ctx) == BackendHeap {
+		err := db.QueryRow(ctx, heapStatsSQL(tableName)).Scan(
+			&stats.TotalRows,
+			&stats.TotalGroups,
+			&stats.KeyframeCount,
+			&stats.DeltaCount,
+			&stats.RawSizeBytes,
+			&stats.CompressedBytes,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if stats.CompressedBytes > 0 {
+			stats.CompressionRatio = float64(stats.RawSizeBytes) / float64(stats.CompressedBytes)
+		}
+		return stats, nil
+	}
+
 	sql := `
 	SELECT 
 		total_rows,
@@ -305,11 +335,11 @@ func (db *DB) GetDetailedTableSizes(ctx context.Context) (*DetailedTableSizes, e
 func (db *DB) GetCommitStats(ctx context.Context) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
-	var totalCommits int64
-	if err := db.QueryRow(ctx, "SELECT total_rows FROM xpatch.stats('pgit_commits')").Scan(&totalCommits); err != nil {
+	commits, err := db.GetXpatchStats(ctx, "pgit_commits")
+	if err != nil {
 		return nil, err
 	}
-	stats["total_commits"] = totalCommits
+	stats["total_commits"] = commits.TotalRows
 
 	return stats, nil
 }
@@ -320,23 +350,17 @@ func (db *DB) GetBlobStats(ctx context.Context) (map[string]interface{}, error)
 	stats := make(map[string]interface{})
 
 	// Get content stats from both xpatch tables
-	var textRows, textGroups, textSize int64
-	err := db.QueryRow(ctx, `
-		SELECT total_rows, total_groups, raw_size_bytes 
-		FROM xpatch.stats('pgit_text_content')
-	`).Scan(&textRows, &textGroups, &textSize)
+	text, err := db.GetXpatchStats(ctx, "pgit_text_content")
 	if err != nil {
 		return nil, err
 	}
+	textRows, textSize := text.TotalRows, text.RawSizeBytes
 
-	var binaryRows, binaryGroups, binarySize int64
-	err = db.QueryRow(ctx, `
-		SELECT total_rows, total_groups, raw_size_bytes 
-		FROM xpatch.stats('pgit_binary_content')
-	`).Scan(&binaryRows, &binaryGroups, &binarySize)
+	binary, err := db.GetXpatchStats(ctx, "pgit_binary_content")
 	if err != nil {
 		return nil, err
 	}
+	binaryRows, binarySize := binary.TotalRows, binary.RawSizeBytes
 
 	// Get file refs count
 	var totalRefs int64
@@ -67,3 +67,94 @@ func (db *DB) GetAllSyncStates(ctx context.Context) ([]*SyncState, error) {
 
 	return states, rows.Err()
 }
+
+// TransferProgress records a push or pull that has not finished yet, so an
+// interrupted transfer can be resumed instead of started over.
+type TransferProgress struct {
+	RemoteName string
+	Direction  string // "push" or "pull"
+	BaseID     string // Commit the transferred commits build on ("" for all)
+	TargetID   string // HEAD the transfer moves towards
+	LastID     string // Last commit stored on the receiving side
+	Done       int
+	Total      int
+	StartedAt  time.Time
+}
+
+// GetTransferProgress returns the unfinished transfer with a remote, or nil.
+func (db *DB) GetTransferProgress(ctx context.Context, remoteName string) (*TransferProgress, error) {
+	sql := `
+	SELECT transfer_direction, COALESCE(transfer_base, ''), transfer_target, COALESCE(transfer_last, ''),
+		COALESCE(transfer_done, 0), COALESCE(transfer_total, 0), transfer_started_at
+	FROM pgit_sync_state
+	WHERE remote_name = $1 AND transfer_direction IS NOT NULL`
+
+	p := &TransferProgress{RemoteName: remoteName}
+	err := db.QueryRow(ctx, sql, remoteName).Scan(
+		&p.Direction, &p.BaseID, &p.TargetID, &p.LastID, &p.Done, &p.Total, &p.StartedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetAllTransferProgress returns the unfinished transfers with all remotes.
+func (db *DB) GetAllTransferProgress(ctx context.Context) ([]*TransferProgress, error) {
+	sql := `
+	SELECT remote_name, transfer_direction, COALESCE(transfer_base, ''), transfer_target, COALESCE(transfer_last, ''),
+		COALESCE(transfer_done, 0), COALESCE(transfer_total, 0), transfer_started_at
+	FROM pgit_sync_state
+	WHERE transfer_direction IS NOT NULL
+	ORDER BY remote_name`
+
+	rows, err := db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*TransferProgress
+	for rows.Next() {
+		p := &TransferProgress{}
+		if err := rows.Scan(&p.RemoteName, &p.Direction, &p.BaseID, &p.TargetID, &p.LastID,
+			&p.Done, &p.Total, &p.StartedAt); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, p)
+	}
+
+	return transfers, rows.Err()
+}
+
+// SetTransferProgress records the progress of a transfer. The first call
+// for a transfer sets its start time; later calls keep it.
+func (db *DB) SetTransferProgress(ctx context.Context, p *TransferProgress) error {
+	sql := `
+	INSERT INTO pgit_sync_state (remote_name, transfer_direction, transfer_base, transfer_target,
+		transfer_last, transfer_done, transfer_total, transfer_started_at)
+	VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7, NOW())
+	ON CONFLICT (remote_name) DO UPDATE SET
+		transfer_direction = EXCLUDED.transfer_direction,
+		transfer_base = EXCLUDED.transfer_base,
+		transfer_target = EXCLUDED.transfer_target,
+		transfer_last = EXCLUDED.transfer_last,
+		transfer_done = EXCLUDED.transfer_done,
+		transfer_total = EXCLUDED.transfer_total,
+		transfer_started_at = COALESCE(pgit_sync_state.transfer_started_at, EXCLUDED.transfer_started_at)`
+
+	return db.Exec(ctx, sql, p.RemoteName, p.Direction, p.BaseID, p.TargetID, p.LastID, p.Done, p.Total)
+}
+
+// ClearTransferProgress forgets the unfinished transfer with a remote.
+func (db *DB) ClearTransferProgress(ctx context.Context, remoteName string) error {
+	sql := `
+	UPDATE pgit_sync_state SET
+		transfer_direction = NULL, transfer_base = NULL, transfer_target = NULL, transfer_last = NULL,
+		transfer_done = NULL, transfer_total = NULL, transfer_started_at = NULL
+	WHERE remote_name = $1`
+
+	return db.Exec(ctx, sql, remoteName)
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+	"github.com/jackc/pgx/v5"
+)
+
+// trailersIndexedKey marks a database whose pgit_commit_trailers covers
+// every commit. Databases created before the table existed lack it until
+// BackfillCommitTrailers has run.
+const trailersIndexedKey = "trailers_indexed"
+
+// createCommitTrailersTable creates the commit trailers table. Keys are
+// stored lowercased ("co-authored-by").
+func (db *DB) createCommitTrailersTable(ctx context.Context) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS pgit_commit_trailers (
+		commit_id  TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		value      TEXT NOT NULL,
+		PRIMARY KEY (commit_id, key, value)
+	)`
+
+	if err := db.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create pgit_commit_trailers: %w", err)
+	}
+
+	_ = db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_commit_trailers_key ON pgit_commit_trailers(key)")
+
+	return nil
+}
+
+// commitTrailersInsert builds the statement storing the parsed trailers
+// of commits. ok is false when none of the commits has trailers. Existing
+// rows are left untouched, so re-inserting commits is safe.
+func commitTrailersInsert(commits []*Commit) (sql string, args []any, ok bool) {
+	var ids, keys, values []string
+	for _, c := range commits {
+		for _, t := range util.ParseTrailers(c.Message) {
+			ids = append(ids, c.ID)
+			keys = append(keys, t.Key)
+			values = append(values, t.Value)
+		}
+	}
+	if len(ids) == 0 {
+		return "", nil, false
+	}
+
+	sql = `
+		INSERT INTO pgit_commit_trailers (commit_id, key, value)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::text[])
+		ON CONFLICT DO NOTHING`
+	return sql, []any{ids, keys, values}, true
+}
+
+// createCommitTrailers stores the trailers of commits.
+func (db *DB) createCommitTrailers(ctx context.Context, commits []*Commit) error {
+	sql, args, ok := commitTrailersInsert(commits)
+	if !ok {
+		return nil
+	}
+	if err := db.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to insert commit trailers: %w", err)
+	}
+	return nil
+}
+
+// CreateCommitTrailersTx stores the trailers of commits within a transaction.
+func (db *DB) CreateCommitTrailersTx(ctx context.Context, tx pgx.Tx, commits []*Commit) error {
+	sql, args, ok := commitTrailersInsert(commits)
+	if !ok {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to insert commit trailers: %w", err)
+	}
+	return nil
+}
+
+// GetTrailersByKey returns the values of one trailer key per commit.
+func (db *DB) GetTrailersByKey(ctx context.Context, key string) (map[string][]string, error) {
+	rows, err := db.Query(ctx,
+		"SELECT commit_id, value FROM pgit_commit_trailers WHERE key = $1", key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]string)
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		result[id] = append(result[id], value)
+	}
+	return result, rows.Err()
+}
+
+// TrailersIndexed reports whether pgit_commit_trailers covers all commits.
+func (db *DB) TrailersIndexed(ctx context.Context) bool {
+	v, _ := db.GetMetadata(ctx, trailersIndexedKey)
+	return v == "1"
+}
+
+// BackfillCommitTrailers parses the trailers of every stored commit, for
+// databases created before pgit_commit_trailers existed. It scans
+// pgit_commits once front-to-back and marks the database as indexed.
+func (db *DB) BackfillCommitTrailers(ctx context.Context) error {
+	rows, err := db.Query(ctx, "SELECT id, message FROM pgit_commits ORDER BY seq ASC")
+	if err != nil {
+		return err
+	}
+
+	const batchSize = 1000
+	var batch []*Commit
+	for rows.Next() {
+		c := &Commit{}
+		if err := rows.Scan(&c.ID, &c.Message); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, c)
+		if len(batch) == batchSize {
+			if err := db.createCommitTrailers(ctx, batch); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := db.createCommitTrailers(ctx, batch); err != nil {
+		return err
+	}
+
+	return db.SetMetadata(ctx, trailersIndexedKey, "1")
+}
@@ -0,0 +1,519 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BlobTransfer copies the file versions of a set of commits from one
+// database to another without decoding them into blobs.
+//
+// Content moves one delta group at a time: the source streams the versions
+// in version_id order with COPY ... TO STDOUT (FORMAT binary), the rows are
+// renumbered for the destination group on the fly, and COPY ... FROM STDIN
+// appends them, so each side walks its delta chain sequentially, as during
+// import. Content the destination group already holds (same content hash)
+// is referenced instead of copied. File refs carry no content and are
+// written with ordinary batched COPY.
+//
+// Each destination group is written in one transaction, and refs the
+// destination already has are skipped, so a transfer that failed part way
+// can simply be run again.
+type BlobTransfer struct {
+	src, dst *DB
+	units    []*transferUnit
+	total    int
+}
+
+// transferRef is a source file ref together with what is needed to place
+// it in the destination.
+type transferRef struct {
+	srcGroup int32
+	path     string
+	ref      FileRef // source numbering: PathID and VersionID are source IDs
+}
+
+// transferUnit is the work for one destination group.
+type transferUnit struct {
+	group int32
+	refs  []*transferRef
+}
+
+// PrepareBlobTransfer loads the source file refs of commitIDs and registers
+// their paths in dst. Paths that share a delta group in src share one in dst,
+// unless dst already placed them elsewhere.
+func PrepareBlobTransfer(ctx context.Context, src, dst *DB, commitIDs []string) (*BlobTransfer, error) {
+	t := &BlobTransfer{src: src, dst: dst}
+	if len(commitIDs) == 0 {
+		return t, nil
+	}
+
+	var refs []*transferRef
+	const chunkSize = 1000
+	for i := 0; i < len(commitIDs); i += chunkSize {
+		chunk := commitIDs[i:min(i+chunkSize, len(commitIDs))]
+		rows, err := src.Query(ctx, `
+			SELECT p.group_id, p.path, r.commit_id, r.version_id, r.content_hash,
+			       r.mode, r.is_symlink, r.symlink_target, r.is_binary, r.size, r.line_count
+			FROM pgit_file_refs r
+			JOIN pgit_paths p ON p.path_id = r.path_id
+			WHERE r.commit_id = ANY($1)`, chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file refs: %w", err)
+		}
+		for rows.Next() {
+			tr := &transferRef{}
+			if err := rows.Scan(&tr.srcGroup, &tr.path, &tr.ref.CommitID, &tr.ref.VersionID,
+				&tr.ref.ContentHash, &tr.ref.Mode, &tr.ref.IsSymlink, &tr.ref.SymlinkTarget,
+				&tr.ref.IsBinary, &tr.ref.Size, &tr.ref.LineCount); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			refs = append(refs, tr)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(refs) == 0 {
+		return t, nil
+	}
+
+	// Source group IDs stand in for the "local groups" of an import
+	pathToGroup := make(map[string]int)
+	for _, tr := range refs {
+		pathToGroup[tr.path] = int(tr.srcGroup)
+	}
+	paths := make([]string, 0, len(pathToGroup))
+	for p := range pathToGroup {
+		paths = append(paths, p)
+	}
+	pathReg, err := dst.PreRegisterPaths(ctx, paths, pathToGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	units := make(map[int32]*transferUnit)
+	for _, tr := range refs {
+		ids := pathReg[tr.path]
+		tr.ref.PathID = ids.PathID
+		u, ok := units[ids.GroupID]
+		if !ok {
+			u = &transferUnit{group: ids.GroupID}
+			units[ids.GroupID] = u
+		}
+		u.refs = append(u.refs, tr)
+	}
+
+	// Biggest groups first, so a large group does not start last and
+	// leave one worker running alone at the end
+	for _, u := range units {
+		t.units = append(t.units, u)
+	}
+	sort.Slice(t.units, func(i, j int) bool {
+		if len(t.units[i].refs) != len(t.units[j].refs) {
+			return len(t.units[i].refs) > len(t.units[j].refs)
+		}
+		return t.units[i].group < t.units[j].group
+	})
+	t.total = len(refs)
+	return t, nil
+}
+
+// Count returns the number of file refs the transfer covers.
+func (t *BlobTransfer) Count() int {
+	return t.total
+}
+
+// Run copies the file versions using workers parallel workers, one
+// destination group at a time per worker. onProgress, if not nil, is
+// called with the number of file refs handled after each group. Groups
+// are retried on transient errors; onRetry is passed to Retry.
+func (t *BlobTransfer) Run(ctx context.Context, workers int, onProgress func(int), onRetry func(attempt int, err error)) error {
+	if len(t.units) == 0 {
+		return nil
+	}
+	workers = max(1, min(workers, len(t.units)))
+
+	work := make(chan *transferUnit, len(t.units))
+	for _, u := range t.units {
+		work <- u
+	}
+	close(work)
+
+	var firstErr atomic.Pointer[error]
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range work {
+				if firstErr.Load() != nil {
+					return
+				}
+				err := Retry(ctx, onRetry, func() error {
+					return t.transferGroup(ctx, u)
+				})
+				if err != nil {
+					firstErr.CompareAndSwap(nil, &err)
+					return
+				}
+				if onProgress != nil {
+					onProgress(len(u.refs))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errPtr := firstErr.Load(); errPtr != nil {
+		return *errPtr
+	}
+	return nil
+}
+
+// contentKey identifies a source content stream: one source group in the
+// text or binary table.
+type contentKey struct {
+	srcGroup int32
+	isBinary bool
+}
+
+// transferGroup writes the refs of one destination group, and the content
+// they need, in a single transaction.
+func (t *BlobTransfer) transferGroup(ctx context.Context, u *transferUnit) error {
+	dst := t.dst
+	return dst.WithTx(ctx, func(tx pgx.Tx) error {
+		refs, err := dst.missingTransferRefsTx(ctx, tx, u.refs)
+		if err != nil || len(refs) == 0 {
+			return err
+		}
+
+		maxVersions, err := dst.getMaxVersionIDsBatchTx(ctx, tx, []int32{u.group})
+		if err != nil {
+			return err
+		}
+		next := maxVersions[u.group]
+
+		known, err := dst.groupContentVersionsTx(ctx, tx, u.group, refs)
+		if err != nil {
+			return err
+		}
+
+		// Walk the source versions in order so the new destination
+		// versions are appended in the same order: per source group,
+		// ascending version_id
+		sort.Slice(refs, func(i, j int) bool {
+			a, b := refs[i], refs[j]
+			if a.srcGroup != b.srcGroup {
+				return a.srcGroup < b.srcGroup
+			}
+			if a.ref.VersionID != b.ref.VersionID {
+				return a.ref.VersionID < b.ref.VersionID
+			}
+			if a.ref.CommitID != b.ref.CommitID {
+				return a.ref.CommitID < b.ref.CommitID
+			}
+			return a.path < b.path
+		})
+
+		needed := make(map[contentKey]map[int32]int32) // source version → destination version
+		var keys []contentKey
+		fileRefs := make([]*FileRef, 0, len(refs))
+		for _, tr := range refs {
+			ref := tr.ref
+			switch {
+			case ref.ContentHash == nil:
+				// Deletions are unique events and carry no content
+				next++
+				ref.VersionID = next
+			case known[string(ref.ContentHash)] != 0:
+				ref.VersionID = known[string(ref.ContentHash)]
+			default:
+				next++
+				known[string(ref.ContentHash)] = next
+				key := contentKey{srcGroup: tr.srcGroup, isBinary: ref.IsBinary}
+				if needed[key] == nil {
+					needed[key] = make(map[int32]int32)
+					keys = append(keys, key)
+				}
+				needed[key][tr.ref.VersionID] = next
+				ref.VersionID = next
+			}
+			fileRefs = append(fileRefs, &ref)
+		}
+
+		for _, key := range keys {
+			if err := dst.copyContentTx(ctx, tx, t.src, key, u.group, needed[key]); err != nil {
+				return err
+			}
+		}
+		return dst.createFileRefsBatchTx(ctx, tx, fileRefs)
+	})
+}
+
+// missingTransferRefsTx returns the refs the destination doesn't have yet.
+func (db *DB) missingTransferRefsTx(ctx context.Context, tx pgx.Tx, refs []*transferRef) ([]*transferRef, error) {
+	pathSet := make(map[int32]bool)
+	commitSet := make(map[string]bool)
+	for _, tr := range refs {
+		pathSet[tr.ref.PathID] = true
+		commitSet[tr.ref.CommitID] = true
+	}
+	pathIDs := make([]int32, 0, len(pathSet))
+	for id := range pathSet {
+		pathIDs = append(pathIDs, id)
+	}
+	commitIDs := make([]string, 0, len(commitSet))
+	for id := range commitSet {
+		commitIDs = append(commitIDs, id)
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT path_id, commit_id FROM pgit_file_refs
+		 WHERE path_id = ANY($1) AND commit_id = ANY($2)`,
+		pathIDs, commitIDs)
+	if err != nil {
+		return nil, err
+	}
+	type refKey struct {
+		pathID   int32
+		commitID string
+	}
+	existing := make(map[refKey]bool)
+	for rows.Next() {
+		var k refKey
+		if err := rows.Scan(&k.pathID, &k.commitID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[k] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return refs, nil
+	}
+
+	missing := make([]*transferRef, 0, len(refs)-len(existing))
+	for _, tr := range refs {
+		if !existing[refKey{tr.ref.PathID, tr.ref.CommitID}] {
+			missing = append(missing, tr)
+		}
+	}
+	return missing, nil
+}
+
+// groupContentVersionsTx maps the content hashes of refs that group already
+// stores to their version_id.
+func (db *DB) groupContentVersionsTx(ctx context.Context, tx pgx.Tx, group int32, refs []*transferRef) (map[string]int32, error) {
+	seen := make(map[string]bool)
+	var hashes [][]byte
+	for _, tr := range refs {
+		if tr.ref.ContentHash != nil && !seen[string(tr.ref.ContentHash)] {
+			seen[string(tr.ref.ContentHash)] = true
+			hashes = append(hashes, tr.ref.ContentHash)
+		}
+	}
+
+	known := make(map[string]int32)
+	if len(hashes) == 0 {
+		return known, nil
+	}
+	rows, err := tx.Query(ctx,
+		`SELECT DISTINCT ON (r.content_hash) r.content_hash, r.version_id
+		 FROM pgit_file_refs r
+		 JOIN pgit_paths p ON p.path_id = r.path_id
+		 WHERE p.group_id = $1 AND r.content_hash = ANY($2)
+		 ORDER BY r.content_hash, r.version_id`,
+		group, hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash []byte
+		var version int32
+		if err := rows.Scan(&hash, &version); err != nil {
+			return nil, err
+		}
+		known[string(hash)] = version
+	}
+	return known, rows.Err()
+}
+
+// copyContentTx streams the given versions of one source group from src
+// into group of db, renumbering them per versions (source → destination).
+// The COPY query has to be inlined; version IDs are formatted by us.
+func (db *DB) copyContentTx(ctx context.Context, tx pgx.Tx, src *DB, key contentKey, group int32, versions map[int32]int32) error {
+	table := "pgit_text_content"
+	if key.isBinary {
+		table = "pgit_binary_content"
+	}
+	ids := make([]string, 0, len(versions))
+	for v := range versions {
+		ids = append(ids, strconv.Itoa(int(v)))
+	}
+	copyOut := fmt.Sprintf(
+		`COPY (SELECT group_id, version_id, content FROM %s
+		 WHERE group_id = %d AND version_id = ANY('{%s}'::int[])
+		 ORDER BY version_id) TO STDOUT (FORMAT binary)`,
+		table, key.srcGroup, strings.Join(ids, ","))
+	copyIn := fmt.Sprintf(`COPY %s (group_id, version_id, content) FROM STDIN (FORMAT binary)`, table)
+
+	conn, err := src.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// source COPY → outR → rewrite → inW → destination COPY
+	outR, outW := io.Pipe()
+	inR, inW := io.Pipe()
+	var outErr, rewriteErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, outErr = conn.Conn().PgConn().CopyTo(ctx, outW, copyOut)
+		outW.CloseWithError(outErr)
+	}()
+	go func() {
+		defer wg.Done()
+		rewriteErr = rewriteCopyStream(inW, outR, func(_, version int32) (int32, int32, error) {
+			v, ok := versions[version]
+			if !ok {
+				return 0, 0, fmt.Errorf("unexpected version %d of group %d", version, key.srcGroup)
+			}
+			return group, v, nil
+		})
+		// Unblock the source if the rewrite stopped early
+		outR.CloseWithError(rewriteErr)
+		inW.CloseWithError(rewriteErr)
+	}()
+
+	tag, inErr := tx.Conn().PgConn().CopyFrom(ctx, inR, copyIn)
+	if inErr != nil {
+		inR.CloseWithError(inErr)
+	}
+	wg.Wait()
+
+	for _, err := range []error{outErr, rewriteErr, inErr} {
+		if err != nil {
+			return fmt.Errorf("failed to copy content of group %d: %w", key.srcGroup, err)
+		}
+	}
+	if int(tag.RowsAffected()) != len(versions) {
+		return fmt.Errorf("failed to copy content of group %d: expected %d version(s), got %d",
+			key.srcGroup, len(versions), tag.RowsAffected())
+	}
+	return nil
+}
+
+// copySignature starts every binary COPY stream.
+var copySignature = []byte("PGCOPY\n\xff\r\n\x00")
+
+// rewriteCopyStream copies a binary COPY stream of (group_id INTEGER,
+// version_id INTEGER, content) rows from r to w, replacing group_id and
+// version_id with the values remap returns. Content is passed through
+// untouched.
+func rewriteCopyStream(w io.Writer, r io.Reader, remap func(group, version int32) (int32, int32, error)) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	bw := bufio.NewWriterSize(w, 64<<10)
+
+	// Header: signature, flags, header extension length, extension
+	header := make([]byte, len(copySignature)+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("invalid COPY header: %w", err)
+	}
+	if !bytes.Equal(header[:len(copySignature)], copySignature) {
+		return fmt.Errorf("invalid COPY header: not a binary COPY stream")
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	extLen := int64(binary.BigEndian.Uint32(header[len(copySignature)+4:]))
+	if _, err := io.CopyN(bw, br, extLen); err != nil {
+		return fmt.Errorf("invalid COPY header: %w", err)
+	}
+
+	buf := make([]byte, 8)
+	readInt32Field := func() (int32, error) {
+		if _, err := io.ReadFull(br, buf[:8]); err != nil {
+			return 0, err
+		}
+		if n := int32(binary.BigEndian.Uint32(buf[:4])); n != 4 {
+			return 0, fmt.Errorf("invalid COPY row: expected a 4-byte integer, got length %d", n)
+		}
+		return int32(binary.BigEndian.Uint32(buf[4:8])), nil
+	}
+	writeInt32Field := func(v int32) error {
+		binary.BigEndian.PutUint32(buf[:4], 4)
+		binary.BigEndian.PutUint32(buf[4:8], uint32(v))
+		_, err := bw.Write(buf[:8])
+		return err
+	}
+
+	for {
+		if _, err := io.ReadFull(br, buf[:2]); err != nil {
+			return fmt.Errorf("invalid COPY row: %w", err)
+		}
+		fields := int16(binary.BigEndian.Uint16(buf[:2]))
+		if _, err := bw.Write(buf[:2]); err != nil {
+			return err
+		}
+		if fields == -1 {
+			// Trailer
+			return bw.Flush()
+		}
+		if fields != 3 {
+			return fmt.Errorf("invalid COPY row: expected 3 fields, got %d", fields)
+		}
+
+		group, err := readInt32Field()
+		if err != nil {
+			return err
+		}
+		version, err := readInt32Field()
+		if err != nil {
+			return err
+		}
+		group, version, err = remap(group, version)
+		if err != nil {
+			return err
+		}
+		if err := writeInt32Field(group); err != nil {
+			return err
+		}
+		if err := writeInt32Field(version); err != nil {
+			return err
+		}
+
+		// Content: length (-1 for NULL) and bytes
+		if _, err := io.ReadFull(br, buf[:4]); err != nil {
+			return fmt.Errorf("invalid COPY row: %w", err)
+		}
+		if _, err := bw.Write(buf[:4]); err != nil {
+			return err
+		}
+		if n := int32(binary.BigEndian.Uint32(buf[:4])); n > 0 {
+			if _, err := io.CopyN(bw, br, int64(n)); err != nil {
+				return fmt.Errorf("invalid COPY row: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// copyStream builds a binary COPY stream of (group_id, version_id, content)
+// rows. A nil content is written as NULL.
+func copyStream(rows ...[]any) []byte {
+	var b bytes.Buffer
+	b.Write(copySignature)
+	binary.Write(&b, binary.BigEndian, uint32(0)) // flags
+	binary.Write(&b, binary.BigEndian, uint32(0)) // extension length
+	for _, row := range rows {
+		binary.Write(&b, binary.BigEndian, int16(3))
+		for _, v := range row[:2] {
+			binary.Write(&b, binary.BigEndian, int32(4))
+			binary.Write(&b, binary.BigEndian, v.(int32))
+		}
+		if content, _ := row[2].([]byte); content != nil {
+			binary.Write(&b, binary.BigEndian, int32(len(content)))
+			b.Write(content)
+		} else {
+			binary.Write(&b, binary.BigEndian, int32(-1))
+		}
+	}
+	binary.Write(&b, binary.BigEndian, int16(-1))
+	return b.Bytes()
+}
+
+func TestRewriteCopyStream(t *testing.T) {
+	big := []byte(strings.Repeat("x", 200<<10)) // larger than the buffers
+	in := copyStream(
+		[]any{int32(7), int32(1), []byte("hello")},
+		[]any{int32(7), int32(3), []byte{}},
+		[]any{int32(7), int32(4), big},
+		[]any{int32(7), int32(9), nil},
+	)
+	want := copyStream(
+		[]any{int32(2), int32(11), []byte("hello")},
+		[]any{int32(2), int32(13), []byte{}},
+		[]any{int32(2), int32(14), big},
+		[]any{int32(2), int32(19), nil},
+	)
+
+	var out bytes.Buffer
+	err := rewriteCopyStream(&out, bytes.NewReader(in), func(group, version int32) (int32, int32, error) {
+		if group != 7 {
+			t.Errorf("remap got group %d, want 7", group)
+		}
+		return 2, version + 10, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("rewritten stream differs (got %d bytes, want %d)", out.Len(), len(want))
+	}
+}
+
+func TestRewriteCopyStreamErrors(t *testing.T) {
+	keep := func(g, v int32) (int32, int32, error) { return g, v, nil }
+	valid := copyStream([]any{int32(1), int32(1), []byte("a")})
+
+	tests := []struct {
+		name  string
+		in    []byte
+		remap func(int32, int32) (int32, int32, error)
+	}{
+		{"not a COPY stream", []byte("group_id\tversion_id\tcontent\n"), keep},
+		{"truncated", valid[:len(valid)-4], keep},
+		{"remap error", valid, func(int32, int32) (int32, int32, error) { return 0, 0, fmt.Errorf("unknown version") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := rewriteCopyStream(&out, bytes.NewReader(tt.in), tt.remap); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package filter describes history rewrites for 'pgit filter': paths to
+// remove from every commit and text replacements to apply to every stored
+// version of every text file.
+//
+// Replacement rules use the git filter-repo --replace-text format, one rule
+// per line:
+//
+//	secret                      replace "secret" with ***REMOVED***
+//	secret==>xxx                replace "secret" with "xxx"
+//	literal:a==>b               explicit literal match
+//	regex:ghp_[A-Za-z0-9]+==>   regular expression (Go syntax, $1 in the replacement)
+//
+// Blank lines are ignored.
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/imgajeed76/pgit/v4/internal/util"
+)
+
+// DefaultReplacement replaces a match when a rule gives no replacement.
+const DefaultReplacement = "***REMOVED***"
+
+// Rule is one text replacement.
+type Rule struct {
+	Literal     []byte         // set for literal rules
+	Regexp      *regexp.Regexp // set for regex rules
+	Replacement []byte
+}
+
+// ParseRules parses a replace-text rules file.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		pattern, replacement, found := strings.Cut(line, "==>")
+		if !found {
+			replacement = DefaultReplacement
+		}
+		rule := Rule{Replacement: []byte(replacement)}
+
+		switch {
+		case strings.HasPrefix(pattern, "regex:"):
+			re, err := regexp.Compile(strings.TrimPrefix(pattern, "regex:"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			rule.Regexp = re
+		case strings.HasPrefix(pattern, "literal:"):
+			rule.Literal = []byte(strings.TrimPrefix(pattern, "literal:"))
+		default:
+			rule.Literal = []byte(pattern)
+		}
+		if rule.Regexp == nil && len(rule.Literal) == 0 {
+			return nil, fmt.Errorf("line %d: empty pattern", lineNo)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Spec is a complete rewrite.
+type Spec struct {
+	RemovePaths []string // glob patterns
+	Rules       []Rule
+	RulesText   []byte // the rules file, for ID
+}
+
+// NewSpec validates the path patterns and parses the rules file (nil for
+// none).
+func NewSpec(removePaths []string, rulesFile []byte) (*Spec, error) {
+	for _, p := range removePaths {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return nil, fmt.Errorf("invalid path pattern %q", p)
+		}
+	}
+	s := &Spec{RemovePaths: removePaths, RulesText: rulesFile}
+	if rulesFile != nil {
+		rules, err := ParseRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("the rules file has no rules")
+		}
+		s.Rules = rules
+	}
+	return s, nil
+}
+
+// ID identifies the rewrite. The same patterns and rules file give the same
+// ID, so a rewrite applied to the local database and to a remote is
+// recognized as one.
+func (s *Spec) ID() string {
+	var b strings.Builder
+	for _, p := range s.RemovePaths {
+		b.WriteString("remove-path " + p + "\n")
+	}
+	if s.RulesText != nil {
+		b.WriteString("replace-text\n")
+		b.Write(s.RulesText)
+	}
+	return util.HashBytesBlake3Hex([]byte(b.String()))[:16]
+}
+
+// String describes the rewrite without repeating the replaced text.
+func (s *Spec) String() string {
+	var parts []string
+	for _, p := range s.RemovePaths {
+		parts = append(parts, "--remove-path "+p)
+	}
+	if s.Rules != nil {
+		parts = append(parts, fmt.Sprintf("--replace-text (%d rules)", len(s.Rules)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// RemovesPath reports whether the file at p is removed. A pattern matches
+// the whole path or one of its leading directories; a pattern without a
+// slash (other than a trailing one) matches any single path component, so
+// "*.pem" removes every .pem file and "secrets" every file in a directory
+// named secrets, while "/secrets" only removes the top-level one.
+func (s *Spec) RemovesPath(p string) bool {
+	parts := strings.Split(p, "/")
+	for _, pattern := range s.RemovePaths {
+		anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+		pattern = strings.Trim(pattern, "/")
+		if !anchored {
+			for _, part := range parts {
+				if ok, _ := path.Match(pattern, part); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for i := len(parts); i > 0; i-- {
+			if ok, _ := path.Match(pattern, strings.Join(parts[:i], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReplaceText applies the rules to content in order. It returns content
+// itself and false if nothing matched.
+func (s *Spec) ReplaceText(content []byte) ([]byte, bool) {
+	out := content
+	changed := false
+	for _, r := range s.Rules {
+		var next []byte
+		if r.Regexp != nil {
+			if !r.Regexp.Match(out) {
+				continue
+			}
+			next = r.Regexp.ReplaceAll(out, r.Replacement)
+		} else {
+			if !bytes.Contains(out, r.Literal) {
+				continue
+			}
+			next = bytes.ReplaceAll(out, r.Literal, r.Replacement)
+		}
+		if !bytes.Equal(next, out) {
+			out, changed = next, true
+		}
+	}
+	return out, changed
+}
@@ -0,0 +1,73 @@
+package filter
+
+import "testing"
+
+func TestReplaceText(t *testing.T) {
+	spec, err := NewSpec(nil, []byte("hunter2\n\nliteral:a==>b\r\nregex:ghp_([A-Za-z0-9]{4})[A-Za-z0-9]*==>ghp_${1}...\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Rules) != 3 {
+		t.Fatalf("got %d rules, want 3", len(spec.Rules))
+	}
+
+	tests := map[string]string{
+		"pw = hunter2\n":              "pw = ***REMOVED***\n",
+		"a cat":                       "b cbt",
+		"token: ghp_AbCd1234567890xy": "token: ghp_AbCd...",
+	}
+	for in, want := range tests {
+		got, changed := spec.ReplaceText([]byte(in))
+		if string(got) != want || !changed {
+			t.Errorf("ReplaceText(%q) = %q, %v; want %q", in, got, changed, want)
+		}
+	}
+
+	in := []byte("nothing to see")
+	if got, changed := spec.ReplaceText(in); changed || &got[0] != &in[0] {
+		t.Errorf("expected the content to be returned unchanged")
+	}
+
+	for _, rules := range []string{"regex:(==>x", "==>x", "\n\n"} {
+		if _, err := NewSpec(nil, []byte(rules)); err == nil {
+			t.Errorf("NewSpec(%q): expected an error", rules)
+		}
+	}
+}
+
+func TestRemovesPath(t *testing.T) {
+	spec, err := NewSpec([]string{"*.pem", "secrets", "config/prod/*.env", "/build/"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"certs/server.pem":      true,
+		"server.pem":            true,
+		"app/secrets/token.txt": true,
+		"secrets":               true,
+		"config/prod/db.env":    true,
+		"config/dev/db.env":     false,
+		"build/out/app.bin":     true,
+		"src/build/x":           false,
+		"main.go":               false,
+		"secrets.go":            false,
+	}
+	for p, want := range tests {
+		if got := spec.RemovesPath(p); got != want {
+			t.Errorf("RemovesPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+
+	if _, err := NewSpec([]string{"[abc"}, nil); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+}
+
+func TestSpecID(t *testing.T) {
+	a, _ := NewSpec([]string{"*.pem"}, []byte("x\n"))
+	b, _ := NewSpec([]string{"*.pem"}, []byte("x\n"))
+	c, _ := NewSpec([]string{"*.pem"}, []byte("y\n"))
+	if a.ID() != b.ID() || a.ID() == c.ID() || len(a.ID()) != 16 {
+		t.Fatalf("unexpected IDs %s %s %s", a.ID(), b.ID(), c.ID())
+	}
+}
@@ -0,0 +1,169 @@
+// Package mailmap implements git's .mailmap author identity normalization.
+//
+// A .mailmap file maps the identities recorded in commits to canonical ones.
+// Each non-comment line has one of four forms:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+//
+// Emails and commit names match case-insensitively. A rule naming both the
+// commit name and email takes precedence over an email-only rule, and for
+// the same key a later rule replaces an earlier one.
+package mailmap
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Entry is a single mailmap rule.
+type Entry struct {
+	ProperName  string // "" keeps the commit's name
+	ProperEmail string // "" keeps the commit's email
+	CommitName  string // "" matches any name
+	CommitEmail string
+}
+
+// String formats the entry as a .mailmap line.
+func (e Entry) String() string {
+	var b strings.Builder
+	if e.ProperName != "" {
+		b.WriteString(e.ProperName)
+		b.WriteByte(' ')
+	}
+	if e.ProperEmail != "" {
+		b.WriteString("<" + e.ProperEmail + "> ")
+	}
+	if e.CommitName != "" {
+		b.WriteString(e.CommitName)
+		b.WriteByte(' ')
+	}
+	b.WriteString("<" + e.CommitEmail + ">")
+	return b.String()
+}
+
+// Parse reads .mailmap rules. Blank lines, comment lines, and lines without
+// a usable rule are skipped, as git does.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if e, ok := parseLine(scanner.Text()); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// parseLine parses one .mailmap line.
+func parseLine(line string) (Entry, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return Entry{}, false
+	}
+
+	name1, email1, rest, ok := nameAndEmail(line)
+	if !ok {
+		return Entry{}, false
+	}
+	name2, email2, _, ok := nameAndEmail(rest)
+	if !ok {
+		// Single email: "Proper Name <commit@email>"
+		if name1 == "" {
+			return Entry{}, false
+		}
+		return Entry{ProperName: name1, CommitEmail: email1}, true
+	}
+	return Entry{ProperName: name1, ProperEmail: email1, CommitName: name2, CommitEmail: email2}, true
+}
+
+// nameAndEmail splits "Name <email> rest" into its parts.
+func nameAndEmail(s string) (name, email, rest string, ok bool) {
+	lt := strings.IndexByte(s, '<')
+	if lt < 0 {
+		return "", "", "", false
+	}
+	gt := strings.IndexByte(s[lt:], '>')
+	if gt < 0 {
+		return "", "", "", false
+	}
+	gt += lt
+	return strings.TrimSpace(s[:lt]), strings.TrimSpace(s[lt+1 : gt]), s[gt+1:], true
+}
+
+// Mailmap resolves commit identities to canonical ones.
+// A nil *Mailmap is valid and resolves every identity to itself.
+type Mailmap struct {
+	byEmail map[string]map[string]Entry // lower(commit email) -> lower(commit name) -> entry
+	entries []Entry
+}
+
+// New builds a Mailmap from rules, later rules overriding earlier ones
+// with the same commit name and email.
+func New(entries []Entry) *Mailmap {
+	m := &Mailmap{byEmail: make(map[string]map[string]Entry)}
+	for _, e := range entries {
+		email := strings.ToLower(e.CommitEmail)
+		byName := m.byEmail[email]
+		if byName == nil {
+			byName = make(map[string]Entry)
+			m.byEmail[email] = byName
+		}
+		byName[strings.ToLower(e.CommitName)] = e
+	}
+	for _, byName := range m.byEmail {
+		for _, e := range byName {
+			m.entries = append(m.entries, e)
+		}
+	}
+	return m
+}
+
+// Entries returns the effective rules (duplicates removed), unordered.
+func (m *Mailmap) Entries() []Entry {
+	if m == nil {
+		return nil
+	}
+	return m.entries
+}
+
+// Len returns the number of effective rules.
+func (m *Mailmap) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.entries)
+}
+
+// Resolve returns the canonical name and email for a commit identity.
+func (m *Mailmap) Resolve(name, email string) (string, string) {
+	if m == nil {
+		return name, email
+	}
+	byName, ok := m.byEmail[strings.ToLower(email)]
+	if !ok {
+		return name, email
+	}
+	e, ok := byName[strings.ToLower(name)]
+	if !ok {
+		if e, ok = byName[""]; !ok {
+			return name, email
+		}
+	}
+	if e.ProperName != "" {
+		name = e.ProperName
+	}
+	if e.ProperEmail != "" {
+		email = e.ProperEmail
+	}
+	return name, email
+}
+
+// ResolveName returns only the canonical name, for output that shows names.
+func (m *Mailmap) ResolveName(name, email string) string {
+	name, _ = m.Resolve(name, email)
+	return name
+}
@@ -0,0 +1,96 @@
+package mailmap
+
+import (
+	"strings"
+	"testing"
+)
+
+const sample = `# comment
+Jane Doe <jane@example.com>
+<jane@example.com> <jane@old-laptop.local>
+Jane Doe <jane@example.com> <JDOE@corp.example>
+Jane Doe <jane@example.com> jd <shared@example.com>
+
+not a rule
+`
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d: %+v", len(entries), entries)
+	}
+
+	want := Entry{ProperName: "Jane Doe", ProperEmail: "jane@example.com", CommitName: "jd", CommitEmail: "shared@example.com"}
+	if entries[3] != want {
+		t.Fatalf("got %+v, want %+v", entries[3], want)
+	}
+	if got := entries[3].String(); got != "Jane Doe <jane@example.com> jd <shared@example.com>" {
+		t.Fatalf("String() = %q", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	entries, _ := Parse(strings.NewReader(sample))
+	m := New(entries)
+
+	tests := []struct {
+		name, email         string
+		wantName, wantEmail string
+	}{
+		// Name-only rule
+		{"jane", "jane@example.com", "Jane Doe", "jane@example.com"},
+		// Email-only rule keeps the name
+		{"Jane D.", "jane@old-laptop.local", "Jane D.", "jane@example.com"},
+		// Email match is case-insensitive
+		{"J Doe", "jdoe@corp.example", "Jane Doe", "jane@example.com"},
+		// Name+email rule applies only to the matching name
+		{"JD", "shared@example.com", "Jane Doe", "jane@example.com"},
+		{"someone", "shared@example.com", "someone", "shared@example.com"},
+		// Unknown identities are unchanged
+		{"Bob", "bob@example.com", "Bob", "bob@example.com"},
+	}
+	for _, tt := range tests {
+		name, email := m.Resolve(tt.name, tt.email)
+		if name != tt.wantName || email != tt.wantEmail {
+			t.Errorf("Resolve(%q, %q) = %q, %q; want %q, %q",
+				tt.name, tt.email, name, email, tt.wantName, tt.wantEmail)
+		}
+	}
+
+	var nilMap *Mailmap
+	if name, email := nilMap.Resolve("a", "b"); name != "a" || email != "b" {
+		t.Fatal("nil Mailmap must resolve identities to themselves")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	ids := []Identity{
+		{"Jane Doe", "jane@example.com", 50},
+		{"jane doe", "jane@old-laptop.local", 5},
+		{"jdoe", "JANE@example.com", 3},
+		{"Jane", "12345+janedoe@users.noreply.github.com", 2},
+		{"J. Doe", "janedoe@corp.example", 1},
+		{"Bob", "root@host-a", 7},
+		{"Alice", "root@host-b", 4},
+	}
+
+	suggestions := Suggest(ids, nil)
+	if len(suggestions) != 1 {
+		t.Fatalf("expected 1 group, got %d: %+v", len(suggestions), suggestions)
+	}
+	s := suggestions[0]
+	if s.Canonical.Email != "jane@example.com" {
+		t.Fatalf("canonical = %+v", s.Canonical)
+	}
+	if len(s.Aliases) != 4 {
+		t.Fatalf("expected 4 aliases, got %+v", s.Aliases)
+	}
+
+	// Once mapped, the group is no longer suggested
+	if again := Suggest(ids, New(s.Entries())); len(again) != 0 {
+		t.Fatalf("expected no suggestions after applying, got %+v", again)
+	}
+}
@@ -0,0 +1,170 @@
+package mailmap
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Identity is an author identity with its commit count.
+type Identity struct {
+	Name    string
+	Email   string
+	Commits int
+}
+
+// Suggestion proposes mapping Aliases onto Canonical, the identity with
+// the most commits in the group.
+type Suggestion struct {
+	Canonical Identity
+	Aliases   []Identity
+}
+
+// Entries returns the suggestion as mailmap rules, one per alias.
+func (s Suggestion) Entries() []Entry {
+	entries := make([]Entry, len(s.Aliases))
+	for i, a := range s.Aliases {
+		entries[i] = Entry{
+			ProperName:  s.Canonical.Name,
+			ProperEmail: s.Canonical.Email,
+			CommitName:  a.Name,
+			CommitEmail: a.Email,
+		}
+	}
+	return entries
+}
+
+// genericLocalParts are email local parts shared by unrelated people, so
+// they never link identities on their own.
+var genericLocalParts = map[string]bool{
+	"root": true, "admin": true, "info": true, "mail": true, "user": true,
+	"noreply": true, "git": true, "dev": true, "developer": true, "test": true,
+	"build": true, "bot": true, "ci": true, "github": true, "gitlab": true,
+	"support": true, "contact": true, "webmaster": true, "none": true,
+}
+
+// noreplyPrefix matches the numeric ID GitHub prepends to noreply addresses
+// (12345+octocat@users.noreply.github.com).
+var noreplyPrefix = regexp.MustCompile(`^\d+\+`)
+
+// Suggest groups identities that probably belong to the same person:
+// the same email in different case, the same full name (two or more words,
+// ignoring case and punctuation), or the same distinctive email local part
+// (which also matches a full name written without spaces).
+// Identities are first resolved through m, so existing rules are respected
+// and already merged identities are not proposed again. Groups are returned
+// largest commit count first.
+func Suggest(identities []Identity, m *Mailmap) []Suggestion {
+	// Resolve and aggregate
+	type key struct{ name, email string }
+	merged := make(map[key]int)
+	for _, id := range identities {
+		name, email := m.Resolve(id.Name, id.Email)
+		merged[key{name, email}] += id.Commits
+	}
+	ids := make([]Identity, 0, len(merged))
+	for k, n := range merged {
+		ids = append(ids, Identity{Name: k.name, Email: k.email, Commits: n})
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Commits != ids[j].Commits {
+			return ids[i].Commits > ids[j].Commits
+		}
+		if ids[i].Name != ids[j].Name {
+			return ids[i].Name < ids[j].Name
+		}
+		return ids[i].Email < ids[j].Email
+	})
+
+	// Union identities sharing any key
+	parent := make([]int, len(ids))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(x int) int {
+		if parent[x] != x {
+			parent[x] = find(parent[x])
+		}
+		return parent[x]
+	}
+	firstByKey := make(map[string]int)
+	link := func(k string, i int) {
+		if j, ok := firstByKey[k]; ok {
+			a, b := find(i), find(j)
+			if a != b {
+				// Keep the root at the lower index (more commits)
+				if a < b {
+					parent[b] = a
+				} else {
+					parent[a] = b
+				}
+			}
+			return
+		}
+		firstByKey[k] = i
+	}
+	for i, id := range ids {
+		link("e:"+strings.ToLower(id.Email), i)
+		if n := normalizeName(id.Name); n != "" {
+			link("n:"+n, i)
+			// "Jane Doe" also matches janedoe@ / jane.doe@ addresses
+			link("l:"+strings.ReplaceAll(n, " ", ""), i)
+		}
+		if l := distinctiveLocalPart(id.Email); l != "" {
+			link("l:"+l, i)
+		}
+	}
+
+	groups := make(map[int]*Suggestion)
+	var order []int
+	for i, id := range ids {
+		root := find(i)
+		if root == i {
+			groups[i] = &Suggestion{Canonical: id}
+			order = append(order, i)
+		} else {
+			groups[root].Aliases = append(groups[root].Aliases, id)
+		}
+	}
+
+	var result []Suggestion
+	for _, root := range order {
+		if s := groups[root]; len(s.Aliases) > 0 {
+			result = append(result, *s)
+		}
+	}
+	return result
+}
+
+// normalizeName returns a lowercase, punctuation-free form of a name with
+// at least two words, or "" for single-word names (too ambiguous to link).
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	})
+	if len(words) < 2 {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// distinctiveLocalPart returns the normalized local part of an email,
+// or "" if it is too short or too generic to identify a person.
+func distinctiveLocalPart(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 {
+		return ""
+	}
+	local := noreplyPrefix.ReplaceAllString(strings.ToLower(email[:at]), "")
+	local = strings.Map(func(r rune) rune {
+		if r == '.' || r == '_' || r == '-' {
+			return -1
+		}
+		return r
+	}, local)
+	if len(local) < 4 || genericLocalParts[local] {
+		return ""
+	}
+	return local
+}
@@ -0,0 +1,130 @@
+package merge
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Driver merges one kind of file. Merge returns ok=false when it can't
+// merge the versions cleanly (unparseable input, or a real conflict); the
+// caller then falls back to the line merge, which marks the conflicts.
+// resolved counts the changes taken from one side.
+type Driver interface {
+	Name() string
+	Merge(base, local, remote []byte) (merged []byte, resolved int, ok bool)
+}
+
+// lineDriver never merges, so files it matches always get the line merge.
+// It lets a rule opt a path out of a structured driver.
+type lineDriver struct{}
+
+func (lineDriver) Name() string { return "line" }
+
+func (lineDriver) Merge(base, local, remote []byte) ([]byte, int, bool) {
+	return nil, 0, false
+}
+
+// builtinDrivers are the drivers that rules can name.
+var builtinDrivers = map[string]Driver{
+	"line": lineDriver{},
+	"json": &structuredDriver{name: "json", format: jsonFormat{}},
+	"yaml": &structuredDriver{name: "yaml", format: yamlFormat{}},
+	"toml": &structuredDriver{name: "toml", format: tomlFormat{}},
+}
+
+// LookupDriver returns the built-in driver with the given name.
+func LookupDriver(name string) (Driver, bool) {
+	d, ok := builtinDrivers[strings.ToLower(name)]
+	return d, ok
+}
+
+// DriverNames returns the names of the built-in drivers, sorted.
+func DriverNames() []string {
+	names := make([]string, 0, len(builtinDrivers))
+	for name := range builtinDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rule selects a driver for the paths matching Pattern. A pattern without a
+// slash matches the file name in any directory ("*.json"); one with a
+// slash matches the whole repository-relative path ("config/*.yml").
+type Rule struct {
+	Pattern string
+	Driver  Driver
+}
+
+// Matches reports whether the rule applies to path.
+func (r Rule) Matches(p string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		p = path.Base(p)
+	}
+	ok, _ := path.Match(r.Pattern, p)
+	return ok
+}
+
+// Drivers is an ordered list of rules; the first matching rule wins.
+type Drivers []Rule
+
+// DefaultDrivers returns the built-in rules: JSON, YAML and TOML files by
+// extension.
+func DefaultDrivers() Drivers {
+	return Drivers{
+		{Pattern: "*.json", Driver: builtinDrivers["json"]},
+		{Pattern: "*.yaml", Driver: builtinDrivers["yaml"]},
+		{Pattern: "*.yml", Driver: builtinDrivers["yaml"]},
+		{Pattern: "*.toml", Driver: builtinDrivers["toml"]},
+	}
+}
+
+// ParseDrivers parses a comma-separated list of pattern=driver rules, such
+// as "*.lock=line,*.jsonc=json", and returns them ahead of the default
+// rules so they take precedence.
+func ParseDrivers(spec string) (Drivers, error) {
+	var rules Drivers
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(item, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid merge driver rule %q (use pattern=driver)", item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		d, ok := LookupDriver(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown merge driver %q (use %s)", strings.TrimSpace(name), strings.Join(DriverNames(), ", "))
+		}
+		rules = append(rules, Rule{Pattern: pattern, Driver: d})
+	}
+	return append(rules, DefaultDrivers()...), nil
+}
+
+// For returns the driver for path, or nil when no rule matches.
+func (ds Drivers) For(p string) Driver {
+	for _, r := range ds {
+		if r.Matches(p) {
+			return r.Driver
+		}
+	}
+	return nil
+}
+
+// Merge merges one file: with the driver selected for path when there is
+// one and it merges cleanly, otherwise with ThreeWayStyle.
+func (ds Drivers) Merge(p string, base, local, remote []byte, remoteName string, style ConflictStyle) *Result {
+	if d := ds.For(p); d != nil {
+		if merged, resolved, ok := d.Merge(base, local, remote); ok {
+			return &Result{Content: merged, AutoResolved: resolved, Driver: d.Name()}
+		}
+	}
+	return ThreeWayStyle(base, local, remote, remoteName, style)
+}
@@ -0,0 +1,232 @@
+package merge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDrivers_For(t *testing.T) {
+	ds, err := ParseDrivers("package-lock.json=line, config/*.conf=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"a/b/settings.json":     "json",
+		"package-lock.json":     "line",
+		"web/package-lock.json": "line",
+		"config/app.conf":       "json",
+		"other/app.conf":        "",
+		"ci.yml":                "yaml",
+		"Cargo.toml":            "toml",
+		"main.go":               "",
+	}
+	for path, want := range tests {
+		got := ""
+		if d := ds.For(path); d != nil {
+			got = d.Name()
+		}
+		if got != want {
+			t.Errorf("For(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	for _, spec := range []string{"*.json", "*.json=xml", "[=json"} {
+		if _, err := ParseDrivers(spec); err == nil {
+			t.Errorf("ParseDrivers(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestJSONDriver_DifferentKeys(t *testing.T) {
+	// Both sides add a key at the end: the line merge conflicts on the
+	// closing lines, the key merge doesn't
+	base := lines(`{`, `  "name": "app",`, `  "version": "1.0.0"`, `}`)
+	local := lines(`{`, `  "name": "app",`, `  "version": "1.0.0",`, `  "license": "MIT"`, `}`)
+	remote := lines(`{`, `  "name": "app",`, `  "version": "1.0.0",`, `  "private": true`, `}`)
+
+	if !ThreeWay(base, local, remote, "origin").HasConflicts {
+		t.Fatal("expected the line merge to conflict")
+	}
+
+	result := DefaultDrivers().Merge("package.json", base, local, remote, "origin", StyleDiff3)
+	if result.HasConflicts || result.Driver != "json" {
+		t.Fatalf("expected a clean json merge, got %+v", result)
+	}
+	want := lines(`{`, `  "name": "app",`, `  "version": "1.0.0",`, `  "license": "MIT",`, `  "private": true`, `}`)
+	if string(result.Content) != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", result.Content, want)
+	}
+	if result.AutoResolved != 2 {
+		t.Errorf("AutoResolved = %d, want 2", result.AutoResolved)
+	}
+}
+
+func TestJSONDriver_NestedAndDeleted(t *testing.T) {
+	base := []byte(`{"deps": {"a": "1", "b": "1"}, "old": 1}`)
+	local := []byte(`{"deps": {"a": "2", "b": "1"}}`)
+	remote := []byte(`{"deps": {"a": "1", "b": "1", "c": "1"}, "old": 1}`)
+
+	result := DefaultDrivers().Merge("x.json", base, local, remote, "origin", StyleMerge)
+	if result.HasConflicts {
+		t.Fatalf("unexpected conflict:\n%s", result.Content)
+	}
+	if want := `{"deps":{"a":"2","b":"1","c":"1"}}`; string(result.Content) != want {
+		t.Fatalf("got %s, want %s", result.Content, want)
+	}
+}
+
+func TestJSONDriver_RealConflictFallsBack(t *testing.T) {
+	base := lines(`{`, `  "version": "1.0.0"`, `}`)
+	local := lines(`{`, `  "version": "1.1.0"`, `}`)
+	remote := lines(`{`, `  "version": "2.0.0"`, `}`)
+
+	result := DefaultDrivers().Merge("package.json", base, local, remote, "origin", StyleMerge)
+	if !result.HasConflicts || result.Driver != "" {
+		t.Fatalf("expected a line-merge conflict, got %+v", result)
+	}
+	if !HasConflictMarkers(result.Content) {
+		t.Fatal("expected conflict markers")
+	}
+}
+
+func TestJSONDriver_Invalid(t *testing.T) {
+	d, _ := LookupDriver("json")
+	if _, _, ok := d.Merge([]byte(`{}`), []byte(`{"a": 1}`), []byte(`{"b": `)); ok {
+		t.Fatal("expected invalid JSON to fall back")
+	}
+}
+
+func TestYAMLDriver_KeepsComments(t *testing.T) {
+	base := lines(
+		"# service settings",
+		"server:",
+		"    port: 80 # default",
+		"    host: localhost",
+	)
+	local := lines(
+		"# service settings",
+		"server:",
+		"    port: 80 # default",
+		"    host: example.com",
+	)
+	remote := lines(
+		"# service settings",
+		"server:",
+		"    port: 8080 # default",
+		"    host: localhost",
+		"    tls: true",
+	)
+
+	result := DefaultDrivers().Merge("app.yml", base, local, remote, "origin", StyleMerge)
+	if result.HasConflicts || result.Driver != "yaml" {
+		t.Fatalf("expected a clean yaml merge, got %+v", result)
+	}
+	want := lines(
+		"# service settings",
+		"server:",
+		"    port: 8080 # default",
+		"    host: example.com",
+		"    tls: true",
+	)
+	if string(result.Content) != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", result.Content, want)
+	}
+}
+
+func TestYAMLDriver_Reencodes(t *testing.T) {
+	// Adjacent additions conflict in the line merge, so the tree is encoded
+	base := lines("a: 1", "list:", "  - x")
+	local := lines("a: 1", "b: 2 # mine", "list:", "  - x")
+	remote := lines("a: 1", "c: 3", "list:", "  - x")
+
+	d, _ := LookupDriver("yaml")
+	merged, _, ok := d.Merge(base, local, remote)
+	if !ok {
+		t.Fatal("expected a clean merge")
+	}
+	want := lines("a: 1", "b: 2 # mine", "list:", "  - x", "c: 3")
+	if string(merged) != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", merged, want)
+	}
+}
+
+func TestYAMLDriver_Aliases(t *testing.T) {
+	base := lines("base: &b {x: 1}", "a: *b")
+	local := lines("base: &b {x: 1}", "a: *b", "l: 1")
+	remote := lines("base: &b {x: 1}", "a: *b", "r: 1")
+
+	d, _ := LookupDriver("yaml")
+	if _, _, ok := d.Merge(base, local, remote); ok {
+		t.Fatal("expected documents with aliases to fall back")
+	}
+}
+
+func TestTOMLDriver(t *testing.T) {
+	base := lines(
+		`name = "app"`,
+		``,
+		`[dependencies]`,
+		`serde = "1"`,
+	)
+	local := lines(
+		`name = "app"`,
+		``,
+		`[dependencies]`,
+		`serde = "1"`,
+		`tokio = "1"`,
+	)
+	remote := lines(
+		`name = "app"`,
+		``,
+		`[dependencies]`,
+		`serde = "1"`,
+		`anyhow = "1"`,
+		``,
+		`[[bin]]`,
+		`name = "cli"`,
+	)
+
+	result := DefaultDrivers().Merge("Cargo.toml", base, local, remote, "origin", StyleMerge)
+	if result.HasConflicts || result.Driver != "toml" {
+		t.Fatalf("expected a clean toml merge, got %+v", result)
+	}
+	want := lines(
+		`name = "app"`,
+		``,
+		`[dependencies]`,
+		`serde = "1"`,
+		`tokio = "1"`,
+		`anyhow = "1"`,
+		``,
+		`[[bin]]`,
+		`name = "cli"`,
+	)
+	if string(result.Content) != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", result.Content, want)
+	}
+}
+
+func TestTOMLDriver_RealConflict(t *testing.T) {
+	base := lines(`[package]`, `version = "1.0.0"`)
+	local := lines(`[package]`, `version = "1.1.0"`)
+	remote := lines(`[package]`, `version = "2.0.0"`)
+
+	result := DefaultDrivers().Merge("Cargo.toml", base, local, remote, "origin", StyleMerge)
+	if !result.HasConflicts {
+		t.Fatal("expected a conflict")
+	}
+	if !strings.Contains(string(result.Content), conflictMarkerLocal) {
+		t.Fatalf("expected conflict markers:\n%s", result.Content)
+	}
+}
+
+func TestStructured_BothAddedFile(t *testing.T) {
+	d, _ := LookupDriver("json")
+	merged, _, ok := d.Merge(nil, []byte(`{"a": 1}`+"\n"), []byte(`{"b": 2}`+"\n"))
+	if !ok {
+		t.Fatal("expected a clean merge")
+	}
+	if want := `{"a":1,"b":2}` + "\n"; string(merged) != want {
+		t.Fatalf("got %q, want %q", merged, want)
+	}
+}
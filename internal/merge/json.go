@@ -0,0 +1,107 @@
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+)
+
+// jsonFormat handles JSON documents. Leaves keep their original text
+// (json.RawMessage), so numbers and escapes survive a re-encode.
+type jsonFormat struct{}
+
+func (jsonFormat) parse(data []byte) (*tree, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return parseJSONValue(raw)
+}
+
+func parseJSONValue(raw json.RawMessage) (*tree, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return nil, err
+		}
+		return &tree{canon: compact.String(), node: json.RawMessage(compact.Bytes())}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil { // {
+		return nil, err
+	}
+	t := newMap(nil)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := tok.(string)
+		if !ok {
+			return nil, errors.New("invalid object key")
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		child, err := parseJSONValue(v)
+		if err != nil {
+			return nil, err
+		}
+		t.set(k, child)
+	}
+	return t, nil
+}
+
+// jsonIndentPattern finds the indentation of the first nested line.
+var jsonIndentPattern = regexp.MustCompile(`[\[{]\r?\n([ \t]+)\S`)
+
+func (jsonFormat) encode(t *tree, like []byte) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := writeJSON(&compact, t); err != nil {
+		return nil, err
+	}
+
+	out := compact.Bytes()
+	if m := jsonIndentPattern.FindSubmatch(like); m != nil {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, out, "", string(m[1])); err != nil {
+			return nil, err
+		}
+		out = indented.Bytes()
+	}
+	if bytes.HasSuffix(like, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+func writeJSON(buf *bytes.Buffer, t *tree) error {
+	if !t.isMap() {
+		buf.Write(t.node.(json.RawMessage))
+		return nil
+	}
+	buf.WriteByte('{')
+	for i, k := range t.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		// An Encoder, unlike Marshal, can leave <, > and & unescaped
+		var key bytes.Buffer
+		enc := json.NewEncoder(&key)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(k); err != nil {
+			return err
+		}
+		buf.Write(bytes.TrimSuffix(key.Bytes(), []byte("\n")))
+		buf.WriteByte(':')
+		if err := writeJSON(buf, t.fields[k]); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
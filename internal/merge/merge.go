@@ -1,4 +1,5 @@
-// Package merge implements three-way merge for text files.
+// Package merge implements three-way merge for text files, line by line or,
+// through a Driver, by structure.
 //
 // A three-way merge uses three versions of a file:
 //   - Base: the common ancestor version (what both sides started from)
@@ -11,6 +12,18 @@
 //   - Only one side changed → take that side's changes (auto-merge)
 //   - Both sides changed identically → take either (they agree)
 //   - Both sides changed differently → conflict (insert markers around just those lines)
+//
+// Conflicts are written in one of two styles. StyleMerge shows the local and
+// remote lines; StyleDiff3 adds the base lines between them, so the reader
+// can see what each side changed:
+//
+//	<<<<<<< LOCAL
+//	local lines
+//	||||||| BASE
+//	base lines
+//	=======
+//	remote lines
+//	>>>>>>> REMOTE (origin)
 package merge
 
 import (
@@ -34,6 +47,10 @@ type Result struct {
 	// AutoResolved is the number of regions where only one side changed
 	// and the change was applied automatically.
 	AutoResolved int
+
+	// Driver names the structured driver that produced Content, or is
+	// empty for the line merge.
+	Driver string
 }
 
 // Conflict describes a single conflicting region in the merged output.
@@ -47,11 +64,38 @@ type Conflict struct {
 
 	// RemoteLines are the remote side's lines for this conflict.
 	RemoteLines []string
+
+	// BaseLines are the common ancestor's lines for this conflict.
+	BaseLines []string
+}
+
+// ConflictStyle selects how conflicting regions are marked.
+type ConflictStyle int
+
+const (
+	// StyleMerge marks the local and remote sides only.
+	StyleMerge ConflictStyle = iota
+	// StyleDiff3 also includes the common ancestor's lines.
+	StyleDiff3
+)
+
+// ParseConflictStyle parses a conflict style name ("merge" or "diff3").
+func ParseConflictStyle(name string) (ConflictStyle, bool) {
+	switch strings.ToLower(name) {
+	case "merge":
+		return StyleMerge, true
+	case "diff3":
+		return StyleDiff3, true
+	}
+	return StyleDiff3, false
 }
 
 // conflictMarkerLocal is the marker that begins the local side of a conflict.
 const conflictMarkerLocal = "<<<<<<< LOCAL"
 
+// conflictMarkerBase begins the base section of a diff3-style conflict.
+const conflictMarkerBase = "||||||| BASE"
+
 // conflictMarkerSeparator separates local and remote sides.
 const conflictMarkerSeparator = "======="
 
@@ -69,7 +113,14 @@ const conflictMarkerRemote = ">>>>>>> REMOTE"
 //  3. Walk both edit region lists simultaneously against the base, detecting
 //     overlaps and classifying each region
 //  4. Produce merged output with inline conflict markers only where needed
+//
+// Conflicts are marked in StyleMerge; see ThreeWayStyle.
 func ThreeWay(base, local, remote []byte, remoteName string) *Result {
+	return ThreeWayStyle(base, local, remote, remoteName, StyleMerge)
+}
+
+// ThreeWayStyle is ThreeWay with the given conflict marker style.
+func ThreeWayStyle(base, local, remote []byte, remoteName string, style ConflictStyle) *Result {
 	baseStr := string(base)
 	localStr := string(local)
 	remoteStr := string(remote)
@@ -83,7 +134,7 @@ func ThreeWay(base, local, remote []byte, remoteName string) *Result {
 	remoteEdits := computeEditRegions(baseLines, remoteLines)
 
 	// Merge the two edit region lists against the base
-	result := mergeRegions(baseLines, localLines, remoteLines, localEdits, remoteEdits, remoteName)
+	result := mergeRegions(baseLines, localLines, remoteLines, localEdits, remoteEdits, remoteName, style)
 
 	// Determine trailing newline for the merged output.
 	// If there are no conflicts, the merged output should preserve the trailing
@@ -226,6 +277,7 @@ func mergeRegions(
 	baseLines, localLines, remoteLines []string,
 	localEdits, remoteEdits []editRegion,
 	remoteName string,
+	style ConflictStyle,
 ) *Result {
 	var output []string
 	var conflicts []Conflict
@@ -334,15 +386,21 @@ func mergeRegions(
 				// True conflict — emit markers around just the conflicting lines
 				conflictStartLine := len(output) + 1 // 1-based
 
+				baseOverlap := baseLines[overlapBaseStart:overlapBaseEnd]
 				conflict := Conflict{
 					OutputStartLine: conflictStartLine,
 					LocalLines:      localOverlap,
 					RemoteLines:     remoteOverlap,
+					BaseLines:       baseOverlap,
 				}
 				conflicts = append(conflicts, conflict)
 
 				output = append(output, conflictMarkerLocal)
 				output = append(output, localOverlap...)
+				if style == StyleDiff3 {
+					output = append(output, conflictMarkerBase)
+					output = append(output, baseOverlap...)
+				}
 				output = append(output, conflictMarkerSeparator)
 				output = append(output, remoteOverlap...)
 				output = append(output, remoteMarkerEnd)
@@ -486,3 +544,47 @@ func maxInt(a, b int) int {
 	}
 	return b
 }
+
+// WholeFile marks local and remote as a single conflict covering the whole
+// file, for content that can't be merged line by line. With StyleDiff3 the
+// base is included; pass nil if the file didn't exist in the ancestor.
+func WholeFile(base, local, remote []byte, remoteName string, style ConflictStyle) []byte {
+	var b strings.Builder
+	section := func(marker string, content []byte) {
+		b.WriteString(marker + "\n")
+		b.Write(content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			b.WriteString("\n")
+		}
+	}
+	section(conflictMarkerLocal, local)
+	if style == StyleDiff3 {
+		section(conflictMarkerBase, base)
+	}
+	section(conflictMarkerSeparator, remote)
+	b.WriteString(conflictMarkerRemote)
+	if remoteName != "" {
+		b.WriteString(" (" + remoteName + ")")
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+// HasConflictMarkers reports whether content still contains a conflict
+// written by this package: a local marker line followed by a separator
+// and a remote marker line.
+func HasConflictMarkers(content []byte) bool {
+	state := 0
+	for _, line := range splitLines(string(content)) {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case state == 0 && strings.HasPrefix(line, conflictMarkerLocal):
+			state = 1
+		case state == 1 && line == conflictMarkerSeparator:
+			state = 2
+		case state == 2 && strings.HasPrefix(line, conflictMarkerRemote):
+			return true
+		}
+	}
+	return false
+}
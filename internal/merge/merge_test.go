@@ -572,3 +572,79 @@ func TestSplitLines(t *testing.T) {
 		}
 	}
 }
+
+func TestThreeWayStyle_Diff3(t *testing.T) {
+	base := lines("line1", "line2", "line3")
+	local := lines("line1", "LOCAL", "line3")
+	remote := lines("line1", "REMOTE", "line3")
+
+	result := ThreeWayStyle(base, local, remote, "origin", StyleDiff3)
+
+	want := lines("line1",
+		"<<<<<<< LOCAL", "LOCAL",
+		"||||||| BASE", "line2",
+		"=======", "REMOTE",
+		">>>>>>> REMOTE (origin)",
+		"line3")
+	if string(result.Content) != string(want) {
+		t.Fatalf("unexpected diff3 output:\n  got:  %q\n  want: %q", string(result.Content), string(want))
+	}
+	if len(result.Conflicts) != 1 || len(result.Conflicts[0].BaseLines) != 1 || result.Conflicts[0].BaseLines[0] != "line2" {
+		t.Fatalf("expected base lines [line2], got %+v", result.Conflicts)
+	}
+
+	// Both sides adding at the same point: the base section is empty
+	result = ThreeWayStyle(lines("a", "b"), lines("a", "L", "b"), lines("a", "R", "b"), "", StyleDiff3)
+	want = lines("a", "<<<<<<< LOCAL", "L", "||||||| BASE", "=======", "R", ">>>>>>> REMOTE", "b")
+	if string(result.Content) != string(want) {
+		t.Fatalf("unexpected diff3 insertion output:\n  got:  %q\n  want: %q", string(result.Content), string(want))
+	}
+}
+
+func TestParseConflictStyle(t *testing.T) {
+	if s, ok := ParseConflictStyle("Merge"); !ok || s != StyleMerge {
+		t.Errorf("Merge: got %v, %v", s, ok)
+	}
+	if s, ok := ParseConflictStyle("diff3"); !ok || s != StyleDiff3 {
+		t.Errorf("diff3: got %v, %v", s, ok)
+	}
+	if _, ok := ParseConflictStyle("zdiff3"); ok {
+		t.Error("zdiff3 should not parse")
+	}
+}
+
+func TestWholeFile(t *testing.T) {
+	got := WholeFile([]byte("base"), []byte("ours\n"), nil, "origin", StyleDiff3)
+	want := lines("<<<<<<< LOCAL", "ours", "||||||| BASE", "base", "=======", ">>>>>>> REMOTE (origin)")
+	if string(got) != string(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	got = WholeFile([]byte("base"), []byte("ours"), []byte("theirs"), "origin", StyleMerge)
+	want = lines("<<<<<<< LOCAL", "ours", "=======", "theirs", ">>>>>>> REMOTE (origin)")
+	if string(got) != string(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	conflicted := ThreeWayStyle(lines("a", "b"), lines("a", "L"), lines("a", "R"), "origin", StyleDiff3).Content
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"diff3 conflict", conflicted, true},
+		{"whole file", WholeFile(nil, []byte("x"), []byte("y"), "", StyleMerge), true},
+		{"resolved", lines("a", "L"), false},
+		{"separator only", lines("a", "=======", "b"), false},
+		{"unterminated", lines("<<<<<<< LOCAL", "a", "======="), false},
+		{"crlf", []byte("<<<<<<< LOCAL\r\nx\r\n=======\r\ny\r\n>>>>>>> REMOTE\r\n"), true},
+	}
+	for _, tt := range tests {
+		if got := HasConflictMarkers(tt.content); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
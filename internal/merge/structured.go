@@ -0,0 +1,183 @@
+package merge
+
+import "bytes"
+
+// A structured driver parses the three versions into trees of keyed
+// mappings and merges them key by key, so that two sides adding or
+// changing different keys of the same object never conflict, however close
+// together the lines are:
+//   - Both sides agree (or only one changed) → take that value
+//   - Both changed a mapping → merge its keys the same way
+//   - Both changed anything else differently → real conflict
+//
+// Anything other than a mapping (scalars, lists) is a leaf and merges as a
+// whole. On a real conflict, or when a version doesn't parse, the driver
+// gives up and the caller falls back to the line merge.
+//
+// Writing the merged tree back loses formatting the tree doesn't hold, so
+// the driver prefers text it already has: one side's file if the result
+// equals it, else the line merge's output if it merged cleanly to the
+// same tree. Only when neither fits is the tree re-encoded.
+
+// tree is a parsed document value. A mapping has fields (keys in document
+// order); anything else is a leaf compared by canon.
+type tree struct {
+	keys   []string
+	fields map[string]*tree
+
+	canon string // leaf identity, independent of formatting
+	node  any    // format data: the leaf value, or the original mapping
+	key   any    // format data for the key holding this value
+}
+
+func (t *tree) isMap() bool {
+	return t != nil && t.fields != nil
+}
+
+// set adds or replaces a field, keeping first-seen key order.
+func (t *tree) set(k string, v *tree) {
+	if _, ok := t.fields[k]; !ok {
+		t.keys = append(t.keys, k)
+	}
+	t.fields[k] = v
+}
+
+func newMap(node any) *tree {
+	return &tree{fields: map[string]*tree{}, node: node}
+}
+
+// equal reports whether two trees hold the same data. nil means absent.
+// Key order doesn't matter.
+func equal(a, b *tree) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.isMap() != b.isMap() {
+		return false
+	}
+	if !a.isMap() {
+		return a.canon == b.canon
+	}
+	if len(a.fields) != len(b.fields) {
+		return false
+	}
+	for k, av := range a.fields {
+		if !equal(av, b.fields[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeTree merges local and remote against base, any of which may be nil
+// (absent). It returns the merged tree (nil if the value is deleted), the
+// number of changes taken from one side, and ok=false on a conflict.
+func mergeTree(base, local, remote *tree) (*tree, int, bool) {
+	switch {
+	case equal(local, remote):
+		return local, 0, true
+	case equal(base, local):
+		return remote, 1, true
+	case equal(base, remote):
+		return local, 1, true
+	}
+
+	// Both changed: only mappings on both sides can still merge
+	if !local.isMap() || !remote.isMap() || (base != nil && !base.isMap()) {
+		return nil, 0, false
+	}
+	if base == nil {
+		base = newMap(nil) // both added the mapping
+	}
+
+	out := newMap(local.node)
+	out.key = local.key
+	resolved := 0
+	add := func(k string) bool {
+		v, n, ok := mergeTree(base.fields[k], local.fields[k], remote.fields[k])
+		if !ok {
+			return false
+		}
+		if v != nil {
+			out.set(k, v)
+		}
+		resolved += n
+		return true
+	}
+	for _, k := range local.keys {
+		if !add(k) {
+			return nil, 0, false
+		}
+	}
+	for _, k := range remote.keys {
+		if _, seen := local.fields[k]; !seen {
+			if !add(k) {
+				return nil, 0, false
+			}
+		}
+	}
+	return out, resolved, true
+}
+
+// format parses and encodes one file type for a structured driver.
+type format interface {
+	// parse returns the document tree; nil for an empty document.
+	parse(data []byte) (*tree, error)
+	// encode writes t, following the layout of like where it can.
+	encode(t *tree, like []byte) ([]byte, error)
+}
+
+// structuredDriver merges files of one format key by key.
+type structuredDriver struct {
+	name   string
+	format format
+}
+
+func (d *structuredDriver) Name() string { return d.name }
+
+func (d *structuredDriver) Merge(base, local, remote []byte) ([]byte, int, bool) {
+	baseTree, err := d.parseOptional(base)
+	if err != nil {
+		return nil, 0, false
+	}
+	localTree, err := d.format.parse(local)
+	if err != nil {
+		return nil, 0, false
+	}
+	remoteTree, err := d.format.parse(remote)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	merged, resolved, ok := mergeTree(baseTree, localTree, remoteTree)
+	if !ok || merged == nil {
+		return nil, 0, false
+	}
+
+	switch {
+	case equal(merged, localTree):
+		return local, resolved, true
+	case equal(merged, remoteTree):
+		return remote, resolved, true
+	}
+	if line := ThreeWayStyle(base, local, remote, "", StyleMerge); !line.HasConflicts {
+		if t, err := d.format.parse(line.Content); err == nil && equal(t, merged) {
+			return line.Content, resolved, true
+		}
+	}
+
+	out, err := d.format.encode(merged, local)
+	if err != nil {
+		return nil, 0, false
+	}
+	return out, resolved, true
+}
+
+// parseOptional parses a base version, which is absent (nil) when both
+// sides added the file.
+func (d *structuredDriver) parseOptional(data []byte) (*tree, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	return d.format.parse(data)
+}
@@ -0,0 +1,151 @@
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlFormat handles TOML documents. Tables are mappings; everything else,
+// arrays of tables included, is a leaf. A re-encoded file keeps key order
+// but not comments or layout, which is why the driver prefers existing text.
+type tomlFormat struct{}
+
+func (tomlFormat) parse(data []byte) (*tree, error) {
+	var doc map[string]any
+	md, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys come back as a map; the metadata has them in document order
+	order := map[string][]string{}
+	for _, key := range md.Keys() {
+		parent := strings.Join(key[:len(key)-1], "\x00")
+		order[parent] = append(order[parent], key[len(key)-1])
+	}
+	return tomlTree(doc, nil, order), nil
+}
+
+func tomlTree(table map[string]any, path []string, order map[string][]string) *tree {
+	t := newMap(nil)
+	add := func(k string) {
+		v, ok := table[k]
+		if !ok {
+			return
+		}
+		if sub, ok := v.(map[string]any); ok {
+			t.set(k, tomlTree(sub, append(path[:len(path):len(path)], k), order))
+		} else {
+			t.set(k, &tree{canon: fmt.Sprintf("%#v", v), node: v})
+		}
+	}
+	for _, k := range order[strings.Join(path, "\x00")] {
+		add(k)
+	}
+	// Keys the metadata didn't list, such as those of array-of-table elements
+	rest := make([]string, 0, len(table))
+	for k := range table {
+		if _, ok := t.fields[k]; !ok {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	for _, k := range rest {
+		add(k)
+	}
+	return t
+}
+
+func (tomlFormat) encode(t *tree, like []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeTOMLTable(&buf, nil, t); err != nil {
+		return nil, err
+	}
+	return bytes.TrimLeft(buf.Bytes(), "\n"), nil
+}
+
+// writeTOMLTable writes the keys of table t: plain values first, then
+// sub-tables and arrays of tables under their own headers.
+func writeTOMLTable(buf *bytes.Buffer, path []string, t *tree) error {
+	var tables []string
+	for _, k := range t.keys {
+		child := t.fields[k]
+		if _, isArray := child.node.([]map[string]any); child.isMap() || isArray {
+			tables = append(tables, k)
+			continue
+		}
+		line, err := toml.Marshal(map[string]any{"v": child.node})
+		if err != nil {
+			return err
+		}
+		buf.WriteString(tomlKey(k))
+		buf.Write(bytes.TrimPrefix(line, []byte("v")))
+	}
+
+	for _, k := range tables {
+		child := t.fields[k]
+		header := tomlHeader(append(path[:len(path):len(path)], k))
+		if elems, ok := child.node.([]map[string]any); ok {
+			for _, elem := range elems {
+				fmt.Fprintf(buf, "\n[[%s]]\n", header)
+				if err := writeTOMLTable(buf, append(path[:len(path):len(path)], k), tomlTree(elem, nil, nil)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// A header is only needed for a table with values of its own
+		needsHeader := len(child.keys) == 0
+		for _, ck := range child.keys {
+			_, isArray := child.fields[ck].node.([]map[string]any)
+			if !child.fields[ck].isMap() && !isArray {
+				needsHeader = true
+			}
+		}
+		if needsHeader {
+			fmt.Fprintf(buf, "\n[%s]\n", header)
+		}
+		if err := writeTOMLTable(buf, append(path[:len(path):len(path)], k), child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey quotes a key unless it is a bare key.
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range k {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func tomlHeader(path []string) string {
+	parts := make([]string, len(path))
+	for i, k := range path {
+		parts[i] = tomlKey(k)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,123 @@
+package merge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFormat handles single-document YAML files. It works on yaml.Node
+// trees, so key order, styles and comments survive a re-encode. Documents
+// with anchors or aliases are not merged: moving nodes around could leave
+// an alias without its anchor.
+type yamlFormat struct{}
+
+func (yamlFormat) parse(data []byte) (*tree, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var next yaml.Node
+	if err := dec.Decode(&next); err != io.EOF {
+		return nil, errors.New("multi-document YAML")
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return parseYAMLNode(doc.Content[0])
+}
+
+func parseYAMLNode(n *yaml.Node) (*tree, error) {
+	if n.Anchor != "" || n.Kind == yaml.AliasNode {
+		return nil, errors.New("YAML anchors and aliases are not merged")
+	}
+	if n.Kind != yaml.MappingNode {
+		if err := checkYAMLLeaf(n); err != nil {
+			return nil, err
+		}
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return &tree{canon: fmt.Sprintf("%#v", v), node: n}, nil
+	}
+
+	t := newMap(n)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keyNode, valueNode := n.Content[i], n.Content[i+1]
+		if keyNode.Kind != yaml.ScalarNode || keyNode.Tag == "!!merge" {
+			return nil, errors.New("unsupported YAML key")
+		}
+		child, err := parseYAMLNode(valueNode)
+		if err != nil {
+			return nil, err
+		}
+		child.key = keyNode
+		t.set(keyNode.Value, child)
+	}
+	return t, nil
+}
+
+// checkYAMLLeaf rejects anchors and aliases below a leaf.
+func checkYAMLLeaf(n *yaml.Node) error {
+	if n.Anchor != "" || n.Kind == yaml.AliasNode {
+		return errors.New("YAML anchors and aliases are not merged")
+	}
+	for _, c := range n.Content {
+		if err := checkYAMLLeaf(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlIndentPattern finds the indentation of the first nested line.
+var yamlIndentPattern = regexp.MustCompile(`(?m):[ \t]*\r?\n( +)\S`)
+
+func (yamlFormat) encode(t *tree, like []byte) ([]byte, error) {
+	indent := 2
+	if m := yamlIndentPattern.FindSubmatch(like); m != nil {
+		indent = len(m[1])
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{buildYAMLNode(t)}}
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func buildYAMLNode(t *tree) *yaml.Node {
+	if !t.isMap() {
+		return t.node.(*yaml.Node)
+	}
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if orig, ok := t.node.(*yaml.Node); ok {
+		copied := *orig
+		n = &copied
+	}
+	n.Content = make([]*yaml.Node, 0, 2*len(t.keys))
+	for _, k := range t.keys {
+		child := t.fields[k]
+		keyNode, ok := child.key.(*yaml.Node)
+		if !ok {
+			keyNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
+		}
+		n.Content = append(n.Content, keyNode, buildYAMLNode(child))
+	}
+	return n
+}
@@ -141,6 +141,7 @@ func (r *Repository) Commit(ctx context.Context, opts CommitOptions) (*db.Commit
 				Mode:        blob.Mode,
 				Path:        blob.Path,
 				ContentHash: blob.ContentHash,
+				IsSymlink:   blob.IsSymlink,
 			})
 
 		case config.StatusDeleted:
@@ -160,6 +161,7 @@ func (r *Repository) Commit(ctx context.Context, opts CommitOptions) (*db.Commit
 				Mode:        blob.Mode,
 				Path:        blob.Path,
 				ContentHash: blob.ContentHash,
+				IsSymlink:   blob.IsSymlink,
 			})
 		}
 	}
@@ -186,6 +188,17 @@ func (r *Repository) Commit(ctx context.Context, opts CommitOptions) (*db.Commit
 		CommittedAt:    commitTime,
 	}
 
+	// Chain the commit hash onto the parent's
+	parentHash := ""
+	if parentID != nil {
+		hashes, err := r.DB.CommitHashes(ctx, []string{*parentID})
+		if err != nil {
+			return nil, err
+		}
+		parentHash = hashes[*parentID]
+	}
+	commit.CommitHash = commit.ComputeHash(parentHash)
+
 	// Detect binary for each staged blob
 	for _, blob := range blobs {
 		if blob.Content != nil && blob.ContentHash != nil {
@@ -197,14 +210,17 @@ func (r *Repository) Commit(ctx context.Context, opts CommitOptions) (*db.Commit
 	err = r.DB.WithTx(ctx, func(tx pgx.Tx) error {
 		// Create commit first
 		_, err := tx.Exec(ctx, `
-			INSERT INTO pgit_commits (id, seq, parent_id, tree_hash, message, author_name, author_email, authored_at, committer_name, committer_email, committed_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			INSERT INTO pgit_commits (id, seq, parent_id, tree_hash, message, author_name, author_email, authored_at, committer_name, committer_email, committed_at, commit_hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
 			commit.ID, commit.Seq, commit.ParentID, commit.TreeHash, commit.Message,
 			commit.AuthorName, commit.AuthorEmail, commit.AuthoredAt,
-			commit.CommitterName, commit.CommitterEmail, commit.CommittedAt)
+			commit.CommitterName, commit.CommitterEmail, commit.CommittedAt, commit.CommitHash)
 		if err != nil {
 			return err
 		}
+		if err := r.DB.CreateCommitTrailersTx(ctx, tx, []*db.Commit{commit}); err != nil {
+			return err
+		}
 
 		// Create blobs using the new schema
 		if err := r.DB.CreateBlobs(ctx, blobs); err != nil {
@@ -223,6 +239,10 @@ func (r *Repository) Commit(ctx context.Context, opts CommitOptions) (*db.Commit
 		return nil, err
 	}
 
+	// Line counts are derived data; if this fails they are computed when
+	// next needed
+	_, _ = r.DB.FillFileChanges(ctx, []string{commitID}, nil)
+
 	// Clear index
 	idx.Clear()
 	if err := idx.Save(r.Root); err != nil {
@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -111,8 +113,19 @@ func Init(path string) (*Repository, error) {
 	}, nil
 }
 
-// Connect connects to the local database
+// Connect connects to the local database, creating the schema if needed.
+// An out-of-date schema is an error; see ConnectAnySchema.
 func (r *Repository) Connect(ctx context.Context) error {
+	return r.connect(ctx, true)
+}
+
+// ConnectAnySchema connects like Connect but accepts any schema version,
+// for 'pgit migrate'.
+func (r *Repository) ConnectAnySchema(ctx context.Context) error {
+	return r.connect(ctx, false)
+}
+
+func (r *Repository) connect(ctx context.Context, checkSchema bool) error {
 	if r.DB != nil && r.DB.IsConnected() {
 		return nil // Already connected
 	}
@@ -160,9 +173,49 @@ func (r *Repository) Connect(ctx context.Context) error {
 	_ = r.DB.EnsureMetadataTable(ctx)
 	_ = r.DB.SetRepoPath(ctx, r.Root)
 
+	if !checkSchema {
+		return nil
+	}
+	if err := r.DB.CheckSchemaVersion(ctx); err != nil {
+		r.Close()
+		return SchemaError(err, "")
+	}
+
 	return nil
 }
 
+// SchemaError turns a *db.SchemaVersionError from the local database (or
+// the named remote) into an error that says how to fix it. Other errors are
+// returned unchanged.
+func SchemaError(err error, remoteName string) error {
+	var versionErr *db.SchemaVersionError
+	if !errors.As(err, &versionErr) {
+		return err
+	}
+
+	where, migrate := "The local database", "pgit migrate"
+	if remoteName != "" {
+		where = fmt.Sprintf("The remote '%s'", remoteName)
+		migrate = "pgit migrate --remote " + remoteName
+	}
+	switch {
+	case versionErr.Version > db.SchemaVersion:
+		return util.NewError("Database schema is newer than this pgit").
+			WithMessage(fmt.Sprintf("%s has schema version %d; this pgit supports up to %d",
+				where, versionErr.Version, db.SchemaVersion)).
+			WithSuggestion("Upgrade pgit to the version that wrote it")
+	case !versionErr.Migratable():
+		return util.NewError("Database schema is too old to migrate").
+			WithMessage(fmt.Sprintf("%s has schema version %d; in-place migration starts at version %d",
+				where, versionErr.Version, db.MinMigratableVersion)).
+			WithSuggestion("pgit import --force /path/to/git/repo  # Re-import from git")
+	}
+	return util.NewError("Database schema is out of date").
+		WithMessage(fmt.Sprintf("%s has schema version %d; this pgit uses version %d",
+			where, versionErr.Version, db.SchemaVersion)).
+		WithSuggestion(migrate + "  # Upgrade it in place, keeping all history")
+}
+
 // ConnectTo connects to a specific database URL (for remotes)
 func (r *Repository) ConnectTo(ctx context.Context, url string) (*db.DB, error) {
 	return db.Connect(ctx, url)
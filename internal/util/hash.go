@@ -6,8 +6,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"sort"
+	"strings"
+	"sync/atomic"
 
 	"github.com/zeebo/blake3"
 )
@@ -134,30 +137,251 @@ type TreeEntry struct {
 	Mode        int
 	Path        string
 	ContentHash []byte // 16 bytes BLAKE3 hash
+	IsSymlink   bool
 }
 
-// ComputeTreeHash computes the tree hash from a list of files using BLAKE3.
-// Files must have non-empty ContentHash (deleted files are excluded).
-// The hash is computed as BLAKE3 of sorted entries in format:
-// "{mode} {path}\0{content_hash_bytes}"
+// treeMode is the mode of a directory entry in a tree hash.
+const treeMode = 040000
+
+// CanonicalMode maps a file mode to the one tree hashes use, as git does:
+// 120000 for symlinks, 160000 for submodules, and 100755 or 100644 for
+// files by the owner's execute bit. Native commits store permission bits
+// and imports store git modes; both hash the same.
+func CanonicalMode(mode int, isSymlink bool) int {
+	switch {
+	case isSymlink || mode&0170000 == 0120000:
+		return 0120000
+	case mode&0170000 == 0160000:
+		return 0160000
+	case mode&0100 != 0:
+		return 0100755
+	}
+	return 0100644
+}
+
+// ComputeTreeHash computes the canonical tree hash of a set of files (see
+// MerkleTree). Entries without a ContentHash (deletions) are skipped.
 func ComputeTreeHash(entries []TreeEntry) string {
-	// Sort by path
-	sorted := make([]TreeEntry, len(entries))
-	copy(sorted, entries)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].Path < sorted[j].Path
+	t := NewMerkleTree()
+	for _, e := range entries {
+		if e.ContentHash != nil {
+			t.Set(e)
+		}
+	}
+	return t.Hash()
+}
+
+// MerkleTree computes the canonical tree hash of a set of files, git
+// style: each directory hashes to BLAKE3 over its entries sorted by name,
+// each written as "{mode in octal} {name}\0" followed by the raw content
+// hash of a file or the hash of a subdirectory (mode 40000). The tree hash
+// is the hex hash of the root directory.
+//
+// Files can be set and removed between calls to Hash; only the directories
+// on changed paths are hashed again, so hashing every commit of a long
+// history costs about as much as the changes it makes. Clone shares all
+// directories with the original, and each tree copies a directory the
+// first time it changes it.
+type MerkleTree struct {
+	root  *merkleDir
+	owner uint64 // directories with this owner may be changed in place
+}
+
+type merkleDir struct {
+	dirs  map[string]*merkleDir
+	files map[string]merkleFile
+	hash  []byte // nil until computed, and again after a change below
+	owner uint64
+}
+
+type merkleFile struct {
+	mode int
+	hash []byte
+}
+
+// merkleOwners hands out MerkleTree owner IDs.
+var merkleOwners atomic.Uint64
+
+// NewMerkleTree returns an empty tree.
+func NewMerkleTree() *MerkleTree {
+	owner := merkleOwners.Add(1)
+	return &MerkleTree{root: newMerkleDir(owner), owner: owner}
+}
+
+func newMerkleDir(owner uint64) *merkleDir {
+	return &merkleDir{dirs: make(map[string]*merkleDir), files: make(map[string]merkleFile), owner: owner}
+}
+
+// Clone returns a copy of the tree. It is cheap: directories are shared
+// until one of the trees changes them.
+func (t *MerkleTree) Clone() *MerkleTree {
+	// Neither tree owns the shared directories any more
+	t.owner = merkleOwners.Add(1)
+	return &MerkleTree{root: t.root, owner: merkleOwners.Add(1)}
+}
+
+// own returns d if the tree may change it, else a copy the tree owns. The
+// result's hash is cleared, as the caller is about to change something
+// below it.
+func (t *MerkleTree) own(d *merkleDir) *merkleDir {
+	if d.owner != t.owner {
+		d = &merkleDir{dirs: maps.Clone(d.dirs), files: maps.Clone(d.files), owner: t.owner}
+	}
+	d.hash = nil
+	return d
+}
+
+// Set adds or replaces a file. An entry without a ContentHash removes it.
+func (t *MerkleTree) Set(e TreeEntry) {
+	if e.ContentHash == nil {
+		t.Remove(e.Path)
+		return
+	}
+	parts := strings.Split(e.Path, "/")
+	t.root = t.own(t.root)
+	d := t.root
+	for _, name := range parts[:len(parts)-1] {
+		child := d.dirs[name]
+		if child == nil {
+			child = newMerkleDir(t.owner)
+		} else {
+			child = t.own(child)
+		}
+		d.dirs[name] = child
+		d = child
+	}
+	d.files[parts[len(parts)-1]] = merkleFile{mode: CanonicalMode(e.Mode, e.IsSymlink), hash: e.ContentHash}
+}
+
+// Remove removes a file; directories left empty go with it.
+func (t *MerkleTree) Remove(path string) {
+	parts := strings.Split(path, "/")
+	if !t.root.has(parts) {
+		return
+	}
+	t.root = t.remove(t.root, parts)
+}
+
+func (d *merkleDir) has(parts []string) bool {
+	for _, name := range parts[:len(parts)-1] {
+		if d = d.dirs[name]; d == nil {
+			return false
+		}
+	}
+	_, ok := d.files[parts[len(parts)-1]]
+	return ok
+}
+
+// remove removes the file at parts, which exists below d, and returns d or
+// the copy of it the tree owns.
+func (t *MerkleTree) remove(d *merkleDir, parts []string) *merkleDir {
+	d = t.own(d)
+	if len(parts) == 1 {
+		delete(d.files, parts[0])
+		return d
+	}
+	child := t.remove(d.dirs[parts[0]], parts[1:])
+	if len(child.dirs) == 0 && len(child.files) == 0 {
+		delete(d.dirs, parts[0])
+	} else {
+		d.dirs[parts[0]] = child
+	}
+	return d
+}
+
+// Hash returns the tree hash as a hex string.
+func (t *MerkleTree) Hash() string {
+	return hex.EncodeToString(t.root.sum())
+}
+
+// TreeReplay computes the tree hash of every commit of a history from its
+// parent's tree and its own changes, so each commit's tree follows its
+// ancestry whatever order the commit IDs sort in. Commits are replayed
+// parents first. A tree is kept until the last child of its commit has
+// been replayed and then handed on without a copy, so a linear history
+// moves a single MerkleTree along; a fork clones it.
+type TreeReplay struct {
+	trees   map[string]*MerkleTree
+	pending map[string]int // children of each commit not replayed yet
+}
+
+// NewTreeReplay prepares a replay. parentIDs holds the parent ID of every
+// commit that will be replayed ("" for a root).
+func NewTreeReplay(parentIDs []string) *TreeReplay {
+	r := &TreeReplay{trees: make(map[string]*MerkleTree), pending: make(map[string]int)}
+	for _, id := range parentIDs {
+		if id != "" {
+			r.pending[id]++
+		}
+	}
+	return r
+}
+
+// SetBase sets the tree of a commit that is not replayed itself but is the
+// parent of replayed commits.
+func (r *TreeReplay) SetBase(id string, tree *MerkleTree) {
+	r.trees[id] = tree
+}
+
+// Replay applies the changes of commit id (entries without a ContentHash
+// are deletions) to its parent's tree and returns the tree hash. A parent
+// that is neither replayed nor set with SetBase counts as an empty tree.
+func (r *TreeReplay) Replay(id, parentID string, changes []TreeEntry) string {
+	tree := r.parentTree(parentID)
+	for _, e := range changes {
+		tree.Set(e)
+	}
+	if r.pending[id] > 0 {
+		r.trees[id] = tree
+	}
+	return tree.Hash()
+}
+
+// parentTree returns the tree a child of parentID starts from, which the
+// caller may change.
+func (r *TreeReplay) parentTree(parentID string) *MerkleTree {
+	tree, ok := r.trees[parentID]
+	if parentID == "" || !ok {
+		return NewMerkleTree()
+	}
+	r.pending[parentID]--
+	if r.pending[parentID] > 0 {
+		return tree.Clone()
+	}
+	delete(r.trees, parentID)
+	return tree
+}
+
+func (d *merkleDir) sum() []byte {
+	if d.hash != nil {
+		return d.hash
+	}
+	type entry struct {
+		name string
+		mode int
+		hash []byte
+	}
+	entries := make([]entry, 0, len(d.dirs)+len(d.files))
+	for name, f := range d.files {
+		entries = append(entries, entry{name, f.mode, f.hash})
+	}
+	for name, sub := range d.dirs {
+		entries = append(entries, entry{name, treeMode, sub.sum()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		}
+		return entries[i].mode < entries[j].mode
 	})
 
 	h := blake3.New()
-	for _, e := range sorted {
-		// Format: "{mode} {path}\0" followed by raw hash bytes
-		header := []byte(fmt.Sprintf("%d %s\x00", e.Mode, e.Path))
-		_, _ = h.Write(header)
-		_, _ = h.Write(e.ContentHash)
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(h, "%o %s\x00", e.mode, e.name)
+		_, _ = h.Write(e.hash)
 	}
-
-	sum := h.Sum(nil)
-	return hex.EncodeToString(sum[:])
+	d.hash = h.Sum(nil)
+	return d.hash
 }
 
 // TreeEntryLegacy represents a file in the tree for hashing (legacy format).
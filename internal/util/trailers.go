@@ -0,0 +1,88 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Trailer is a "Key: value" line from the trailer block at the end of a
+// commit message (Signed-off-by, Co-authored-by, Reviewed-by, Fixes, ...).
+type Trailer struct {
+	Key   string // lowercased, e.g. "co-authored-by"
+	Value string
+}
+
+// Common trailer keys, lowercased as stored.
+const (
+	TrailerCoAuthoredBy = "co-authored-by"
+	TrailerSignedOffBy  = "signed-off-by"
+)
+
+var trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)[ \t]*:[ \t]*(\S.*)$`)
+
+// trailerKeys are the single-word keys accepted as trailers. Hyphenated keys
+// (Signed-off-by, Change-Id, ...) are accepted without being listed.
+var trailerKeys = map[string]bool{
+	"fixes": true, "closes": true, "resolves": true, "refs": true,
+	"references": true, "bug": true, "issue": true, "cc": true, "link": true,
+}
+
+// ParseTrailers extracts the trailer block of a commit message: its last
+// paragraph, when that is not also the subject and every line in it is a
+// "Key: value" trailer (lines starting with whitespace continue the
+// previous value, as in git). Keys are lowercased; order is preserved.
+//
+// A paragraph of prose that happens to look like that ("Note: ...", a bare
+// URL) is not a trailer block: no value may start with "//", and at least
+// one key has to be hyphenated or a known trailer word such as Fixes.
+func ParseTrailers(message string) []Trailer {
+	message = strings.TrimRight(strings.ReplaceAll(message, "\r\n", "\n"), " \t\n")
+	sep := strings.LastIndex(message, "\n\n")
+	if sep < 0 {
+		return nil // single paragraph: the subject is never a trailer block
+	}
+	if strings.TrimSpace(message[:sep]) == "" {
+		return nil
+	}
+
+	var trailers []Trailer
+	for _, line := range strings.Split(message[sep+2:], "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(trailers) == 0 {
+				return nil
+			}
+			last := &trailers[len(trailers)-1]
+			last.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		m := trailerLine.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(m[2], "//") {
+			return nil
+		}
+		trailers = append(trailers, Trailer{
+			Key:   strings.ToLower(m[1]),
+			Value: strings.TrimSpace(m[2]),
+		})
+	}
+
+	for _, t := range trailers {
+		if strings.Contains(t.Key, "-") || trailerKeys[t.Key] {
+			return trailers
+		}
+	}
+	return nil
+}
+
+// ParseIdentity splits "Name <email>" as found in Co-authored-by trailers.
+// A value without angle brackets is returned as the name.
+func ParseIdentity(s string) (name, email string) {
+	lt := strings.IndexByte(s, '<')
+	gt := strings.LastIndexByte(s, '>')
+	if lt < 0 || gt < lt {
+		return strings.TrimSpace(s), ""
+	}
+	return strings.TrimSpace(s[:lt]), strings.TrimSpace(s[lt+1 : gt])
+}
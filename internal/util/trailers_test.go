@@ -0,0 +1,94 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrailers(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []Trailer
+	}{
+		{
+			name:    "subject only",
+			message: "Signed-off-by: A <a@x>",
+		},
+		{
+			name:    "trailer block",
+			message: "Fix parser\n\nLonger body.\n\nSigned-off-by: A <a@x>\nCo-Authored-By: B <b@x>\n",
+			want: []Trailer{
+				{Key: TrailerSignedOffBy, Value: "A <a@x>"},
+				{Key: TrailerCoAuthoredBy, Value: "B <b@x>"},
+			},
+		},
+		{
+			name:    "known single-word key",
+			message: "Fix crash\n\nFixes: #123\nLink: https://example.com/issue/123",
+			want: []Trailer{
+				{Key: "fixes", Value: "#123"},
+				{Key: "link", Value: "https://example.com/issue/123"},
+			},
+		},
+		{
+			name:    "continuation line",
+			message: "Subject\n\nReviewed-by: A\n  <a@x>",
+			want:    []Trailer{{Key: "reviewed-by", Value: "A <a@x>"}},
+		},
+		{
+			name:    "CRLF line endings",
+			message: "Subject\r\n\r\nAcked-by: A <a@x>\r\n",
+			want:    []Trailer{{Key: "acked-by", Value: "A <a@x>"}},
+		},
+		{
+			name:    "bare URL paragraph",
+			message: "Update docs\n\nhttps://example.com/docs/page",
+		},
+		{
+			name:    "note paragraph",
+			message: "Update docs\n\nNote: this only covers the CLI.",
+		},
+		{
+			name:    "prose line in block",
+			message: "Subject\n\nSigned-off-by: A <a@x>\nthanks for the review",
+		},
+		{
+			name:    "trailers not in last paragraph",
+			message: "Subject\n\nSigned-off-by: A <a@x>\n\nMore prose after it.",
+		},
+		{
+			name:    "continuation without trailer",
+			message: "Subject\n\n  indented\nSigned-off-by: A <a@x>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseTrailers(tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTrailers(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIdentity(t *testing.T) {
+	tests := []struct {
+		in          string
+		name, email string
+	}{
+		{"Jane Doe <jane@example.com>", "Jane Doe", "jane@example.com"},
+		{"  Jane Doe   < jane@example.com > ", "Jane Doe", "jane@example.com"},
+		{"<jane@example.com>", "", "jane@example.com"},
+		{"Jane Doe", "Jane Doe", ""},
+		{"Jane Doe jane@example.com>", "Jane Doe jane@example.com>", ""},
+		{"Jane > Doe <", "Jane > Doe <", ""},
+	}
+
+	for _, tt := range tests {
+		name, email := ParseIdentity(tt.in)
+		if name != tt.name || email != tt.email {
+			t.Errorf("ParseIdentity(%q) = %q, %q; want %q, %q", tt.in, name, email, tt.name, tt.email)
+		}
+	}
+}